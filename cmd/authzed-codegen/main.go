@@ -1,39 +1,98 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
 	"path/filepath"
 
 	"github.com/oitnes/authzed-codegen/internal/generator"
+	"github.com/oitnes/authzed-codegen/internal/generator/diff"
+	"github.com/oitnes/authzed-codegen/internal/generator/loader"
+	"github.com/oitnes/authzed-codegen/internal/generator/validator"
+)
+
+// Exit codes. Validation failures and usage errors differ so that hooks can tell a bad
+// schema from a bad invocation.
+const (
+	exitOK      = 0
+	exitFailure = 1 // generation failed, or the schema has errors
+	exitUsage   = 2 // bad arguments, or a schema file could not be read
 )
 
 func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(args []string) int {
+	if len(args) > 0 {
+		switch args[0] {
+		case "generate":
+			return runGenerate(args[1:])
+		case "validate":
+			return runValidate(args[1:])
+		case "fmt":
+			return runFmt(args[1:])
+		case "diff":
+			return runDiff(args[1:])
+		case "help", "-h", "-help", "--help":
+			usage()
+			return exitOK
+		}
+	}
+
+	// Without a subcommand the arguments are generate flags, as before subcommands existed.
+	return runGenerate(args)
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "authzed-codegen - Type-safe Go code generator for SpiceDB schemas\n\n")
+	fmt.Fprintf(os.Stderr, "Usage:\n  %s <command> [options]\n\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "Commands:\n")
+	fmt.Fprintf(os.Stderr, "  generate   generate Go code from a schema (the default command)\n")
+	fmt.Fprintf(os.Stderr, "  validate   check schemas and report diagnostics without writing files\n")
+	fmt.Fprintf(os.Stderr, "  fmt        rewrite schemas in canonical form\n")
+	fmt.Fprintf(os.Stderr, "  diff       report the changes between two schemas and whether they break anything\n\n")
+	fmt.Fprintf(os.Stderr, "Run '%s <command> -h' for the options of a command.\n", os.Args[0])
+}
+
+func runGenerate(args []string) int {
 	var cfg generator.Config
 
-	flag.StringVar(&cfg.SchemaPath, "schema", "", "path to .zed schema file (required)")
-	flag.StringVar(&cfg.OutputPath, "output", "", "output directory for generated Go files (required)")
-	flag.StringVar(&cfg.PackageName, "package", "", "package name for generated code (defaults to output directory name)")
-	flag.BoolVar(&cfg.WithRepository, "with-repository", false, "generate entity CRUD methods")
-	flag.BoolVar(&cfg.CleanPackage, "clean-package", false, "remove output directory before generating code")
+	fs := flag.NewFlagSet("generate", flag.ContinueOnError)
+	fs.StringVar(&cfg.SchemaPath, "schema", "", "path to a .zed schema file, a directory of them, or a glob (required)")
+	fs.StringVar(&cfg.OutputPath, "output", "", "output directory for generated Go files (required)")
+	fs.StringVar(&cfg.PackageName, "package", "", "package name for generated code (defaults to output directory name)")
+	fs.BoolVar(&cfg.WithRepository, "with-repository", false, "generate entity CRUD methods")
+	fs.BoolVar(&cfg.CleanPackage, "clean-package", false, "remove output directory before generating code")
+	fs.BoolVar(&cfg.SplitNamespaces, "split-namespaces", false, "generate each namespace into its own sub-package of the output directory")
+	fs.StringVar(&cfg.ImportPath, "import-path", "", "import path of the output directory for --split-namespaces (defaults to the path derived from go.mod)")
 
-	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "authzed-codegen - Type-safe Go code generator for SpiceDB schemas\n\n")
-		fmt.Fprintf(os.Stderr, "Usage:\n  %s [options]\n\n", os.Args[0])
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage:\n  %s generate [options]\n\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "Options:\n")
-		flag.PrintDefaults()
+		fs.PrintDefaults()
 		fmt.Fprintf(os.Stderr, "\nExamples:\n")
-		fmt.Fprintf(os.Stderr, "  %s --schema schema.zed --output ./permissions\n", os.Args[0])
-		fmt.Fprintf(os.Stderr, "  %s --schema schema.zed --output ./permissions --with-repository\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s generate --schema schema.zed --output ./permissions\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s generate --schema schema.zed --output ./permissions --with-repository\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s generate --schema './schema/*.zed' --output ./permissions\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s generate --schema schema.zed --output ./permissions --split-namespaces\n", os.Args[0])
 	}
 
-	flag.Parse()
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		return exitUsage
+	}
 
 	if cfg.SchemaPath == "" || cfg.OutputPath == "" {
 		fmt.Fprintln(os.Stderr, "error: --schema and --output are required")
-		flag.Usage()
-		os.Exit(1)
+		fs.Usage()
+		return exitUsage
 	}
 
 	if cfg.PackageName == "" {
@@ -42,6 +101,219 @@ func main() {
 
 	if err := generator.Generate(cfg); err != nil {
 		fmt.Fprintf(os.Stderr, "error: %v\n", err)
-		os.Exit(1)
+		return exitFailure
+	}
+	return exitOK
+}
+
+func runValidate(args []string) int {
+	var schemaPath, format string
+
+	fs := flag.NewFlagSet("validate", flag.ContinueOnError)
+	fs.StringVar(&schemaPath, "schema", "", "path to a .zed schema file, a directory of them, or a glob (or pass them as arguments)")
+	fs.StringVar(&format, "format", "human", "output format: human or json")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage:\n  %s validate [options] [schema ...]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Each schema is a file, a directory or a glob, whose files are checked together.\n")
+		fmt.Fprintf(os.Stderr, "Reports every diagnostic as file:line:column: severity: message.\n")
+		fmt.Fprintf(os.Stderr, "Exits with %d if the schemas are valid (warnings allowed), %d if any has errors,\n", exitOK, exitFailure)
+		fmt.Fprintf(os.Stderr, "and %d on bad arguments or unreadable files.\n\n", exitUsage)
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		return exitUsage
+	}
+
+	paths := fs.Args()
+	if schemaPath != "" {
+		paths = append([]string{schemaPath}, paths...)
+	}
+	if len(paths) == 0 {
+		fmt.Fprintln(os.Stderr, "error: no schema files given")
+		fs.Usage()
+		return exitUsage
+	}
+	if format != "human" && format != "json" {
+		fmt.Fprintf(os.Stderr, "error: unknown format %q, expected human or json\n", format)
+		return exitUsage
+	}
+
+	diagnostics := []generator.Diagnostic{}
+	for _, path := range paths {
+		fileDiagnostics, err := generator.ValidateFile(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return exitUsage
+		}
+		diagnostics = append(diagnostics, fileDiagnostics...)
+	}
+
+	if format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(diagnostics); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return exitFailure
+		}
+	} else {
+		for _, d := range diagnostics {
+			fmt.Println(d)
+		}
+	}
+
+	if generator.HasErrors(diagnostics) {
+		return exitFailure
+	}
+	return exitOK
+}
+
+func runFmt(args []string) int {
+	var write, check bool
+
+	fs := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	fs.BoolVar(&write, "w", false, "write the result to the schema files instead of stdout")
+	fs.BoolVar(&check, "check", false, "list the schema files that are not formatted, without changing them")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage:\n  %s fmt [options] schema.zed ...\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Prints the schemas in canonical form, keeping their comments.\n")
+		fmt.Fprintf(os.Stderr, "With --check, exits with %d if any schema is not formatted or has syntax errors.\n\n", exitFailure)
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		return exitUsage
+	}
+
+	paths := fs.Args()
+	if len(paths) == 0 {
+		fmt.Fprintln(os.Stderr, "error: no schema files given")
+		fs.Usage()
+		return exitUsage
+	}
+	if write && check {
+		fmt.Fprintln(os.Stderr, "error: -w and --check cannot be used together")
+		return exitUsage
+	}
+
+	status := exitOK
+	for _, path := range paths {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: reading schema: %v\n", err)
+			return exitUsage
+		}
+
+		formatted, err := generator.Format(string(content))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s: %v\n", path, err)
+			status = exitFailure
+			continue
+		}
+
+		switch {
+		case check:
+			if !bytes.Equal(content, formatted) {
+				fmt.Println(path)
+				status = exitFailure
+			}
+		case write:
+			if bytes.Equal(content, formatted) {
+				continue
+			}
+			info, err := os.Stat(path)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				return exitUsage
+			}
+			if err := os.WriteFile(path, formatted, info.Mode().Perm()); err != nil {
+				fmt.Fprintf(os.Stderr, "error: writing %s: %v\n", path, err)
+				return exitUsage
+			}
+		default:
+			os.Stdout.Write(formatted)
+		}
+	}
+	return status
+}
+
+func runDiff(args []string) int {
+	var format string
+	var allowAPIBreaks bool
+
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	fs.StringVar(&format, "format", "human", "output format: human or json")
+	fs.BoolVar(&allowAPIBreaks, "allow-api-breaks", false, "do not fail on changes that only break the generated Go API")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage:\n  %s diff [options] old.zed new.zed\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Each schema may also be a directory or a glob, whose files are compared as one schema.\n")
+		fmt.Fprintf(os.Stderr, "Reports every change as kind: object: message, where kind is additive,\n")
+		fmt.Fprintf(os.Stderr, "breaking-api (generated code changes) or breaking-data (stored relationships become invalid).\n")
+		fmt.Fprintf(os.Stderr, "Exits with %d if nothing breaks, %d if a change breaks or a schema is invalid,\n", exitOK, exitFailure)
+		fmt.Fprintf(os.Stderr, "and %d on bad arguments or unreadable files.\n\n", exitUsage)
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		return exitUsage
+	}
+
+	if fs.NArg() != 2 {
+		fmt.Fprintln(os.Stderr, "error: expected an old and a new schema file")
+		fs.Usage()
+		return exitUsage
+	}
+	if format != "human" && format != "json" {
+		fmt.Fprintf(os.Stderr, "error: unknown format %q, expected human or json\n", format)
+		return exitUsage
+	}
+
+	changes, err := generator.Diff(fs.Arg(0), fs.Arg(1))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		var loadErr *loader.Error
+		var validationErr *validator.Error
+		if errors.As(err, &loadErr) || errors.As(err, &validationErr) {
+			return exitFailure
+		}
+		return exitUsage
+	}
+
+	if format == "json" {
+		if changes == nil {
+			changes = []diff.Change{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(changes); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return exitFailure
+		}
+	} else {
+		for _, c := range changes {
+			fmt.Println(c)
+		}
+	}
+
+	for _, c := range changes {
+		if c.Kind == diff.BreakingData || (c.Kind == diff.BreakingAPI && !allowAPIBreaks) {
+			return exitFailure
+		}
 	}
+	return exitOK
 }
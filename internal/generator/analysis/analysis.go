@@ -0,0 +1,172 @@
+// Package analysis computes properties of a parsed schema that code generation relies on,
+// such as which subject types can hold each relation and permission.
+package analysis
+
+import (
+	"sort"
+
+	"github.com/oitnes/authzed-codegen/internal/generator/ast"
+)
+
+// member names a relation or permission of a definition.
+type member struct {
+	def  string
+	name string
+}
+
+// Reachability maps each relation and permission of a schema to the subject types that can
+// hold it, that is, the object types a permission check can be allowed for.
+type Reachability struct {
+	order map[string]int // position of each definition in the schema
+	sets  map[member]map[string]bool
+}
+
+// ComputeReachability walks the relations and permissions of schema and returns the subject
+// types that can reach each of them. Subject relations such as group#member contribute the
+// subject types of the relation they name, not the type itself, since a check is made for
+// a single object. Arrows contribute the subject types of the permission they walk to on
+// each type of their relation. A subject type can hold an intersection only if it can hold
+// both operands, and an exclusion only if it can hold the included operand.
+func ComputeReachability(schema *ast.Schema) *Reachability {
+	r := &Reachability{
+		order: make(map[string]int),
+		sets:  make(map[member]map[string]bool),
+	}
+	for i, def := range schema.Definitions {
+		if _, ok := r.order[def.Name]; !ok {
+			r.order[def.Name] = i
+		}
+	}
+
+	// Members may refer to each other in cycles, e.g. group#member through group#member, so
+	// the sets grow from empty until none of them changes.
+	for changed := true; changed; {
+		changed = false
+		for _, def := range schema.Definitions {
+			for _, rel := range def.Relations {
+				changed = r.update(member{def.Name, rel.Name}, r.relationTypes(rel)) || changed
+			}
+			for _, perm := range def.Permissions {
+				changed = r.update(member{def.Name, perm.Name}, r.exprTypes(def, perm.Expression)) || changed
+			}
+		}
+	}
+
+	return r
+}
+
+// SubjectTypes returns the subject types that can hold the relation or permission name of
+// the definition defName, in schema order. Unknown members have no subject types.
+func (r *Reachability) SubjectTypes(defName, name string) []string {
+	set := r.sets[member{defName, name}]
+	types := make([]string, 0, len(set))
+	for t := range set {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool {
+		oi, iok := r.order[types[i]]
+		oj, jok := r.order[types[j]]
+		if iok != jok {
+			return iok
+		}
+		if oi != oj {
+			return oi < oj
+		}
+		return types[i] < types[j]
+	})
+	return types
+}
+
+// update adds types to the set of m and reports whether the set grew.
+func (r *Reachability) update(m member, types map[string]bool) bool {
+	set := r.sets[m]
+	if set == nil {
+		set = make(map[string]bool)
+		r.sets[m] = set
+	}
+	grew := false
+	for t := range types {
+		if !set[t] {
+			set[t] = true
+			grew = true
+		}
+	}
+	return grew
+}
+
+func (r *Reachability) relationTypes(rel *ast.Relation) map[string]bool {
+	types := make(map[string]bool)
+	for _, st := range rel.SubjectTypes {
+		if st.Relation == "" {
+			types[st.TypeName] = true
+			continue
+		}
+		for t := range r.sets[member{st.TypeName, st.Relation}] {
+			types[t] = true
+		}
+	}
+	return types
+}
+
+func (r *Reachability) exprTypes(def *ast.Definition, expr ast.Expr) map[string]bool {
+	switch e := expr.(type) {
+	case *ast.RelationRef:
+		return copySet(r.sets[member{def.Name, e.Name}])
+	case *ast.UnionExpr:
+		return union(r.exprTypes(def, e.Left), r.exprTypes(def, e.Right))
+	case *ast.IntersectionExpr:
+		return intersection(r.exprTypes(def, e.Left), r.exprTypes(def, e.Right))
+	case *ast.ExclusionExpr:
+		// Excluding a type's subjects may still leave others of that type, so only the
+		// included side decides which types can hold the permission.
+		return r.exprTypes(def, e.Left)
+	case *ast.ArrowExpr:
+		return r.arrowTypes(def, e.Relation, e.Permission)
+	case *ast.FunctionedArrowExpr:
+		return r.arrowTypes(def, e.Relation, e.Permission)
+	default:
+		return nil
+	}
+}
+
+// arrowTypes returns the subject types of target on each type related through relation.
+// Types without a member named target contribute nothing, as in SpiceDB.
+func (r *Reachability) arrowTypes(def *ast.Definition, relation, target string) map[string]bool {
+	types := make(map[string]bool)
+	for _, rel := range def.Relations {
+		if rel.Name != relation {
+			continue
+		}
+		for _, st := range rel.SubjectTypes {
+			for t := range r.sets[member{st.TypeName, target}] {
+				types[t] = true
+			}
+		}
+	}
+	return types
+}
+
+func copySet(set map[string]bool) map[string]bool {
+	return union(set, nil)
+}
+
+func intersection(a, b map[string]bool) map[string]bool {
+	out := make(map[string]bool)
+	for t := range a {
+		if b[t] {
+			out[t] = true
+		}
+	}
+	return out
+}
+
+func union(a, b map[string]bool) map[string]bool {
+	out := make(map[string]bool, len(a)+len(b))
+	for t := range a {
+		out[t] = true
+	}
+	for t := range b {
+		out[t] = true
+	}
+	return out
+}
@@ -0,0 +1,180 @@
+package analysis
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/oitnes/authzed-codegen/internal/generator/ast"
+	"github.com/oitnes/authzed-codegen/internal/generator/parser"
+	zedlexer "github.com/oitnes/authzed-codegen/internal/generator/zed_lexer"
+)
+
+func mustParse(t *testing.T, input string) *ast.Schema {
+	t.Helper()
+	tokens, err := zedlexer.Lex(input)
+	if err != nil {
+		t.Fatalf("Lex() error: %v", err)
+	}
+	schema, err := parser.Parse(tokens)
+	if err != nil {
+		t.Fatalf("Parse() error: %v", err)
+	}
+	return schema
+}
+
+func TestSubjectTypes(t *testing.T) {
+	schema := mustParse(t, `
+definition user {}
+
+definition service_account {}
+
+definition group {
+	relation member: user | group#member
+}
+
+definition folder {
+	relation parent: folder
+	relation viewer: service_account | user:*
+	permission view = viewer + parent->view
+}
+
+definition document {
+	relation parent: folder
+	relation viewer: group#member
+	relation banned: user
+	permission view = viewer + parent.any(view)
+	permission edit = nil
+}
+`)
+	r := ComputeReachability(schema)
+
+	tests := []struct {
+		def, name string
+		want      []string
+	}{
+		{"group", "member", []string{"user"}},
+		{"folder", "viewer", []string{"user", "service_account"}},
+		{"folder", "view", []string{"user", "service_account"}},
+		{"document", "parent", []string{"folder"}},
+		{"document", "viewer", []string{"user"}},
+		{"document", "view", []string{"user", "service_account"}},
+		{"document", "edit", []string{}},
+		{"document", "missing", []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.def+"#"+tt.name, func(t *testing.T) {
+			if got := r.SubjectTypes(tt.def, tt.name); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SubjectTypes(%q, %q) = %v, want %v", tt.def, tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSubjectTypesIntersectionAndExclusion(t *testing.T) {
+	schema := mustParse(t, `
+definition user {}
+
+definition customer {}
+
+definition booking {
+	relation owner: user
+	relation editor: user | customer
+	relation guest: customer
+	relation banned: customer
+	permission write = owner & editor
+	permission view = (editor + guest) - banned
+	permission audit = owner & guest
+}
+`)
+	r := ComputeReachability(schema)
+
+	tests := []struct {
+		name string
+		want []string
+	}{
+		{"write", []string{"user"}},
+		{"view", []string{"user", "customer"}},
+		{"audit", []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := r.SubjectTypes("booking", tt.name); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SubjectTypes(%q, %q) = %v, want %v", "booking", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSubjectTypesArrowToMissingMember(t *testing.T) {
+	schema := mustParse(t, `
+definition user {}
+
+definition organization {
+	relation admin: user
+	permission manage = admin
+}
+
+definition team {}
+
+definition project {
+	relation owner: organization | team
+	permission manage = owner->manage
+}
+`)
+	r := ComputeReachability(schema)
+
+	if got, want := r.SubjectTypes("project", "manage"), []string{"user"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("SubjectTypes() = %v, want %v", got, want)
+	}
+}
+
+// TestSubjectTypesThroughLaterMembers covers members that only resolve once the sets of
+// definitions declared after them are known.
+func TestSubjectTypesThroughLaterMembers(t *testing.T) {
+	schema := mustParse(t, `
+definition user {}
+
+definition bot {}
+
+definition binder {
+	relation reader: folder#view
+	relation parent: folder | team#member
+	permission read = reader
+	permission inherited = parent->view
+	permission any_inherited = parent.any(view)
+}
+
+definition team {
+	relation member: user
+	permission view = member
+}
+
+definition folder {
+	relation owner: bot
+	relation parent: folder
+	permission view = owner + parent->view
+}
+`)
+	r := ComputeReachability(schema)
+
+	tests := []struct {
+		def, name string
+		want      []string
+	}{
+		// A subject relation naming a permission takes the subject types of the permission.
+		{"binder", "reader", []string{"bot"}},
+		{"binder", "read", []string{"bot"}},
+		// An arrow over a relation that mixes a plain type and a subject relation walks to the
+		// target on the object type of each, ignoring the subject relation.
+		{"binder", "parent", []string{"user", "folder"}},
+		{"binder", "inherited", []string{"user", "bot"}},
+		{"binder", "any_inherited", []string{"user", "bot"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.def+"#"+tt.name, func(t *testing.T) {
+			if got := r.SubjectTypes(tt.def, tt.name); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SubjectTypes(%q, %q) = %v, want %v", tt.def, tt.name, got, tt.want)
+			}
+		})
+	}
+}
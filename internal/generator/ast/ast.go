@@ -1,33 +1,145 @@
 package ast
 
+import (
+	"fmt"
+	"strings"
+)
+
+// Pos is a 1-based source position. The zero value means the position is unknown.
+type Pos struct {
+	File   string // Schema file, when the schema was loaded from files
+	Line   int
+	Column int
+}
+
+// String formats the position as file:line:column, or as "line L, column C" without a file.
+func (p Pos) String() string {
+	if p.File == "" {
+		return fmt.Sprintf("line %d, column %d", p.Line, p.Column)
+	}
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Column)
+}
+
+// Comments holds the comments attached to a node, as written, including their // or /* */
+// delimiters. An empty string in Leading stands for a blank line between groups of comments.
+type Comments struct {
+	Leading  []string // Comments on the lines before the node
+	Trailing []string // Comments within the node and after it on its last line
+}
+
 // Schema represents the complete parsed Zed schema
 type Schema struct {
+	UseFlags    []*UseFlag
+	Imports     []*Import // Other schema files this one is composed with
 	Definitions []*Definition
+	Partials    []*Definition // Partial definitions, included into others with "...name"
+	Caveats     []*Caveat
+	EndComments []string // Comments after the last declaration
+}
+
+// Uses reports whether the schema enables the named feature with a use flag.
+func (s *Schema) Uses(feature string) bool {
+	for _, flag := range s.UseFlags {
+		if flag.Name == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// UseFlag represents a "use" directive that enables an optional feature, e.g. "use expiration"
+type UseFlag struct {
+	Name     string   // e.g., "expiration"
+	Pos      Pos      // Position of the feature name
+	Comments Comments // Comments attached to the directive
+}
+
+// Import represents an import directive, e.g. import "./common.zed"
+type Import struct {
+	Path     string   // e.g., "./common.zed", relative to the importing file
+	Pos      Pos      // Position of the path
+	Comments Comments // Comments attached to the directive
 }
 
-// Definition represents a single object type definition
+// Definition represents a single object type definition, or a partial definition
 type Definition struct {
 	Name        string        // e.g., "public_forum" or "bookingsvc/booking"
+	PartialRefs []*PartialRef // Partials whose members this definition includes
 	Relations   []*Relation   // Relations defined on this type
 	Permissions []*Permission // Permissions computed on this type
+	Pos         Pos           // Position of the definition name
+	Comments    Comments      // Comments before the definition and within its header
+	EndComments Comments      // Comments before and after the closing brace
+}
+
+// PartialRef represents the inclusion of a partial's members in a definition: ...name
+type PartialRef struct {
+	Name     string   // e.g., "viewable"
+	Pos      Pos      // Position of the partial name
+	Comments Comments // Comments attached to the reference
 }
 
 // Relation represents a relation definition
 type Relation struct {
 	Name         string         // e.g., "owner", "member"
 	SubjectTypes []*SubjectType // Types that can be subjects of this relation
+	Pos          Pos            // Position of the relation name
+	Comments     Comments       // Comments attached to the relation
 }
 
 // SubjectType represents a type that can be a subject in a relation
 type SubjectType struct {
 	TypeName   string // e.g., "user" or "bookingsvc/user"
+	Relation   string // e.g., "member" for "group#member"; empty for direct subjects
 	IsWildcard bool   // true for "user:*"
+	Caveat     string // e.g., "ip_allowlist" for "user with ip_allowlist"; empty when uncaveated
+	Expiration bool   // true for "user with expiration" or "user with ip_allowlist and expiration"
+	Pos        Pos    // Position of the type name
+}
+
+// Caveat represents a caveat definition
+type Caveat struct {
+	Name        string             // e.g., "ip_allowlist" or "bookingsvc/ip_allowlist"
+	Parameters  []*CaveatParameter // Typed parameters the expression can reference
+	Expression  string             // CEL expression text, e.g., "cidr.contains(user_ip)"
+	Pos         Pos                // Position of the caveat name
+	Comments    Comments           // Comments before the caveat and within its header
+	EndComments Comments           // Comments after the closing brace
+}
+
+// CaveatParameter represents a single typed caveat parameter
+type CaveatParameter struct {
+	Name string               // e.g., "user_ip"
+	Type *CaveatParameterType // e.g., "ipaddress" or "list<string>"
+	Pos  Pos                  // Position of the parameter name
+}
+
+// CaveatParameterType represents a CEL type reference, possibly generic
+type CaveatParameterType struct {
+	Name     string                 // e.g., "int", "list", "map"
+	TypeArgs []*CaveatParameterType // Child types for generic types such as list<int>
+	Pos      Pos                    // Position of the type name
+}
+
+// String renders the type the way it is written in the schema, e.g. "map<list<int>>".
+func (t *CaveatParameterType) String() string {
+	if len(t.TypeArgs) == 0 {
+		return t.Name
+	}
+
+	args := make([]string, len(t.TypeArgs))
+	for i, arg := range t.TypeArgs {
+		args[i] = arg.String()
+	}
+	return t.Name + "<" + strings.Join(args, ", ") + ">"
 }
 
 // Permission represents a permission definition
 type Permission struct {
-	Name       string // e.g., "view", "edit"
-	Expression Expr   // Expression that computes this permission
+	Name       string   // e.g., "view", "edit"
+	Expression Expr     // Expression that computes this permission
+	Pos        Pos      // Position of the permission name
+	Comments   Comments // Comments attached to the permission
 }
 
 // Expr is the interface for permission expressions
@@ -39,34 +151,76 @@ type Expr interface {
 type UnionExpr struct {
 	Left  Expr
 	Right Expr
+	Pos   Pos // Position of the operator
 }
 
 // IntersectionExpr represents an intersection operation (AND): left & right
 type IntersectionExpr struct {
 	Left  Expr
 	Right Expr
+	Pos   Pos // Position of the operator
 }
 
 // ExclusionExpr represents an exclusion operation: left - right
 type ExclusionExpr struct {
 	Left  Expr
 	Right Expr
+	Pos   Pos // Position of the operator
 }
 
 // ArrowExpr represents arrow traversal: relation->permission
 type ArrowExpr struct {
-	Relation   string // The relation to traverse
-	Permission string // The permission to check on the related object
+	Relation      string // The relation to traverse
+	Permission    string // The permission to check on the related object
+	Pos           Pos    // Position of the relation name
+	PermissionPos Pos    // Position of the permission name
+}
+
+// ArrowFunction selects how a functioned arrow combines the objects it walks.
+type ArrowFunction int
+
+const (
+	ArrowFunctionAny ArrowFunction = iota // relation.any(permission): any related object grants it, like ->
+	ArrowFunctionAll                      // relation.all(permission): every related object must grant it
+)
+
+func (f ArrowFunction) String() string {
+	switch f {
+	case ArrowFunctionAny:
+		return "any"
+	case ArrowFunctionAll:
+		return "all"
+	default:
+		return "unknown"
+	}
+}
+
+// FunctionedArrowExpr represents arrow traversal through a function: relation.any(permission)
+// or relation.all(permission)
+type FunctionedArrowExpr struct {
+	Relation      string        // The relation to traverse
+	Function      ArrowFunction // How the results for the related objects are combined
+	Permission    string        // The permission to check on the related objects
+	Pos           Pos           // Position of the relation name
+	PermissionPos Pos           // Position of the permission name
+}
+
+// NilExpr represents the nil keyword, a permission that no subject has
+type NilExpr struct {
+	Pos Pos // Position of the keyword
 }
 
 // RelationRef represents a reference to a relation by name
 type RelationRef struct {
 	Name string // The relation name
+	Pos  Pos    // Position of the name
 }
 
 // Implement exprNode() for all expression types
-func (*UnionExpr) exprNode()        {}
-func (*IntersectionExpr) exprNode() {}
-func (*ExclusionExpr) exprNode()    {}
-func (*ArrowExpr) exprNode()        {}
-func (*RelationRef) exprNode()      {}
+func (*UnionExpr) exprNode()           {}
+func (*IntersectionExpr) exprNode()    {}
+func (*ExclusionExpr) exprNode()       {}
+func (*ArrowExpr) exprNode()           {}
+func (*FunctionedArrowExpr) exprNode() {}
+func (*NilExpr) exprNode()             {}
+func (*RelationRef) exprNode()         {}
@@ -9,13 +9,24 @@ func TestExprNodeMarkers(t *testing.T) {
 	exprs = append(exprs, &IntersectionExpr{})
 	exprs = append(exprs, &ExclusionExpr{})
 	exprs = append(exprs, &ArrowExpr{})
+	exprs = append(exprs, &FunctionedArrowExpr{})
+	exprs = append(exprs, &NilExpr{})
 	exprs = append(exprs, &RelationRef{})
 
 	for _, e := range exprs {
 		e.exprNode() // call marker method
 	}
 
-	if len(exprs) != 5 {
-		t.Errorf("expected 5 expression types, got %d", len(exprs))
+	if len(exprs) != 7 {
+		t.Errorf("expected 7 expression types, got %d", len(exprs))
+	}
+}
+
+func TestPosString(t *testing.T) {
+	if got, want := (Pos{Line: 3, Column: 7}).String(), "line 3, column 7"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	if got, want := (Pos{File: "schema/common.zed", Line: 3, Column: 7}).String(), "schema/common.zed:3:7"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
 	}
 }
@@ -0,0 +1,135 @@
+package codegen
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/dave/jennifer/jen"
+	"github.com/oitnes/authzed-codegen/internal/generator/ast"
+	"github.com/oitnes/authzed-codegen/internal/generator/naming"
+)
+
+// generateCaveatsFile generates a caveats.go file with a name constant and a typed
+// context struct for every caveat of the package.
+func generateCaveatsFile(sc *scope) (*GeneratedFile, error) {
+	f := sc.pkg.newFile()
+
+	for _, caveat := range sc.pkg.Caveats {
+		generateCaveat(f, sc, caveat)
+	}
+
+	var buf bytes.Buffer
+	if err := f.Render(&buf); err != nil {
+		return nil, fmt.Errorf("rendering caveats: %w", err)
+	}
+
+	return &GeneratedFile{Name: sc.pkg.fileName("caveats.go"), Content: buf.String()}, nil
+}
+
+// generateCaveat writes the constant, context struct, and helper methods for one caveat.
+func generateCaveat(f *jen.File, sc *scope, caveat *ast.Caveat) {
+	constName := naming.CaveatConstName(sc.local(caveat.Name))
+	structName := naming.CaveatContextStructName(sc.local(caveat.Name))
+
+	f.Commentf("%s is the SpiceDB caveat name for %s.", constName, caveat.Name)
+	f.Const().Id(constName).Op("=").Qual(authzPkg, "CaveatName").Call(jen.Lit(caveat.Name))
+	f.Line()
+
+	var fields []jen.Code
+	var body []jen.Code
+	body = append(body, jen.Id("result").Op(":=").Make(jen.Map(jen.String()).Any()))
+
+	for _, param := range caveat.Parameters {
+		fieldName := naming.ToPascalCase(param.Name)
+		goType, nillable := caveatGoType(param.Type)
+
+		value := jen.Id("c").Dot(fieldName)
+		if nillable {
+			fields = append(fields, jen.Id(fieldName).Add(goType).Comment(param.Type.String()))
+		} else {
+			fields = append(fields, jen.Id(fieldName).Op("*").Add(goType).Comment(param.Type.String()))
+			value = jen.Op("*").Id("c").Dot(fieldName)
+		}
+
+		body = append(body,
+			jen.If(jen.Id("c").Dot(fieldName).Op("!=").Nil()).Block(
+				jen.Id("result").Index(jen.Lit(param.Name)).Op("=").Add(value),
+			),
+		)
+	}
+	body = append(body, jen.Return(jen.Id("result")))
+
+	f.Commentf("%s holds context values for the %s caveat.", structName, caveat.Name)
+	f.Comment("Nil fields are omitted so they can be supplied at check time instead.")
+	f.Type().Id(structName).Struct(fields...)
+	f.Line()
+
+	f.Comment("CaveatContext returns the set fields keyed by caveat parameter name.")
+	f.Func().Params(jen.Id("c").Id(structName)).Id("CaveatContext").Params().Map(jen.String()).Any().Block(body...)
+	f.Line()
+
+	// caveat() helper, exported as Caveat() when namespaces are split
+	if sc.layout.split {
+		f.Comment("Caveat returns the caveat with this context, as written on relationships.")
+	}
+	f.Func().Params(jen.Id("c").Id(structName)).Id(sc.caveatMethod()).Params().Op("*").Qual(authzPkg, "Caveat").Block(
+		jen.Return(jen.Op("&").Qual(authzPkg, "Caveat").Values(jen.Dict{
+			jen.Id("Name"):    jen.Id(constName),
+			jen.Id("Context"): jen.Id("c").Dot("CaveatContext").Call(),
+		})),
+	)
+	f.Line()
+}
+
+// caveatGoType maps a CEL caveat parameter type to a Go type. nillable reports whether the
+// Go type already has a nil value, so that the context field does not need a pointer.
+func caveatGoType(t *ast.CaveatParameterType) (goType jen.Code, nillable bool) {
+	switch t.Name {
+	case "int":
+		return jen.Int64(), false
+	case "uint":
+		return jen.Uint64(), false
+	case "bool":
+		return jen.Bool(), false
+	case "string", "ipaddress":
+		return jen.String(), false
+	case "double":
+		return jen.Float64(), false
+	case "duration":
+		return jen.Qual("time", "Duration"), false
+	case "timestamp":
+		return jen.Qual("time", "Time"), false
+	case "bytes":
+		return jen.Index().Byte(), true
+	case "list":
+		return jen.Index().Add(caveatTypeArg(t)), true
+	case "map":
+		return jen.Map(jen.String()).Add(caveatTypeArg(t)), true
+	default:
+		return jen.Any(), true
+	}
+}
+
+// caveatTypeArg returns the Go element type of a generic caveat type, falling back to any.
+func caveatTypeArg(t *ast.CaveatParameterType) jen.Code {
+	if len(t.TypeArgs) == 0 {
+		return jen.Any()
+	}
+	elem, _ := caveatGoType(t.TypeArgs[0])
+	return elem
+}
+
+// relationCaveats returns the unique caveat names used by a relation's subject types, in order.
+func relationCaveats(rel *ast.Relation) []string {
+	seen := make(map[string]bool)
+	var caveats []string
+
+	for _, st := range rel.SubjectTypes {
+		if st.Caveat != "" && !seen[st.Caveat] {
+			seen[st.Caveat] = true
+			caveats = append(caveats, st.Caveat)
+		}
+	}
+
+	return caveats
+}
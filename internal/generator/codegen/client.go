@@ -5,16 +5,14 @@ import (
 	"fmt"
 
 	"github.com/dave/jennifer/jen"
-	"github.com/oitnes/authzed-codegen/internal/generator/ast"
 	"github.com/oitnes/authzed-codegen/internal/generator/naming"
 )
 
 // generateClientFile generates a client.go file containing a Client struct that
 // holds the engine (and optionally repo) and exposes factory methods for every
 // definition type so callers never have to pass the engine individually.
-func generateClientFile(schema *ast.Schema, opts Options) (*GeneratedFile, error) {
-	f := jen.NewFile(opts.PackageName)
-	f.HeaderComment("Code generated by authzed-codegen. DO NOT EDIT.")
+func generateClientFile(sc *scope, opts Options) (*GeneratedFile, error) {
+	f := sc.pkg.newFile()
 
 	// Struct fields
 	fields := []jen.Code{
@@ -53,9 +51,12 @@ func generateClientFile(schema *ast.Schema, opts Options) (*GeneratedFile, error
 	)
 	f.Line()
 
+	generateTx(f, opts.SplitNamespaces)
+	generateDispatcher(f, sc, opts.WithRepository)
+
 	// One factory method per definition type
-	for _, def := range schema.Definitions {
-		typeName := naming.TypeStructName(def.Name)
+	for _, def := range sc.pkg.Definitions {
+		typeName := naming.TypeStructName(sc.local(def.Name))
 		constructorArgs := []jen.Code{
 			jen.Id("id"),
 			jen.Id("c").Dot("engine"),
@@ -79,5 +80,77 @@ func generateClientFile(schema *ast.Schema, opts Options) (*GeneratedFile, error
 		return nil, fmt.Errorf("rendering client: %w", err)
 	}
 
-	return &GeneratedFile{Name: "client.go", Content: buf.String()}, nil
+	return &GeneratedFile{Name: sc.pkg.fileName("client.go"), Content: buf.String()}, nil
+}
+
+// generateTx generates the Tx write batch, its Client.Tx constructor and Commit. The typed
+// Create, Touch and Delete methods on Tx are generated alongside each definition. A shared Tx
+// refers to its batch, so that the transactions of several packages can share one through
+// Client.TxOn.
+func generateTx(f *jen.File, shared bool) {
+	batchType := jen.Qual(authzPkg, "WriteBatch")
+	txValues := jen.Dict{
+		jen.Id("engine"): jen.Id("c").Dot("engine"),
+	}
+	if shared {
+		batchType = jen.Op("*").Qual(authzPkg, "WriteBatch")
+		txValues[jen.Id("batch")] = jen.Op("&").Qual(authzPkg, "WriteBatch").Values()
+	}
+
+	f.Comment("Tx collects relationship writes across definitions and commits them in one atomic")
+	f.Comment("write: either all of them apply or none do. A Tx is not safe for concurrent use.")
+	f.Type().Id("Tx").Struct(
+		jen.Id("engine").Qual(authzPkg, "Engine"),
+		jen.Id("batch").Add(batchType),
+	)
+	f.Line()
+
+	f.Comment("Tx starts a write transaction. Nothing is written until Commit is called.")
+	f.Func().Params(jen.Id("c").Op("*").Id("Client")).Id("Tx").Params().Op("*").Id("Tx").Block(
+		jen.Return(jen.Op("&").Id("Tx").Values(txValues)),
+	)
+	f.Line()
+
+	if shared {
+		f.Comment("TxOn starts a write transaction that collects its writes in batch. Transactions of the")
+		f.Comment("packages of other namespaces can share the batch, and committing any of them writes the")
+		f.Comment("writes of all of them in one atomic write.")
+		f.Func().Params(jen.Id("c").Op("*").Id("Client")).Id("TxOn").Params(
+			jen.Id("batch").Op("*").Qual(authzPkg, "WriteBatch"),
+		).Op("*").Id("Tx").Block(
+			jen.Return(jen.Op("&").Id("Tx").Values(jen.Dict{
+				jen.Id("engine"): jen.Id("c").Dot("engine"),
+				jen.Id("batch"):  jen.Id("batch"),
+			})),
+		)
+		f.Line()
+	}
+
+	f.Comment("Require adds preconditions that must hold when the transaction commits; if one does not,")
+	f.Comment("Commit fails with an *authz.PreconditionFailedError and nothing is written.")
+	f.Func().Params(jen.Id("tx").Op("*").Id("Tx")).Id("Require").Params(
+		jen.Id("preconditions").Op("...").Qual(authzPkg, "Precondition"),
+	).Op("*").Id("Tx").Block(
+		jen.Id("tx").Dot("batch").Dot("Require").Call(jen.Id("preconditions").Op("...")),
+		jen.Return(jen.Id("tx")),
+	)
+	f.Line()
+
+	f.Comment("Len returns the number of relationship writes collected so far.")
+	f.Func().Params(jen.Id("tx").Op("*").Id("Tx")).Id("Len").Params().Int().Block(
+		jen.Return(jen.Id("tx").Dot("batch").Dot("Len").Call()),
+	)
+	f.Line()
+
+	f.Comment("Commit writes all collected relationships atomically and returns the ZedToken of the write.")
+	f.Func().Params(jen.Id("tx").Op("*").Id("Tx")).Id("Commit").Params(
+		jen.Id("ctx").Qual("context", "Context"),
+	).Params(jen.Qual(authzPkg, "ZedToken"), jen.Error()).Block(
+		jen.Return(jen.Id("tx").Dot("engine").Dot("WriteRelationships").Call(
+			jen.Id("ctx"),
+			jen.Id("tx").Dot("batch").Dot("Updates").Call(),
+			jen.Id("tx").Dot("batch").Dot("Preconditions").Call().Op("..."),
+		)),
+	)
+	f.Line()
 }
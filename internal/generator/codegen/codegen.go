@@ -6,14 +6,16 @@ import (
 	"sort"
 
 	"github.com/dave/jennifer/jen"
+	"github.com/oitnes/authzed-codegen/internal/generator/analysis"
 	"github.com/oitnes/authzed-codegen/internal/generator/ast"
 	"github.com/oitnes/authzed-codegen/internal/generator/naming"
 )
 
 const authzPkg = "github.com/oitnes/authzed-codegen/pkg/authz"
 
-// newEntityCall builds a New<typeName>(id, <receiver>.engine[, <receiver>.repo]) jennifer expression.
-func newEntityCall(typeName, receiver string, withRepo bool) jen.Code {
+// newEntityCall builds a New<Type>(id, <receiver>.engine[, <receiver>.repo]) jennifer expression
+// for the definition typeName.
+func newEntityCall(sc *scope, typeName, receiver string, withRepo bool) jen.Code {
 	args := []jen.Code{
 		jen.String().Call(jen.Id("id")),
 		jen.Id(receiver).Dot("engine"),
@@ -21,18 +23,26 @@ func newEntityCall(typeName, receiver string, withRepo bool) jen.Code {
 	if withRepo {
 		args = append(args, jen.Id(receiver).Dot("repo"))
 	}
-	return jen.Id("New" + typeName).Call(args...)
+	return sc.newEntity(typeName).Call(args...)
 }
 
 // Options controls code generation behavior.
 type Options struct {
 	PackageName    string
 	WithRepository bool
+
+	// SplitNamespaces generates each namespace prefix, such as "bookingsvc" in
+	// "bookingsvc/booking", into a sub-package of the same name with short type names.
+	// Definitions and caveats without a namespace stay in the root package.
+	SplitNamespaces bool
+	// ImportPath is the import path of the root package. It is required with SplitNamespaces,
+	// since a package imports the packages of the types its relations refer to.
+	ImportPath string
 }
 
 // GeneratedFile represents a generated Go source file.
 type GeneratedFile struct {
-	Name    string
+	Name    string // slash-separated path relative to the output directory
 	Content string
 }
 
@@ -41,6 +51,8 @@ func Generate(schema *ast.Schema, opts Options) ([]*GeneratedFile, error) {
 	g := &generator{
 		schema: schema,
 		opts:   opts,
+		reach:  analysis.ComputeReachability(schema),
+		layout: newLayout(schema, opts),
 	}
 	return g.generate()
 }
@@ -48,24 +60,53 @@ func Generate(schema *ast.Schema, opts Options) ([]*GeneratedFile, error) {
 type generator struct {
 	schema *ast.Schema
 	opts   Options
+	reach  *analysis.Reachability
+	layout *layout
 }
 
 func (g *generator) generate() ([]*GeneratedFile, error) {
+	if err := g.checkCaveatReferences(); err != nil {
+		return nil, err
+	}
+	if g.opts.SplitNamespaces {
+		if g.opts.ImportPath == "" {
+			return nil, fmt.Errorf("splitting namespaces requires the import path of the output package")
+		}
+		if err := g.layout.checkImportCycles(g.reach); err != nil {
+			return nil, err
+		}
+	}
+
 	var files []*GeneratedFile
 
-	for _, def := range g.schema.Definitions {
-		file, err := g.generateDefinitionFile(def)
-		if err != nil {
-			return nil, fmt.Errorf("generating %s: %w", def.Name, err)
+	for _, pkg := range g.layout.packages {
+		sc := &scope{layout: g.layout, pkg: pkg}
+
+		for _, def := range pkg.Definitions {
+			file, err := g.generateDefinitionFile(sc, def)
+			if err != nil {
+				return nil, fmt.Errorf("generating %s: %w", def.Name, err)
+			}
+			files = append(files, file)
+		}
+
+		// A split root package that only holds caveats needs no client.
+		if len(pkg.Definitions) > 0 || !g.opts.SplitNamespaces {
+			clientFile, err := generateClientFile(sc, g.opts)
+			if err != nil {
+				return nil, fmt.Errorf("generating client: %w", err)
+			}
+			files = append(files, clientFile)
 		}
-		files = append(files, file)
-	}
 
-	clientFile, err := generateClientFile(g.schema, g.opts)
-	if err != nil {
-		return nil, fmt.Errorf("generating client: %w", err)
+		if len(pkg.Caveats) > 0 {
+			caveatsFile, err := generateCaveatsFile(sc)
+			if err != nil {
+				return nil, fmt.Errorf("generating caveats: %w", err)
+			}
+			files = append(files, caveatsFile)
+		}
 	}
-	files = append(files, clientFile)
 
 	sort.Slice(files, func(i, j int) bool {
 		return files[i].Name < files[j].Name
@@ -74,19 +115,23 @@ func (g *generator) generate() ([]*GeneratedFile, error) {
 	return files, nil
 }
 
-func (g *generator) generateDefinitionFile(def *ast.Definition) (*GeneratedFile, error) {
-	f := jen.NewFile(g.opts.PackageName)
-	f.HeaderComment("Code generated by authzed-codegen. DO NOT EDIT.")
+func (g *generator) generateDefinitionFile(sc *scope, def *ast.Definition) (*GeneratedFile, error) {
+	f := sc.pkg.newFile()
 
-	generateConstants(f, def)
-	generateTypeDefinition(f, def, g.opts.WithRepository)
-	generateRelationMethods(f, def, g.opts.WithRepository)
+	generateConstants(f, sc, def)
+	generateTypeDefinition(f, sc, def, g.opts.WithRepository)
+	generateRelationMethods(f, sc, def, g.opts.WithRepository)
+	generateDeleteAllMethods(f, sc, g.schema, def)
+	generateWatchEvents(f, sc, def, g.opts.WithRepository)
 
 	generatedLookups := make(map[string]bool)
-	generatePermissionMethods(f, def, generatedLookups, g.opts.WithRepository)
+	generatePermissionMethods(f, sc, def, g.reach, generatedLookups, g.opts.WithRepository)
+	if g.opts.SplitNamespaces {
+		generateSubjectMarkers(f, sc, g.schema, def, g.reach)
+	}
 
 	if g.opts.WithRepository {
-		generateRepositoryMethods(f, def)
+		generateRepositoryMethods(f, sc, def)
 	}
 
 	var buf bytes.Buffer
@@ -94,6 +139,27 @@ func (g *generator) generateDefinitionFile(def *ast.Definition) (*GeneratedFile,
 		return nil, fmt.Errorf("rendering %s: %w", def.Name, err)
 	}
 
-	fileName := naming.ToSnakeCase(def.Name) + ".go"
-	return &GeneratedFile{Name: fileName, Content: buf.String()}, nil
+	fileName := naming.ToSnakeCase(sc.local(def.Name)) + ".go"
+	return &GeneratedFile{Name: sc.pkg.fileName(fileName), Content: buf.String()}, nil
+}
+
+// checkCaveatReferences ensures every caveat used by a relation is defined, since the
+// generated code refers to the caveat's context struct by name.
+func (g *generator) checkCaveatReferences() error {
+	defined := make(map[string]bool)
+	for _, caveat := range g.schema.Caveats {
+		defined[caveat.Name] = true
+	}
+
+	for _, def := range g.schema.Definitions {
+		for _, rel := range def.Relations {
+			for _, caveat := range relationCaveats(rel) {
+				if !defined[caveat] {
+					return fmt.Errorf("relation %s#%s references undefined caveat %q", def.Name, rel.Name, caveat)
+				}
+			}
+		}
+	}
+
+	return nil
 }
@@ -3,6 +3,7 @@ package codegen
 import (
 	"go/parser"
 	"go/token"
+	"regexp"
 	"strings"
 	"testing"
 
@@ -85,6 +86,13 @@ func TestGenerateDefinitionWithRelations(t *testing.T) {
 	assertContains(t, docFile.Content, "CreateOwnerRelations")
 	assertContains(t, docFile.Content, "ReadOwnerRelations")
 	assertContains(t, docFile.Content, "DeleteOwnerRelations")
+	assertContains(t, docFile.Content, "func (d Document) CreateOwnerRelations(ctx context.Context, subjects DocumentOwnerObjects, preconditions ...authz.Precondition) (authz.ZedToken, error)")
+	assertContains(t, docFile.Content, "func (d Document) DeleteOwnerRelations(ctx context.Context, subjects DocumentOwnerObjects, preconditions ...authz.Precondition) (authz.ZedToken, error)")
+	assertContains(t, docFile.Content, "func (d Document) TouchOwnerRelations(ctx context.Context, subjects DocumentOwnerObjects, preconditions ...authz.Precondition) (authz.ZedToken, error)")
+	assertContains(t, docFile.Content, "ids := make([]authz.ID, len(subjects.User))")
+	assertContains(t, docFile.Content, `return d.engine.TouchRelations(ctx, d.resource(), DocumentRelationOwner, TypeUser, "", ids, nil, time.Time{}, preconditions...)`)
+	assertContains(t, docFile.Content, `return d.engine.DeleteRelations(ctx, d.resource(), DocumentRelationOwner, TypeUser, "", ids, preconditions...)`)
+	assertNotContains(t, docFile.Content, "d.engine.WriteRelationships")
 }
 
 func TestGenerateDefinitionWithPermissions(t *testing.T) {
@@ -130,9 +138,222 @@ func TestGenerateDefinitionWithPermissions(t *testing.T) {
 	assertContains(t, docFile.Content, "DocumentPermissionEdit")
 	assertContains(t, docFile.Content, "CheckDocumentEditInputs")
 	assertContains(t, docFile.Content, "CheckEdit")
+	assertContains(t, docFile.Content, "func (d Document) CheckEditResult(ctx context.Context, subjects CheckDocumentEditInputs, caveatContext map[string]any) (authz.CheckResult, error)")
+	assertContains(t, docFile.Content, "checks := d.editChecks(subjects, caveatContext)")
+	assertContains(t, docFile.Content, "chunk := checks[start:min(start+authz.MaxBulkCheckItems, len(checks))]")
+	assertContains(t, docFile.Content, "results, err := d.engine.CheckBulkPermission(ctx, chunk)")
+	assertContains(t, docFile.Content, "return authz.CheckResult{}, res.Err")
+	assertContains(t, docFile.Content, "result.Permissionship = authz.PermissionshipConditional")
+	assertContains(t, docFile.Content, "if !slices.Contains(result.MissingFields, field) {")
+	assertContains(t, docFile.Content, "res, err := d.CheckEditResult(ctx, subjects, nil)")
 	assertContains(t, docFile.Content, "LookupDocumentsWith")
 }
 
+func TestGenerateCheckMany(t *testing.T) {
+	schema := &ast.Schema{
+		Definitions: []*ast.Definition{
+			{
+				Name: "document",
+				Relations: []*ast.Relation{
+					{Name: "viewer", SubjectTypes: []*ast.SubjectType{{TypeName: "user"}, {TypeName: "group", Relation: "member"}}},
+				},
+				Permissions: []*ast.Permission{
+					{Name: "can_view", Expression: &ast.RelationRef{Name: "viewer"}},
+				},
+			},
+			{Name: "group"},
+			{Name: "user"},
+		},
+	}
+
+	files, err := Generate(schema, Options{PackageName: "authz"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var docFile *GeneratedFile
+	for _, f := range files {
+		if f.Name == "document.go" {
+			docFile = f
+		}
+	}
+	if docFile == nil {
+		t.Fatal("expected document.go file")
+	}
+
+	assertValidGo(t, docFile)
+	assertContains(t, docFile.Content, "func (d Document) canViewChecks(subjects CheckDocumentCanViewInputs, caveatContext map[string]any) []authz.PermissionCheck")
+	assertContains(t, docFile.Content, "for _, subject := range subjects.User {")
+	assertNotContains(t, docFile.Content, "range subjects.Group {")
+	assertContains(t, docFile.Content, "func CheckManyDocumentsWithCanView(ctx context.Context, engine authz.Engine, resources []Document, subjects CheckDocumentCanViewInputs) ([]bool, error)")
+	assertContains(t, docFile.Content, "checks = append(checks, resource.canViewChecks(subjects, nil)...)")
+	assertContains(t, docFile.Content, "chunk := checks[start:min(start+authz.MaxBulkCheckItems, len(checks))]")
+	assertContains(t, docFile.Content, "allowed[(start+i)/perResource] = true")
+}
+
+func TestGenerateFilter(t *testing.T) {
+	schema := &ast.Schema{
+		Definitions: []*ast.Definition{
+			{
+				Name: "document",
+				Relations: []*ast.Relation{
+					{Name: "viewer", SubjectTypes: []*ast.SubjectType{{TypeName: "user"}, {TypeName: "group", Relation: "member"}}},
+				},
+				Permissions: []*ast.Permission{
+					{Name: "can_view", Expression: &ast.RelationRef{Name: "viewer"}},
+				},
+			},
+			{Name: "group"},
+			{Name: "user"},
+		},
+	}
+
+	files, err := Generate(schema, Options{PackageName: "authz"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var docFile *GeneratedFile
+	for _, f := range files {
+		if f.Name == "document.go" {
+			docFile = f
+		}
+	}
+	if docFile == nil {
+		t.Fatal("expected document.go file")
+	}
+
+	assertValidGo(t, docFile)
+	assertContains(t, docFile.Content, "type DocumentCanViewSubject interface {")
+	assertContains(t, docFile.Content, "func (User) isDocumentCanViewSubject() {}")
+	// group#member has no subjects, since group defines no member relation.
+	assertNotContains(t, docFile.Content, "func (Group) isDocumentCanViewSubject() {}")
+	assertContains(t, docFile.Content, "func FilterDocumentsByCanView(ctx context.Context, engine authz.Engine, subject DocumentCanViewSubject, resources []Document) ([]Document, error)")
+	assertContains(t, docFile.Content, "start += authz.MaxBulkCheckItems")
+	assertContains(t, docFile.Content, "chunk := resources[start:min(start+authz.MaxBulkCheckItems, len(resources))]")
+	assertContains(t, docFile.Content, "allowed = append(allowed, chunk[i])")
+}
+
+func TestGenerateSubjectInterface(t *testing.T) {
+	schema := &ast.Schema{
+		Definitions: []*ast.Definition{
+			{Name: "user"},
+			{Name: "service_account"},
+			{
+				Name: "group",
+				Relations: []*ast.Relation{
+					{Name: "member", SubjectTypes: []*ast.SubjectType{{TypeName: "user"}, {TypeName: "group", Relation: "member"}}},
+				},
+			},
+			{
+				Name: "folder",
+				Relations: []*ast.Relation{
+					{Name: "viewer", SubjectTypes: []*ast.SubjectType{{TypeName: "service_account"}}},
+				},
+				Permissions: []*ast.Permission{
+					{Name: "view", Expression: &ast.RelationRef{Name: "viewer"}},
+				},
+			},
+			{
+				Name: "document",
+				Relations: []*ast.Relation{
+					{Name: "parent", SubjectTypes: []*ast.SubjectType{{TypeName: "folder"}}},
+					{Name: "viewer", SubjectTypes: []*ast.SubjectType{{TypeName: "group", Relation: "member"}}},
+				},
+				Permissions: []*ast.Permission{
+					{Name: "view", Expression: &ast.UnionExpr{
+						Left:  &ast.RelationRef{Name: "viewer"},
+						Right: &ast.ArrowExpr{Relation: "parent", Permission: "view"},
+					}},
+					{Name: "blocked", Expression: &ast.NilExpr{}},
+				},
+			},
+		},
+	}
+
+	files, err := Generate(schema, Options{PackageName: "authz"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var docFile *GeneratedFile
+	for _, f := range files {
+		if f.Name == "document.go" {
+			docFile = f
+		}
+	}
+	if docFile == nil {
+		t.Fatal("expected document.go file")
+	}
+
+	assertValidGo(t, docFile)
+	assertContains(t, docFile.Content, "type DocumentViewSubject interface {")
+	assertContains(t, docFile.Content, "func (User) isDocumentViewSubject() {}")
+	assertContains(t, docFile.Content, "func (ServiceAccount) isDocumentViewSubject() {}")
+	assertNotContains(t, docFile.Content, "func (Group) isDocumentViewSubject() {}")
+	assertNotContains(t, docFile.Content, "func (Folder) isDocumentViewSubject() {}")
+	assertContains(t, docFile.Content, "func (d Document) CanViewResult(ctx context.Context, subject DocumentViewSubject, caveatContext map[string]any) (authz.CheckResult, error)")
+	assertContains(t, docFile.Content, "return d.engine.CheckPermission(ctx, d.resource(), DocumentPermissionView, sub.Type, sub.ID, caveatContext)")
+	assertContains(t, docFile.Content, "func (d Document) CanView(ctx context.Context, subject DocumentViewSubject) (bool, error)")
+	assertContains(t, docFile.Content, "func LookupDocumentsWithView(ctx context.Context, engine authz.Engine, subject DocumentViewSubject) ([]Document, error)")
+
+	// No subject can hold a nil permission, so nothing takes its subject interface.
+	assertNotContains(t, docFile.Content, "DocumentBlockedSubject")
+	assertNotContains(t, docFile.Content, "CanBlocked")
+}
+
+func TestGeneratePrunesUnreachableSubjectTypes(t *testing.T) {
+	schema := &ast.Schema{
+		Definitions: []*ast.Definition{
+			{Name: "user"},
+			{Name: "customer"},
+			{
+				Name: "booking",
+				Relations: []*ast.Relation{
+					{Name: "owner", SubjectTypes: []*ast.SubjectType{{TypeName: "user"}}},
+					{Name: "editor", SubjectTypes: []*ast.SubjectType{{TypeName: "user"}, {TypeName: "customer"}}},
+					{Name: "guest", SubjectTypes: []*ast.SubjectType{{TypeName: "customer"}}},
+					{Name: "banned", SubjectTypes: []*ast.SubjectType{{TypeName: "customer"}}},
+				},
+				Permissions: []*ast.Permission{
+					{Name: "write", Expression: &ast.IntersectionExpr{
+						Left:  &ast.RelationRef{Name: "owner"},
+						Right: &ast.RelationRef{Name: "editor"},
+					}},
+					{Name: "view", Expression: &ast.ExclusionExpr{
+						Left:  &ast.UnionExpr{Left: &ast.RelationRef{Name: "editor"}, Right: &ast.RelationRef{Name: "guest"}},
+						Right: &ast.RelationRef{Name: "banned"},
+					}},
+				},
+			},
+		},
+	}
+
+	files, err := Generate(schema, Options{PackageName: "authz"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var bookingFile *GeneratedFile
+	for _, f := range files {
+		if f.Name == "booking.go" {
+			bookingFile = f
+		}
+	}
+	if bookingFile == nil {
+		t.Fatal("expected booking.go file")
+	}
+
+	assertValidGo(t, bookingFile)
+	assertContains(t, bookingFile.Content, "func LookupBookingsWithWriteByUser(")
+	assertContains(t, bookingFile.Content, "func (b Booking) LookupUsersWithWrite(")
+	assertNotContains(t, bookingFile.Content, "LookupBookingsWithWriteByCustomer")
+	assertNotContains(t, bookingFile.Content, "LookupCustomersWithWrite")
+	assertNotContains(t, bookingFile.Content, "func (Customer) isBookingWriteSubject() {}")
+	assertContains(t, bookingFile.Content, "func LookupBookingsWithViewByCustomer(")
+	assertContains(t, bookingFile.Content, "func (b Booking) LookupCustomersWithView(")
+}
+
 func TestGenerateNamespacedDefinition(t *testing.T) {
 	schema := &ast.Schema{
 		Definitions: []*ast.Definition{
@@ -386,6 +607,778 @@ func TestGenerateMultipleSubjectTypes(t *testing.T) {
 	assertContains(t, docFile.Content, "[]Group")
 }
 
+func TestGenerateCaveats(t *testing.T) {
+	schema := &ast.Schema{
+		Caveats: []*ast.Caveat{
+			{
+				Name: "ip_check",
+				Parameters: []*ast.CaveatParameter{
+					{Name: "allowed", Type: &ast.CaveatParameterType{Name: "list", TypeArgs: []*ast.CaveatParameterType{{Name: "string"}}}},
+					{Name: "user_ip", Type: &ast.CaveatParameterType{Name: "ipaddress"}},
+					{Name: "expires", Type: &ast.CaveatParameterType{Name: "timestamp"}},
+				},
+				Expression: "user_ip.in_cidr(allowed[0])",
+			},
+		},
+		Definitions: []*ast.Definition{
+			{
+				Name: "document",
+				Relations: []*ast.Relation{
+					{
+						Name: "viewer",
+						SubjectTypes: []*ast.SubjectType{
+							{TypeName: "user"},
+							{TypeName: "user", Caveat: "ip_check"},
+							{TypeName: "user", IsWildcard: true, Caveat: "ip_check"},
+						},
+					},
+				},
+			},
+			{Name: "user"},
+		},
+	}
+
+	files, err := Generate(schema, Options{PackageName: "authz"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var caveatsFile, docFile *GeneratedFile
+	for _, f := range files {
+		switch f.Name {
+		case "caveats.go":
+			caveatsFile = f
+		case "document.go":
+			docFile = f
+		}
+	}
+	if caveatsFile == nil || docFile == nil {
+		t.Fatal("expected caveats.go and document.go files")
+	}
+
+	assertValidGo(t, caveatsFile)
+	assertContains(t, caveatsFile.Content, `CaveatIpCheck = authz.CaveatName("ip_check")`)
+	assertContains(t, caveatsFile.Content, "type IpCheckCaveatContext struct")
+	assertContains(t, caveatsFile.Content, "Allowed []string")
+	assertContains(t, caveatsFile.Content, "UserIp  *string")
+	assertContains(t, caveatsFile.Content, "Expires *time.Time")
+	assertContains(t, caveatsFile.Content, `result["user_ip"] = *c.UserIp`)
+	assertContains(t, caveatsFile.Content, `result["allowed"] = c.Allowed`)
+
+	assertValidGo(t, docFile)
+	// The plain objects struct must not repeat the User field for caveated variants.
+	if n := regexp.MustCompile(`(?m)^\tUser +\[\]User$`).FindAllStringIndex(docFile.Content, -1); len(n) != 2 {
+		t.Errorf("expected User field in plain and caveated objects structs only, got %d", len(n))
+	}
+	assertContains(t, docFile.Content, "type DocumentViewerWithIpCheckObjects struct")
+	assertContains(t, docFile.Content, "func (d Document) CreateViewerRelationsWithIpCheck(ctx context.Context, subjects DocumentViewerWithIpCheckObjects, caveatContext IpCheckCaveatContext, preconditions ...authz.Precondition) (authz.ZedToken, error)")
+	assertContains(t, docFile.Content, "func (d Document) TouchViewerRelationsWithIpCheck(ctx context.Context, subjects DocumentViewerWithIpCheckObjects, caveatContext IpCheckCaveatContext, preconditions ...authz.Precondition) (authz.ZedToken, error)")
+	assertContains(t, docFile.Content, "caveatContext.caveat()")
+}
+
+func TestGenerateCaveatOnlyRelation(t *testing.T) {
+	schema := &ast.Schema{
+		Caveats: []*ast.Caveat{
+			{
+				Name:       "ip_check",
+				Parameters: []*ast.CaveatParameter{{Name: "user_ip", Type: &ast.CaveatParameterType{Name: "ipaddress"}}},
+				Expression: "user_ip == user_ip",
+			},
+		},
+		Definitions: []*ast.Definition{
+			{
+				Name: "document",
+				Relations: []*ast.Relation{
+					{
+						Name: "viewer",
+						SubjectTypes: []*ast.SubjectType{
+							{TypeName: "user", Caveat: "ip_check"},
+						},
+					},
+					{
+						Name: "editor",
+						SubjectTypes: []*ast.SubjectType{
+							{TypeName: "user"},
+							{TypeName: "group", Caveat: "ip_check"},
+						},
+					},
+				},
+			},
+			{Name: "group"},
+			{Name: "user"},
+		},
+	}
+
+	files, err := Generate(schema, Options{PackageName: "authz"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var docFile *GeneratedFile
+	for _, f := range files {
+		if f.Name == "document.go" {
+			docFile = f
+		}
+	}
+	if docFile == nil {
+		t.Fatal("expected document.go file")
+	}
+
+	assertValidGo(t, docFile)
+	assertNotContains(t, docFile.Content, "DocumentViewerObjects struct")
+	assertNotContains(t, docFile.Content, "CreateViewerRelations(")
+	assertNotContains(t, docFile.Content, "ReadViewerRelations(")
+	assertNotContains(t, docFile.Content, "RequireViewerSubjects(")
+	assertContains(t, docFile.Content, "func (d Document) CreateViewerRelationsWithIpCheck(")
+	assertContains(t, docFile.Content, "func (d Document) DeleteViewerRelationsWithIpCheck(ctx context.Context, subjects DocumentViewerWithIpCheckObjects, preconditions ...authz.Precondition) (authz.ZedToken, error)")
+	assertContains(t, docFile.Content, "func (d Document) ReadViewerRelationsDetailed(")
+	assertContains(t, docFile.Content, "func (d Document) RequireAnyViewer() authz.Precondition")
+
+	// The plain editor methods only take the uncaveated user subjects.
+	assertContains(t, docFile.Content, "type DocumentEditorObjects struct {\n\tUser []User\n}")
+	assertContains(t, docFile.Content, "type DocumentEditorWithIpCheckObjects struct {\n\tGroup []Group\n}")
+	assertContains(t, docFile.Content, "Subject types that require a caveat are only returned by ReadEditorRelationsDetailed.")
+}
+
+func TestGenerateExpiringRelations(t *testing.T) {
+	schema := &ast.Schema{
+		UseFlags: []*ast.UseFlag{{Name: "expiration"}},
+		Caveats: []*ast.Caveat{
+			{
+				Name:       "ip_check",
+				Parameters: []*ast.CaveatParameter{{Name: "user_ip", Type: &ast.CaveatParameterType{Name: "ipaddress"}}},
+				Expression: "user_ip == \"10.0.0.1\"",
+			},
+		},
+		Definitions: []*ast.Definition{
+			{
+				Name: "document",
+				Relations: []*ast.Relation{
+					{Name: "owner", SubjectTypes: []*ast.SubjectType{{TypeName: "user"}}},
+					{
+						Name: "viewer",
+						SubjectTypes: []*ast.SubjectType{
+							{TypeName: "user"},
+							{TypeName: "user", Expiration: true},
+							{TypeName: "user", Caveat: "ip_check", Expiration: true},
+						},
+					},
+				},
+			},
+			{Name: "user"},
+		},
+	}
+
+	files, err := Generate(schema, Options{PackageName: "authz"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var docFile *GeneratedFile
+	for _, f := range files {
+		if f.Name == "document.go" {
+			docFile = f
+		}
+	}
+	if docFile == nil {
+		t.Fatal("expected document.go file")
+	}
+
+	assertValidGo(t, docFile)
+	assertContains(t, docFile.Content, "func (d Document) CreateOwnerRelations(ctx context.Context, subjects DocumentOwnerObjects, preconditions ...authz.Precondition) (authz.ZedToken, error)")
+	assertContains(t, docFile.Content, `return d.engine.CreateRelations(ctx, d.resource(), DocumentRelationOwner, TypeUser, "", ids, nil, time.Time{}, preconditions...)`)
+	assertContains(t, docFile.Content, `return d.engine.CreateRelations(ctx, d.resource(), DocumentRelationViewer, TypeUser, "", ids, nil, expiresAt, preconditions...)`)
+	assertContains(t, docFile.Content, `return d.engine.CreateRelations(ctx, d.resource(), DocumentRelationViewer, TypeUser, "", ids, caveatContext.caveat(), expiresAt, preconditions...)`)
+	assertContains(t, docFile.Content, "func (d Document) CreateViewerRelations(ctx context.Context, subjects DocumentViewerObjects, expiresAt time.Time, preconditions ...authz.Precondition) (authz.ZedToken, error)")
+	assertContains(t, docFile.Content, "batch.Create(authz.RelationshipObject{\n\t\t\tExpiresAt:   expiresAt,\n\t\t\tRelation:    DocumentRelationViewer,")
+	assertContains(t, docFile.Content, "func (d Document) CreateViewerRelationsWithIpCheck(ctx context.Context, subjects DocumentViewerWithIpCheckObjects, caveatContext IpCheckCaveatContext, expiresAt time.Time, preconditions ...authz.Precondition) (authz.ZedToken, error)")
+	assertContains(t, docFile.Content, "batch.Create(authz.RelationshipObject{\n\t\t\tCaveat:      caveatContext.caveat(),\n\t\t\tExpiresAt:   expiresAt,")
+	assertContains(t, docFile.Content, "a zero expiresAt creates relations that do not expire")
+}
+
+func TestGenerateMixedExpiringRelations(t *testing.T) {
+	schema := &ast.Schema{
+		UseFlags: []*ast.UseFlag{{Name: "expiration"}},
+		Definitions: []*ast.Definition{
+			{
+				Name: "document",
+				Relations: []*ast.Relation{
+					{
+						Name: "viewer",
+						SubjectTypes: []*ast.SubjectType{
+							{TypeName: "user"},
+							{TypeName: "group", Relation: "member", Expiration: true},
+						},
+					},
+				},
+			},
+			{Name: "group", Relations: []*ast.Relation{{Name: "member", SubjectTypes: []*ast.SubjectType{{TypeName: "user"}}}}},
+			{Name: "user"},
+		},
+	}
+
+	files, err := Generate(schema, Options{PackageName: "authz"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var docFile *GeneratedFile
+	for _, f := range files {
+		if f.Name == "document.go" {
+			docFile = f
+		}
+	}
+	if docFile == nil {
+		t.Fatal("expected document.go file")
+	}
+
+	assertValidGo(t, docFile)
+	assertContains(t, docFile.Content, "func (d Document) CreateViewerRelations(ctx context.Context, subjects DocumentViewerObjects, expiresAt time.Time, preconditions ...authz.Precondition) (authz.ZedToken, error)")
+	assertContains(t, docFile.Content, "batch.Create(authz.RelationshipObject{\n\t\t\tRelation:    DocumentRelationViewer,\n\t\t\tResource:    d.resource(),\n\t\t\tSubjectID:   authz.ID(s.id),\n\t\t\tSubjectType: TypeUser,")
+	assertContains(t, docFile.Content, "batch.Create(authz.RelationshipObject{\n\t\t\tExpiresAt:       expiresAt,\n\t\t\tRelation:        DocumentRelationViewer,")
+	assertContains(t, docFile.Content, "if expiresAt.IsZero() && len(subjects.GroupMember) > 0 {")
+	assertContains(t, docFile.Content, "// Relations of group#member subjects expire at expiresAt, which must not be zero.\n// Relations of user subjects do not expire.")
+	assertNotContains(t, docFile.Content, "a zero expiresAt creates relations that do not expire")
+}
+
+func TestGenerateSubjectRelations(t *testing.T) {
+	schema := &ast.Schema{
+		Definitions: []*ast.Definition{
+			{
+				Name: "document",
+				Relations: []*ast.Relation{
+					{
+						Name: "viewer",
+						SubjectTypes: []*ast.SubjectType{
+							{TypeName: "user"},
+							{TypeName: "group"},
+							{TypeName: "group", Relation: "member"},
+						},
+					},
+				},
+			},
+			{Name: "group"},
+			{Name: "user"},
+		},
+	}
+
+	files, err := Generate(schema, Options{PackageName: "authz"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var docFile *GeneratedFile
+	for _, f := range files {
+		if f.Name == "document.go" {
+			docFile = f
+		}
+	}
+	if docFile == nil {
+		t.Fatal("expected document.go file")
+	}
+
+	assertValidGo(t, docFile)
+	assertContains(t, docFile.Content, "GroupMember []Group")
+	assertContains(t, docFile.Content, "for _, s := range subjects.GroupMember {\n\t\tbatch.Create(authz.RelationshipObject{")
+	assertContains(t, docFile.Content, `SubjectRelation: "member",`)
+	assertContains(t, docFile.Content, `d.engine.ReadRelations(ctx, d.resource(), DocumentRelationViewer, TypeGroup, "member")`)
+	assertContains(t, docFile.Content, "for _, s := range subjects.GroupMember {\n\t\tbatch.Delete(authz.RelationshipObject{")
+	assertContains(t, docFile.Content, "result.GroupMember = append(result.GroupMember, NewGroup(string(id), d.engine))")
+}
+
+func TestGenerateArrowFunctionsAndNil(t *testing.T) {
+	schema := &ast.Schema{
+		Definitions: []*ast.Definition{
+			{
+				Name: "document",
+				Relations: []*ast.Relation{
+					{Name: "approver", SubjectTypes: []*ast.SubjectType{{TypeName: "group"}}},
+				},
+				Permissions: []*ast.Permission{
+					{Name: "approve", Expression: &ast.FunctionedArrowExpr{Relation: "approver", Function: ast.ArrowFunctionAll, Permission: "member"}},
+					{Name: "archive", Expression: &ast.NilExpr{}},
+				},
+			},
+			{
+				Name:      "group",
+				Relations: []*ast.Relation{{Name: "member", SubjectTypes: []*ast.SubjectType{{TypeName: "user"}}}},
+			},
+			{Name: "user"},
+		},
+	}
+
+	files, err := Generate(schema, Options{PackageName: "authz"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var docFile *GeneratedFile
+	for _, f := range files {
+		if f.Name == "document.go" {
+			docFile = f
+		}
+	}
+	if docFile == nil {
+		t.Fatal("expected document.go file")
+	}
+
+	assertValidGo(t, docFile)
+	assertContains(t, docFile.Content, "DocumentPermissionApprove")
+	assertContains(t, docFile.Content, "func (d Document) CheckApprove(")
+	// No subject can hold a nil permission, so only its constant is generated.
+	assertContains(t, docFile.Content, "DocumentPermissionArchive")
+	assertNotContains(t, docFile.Content, "func (d Document) CheckArchive(")
+}
+
+func TestGenerateDetailedRead(t *testing.T) {
+	schema := &ast.Schema{
+		Definitions: []*ast.Definition{
+			{
+				Name: "document",
+				Relations: []*ast.Relation{
+					{
+						Name: "viewer",
+						SubjectTypes: []*ast.SubjectType{
+							{TypeName: "user"},
+							{TypeName: "user", IsWildcard: true},
+							{TypeName: "group", Relation: "member"},
+						},
+					},
+				},
+			},
+			{Name: "group"},
+			{Name: "user"},
+		},
+	}
+
+	files, err := Generate(schema, Options{PackageName: "authz"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var docFile *GeneratedFile
+	for _, f := range files {
+		if f.Name == "document.go" {
+			docFile = f
+		}
+	}
+	if docFile == nil {
+		t.Fatal("expected document.go file")
+	}
+
+	assertValidGo(t, docFile)
+	assertContains(t, docFile.Content, "type DocumentViewerRelationship struct")
+	assertContains(t, docFile.Content, "User            *User")
+	assertContains(t, docFile.Content, "Group           *Group")
+	assertContains(t, docFile.Content, "ExpiresAt       time.Time")
+	assertContains(t, docFile.Content, "func (d Document) ReadViewerRelationsDetailed(ctx context.Context) ([]DocumentViewerRelationship, error)")
+	assertContains(t, docFile.Content, "item.Wildcard = true")
+	assertContains(t, docFile.Content, "item.Group = &subject")
+	assertContains(t, docFile.Content, "Caveat:          relationship.Caveat,")
+}
+
+func TestGenerateTx(t *testing.T) {
+	schema := &ast.Schema{
+		UseFlags: []*ast.UseFlag{{Name: "expiration"}},
+		Caveats: []*ast.Caveat{
+			{
+				Name:       "ip_check",
+				Parameters: []*ast.CaveatParameter{{Name: "user_ip", Type: &ast.CaveatParameterType{Name: "ipaddress"}}},
+				Expression: "user_ip == user_ip",
+			},
+		},
+		Definitions: []*ast.Definition{
+			{
+				Name: "document",
+				Relations: []*ast.Relation{
+					{
+						Name: "viewer",
+						SubjectTypes: []*ast.SubjectType{
+							{TypeName: "user", IsWildcard: true},
+							{TypeName: "group", Relation: "member"},
+							{TypeName: "user", Caveat: "ip_check", Expiration: true},
+						},
+					},
+				},
+			},
+			{Name: "group"},
+			{Name: "user"},
+		},
+	}
+
+	files, err := Generate(schema, Options{PackageName: "authz"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var clientFile, docFile *GeneratedFile
+	for _, f := range files {
+		switch f.Name {
+		case "client.go":
+			clientFile = f
+		case "document.go":
+			docFile = f
+		}
+	}
+	if clientFile == nil || docFile == nil {
+		t.Fatal("expected client.go and document.go files")
+	}
+
+	assertValidGo(t, clientFile)
+	assertContains(t, clientFile.Content, "batch  authz.WriteBatch")
+	assertContains(t, clientFile.Content, "func (c *Client) Tx() *Tx")
+	assertContains(t, clientFile.Content, "func (tx *Tx) Commit(ctx context.Context) (authz.ZedToken, error)")
+	assertContains(t, clientFile.Content, "tx.engine.WriteRelationships(ctx, tx.batch.Updates(), tx.batch.Preconditions()...)")
+
+	assertValidGo(t, docFile)
+	assertContains(t, docFile.Content, "func (tx *Tx) CreateDocumentViewerRelations(resource Document, subjects DocumentViewerObjects) *Tx")
+	assertContains(t, docFile.Content, "func (tx *Tx) TouchDocumentViewerRelations(resource Document, subjects DocumentViewerObjects) *Tx")
+	assertContains(t, docFile.Content, "func (tx *Tx) DeleteDocumentViewerRelations(resource Document, subjects DocumentViewerObjects) *Tx")
+	assertContains(t, docFile.Content, "func (tx *Tx) CreateDocumentViewerRelationsWithIpCheck(resource Document, subjects DocumentViewerWithIpCheckObjects, caveatContext IpCheckCaveatContext, expiresAt time.Time) *Tx")
+	assertContains(t, docFile.Content, "func (tx *Tx) TouchDocumentViewerRelationsWithIpCheck(")
+	assertContains(t, docFile.Content, "func (tx *Tx) DeleteDocumentViewerRelationsWithIpCheck(resource Document, subjects DocumentViewerWithIpCheckObjects) *Tx")
+	assertContains(t, docFile.Content, `SubjectRelation: "member",`)
+	assertContains(t, docFile.Content, `SubjectID:   authz.ID("*"),`)
+	assertContains(t, docFile.Content, "Caveat:      caveatContext.caveat(),")
+	assertContains(t, docFile.Content, "ExpiresAt:   expiresAt,")
+}
+
+func TestGeneratePreconditions(t *testing.T) {
+	schema := &ast.Schema{
+		Definitions: []*ast.Definition{
+			{
+				Name: "document",
+				Relations: []*ast.Relation{
+					{
+						Name: "owner",
+						SubjectTypes: []*ast.SubjectType{
+							{TypeName: "user"},
+							{TypeName: "group", Relation: "member"},
+						},
+					},
+				},
+			},
+			{Name: "group"},
+			{Name: "user"},
+		},
+	}
+
+	files, err := Generate(schema, Options{PackageName: "authz"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var docFile *GeneratedFile
+	for _, f := range files {
+		if f.Name == "document.go" {
+			docFile = f
+		}
+	}
+	if docFile == nil {
+		t.Fatal("expected document.go file")
+	}
+
+	assertValidGo(t, docFile)
+	assertContains(t, docFile.Content, "func (d Document) RequireAnyOwner() authz.Precondition")
+	assertContains(t, docFile.Content, "func (d Document) RequireNoOwner() authz.Precondition")
+	assertContains(t, docFile.Content, "func (d Document) RequireOwnerSubjects(subjects DocumentOwnerObjects) []authz.Precondition")
+	assertContains(t, docFile.Content, "func (d Document) RequireNoOwnerSubjects(subjects DocumentOwnerObjects) []authz.Precondition")
+	assertContains(t, docFile.Content, "Operation: authz.PreconditionMustNotMatch,")
+	assertContains(t, docFile.Content, `SubjectRelation: "member",`)
+	// All subject types are written in one atomic write that carries the preconditions.
+	if n := strings.Count(docFile.Content, "return d.engine.WriteRelationships(ctx, batch.Updates(), preconditions...)"); n != 3 {
+		t.Errorf("expected one atomic write each in Create, Touch and Delete, got %d", n)
+	}
+}
+
+func TestGenerateDeleteAll(t *testing.T) {
+	schema := &ast.Schema{
+		Definitions: []*ast.Definition{
+			{
+				Name: "document",
+				Relations: []*ast.Relation{
+					{Name: "viewer", SubjectTypes: []*ast.SubjectType{{TypeName: "user"}, {TypeName: "group", Relation: "member"}}},
+				},
+			},
+			{
+				Name: "group",
+				Relations: []*ast.Relation{
+					{Name: "member", SubjectTypes: []*ast.SubjectType{{TypeName: "user"}}},
+				},
+			},
+			{Name: "user"},
+		},
+	}
+
+	files, err := Generate(schema, Options{PackageName: "authz"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	byName := make(map[string]*GeneratedFile)
+	for _, f := range files {
+		byName[f.Name] = f
+	}
+	docFile, groupFile, userFile := byName["document.go"], byName["group.go"], byName["user.go"]
+	if docFile == nil || groupFile == nil || userFile == nil {
+		t.Fatal("expected document.go, group.go and user.go files")
+	}
+
+	assertValidGo(t, docFile)
+	assertContains(t, docFile.Content, "func (d Document) DeleteAllRelations(ctx context.Context) (authz.ZedToken, error)")
+	assertContains(t, docFile.Content, "ResourceID:   d.id,")
+	if strings.Contains(docFile.Content, "DeleteAllSubjectRelations") {
+		t.Error("document is never a subject and should not get DeleteAllSubjectRelations")
+	}
+
+	assertValidGo(t, groupFile)
+	assertContains(t, groupFile.Content, "func (g Group) DeleteAllRelations(ctx context.Context) (authz.ZedToken, error)")
+	assertContains(t, groupFile.Content, "range []authz.Type{TypeDocument}")
+
+	assertValidGo(t, userFile)
+	assertContains(t, userFile.Content, "func (u User) DeleteAllSubjectRelations(ctx context.Context) (authz.ZedToken, error)")
+	assertContains(t, userFile.Content, "range []authz.Type{TypeDocument, TypeGroup}")
+	if strings.Contains(userFile.Content, "DeleteAllRelations(") {
+		t.Error("user has no relations and should not get DeleteAllRelations")
+	}
+}
+
+func TestGenerateLookupStreamsAndPages(t *testing.T) {
+	schema := &ast.Schema{
+		Definitions: []*ast.Definition{
+			{
+				Name: "document",
+				Relations: []*ast.Relation{
+					{Name: "viewer", SubjectTypes: []*ast.SubjectType{{TypeName: "user"}}},
+				},
+				Permissions: []*ast.Permission{
+					{Name: "view", Expression: &ast.RelationRef{Name: "viewer"}},
+				},
+			},
+			{Name: "user"},
+		},
+	}
+
+	files, err := Generate(schema, Options{PackageName: "authz"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var docFile *GeneratedFile
+	for _, f := range files {
+		if f.Name == "document.go" {
+			docFile = f
+		}
+	}
+	if docFile == nil {
+		t.Fatal("expected document.go file")
+	}
+
+	assertValidGo(t, docFile)
+	assertContains(t, docFile.Content, "func LookupDocumentsWithViewByUserSeq(ctx context.Context, engine authz.Engine, subject User) iter.Seq2[Document, error]")
+	assertContains(t, docFile.Content, "range engine.LookupResourcesSeq(ctx, TypeDocument, DocumentPermissionView, TypeUser, authz.ID(subject.id))")
+	assertContains(t, docFile.Content, "func LookupDocumentsWithViewByUserPage(ctx context.Context, engine authz.Engine, subject User, limit uint32, cursor authz.Cursor) ([]Document, authz.Cursor, error)")
+	assertContains(t, docFile.Content, "ids, next, err := engine.LookupResourcesPage(ctx, TypeDocument, DocumentPermissionView, TypeUser, authz.ID(subject.id), limit, cursor)")
+	assertContains(t, docFile.Content, "func (d Document) LookupUsersWithViewSeq(ctx context.Context) iter.Seq2[User, error]")
+	assertContains(t, docFile.Content, "yield(User{}, err)")
+}
+
+func TestGenerateWatchEvents(t *testing.T) {
+	schema := &ast.Schema{
+		Definitions: []*ast.Definition{
+			{
+				Name: "document",
+				Relations: []*ast.Relation{
+					{Name: "viewer", SubjectTypes: []*ast.SubjectType{{TypeName: "user"}, {TypeName: "user", IsWildcard: true}}},
+				},
+			},
+			{Name: "user"},
+		},
+	}
+
+	files, err := Generate(schema, Options{PackageName: "authz", WithRepository: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	byName := make(map[string]*GeneratedFile)
+	for _, f := range files {
+		byName[f.Name] = f
+	}
+	clientFile, docFile, userFile := byName["client.go"], byName["document.go"], byName["user.go"]
+	if clientFile == nil || docFile == nil || userFile == nil {
+		t.Fatal("expected client.go, document.go and user.go files")
+	}
+
+	assertValidGo(t, clientFile)
+	assertContains(t, clientFile.Content, "func (c *Client) Dispatcher() *Dispatcher")
+	assertContains(t, clientFile.Content, "onDocumentViewerAdded   []func(context.Context, DocumentViewerAdded) error")
+	assertContains(t, clientFile.Content, "func (dp *Dispatcher) Dispatch(ctx context.Context, event authz.WatchEvent) error")
+	assertContains(t, clientFile.Content, "func (dp *Dispatcher) Run(ctx context.Context, watcher authz.Watcher, token authz.ZedToken) (authz.ZedToken, error)")
+	assertContains(t, clientFile.Content, "range watcher.Watch(ctx, token, TypeDocument)")
+
+	assertValidGo(t, docFile)
+	assertContains(t, docFile.Content, "type DocumentViewerAdded struct")
+	assertContains(t, docFile.Content, "type DocumentViewerRemoved struct")
+	assertContains(t, docFile.Content, "func (dp *Dispatcher) OnDocumentViewerAdded(handler func(ctx context.Context, event DocumentViewerAdded) error) *Dispatcher")
+	assertContains(t, docFile.Content, "resource := NewDocument(string(relationship.Resource.ID), dp.engine, dp.repo)")
+	assertContains(t, docFile.Content, "item.Wildcard = true")
+	assertContains(t, docFile.Content, "return dispatchTo(ctx, dp.onDocumentViewerRemoved, DocumentViewerRemoved{")
+
+	if strings.Contains(userFile.Content, "Dispatcher") {
+		t.Error("user has no relations and should not get watch events")
+	}
+}
+
+func TestGenerateUndefinedCaveat(t *testing.T) {
+	schema := &ast.Schema{
+		Definitions: []*ast.Definition{
+			{
+				Name: "document",
+				Relations: []*ast.Relation{
+					{
+						Name:         "viewer",
+						SubjectTypes: []*ast.SubjectType{{TypeName: "user", Caveat: "missing"}},
+					},
+				},
+			},
+			{Name: "user"},
+		},
+	}
+
+	_, err := Generate(schema, Options{PackageName: "authz"})
+	if err == nil {
+		t.Fatal("expected error for undefined caveat")
+	}
+	if !strings.Contains(err.Error(), "missing") {
+		t.Errorf("expected caveat name in error, got: %v", err)
+	}
+}
+
+func TestGenerateSplitNamespaces(t *testing.T) {
+	schema := &ast.Schema{
+		Caveats: []*ast.Caveat{
+			{Name: "menusvc/open_hours", Parameters: []*ast.CaveatParameter{{Name: "hour", Type: &ast.CaveatParameterType{Name: "int"}}}},
+		},
+		Definitions: []*ast.Definition{
+			{Name: "user"},
+			{Name: "menusvc/user"},
+			{
+				Name: "menusvc/company",
+				Relations: []*ast.Relation{
+					{Name: "member", SubjectTypes: []*ast.SubjectType{{TypeName: "user"}, {TypeName: "menusvc/user", Caveat: "menusvc/open_hours"}}},
+				},
+				Permissions: []*ast.Permission{
+					{Name: "view", Expression: &ast.RelationRef{Name: "member"}},
+				},
+			},
+			{
+				Name: "bookingsvc/booking",
+				Relations: []*ast.Relation{
+					{Name: "company", SubjectTypes: []*ast.SubjectType{{TypeName: "menusvc/company"}}},
+				},
+				Permissions: []*ast.Permission{
+					{Name: "view", Expression: &ast.ArrowExpr{Relation: "company", Permission: "view"}},
+				},
+			},
+		},
+	}
+
+	files, err := Generate(schema, Options{PackageName: "perms", SplitNamespaces: true, ImportPath: "example.com/app/perms"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	byName := make(map[string]*GeneratedFile)
+	var names []string
+	for _, f := range files {
+		assertValidGo(t, f)
+		byName[f.Name] = f
+		names = append(names, f.Name)
+	}
+	want := []string{
+		"bookingsvc/booking.go",
+		"bookingsvc/client.go",
+		"client.go",
+		"menusvc/caveats.go",
+		"menusvc/client.go",
+		"menusvc/company.go",
+		"menusvc/user.go",
+		"user.go",
+	}
+	if strings.Join(names, " ") != strings.Join(want, " ") {
+		t.Fatalf("files = %v, want %v", names, want)
+	}
+
+	booking := byName["bookingsvc/booking.go"].Content
+	assertContains(t, booking, "package bookingsvc")
+	assertContains(t, booking, `"example.com/app/perms/menusvc"`)
+	assertContains(t, booking, `const TypeBooking = authz.Type("bookingsvc/booking")`)
+	assertContains(t, booking, "type Booking struct")
+	assertContains(t, booking, "Company []menusvc.Company")
+	assertContains(t, booking, "b.engine.ReadRelations(ctx, b.Resource(), BookingRelationCompany, menusvc.TypeCompany, \"\")")
+	assertContains(t, booking, "menusvc.NewCompany(string(id), b.engine)")
+	assertContains(t, booking, "User        []perms.User")
+	assertContains(t, booking, "MenusvcUser []menusvc.User")
+	assertContains(t, booking, "authz.ID(subject.ID())")
+	assertContains(t, booking, "IsBookingsvcBookingViewSubject()")
+	assertNotContains(t, booking, "BookingsvcBooking ")
+
+	company := byName["menusvc/company.go"].Content
+	assertContains(t, company, "package menusvc")
+	assertContains(t, company, "func (c Company) CreateMemberRelationsWithOpenHours(ctx context.Context, subjects CompanyMemberWithOpenHoursObjects, caveatContext OpenHoursCaveatContext")
+	assertContains(t, company, "caveatContext.Caveat()")
+	assertNotContains(t, company, `"example.com/app/perms/bookingsvc"`)
+
+	// Subjects declare the markers of the interfaces they implement, wherever those are.
+	user := byName["user.go"].Content
+	assertContains(t, user, "package perms")
+	assertContains(t, user, "func (User) IsBookingsvcBookingViewSubject() {}")
+	assertContains(t, user, "func (User) IsMenusvcCompanyViewSubject() {}")
+	assertContains(t, user, "func (u User) Resource() authz.Resource")
+	// Resource types of other packages are spelled out, since importing them would be a cycle.
+	assertContains(t, user, `range []authz.Type{authz.Type("menusvc/company")}`)
+
+	caveats := byName["menusvc/caveats.go"].Content
+	assertContains(t, caveats, "type OpenHoursCaveatContext struct")
+	assertContains(t, caveats, "func (c OpenHoursCaveatContext) Caveat() *authz.Caveat")
+
+	client := byName["menusvc/client.go"].Content
+	assertContains(t, client, "batch  *authz.WriteBatch")
+	assertContains(t, client, "func (c *Client) TxOn(batch *authz.WriteBatch) *Tx")
+	assertContains(t, client, "func (c *Client) NewCompany(id string) Company")
+	assertNotContains(t, client, "NewBooking")
+}
+
+func TestGenerateSplitNamespacesImportCycle(t *testing.T) {
+	schema := &ast.Schema{
+		Definitions: []*ast.Definition{
+			{
+				Name: "user",
+				Relations: []*ast.Relation{
+					{Name: "org", SubjectTypes: []*ast.SubjectType{{TypeName: "orgsvc/org"}}},
+				},
+			},
+			{
+				Name: "orgsvc/org",
+				Relations: []*ast.Relation{
+					{Name: "member", SubjectTypes: []*ast.SubjectType{{TypeName: "user"}}},
+				},
+			},
+		},
+	}
+
+	_, err := Generate(schema, Options{PackageName: "perms", SplitNamespaces: true, ImportPath: "example.com/perms"})
+	if err == nil || !strings.Contains(err.Error(), "root package -> orgsvc -> root package") {
+		t.Errorf("expected an import cycle error, got: %v", err)
+	}
+
+	_, err = Generate(schema, Options{PackageName: "perms", SplitNamespaces: true})
+	if err == nil || !strings.Contains(err.Error(), "import path") {
+		t.Errorf("expected an error for the missing import path, got: %v", err)
+	}
+}
+
 func TestGenerateDoNotEditHeader(t *testing.T) {
 	schema := &ast.Schema{
 		Definitions: []*ast.Definition{
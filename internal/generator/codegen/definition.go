@@ -7,9 +7,9 @@ import (
 )
 
 // generateConstants writes type, relation, and permission constants.
-func generateConstants(f *jen.File, def *ast.Definition) {
-	typeName := naming.TypeStructName(def.Name)
-	typeConst := naming.TypeConstName(def.Name)
+func generateConstants(f *jen.File, sc *scope, def *ast.Definition) {
+	typeName := naming.TypeStructName(sc.local(def.Name))
+	typeConst := naming.TypeConstName(sc.local(def.Name))
 
 	// Type constant
 	f.Commentf("%s is the SpiceDB type constant for %s.", typeConst, def.Name)
@@ -18,7 +18,7 @@ func generateConstants(f *jen.File, def *ast.Definition) {
 
 	// Relation constants
 	for _, rel := range def.Relations {
-		constName := naming.RelationConstName(def.Name, rel.Name)
+		constName := naming.RelationConstName(sc.local(def.Name), rel.Name)
 		f.Commentf("%s is the relation constant for %s.%s.", constName, typeName, rel.Name)
 		f.Const().Id(constName).Op("=").Qual(authzPkg, "Relation").Call(jen.Lit(rel.Name))
 	}
@@ -28,7 +28,7 @@ func generateConstants(f *jen.File, def *ast.Definition) {
 
 	// Permission constants
 	for _, perm := range def.Permissions {
-		constName := naming.PermissionConstName(def.Name, perm.Name)
+		constName := naming.PermissionConstName(sc.local(def.Name), perm.Name)
 		f.Commentf("%s is the permission constant for %s.%s.", constName, typeName, perm.Name)
 		f.Const().Id(constName).Op("=").Qual(authzPkg, "Permission").Call(jen.Lit(perm.Name))
 	}
@@ -38,8 +38,8 @@ func generateConstants(f *jen.File, def *ast.Definition) {
 }
 
 // generateTypeDefinition writes the struct, constructor, and accessor methods.
-func generateTypeDefinition(f *jen.File, def *ast.Definition, withRepository bool) {
-	typeName := naming.TypeStructName(def.Name)
+func generateTypeDefinition(f *jen.File, sc *scope, def *ast.Definition, withRepository bool) {
+	typeName := naming.TypeStructName(sc.local(def.Name))
 	receiver := naming.ReceiverName(typeName)
 
 	// Struct definition
@@ -90,10 +90,13 @@ func generateTypeDefinition(f *jen.File, def *ast.Definition, withRepository boo
 	)
 	f.Line()
 
-	// resource() helper (unexported)
-	f.Func().Params(jen.Id(receiver).Id(typeName)).Id("resource").Params().Qual(authzPkg, "Resource").Block(
+	// resource() helper, exported as Resource() when namespaces are split
+	if sc.layout.split {
+		f.Commentf("Resource returns the SpiceDB object reference of this %s.", def.Name)
+	}
+	f.Func().Params(jen.Id(receiver).Id(typeName)).Id(sc.resourceMethod()).Params().Qual(authzPkg, "Resource").Block(
 		jen.Return(jen.Qual(authzPkg, "Resource").Values(jen.Dict{
-			jen.Id("Type"): jen.Id(naming.TypeConstName(def.Name)),
+			jen.Id("Type"): jen.Id(naming.TypeConstName(sc.local(def.Name))),
 			jen.Id("ID"):   jen.Qual(authzPkg, "ID").Call(jen.Id(receiver).Dot("id")),
 		})),
 	)
@@ -2,48 +2,43 @@ package codegen
 
 import (
 	"fmt"
+	"slices"
 
 	"github.com/dave/jennifer/jen"
+	"github.com/oitnes/authzed-codegen/internal/generator/analysis"
 	"github.com/oitnes/authzed-codegen/internal/generator/ast"
 	"github.com/oitnes/authzed-codegen/internal/generator/naming"
 )
 
-// generatePermissionMethods generates Check and Lookup methods for each permission.
-func generatePermissionMethods(f *jen.File, def *ast.Definition, generatedLookups map[string]bool, withRepository bool) {
-	subjectTypes := collectSubjectTypes(def)
-
+// generatePermissionMethods generates Check, CheckMany, Can, Filter and Lookup methods for each
+// permission. They are generated only for the subject types that can hold the permission, and
+// not at all for permissions that no subject can hold.
+func generatePermissionMethods(f *jen.File, sc *scope, def *ast.Definition, reach *analysis.Reachability, generatedLookups map[string]bool, withRepository bool) {
 	for _, perm := range def.Permissions {
-		generateCheckInputStruct(f, def, perm, subjectTypes)
-		generateCheckMethod(f, def, perm, subjectTypes)
-		generateLookupMethods(f, def, perm, subjectTypes, generatedLookups, withRepository)
-	}
-}
-
-// collectSubjectTypes returns all unique subject type names used in relations of the definition.
-func collectSubjectTypes(def *ast.Definition) []string {
-	seen := make(map[string]bool)
-	var types []string
-
-	for _, rel := range def.Relations {
-		for _, st := range rel.SubjectTypes {
-			if !seen[st.TypeName] {
-				seen[st.TypeName] = true
-				types = append(types, st.TypeName)
-			}
+		subjectTypes := reach.SubjectTypes(def.Name, perm.Name)
+		if len(subjectTypes) == 0 {
+			continue
 		}
-	}
 
-	return types
+		generateCheckInputStruct(f, sc, def, perm, subjectTypes)
+		generateCheckMethod(f, sc, def, perm, subjectTypes)
+		generateCheckManyFunction(f, sc, def, perm)
+		generateLookupMethods(f, sc, def, perm, subjectTypes, generatedLookups, withRepository)
+		generateSubjectInterface(f, sc, def, perm, subjectTypes)
+		generateCanMethod(f, sc, def, perm)
+		generateFilterFunction(f, sc, def, perm)
+		generateSubjectLookupFunction(f, sc, def, perm, withRepository)
+	}
 }
 
 // generateCheckInputStruct generates the input struct for permission checks.
-func generateCheckInputStruct(f *jen.File, def *ast.Definition, perm *ast.Permission, subjectTypes []string) {
-	structName := naming.CheckInputStructName(def.Name, perm.Name)
+func generateCheckInputStruct(f *jen.File, sc *scope, def *ast.Definition, perm *ast.Permission, subjectTypes []string) {
+	structName := naming.CheckInputStructName(sc.local(def.Name), perm.Name)
 
 	var fields []jen.Code
+	names := sc.subjectNames(subjectTypes)
 	for _, st := range subjectTypes {
-		fieldName := naming.TypeStructName(st)
-		fields = append(fields, jen.Id(fieldName).Index().Id(fieldName))
+		fields = append(fields, jen.Id(names[st]).Index().Add(sc.typeStruct(st)))
 	}
 
 	f.Commentf("%s holds subjects for %s permission checks.", structName, perm.Name)
@@ -51,59 +46,360 @@ func generateCheckInputStruct(f *jen.File, def *ast.Definition, perm *ast.Permis
 	f.Line()
 }
 
-// generateCheckMethod generates the Check{Permission} method.
-func generateCheckMethod(f *jen.File, def *ast.Definition, perm *ast.Permission, subjectTypes []string) {
-	typeName := naming.TypeStructName(def.Name)
+// generateCheckMethod generates the Check{Permission} and Check{Permission}Result methods,
+// which check all subjects in bulk requests, and the checks helper they share with CheckMany.
+func generateCheckMethod(f *jen.File, sc *scope, def *ast.Definition, perm *ast.Permission, subjectTypes []string) {
+	typeName := naming.TypeStructName(sc.local(def.Name))
 	receiver := naming.ReceiverName(typeName)
 	methodName := "Check" + naming.ToPascalCase(perm.Name)
-	structName := naming.CheckInputStructName(def.Name, perm.Name)
-	permConst := naming.PermissionConstName(def.Name, perm.Name)
-
-	var body []jen.Code
+	resultMethodName := methodName + "Result"
+	checksMethodName := checksMethodName(perm)
+	structName := naming.CheckInputStructName(sc.local(def.Name), perm.Name)
+	permConst := naming.PermissionConstName(sc.local(def.Name), perm.Name)
 
+	checksBody := []jen.Code{
+		jen.Id("resource").Op(":=").Id(receiver).Dot(sc.resourceMethod()).Call(),
+		jen.Var().Id("checks").Index().Qual(authzPkg, "PermissionCheck"),
+	}
+	names := sc.subjectNames(subjectTypes)
 	for _, st := range subjectTypes {
-		fieldName := naming.TypeStructName(st)
-		typeConst := naming.TypeConstName(st)
+		checksBody = append(checksBody,
+			jen.For(jen.Id("_").Op(",").Id("subject").Op(":=").Range().Id("subjects").Dot(names[st])).Block(
+				jen.Id("checks").Op("=").Append(jen.Id("checks"), jen.Qual(authzPkg, "PermissionCheck").Values(jen.Dict{
+					jen.Id("Resource"):      jen.Id("resource"),
+					jen.Id("Permission"):    jen.Id(permConst),
+					jen.Id("SubjectType"):   sc.typeConst(st),
+					jen.Id("SubjectID"):     jen.Qual(authzPkg, "ID").Call(sc.id(jen.Id("subject"))),
+					jen.Id("CaveatContext"): jen.Id("caveatContext"),
+				})),
+			),
+		)
+	}
+	checksBody = append(checksBody, jen.Return(jen.Id("checks")))
 
-		body = append(body,
-			jen.For(jen.Id("_").Op(",").Id("s").Op(":=").Range().Id("subjects").Dot(fieldName)).Block(
-				jen.List(jen.Id("ok"), jen.Err()).Op(":=").Id(receiver).Dot("engine").Dot("CheckPermission").Call(
-					jen.Id("ctx"),
-					jen.Id(receiver).Dot("resource").Call(),
-					jen.Id(permConst),
-					jen.Id(typeConst),
-					jen.Qual(authzPkg, "ID").Call(jen.Id("s").Dot("id")),
+	f.Commentf("%s returns one check of %s permission on this %s per subject.", checksMethodName, perm.Name, def.Name)
+	f.Func().Params(jen.Id(receiver).Id(typeName)).Id(checksMethodName).Params(
+		jen.Id("subjects").Id(structName),
+		jen.Id("caveatContext").Map(jen.String()).Any(),
+	).Index().Qual(authzPkg, "PermissionCheck").Block(checksBody...)
+	f.Line()
+
+	f.Commentf("%s checks if any subject has %s permission on this %s.", resultMethodName, perm.Name, def.Name)
+	f.Comment("The result is allowed if any subject is allowed, conditional if any subject is conditional on")
+	f.Comment("caveat context that was not supplied, and denied otherwise. caveatContext may be nil.")
+	f.Comment("The missing fields of all conditional subjects are reported once each. The checks are sent")
+	f.Comment("in bulk requests of at most authz.MaxBulkCheckItems checks each.")
+	f.Func().Params(jen.Id(receiver).Id(typeName)).Id(resultMethodName).Params(
+		jen.Id("ctx").Qual("context", "Context"),
+		jen.Id("subjects").Id(structName),
+		jen.Id("caveatContext").Map(jen.String()).Any(),
+	).Params(jen.Qual(authzPkg, "CheckResult"), jen.Error()).Block(
+		jen.Var().Id("result").Qual(authzPkg, "CheckResult"),
+		jen.Id("checks").Op(":=").Id(receiver).Dot(checksMethodName).Call(jen.Id("subjects"), jen.Id("caveatContext")),
+		jen.For(
+			jen.Id("start").Op(":=").Lit(0),
+			jen.Id("start").Op("<").Len(jen.Id("checks")),
+			jen.Id("start").Op("+=").Qual(authzPkg, "MaxBulkCheckItems"),
+		).Block(
+			jen.Id("chunk").Op(":=").Id("checks").Index(
+				jen.Id("start"),
+				jen.Min(jen.Id("start").Op("+").Qual(authzPkg, "MaxBulkCheckItems"), jen.Len(jen.Id("checks"))),
+			),
+			jen.List(jen.Id("results"), jen.Err()).Op(":=").Id(receiver).Dot("engine").Dot("CheckBulkPermission").Call(jen.Id("ctx"), jen.Id("chunk")),
+			jen.If(jen.Err().Op("!=").Nil()).Block(
+				jen.Return(jen.Qual(authzPkg, "CheckResult").Values(), jen.Err()),
+			),
+			jen.For(jen.Id("_").Op(",").Id("res").Op(":=").Range().Id("results")).Block(
+				jen.If(jen.Id("res").Dot("Err").Op("!=").Nil()).Block(
+					jen.Return(jen.Qual(authzPkg, "CheckResult").Values(), jen.Id("res").Dot("Err")),
 				),
-				jen.If(jen.Err().Op("!=").Nil()).Block(
-					jen.Return(jen.False(), jen.Err()),
+				jen.If(jen.Id("res").Dot("Allowed").Call()).Block(
+					jen.Return(jen.Id("res").Dot("CheckResult"), jen.Nil()),
 				),
-				jen.If(jen.Id("ok")).Block(
-					jen.Return(jen.True(), jen.Nil()),
+				jen.If(jen.Id("res").Dot("Conditional").Call()).Block(
+					jen.Id("result").Dot("Permissionship").Op("=").Qual(authzPkg, "PermissionshipConditional"),
+					jen.For(jen.Id("_").Op(",").Id("field").Op(":=").Range().Id("res").Dot("MissingFields")).Block(
+						jen.If(jen.Op("!").Qual("slices", "Contains").Call(jen.Id("result").Dot("MissingFields"), jen.Id("field"))).Block(
+							jen.Id("result").Dot("MissingFields").Op("=").Append(jen.Id("result").Dot("MissingFields"), jen.Id("field")),
+						),
+					),
 				),
 			),
-		)
-	}
-
-	body = append(body, jen.Return(jen.False(), jen.Nil()))
+		),
+		jen.Return(jen.Id("result"), jen.Nil()),
+	)
+	f.Line()
 
 	f.Commentf("%s checks if any subject has %s permission on this %s.", methodName, perm.Name, def.Name)
+	f.Comment("Conditional results are reported as not permitted.")
 	f.Func().Params(jen.Id(receiver).Id(typeName)).Id(methodName).Params(
 		jen.Id("ctx").Qual("context", "Context"),
 		jen.Id("subjects").Id(structName),
-	).Params(jen.Bool(), jen.Error()).Block(body...)
+	).Params(jen.Bool(), jen.Error()).Block(
+		jen.List(jen.Id("res"), jen.Err()).Op(":=").Id(receiver).Dot(resultMethodName).Call(
+			jen.Id("ctx"),
+			jen.Id("subjects"),
+			jen.Nil(),
+		),
+		jen.If(jen.Err().Op("!=").Nil()).Block(
+			jen.Return(jen.False(), jen.Err()),
+		),
+		jen.Return(jen.Id("res").Dot("Allowed").Call(), jen.Nil()),
+	)
+	f.Line()
+}
+
+// generateCheckManyFunction generates the package-level CheckMany{Type}sWith{Permission}
+// function, which checks many resources in bulk requests.
+func generateCheckManyFunction(f *jen.File, sc *scope, def *ast.Definition, perm *ast.Permission) {
+	typeName := naming.TypeStructName(sc.local(def.Name))
+	funcName := fmt.Sprintf("CheckMany%ssWith%s", typeName, naming.ToPascalCase(perm.Name))
+	structName := naming.CheckInputStructName(sc.local(def.Name), perm.Name)
+
+	f.Commentf("%s reports, for each resource, whether any subject has %s permission on it.", funcName, perm.Name)
+	f.Comment("The checks are sent in bulk requests of at most authz.MaxBulkCheckItems checks each.")
+	f.Comment("Conditional results are reported as not permitted.")
+	f.Func().Id(funcName).Params(
+		jen.Id("ctx").Qual("context", "Context"),
+		jen.Id("engine").Qual(authzPkg, "Engine"),
+		jen.Id("resources").Index().Id(typeName),
+		jen.Id("subjects").Id(structName),
+	).Params(jen.Index().Bool(), jen.Error()).Block(
+		jen.Id("allowed").Op(":=").Make(jen.Index().Bool(), jen.Len(jen.Id("resources"))),
+		jen.Var().Id("checks").Index().Qual(authzPkg, "PermissionCheck"),
+		jen.For(jen.Id("_").Op(",").Id("resource").Op(":=").Range().Id("resources")).Block(
+			jen.Id("checks").Op("=").Append(jen.Id("checks"), jen.Id("resource").Dot(checksMethodName(perm)).Call(jen.Id("subjects"), jen.Nil()).Op("...")),
+		),
+		jen.If(jen.Len(jen.Id("checks")).Op("==").Lit(0)).Block(
+			jen.Return(jen.Id("allowed"), jen.Nil()),
+		),
+		jen.Comment("Each resource contributes the same number of checks, one per subject."),
+		jen.Id("perResource").Op(":=").Len(jen.Id("checks")).Op("/").Len(jen.Id("resources")),
+		jen.For(
+			jen.Id("start").Op(":=").Lit(0),
+			jen.Id("start").Op("<").Len(jen.Id("checks")),
+			jen.Id("start").Op("+=").Qual(authzPkg, "MaxBulkCheckItems"),
+		).Block(
+			jen.Id("chunk").Op(":=").Id("checks").Index(
+				jen.Id("start"),
+				jen.Min(jen.Id("start").Op("+").Qual(authzPkg, "MaxBulkCheckItems"), jen.Len(jen.Id("checks"))),
+			),
+			jen.List(jen.Id("results"), jen.Err()).Op(":=").Id("engine").Dot("CheckBulkPermission").Call(jen.Id("ctx"), jen.Id("chunk")),
+			jen.If(jen.Err().Op("!=").Nil()).Block(
+				jen.Return(jen.Nil(), jen.Err()),
+			),
+			jen.For(jen.Id("i").Op(",").Id("result").Op(":=").Range().Id("results")).Block(
+				jen.If(jen.Id("result").Dot("Err").Op("!=").Nil()).Block(
+					jen.Return(jen.Nil(), jen.Id("result").Dot("Err")),
+				),
+				jen.If(jen.Id("result").Dot("Allowed").Call()).Block(
+					jen.Id("allowed").Index(jen.Parens(jen.Id("start").Op("+").Id("i")).Op("/").Id("perResource")).Op("=").True(),
+				),
+			),
+		),
+		jen.Return(jen.Id("allowed"), jen.Nil()),
+	)
 	f.Line()
 }
 
+// generateSubjectInterface generates the {Type}{Permission}Subject interface, which only
+// the subject types that can hold the permission implement.
+// The marker methods are generated here unless namespaces are split, in which case they are
+// generated alongside each subject type by generateSubjectMarkers.
+func generateSubjectInterface(f *jen.File, sc *scope, def *ast.Definition, perm *ast.Permission, subjectTypes []string) {
+	interfaceName := naming.SubjectInterfaceName(sc.local(def.Name), perm.Name)
+	markerName := sc.markerName(def, perm)
+
+	f.Commentf("%s is implemented by the subject types that can hold %s permission on %s.", interfaceName, perm.Name, def.Name)
+	f.Type().Id(interfaceName).Interface(
+		jen.Id(sc.resourceMethod()).Params().Qual(authzPkg, "Resource"),
+		jen.Id(markerName).Params(),
+	)
+	f.Line()
+
+	if sc.layout.split {
+		return
+	}
+	for _, st := range subjectTypes {
+		f.Func().Params(jen.Id(naming.TypeStructName(st))).Id(markerName).Params().Block()
+		f.Line()
+	}
+}
+
+// generateSubjectMarkers generates, for a split layout, the marker methods through which the
+// definition implements the subject interfaces of the permissions it can hold, which may be
+// declared in other packages.
+func generateSubjectMarkers(f *jen.File, sc *scope, schema *ast.Schema, def *ast.Definition, reach *analysis.Reachability) {
+	typeName := naming.TypeStructName(sc.local(def.Name))
+	for _, resource := range schema.Definitions {
+		for _, perm := range resource.Permissions {
+			if !slices.Contains(reach.SubjectTypes(resource.Name, perm.Name), def.Name) {
+				continue
+			}
+			markerName := sc.markerName(resource, perm)
+			f.Commentf("%s marks %s as a subject that can hold %s permission on %s.", markerName, typeName, perm.Name, resource.Name)
+			f.Func().Params(jen.Id(typeName)).Id(markerName).Params().Block()
+			f.Line()
+		}
+	}
+}
+
+// generateCanMethod generates the Can{Permission} and Can{Permission}Result methods, which
+// check a single subject of any type that can hold the permission.
+func generateCanMethod(f *jen.File, sc *scope, def *ast.Definition, perm *ast.Permission) {
+	typeName := naming.TypeStructName(sc.local(def.Name))
+	receiver := naming.ReceiverName(typeName)
+	methodName := "Can" + naming.ToPascalCase(perm.Name)
+	resultMethodName := methodName + "Result"
+	interfaceName := naming.SubjectInterfaceName(sc.local(def.Name), perm.Name)
+
+	f.Commentf("%s checks if the subject has %s permission on this %s. caveatContext may be nil.", resultMethodName, perm.Name, def.Name)
+	f.Func().Params(jen.Id(receiver).Id(typeName)).Id(resultMethodName).Params(
+		jen.Id("ctx").Qual("context", "Context"),
+		jen.Id("subject").Id(interfaceName),
+		jen.Id("caveatContext").Map(jen.String()).Any(),
+	).Params(jen.Qual(authzPkg, "CheckResult"), jen.Error()).Block(
+		jen.Id("sub").Op(":=").Id("subject").Dot(sc.resourceMethod()).Call(),
+		jen.Return(jen.Id(receiver).Dot("engine").Dot("CheckPermission").Call(
+			jen.Id("ctx"),
+			jen.Id(receiver).Dot(sc.resourceMethod()).Call(),
+			jen.Id(naming.PermissionConstName(sc.local(def.Name), perm.Name)),
+			jen.Id("sub").Dot("Type"),
+			jen.Id("sub").Dot("ID"),
+			jen.Id("caveatContext"),
+		)),
+	)
+	f.Line()
+
+	f.Commentf("%s checks if the subject has %s permission on this %s.", methodName, perm.Name, def.Name)
+	f.Comment("Conditional results are reported as not permitted.")
+	f.Func().Params(jen.Id(receiver).Id(typeName)).Id(methodName).Params(
+		jen.Id("ctx").Qual("context", "Context"),
+		jen.Id("subject").Id(interfaceName),
+	).Params(jen.Bool(), jen.Error()).Block(
+		jen.List(jen.Id("res"), jen.Err()).Op(":=").Id(receiver).Dot(resultMethodName).Call(
+			jen.Id("ctx"),
+			jen.Id("subject"),
+			jen.Nil(),
+		),
+		jen.If(jen.Err().Op("!=").Nil()).Block(
+			jen.Return(jen.False(), jen.Err()),
+		),
+		jen.Return(jen.Id("res").Dot("Allowed").Call(), jen.Nil()),
+	)
+	f.Line()
+}
+
+// generateSubjectLookupFunction generates the package-level Lookup{Type}sWith{Permission}
+// function, which finds resources for a subject of any type that can hold the permission.
+func generateSubjectLookupFunction(f *jen.File, sc *scope, def *ast.Definition, perm *ast.Permission, withRepository bool) {
+	typeName := naming.TypeStructName(sc.local(def.Name))
+	funcName := fmt.Sprintf("Lookup%ssWith%s", typeName, naming.ToPascalCase(perm.Name))
+
+	params := []jen.Code{
+		jen.Id("ctx").Qual("context", "Context"),
+		jen.Id("engine").Qual(authzPkg, "Engine"),
+		jen.Id("subject").Id(naming.SubjectInterfaceName(sc.local(def.Name), perm.Name)),
+	}
+	args := []jen.Code{
+		jen.String().Call(jen.Id("id")),
+		jen.Id("engine"),
+	}
+	if withRepository {
+		params = append(params, jen.Id("repo").Qual(authzPkg, "Repository"))
+		args = append(args, jen.Id("repo"))
+	}
+
+	f.Commentf("%s finds all %s resources where the subject has %s permission.", funcName, def.Name, perm.Name)
+	f.Func().Id(funcName).Params(params...).Params(jen.Index().Id(typeName), jen.Error()).Block(
+		jen.Id("sub").Op(":=").Id("subject").Dot(sc.resourceMethod()).Call(),
+		jen.List(jen.Id("ids"), jen.Err()).Op(":=").Id("engine").Dot("LookupResources").Call(
+			jen.Id("ctx"),
+			jen.Id(naming.TypeConstName(sc.local(def.Name))),
+			jen.Id(naming.PermissionConstName(sc.local(def.Name), perm.Name)),
+			jen.Id("sub").Dot("Type"),
+			jen.Id("sub").Dot("ID"),
+		),
+		jen.If(jen.Err().Op("!=").Nil()).Block(
+			jen.Return(jen.Nil(), jen.Err()),
+		),
+		jen.Id("result").Op(":=").Make(jen.Index().Id(typeName), jen.Len(jen.Id("ids"))),
+		jen.For(jen.Id("i").Op(",").Id("id").Op(":=").Range().Id("ids")).Block(
+			jen.Id("result").Index(jen.Id("i")).Op("=").Id("New"+typeName).Call(args...),
+		),
+		jen.Return(jen.Id("result"), jen.Nil()),
+	)
+	f.Line()
+}
+
+// generateFilterFunction generates the package-level Filter{Type}sBy{Permission} function,
+// which checks resources in bulk requests of at most authz.MaxBulkCheckItems checks.
+func generateFilterFunction(f *jen.File, sc *scope, def *ast.Definition, perm *ast.Permission) {
+	typeName := naming.TypeStructName(sc.local(def.Name))
+	funcName := fmt.Sprintf("Filter%ssBy%s", typeName, naming.ToPascalCase(perm.Name))
+
+	f.Commentf("%s returns the resources on which the subject has %s permission, in order.", funcName, perm.Name)
+	f.Comment("Conditional results are reported as not permitted.")
+	f.Func().Id(funcName).Params(
+		jen.Id("ctx").Qual("context", "Context"),
+		jen.Id("engine").Qual(authzPkg, "Engine"),
+		jen.Id("subject").Id(naming.SubjectInterfaceName(sc.local(def.Name), perm.Name)),
+		jen.Id("resources").Index().Id(typeName),
+	).Params(jen.Index().Id(typeName), jen.Error()).Block(
+		jen.Id("sub").Op(":=").Id("subject").Dot(sc.resourceMethod()).Call(),
+		jen.Var().Id("allowed").Index().Id(typeName),
+		jen.For(
+			jen.Id("start").Op(":=").Lit(0),
+			jen.Id("start").Op("<").Len(jen.Id("resources")),
+			jen.Id("start").Op("+=").Qual(authzPkg, "MaxBulkCheckItems"),
+		).Block(
+			jen.Id("chunk").Op(":=").Id("resources").Index(
+				jen.Id("start"),
+				jen.Min(jen.Id("start").Op("+").Qual(authzPkg, "MaxBulkCheckItems"), jen.Len(jen.Id("resources"))),
+			),
+			jen.Id("checks").Op(":=").Make(jen.Index().Qual(authzPkg, "PermissionCheck"), jen.Len(jen.Id("chunk"))),
+			jen.For(jen.Id("i").Op(",").Id("resource").Op(":=").Range().Id("chunk")).Block(
+				jen.Id("checks").Index(jen.Id("i")).Op("=").Qual(authzPkg, "PermissionCheck").Values(jen.Dict{
+					jen.Id("Resource"):    jen.Id("resource").Dot(sc.resourceMethod()).Call(),
+					jen.Id("Permission"):  jen.Id(naming.PermissionConstName(sc.local(def.Name), perm.Name)),
+					jen.Id("SubjectType"): jen.Id("sub").Dot("Type"),
+					jen.Id("SubjectID"):   jen.Id("sub").Dot("ID"),
+				}),
+			),
+			jen.List(jen.Id("results"), jen.Err()).Op(":=").Id("engine").Dot("CheckBulkPermission").Call(jen.Id("ctx"), jen.Id("checks")),
+			jen.If(jen.Err().Op("!=").Nil()).Block(
+				jen.Return(jen.Nil(), jen.Err()),
+			),
+			jen.For(jen.Id("i").Op(",").Id("result").Op(":=").Range().Id("results")).Block(
+				jen.If(jen.Id("result").Dot("Err").Op("!=").Nil()).Block(
+					jen.Return(jen.Nil(), jen.Id("result").Dot("Err")),
+				),
+				jen.If(jen.Id("result").Dot("Allowed").Call()).Block(
+					jen.Id("allowed").Op("=").Append(jen.Id("allowed"), jen.Id("chunk").Index(jen.Id("i"))),
+				),
+			),
+		),
+		jen.Return(jen.Id("allowed"), jen.Nil()),
+	)
+	f.Line()
+}
+
+func checksMethodName(perm *ast.Permission) string {
+	return naming.ToCamelCase(perm.Name) + "Checks"
+}
+
 // generateLookupMethods generates LookupResources and LookupSubjects methods.
-func generateLookupMethods(f *jen.File, def *ast.Definition, perm *ast.Permission, subjectTypes []string, generatedLookups map[string]bool, withRepository bool) {
-	typeName := naming.TypeStructName(def.Name)
+func generateLookupMethods(f *jen.File, sc *scope, def *ast.Definition, perm *ast.Permission, subjectTypes []string, generatedLookups map[string]bool, withRepository bool) {
+	typeName := naming.TypeStructName(sc.local(def.Name))
 	receiver := naming.ReceiverName(typeName)
-	permConst := naming.PermissionConstName(def.Name, perm.Name)
-	typeConst := naming.TypeConstName(def.Name)
+	permConst := naming.PermissionConstName(sc.local(def.Name), perm.Name)
+	typeConst := naming.TypeConstName(sc.local(def.Name))
 
+	names := sc.subjectNames(subjectTypes)
 	for _, st := range subjectTypes {
-		subjectTypeName := naming.TypeStructName(st)
-		subjectTypeConst := naming.TypeConstName(st)
+		subjectTypeName := names[st]
+		subjectType := sc.typeStruct(st)
+		subjectTypeConst := sc.typeConst(st)
 
 		// LookupResources — package-level function
 		lookupResKey := fmt.Sprintf("LookupResources_%s_%s_%s", def.Name, perm.Name, st)
@@ -115,7 +411,7 @@ func generateLookupMethods(f *jen.File, def *ast.Definition, perm *ast.Permissio
 			params := []jen.Code{
 				jen.Id("ctx").Qual("context", "Context"),
 				jen.Id("engine").Qual(authzPkg, "Engine"),
-				jen.Id("subject").Id(subjectTypeName),
+				jen.Id("subject").Add(subjectType),
 			}
 			newResourceCall := jen.Id("New"+typeName).Call(
 				jen.String().Call(jen.Id("id")),
@@ -136,8 +432,8 @@ func generateLookupMethods(f *jen.File, def *ast.Definition, perm *ast.Permissio
 					jen.Id("ctx"),
 					jen.Id(typeConst),
 					jen.Id(permConst),
-					jen.Id(subjectTypeConst),
-					jen.Qual(authzPkg, "ID").Call(jen.Id("subject").Dot("id")),
+					subjectTypeConst,
+					jen.Qual(authzPkg, "ID").Call(sc.id(jen.Id("subject"))),
 				),
 				jen.If(jen.Err().Op("!=").Nil()).Block(
 					jen.Return(jen.Nil(), jen.Err()),
@@ -149,6 +445,47 @@ func generateLookupMethods(f *jen.File, def *ast.Definition, perm *ast.Permissio
 				jen.Return(jen.Id("result"), jen.Nil()),
 			)
 			f.Line()
+
+			seqName := funcName + "Seq"
+			f.Commentf("%s streams the %s resources where the subject has %s permission.", seqName, def.Name, perm.Name)
+			f.Func().Id(seqName).Params(params...).Qual("iter", "Seq2").Types(jen.Id(typeName), jen.Error()).Block(
+				jen.Return(lookupSeq(jen.Id(typeName), newResourceCall, jen.Id("engine").Dot("LookupResourcesSeq").Call(
+					jen.Id("ctx"),
+					jen.Id(typeConst),
+					jen.Id(permConst),
+					subjectTypeConst,
+					jen.Qual(authzPkg, "ID").Call(sc.id(jen.Id("subject"))),
+				))),
+			)
+			f.Line()
+
+			pageName := funcName + "Page"
+			pageParams := append(params,
+				jen.Id("limit").Uint32(),
+				jen.Id("cursor").Qual(authzPkg, "Cursor"),
+			)
+			f.Commentf("%s returns up to limit %s resources where the subject has %s permission,", pageName, def.Name, perm.Name)
+			f.Comment("starting after cursor, and the cursor of the next page, which is empty after the last page.")
+			f.Func().Id(pageName).Params(pageParams...).Params(jen.Index().Id(typeName), jen.Qual(authzPkg, "Cursor"), jen.Error()).Block(
+				jen.List(jen.Id("ids"), jen.Id("next"), jen.Err()).Op(":=").Id("engine").Dot("LookupResourcesPage").Call(
+					jen.Id("ctx"),
+					jen.Id(typeConst),
+					jen.Id(permConst),
+					subjectTypeConst,
+					jen.Qual(authzPkg, "ID").Call(sc.id(jen.Id("subject"))),
+					jen.Id("limit"),
+					jen.Id("cursor"),
+				),
+				jen.If(jen.Err().Op("!=").Nil()).Block(
+					jen.Return(jen.Nil(), jen.Lit(""), jen.Err()),
+				),
+				jen.Id("result").Op(":=").Make(jen.Index().Id(typeName), jen.Len(jen.Id("ids"))),
+				jen.For(jen.Id("i").Op(",").Id("id").Op(":=").Range().Id("ids")).Block(
+					jen.Id("result").Index(jen.Id("i")).Op("=").Add(newResourceCall),
+				),
+				jen.Return(jen.Id("result"), jen.Id("next"), jen.Nil()),
+			)
+			f.Line()
 		}
 
 		// LookupSubjects — method on the resource
@@ -157,28 +494,58 @@ func generateLookupMethods(f *jen.File, def *ast.Definition, perm *ast.Permissio
 			generatedLookups[lookupSubKey] = true
 
 			methodName := fmt.Sprintf("Lookup%ssWith%s", subjectTypeName, naming.ToPascalCase(perm.Name))
-			newSubjectCall := newEntityCall(subjectTypeName, receiver, withRepository)
+			newSubjectCall := newEntityCall(sc, st, receiver, withRepository)
 
 			f.Commentf("%s finds all %s subjects that have %s permission on this %s.", methodName, st, perm.Name, def.Name)
 			f.Func().Params(jen.Id(receiver).Id(typeName)).Id(methodName).Params(
 				jen.Id("ctx").Qual("context", "Context"),
-			).Params(jen.Index().Id(subjectTypeName), jen.Error()).Block(
+			).Params(jen.Index().Add(subjectType), jen.Error()).Block(
 				jen.List(jen.Id("ids"), jen.Err()).Op(":=").Id(receiver).Dot("engine").Dot("LookupSubjects").Call(
 					jen.Id("ctx"),
-					jen.Id(receiver).Dot("resource").Call(),
+					jen.Id(receiver).Dot(sc.resourceMethod()).Call(),
 					jen.Id(permConst),
-					jen.Id(subjectTypeConst),
+					subjectTypeConst,
 				),
 				jen.If(jen.Err().Op("!=").Nil()).Block(
 					jen.Return(jen.Nil(), jen.Err()),
 				),
-				jen.Id("result").Op(":=").Make(jen.Index().Id(subjectTypeName), jen.Len(jen.Id("ids"))),
+				jen.Id("result").Op(":=").Make(jen.Index().Add(subjectType), jen.Len(jen.Id("ids"))),
 				jen.For(jen.Id("i").Op(",").Id("id").Op(":=").Range().Id("ids")).Block(
 					jen.Id("result").Index(jen.Id("i")).Op("=").Add(newSubjectCall),
 				),
 				jen.Return(jen.Id("result"), jen.Nil()),
 			)
 			f.Line()
+
+			seqName := methodName + "Seq"
+			f.Commentf("%s streams the %s subjects that have %s permission on this %s.", seqName, st, perm.Name, def.Name)
+			f.Func().Params(jen.Id(receiver).Id(typeName)).Id(seqName).Params(
+				jen.Id("ctx").Qual("context", "Context"),
+			).Qual("iter", "Seq2").Types(subjectType, jen.Error()).Block(
+				jen.Return(lookupSeq(subjectType, newSubjectCall, jen.Id(receiver).Dot("engine").Dot("LookupSubjectsSeq").Call(
+					jen.Id("ctx"),
+					jen.Id(receiver).Dot(sc.resourceMethod()).Call(),
+					jen.Id(permConst),
+					subjectTypeConst,
+				))),
+			)
+			f.Line()
 		}
 	}
 }
+
+// lookupSeq returns an iterator that converts each ID yielded by ids to entityType with
+// newCall, which refers to the ID as id.
+func lookupSeq(entityType *jen.Statement, newCall jen.Code, ids *jen.Statement) *jen.Statement {
+	return jen.Func().Params(jen.Id("yield").Func().Params(entityType.Clone(), jen.Error()).Bool()).Block(
+		jen.For(jen.Id("id").Op(",").Err().Op(":=").Range().Add(ids)).Block(
+			jen.If(jen.Err().Op("!=").Nil()).Block(
+				jen.Id("yield").Call(entityType.Clone().Values(), jen.Err()),
+				jen.Return(),
+			),
+			jen.If(jen.Op("!").Id("yield").Call(newCall, jen.Nil())).Block(
+				jen.Return(),
+			),
+		),
+	)
+}
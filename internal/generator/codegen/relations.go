@@ -1,6 +1,8 @@
 package codegen
 
 import (
+	"fmt"
+	"slices"
 	"strings"
 
 	"github.com/dave/jennifer/jen"
@@ -9,118 +11,671 @@ import (
 )
 
 // generateRelationMethods generates input structs and Create/Read/Delete methods for each relation.
-func generateRelationMethods(f *jen.File, def *ast.Definition, withRepository bool) {
+// The plain methods only take the subject types that may be written without a caveat; relations
+// whose subject types all require a caveat are written and deleted through the With{Caveat}
+// methods and read with Read{Relation}RelationsDetailed.
+func generateRelationMethods(f *jen.File, sc *scope, def *ast.Definition, withRepository bool) {
 	for _, rel := range def.Relations {
-		generateRelationObjectsStruct(f, def, rel)
-		generateRelationMutation(f, def, rel, "Create")
-		generateReadRelation(f, def, rel, withRepository)
-		generateRelationMutation(f, def, rel, "Delete")
+		plain := len(caveatSubjectTypes(rel, "")) > 0
+		if plain {
+			generateRelationObjectsStruct(f, sc, def, rel)
+			generateRelationMutation(f, sc, def, rel, "Create")
+			generateRelationMutation(f, sc, def, rel, "Touch")
+			generateReadRelation(f, sc, def, rel, withRepository)
+		}
+		generateRelationshipStruct(f, sc, def, rel)
+		generateReadRelationDetailed(f, sc, def, rel, withRepository)
+		if plain {
+			generateRelationMutation(f, sc, def, rel, "Delete")
+
+			generateTxRelationWrite(f, sc, def, rel, "Create", "")
+			generateTxRelationWrite(f, sc, def, rel, "Touch", "")
+			generateTxRelationWrite(f, sc, def, rel, "Delete", "")
+		}
+		generatePreconditionBuilders(f, sc, def, rel, plain)
+
+		for _, caveat := range relationCaveats(rel) {
+			generateCaveatedRelationObjectsStruct(f, sc, def, rel, caveat)
+			generateCaveatedRelationWrite(f, sc, def, rel, caveat, "Create")
+			generateCaveatedRelationWrite(f, sc, def, rel, caveat, "Touch")
+			generateCaveatedRelationWrite(f, sc, def, rel, caveat, "Delete")
+			generateTxRelationWrite(f, sc, def, rel, "Create", caveat)
+			generateTxRelationWrite(f, sc, def, rel, "Touch", caveat)
+			generateTxRelationWrite(f, sc, def, rel, "Delete", caveat)
+		}
 	}
 }
 
-// generateRelationObjectsStruct generates the input struct for a relation's subject types.
-func generateRelationObjectsStruct(f *jen.File, def *ast.Definition, rel *ast.Relation) {
-	structName := naming.RelationObjectsStructName(def.Name, rel.Name)
+// subjectField describes one field of a relation objects struct.
+type subjectField struct {
+	TypeName       string      // subject type, e.g. "group"
+	Relation       string      // subject relation, e.g. "member" for "group#member"; empty for direct subjects
+	Name           string      // struct field name, e.g. "Group" or "GroupMember"
+	StructName     string      // identifier of the subject type, e.g. "Group"
+	Wildcard       bool        // true if a {Name}Wildcard bool field accompanies the slice
+	Expiry         expiryModes // how the subjects of the slice may be written
+	WildcardExpiry expiryModes // how the wildcard subject may be written
+}
 
-	var fields []jen.Code
-	for _, st := range rel.SubjectTypes {
-		fieldName := naming.TypeStructName(st.TypeName)
-		fields = append(fields, jen.Id(fieldName).Index().Id(fieldName))
+// expiryModes records whether the relationships of a subject may be written without an expiry,
+// with one, or both, as allowed by the `with expiration` trait of its subject types.
+type expiryModes uint8
+
+const (
+	withoutExpiry expiryModes = 1 << iota
+	withExpiry
+)
+
+// expires reports whether the relationships may be written with an expiry.
+func (m expiryModes) expires() bool {
+	return m&withExpiry != 0
+}
+
+// required reports whether the relationships must be written with an expiry.
+func (m expiryModes) required() bool {
+	return m == withExpiry
+}
+
+// arg returns the expiry passed to the engine: the method's expiresAt parameter for subjects
+// that may expire, otherwise the zero time.
+func (m expiryModes) arg() jen.Code {
+	if m.expires() {
+		return jen.Id("expiresAt")
+	}
+	return jen.Qual("time", "Time").Values()
+}
+
+// collectSubjectFields returns one field per unique subject type and subject relation,
+// merging wildcard variants.
+func collectSubjectFields(sc *scope, subjectTypes []*ast.SubjectType) []subjectField {
+	index := make(map[string]int)
+	var fields []subjectField
+	names := sc.subjectNames(uniqueSubjectTypes(subjectTypes))
+
+	for _, st := range subjectTypes {
+		key := st.TypeName + "#" + st.Relation
+		i, ok := index[key]
+		if !ok {
+			i = len(fields)
+			index[key] = i
+			fields = append(fields, subjectField{
+				TypeName:   st.TypeName,
+				Relation:   st.Relation,
+				Name:       names[st.TypeName] + naming.ToPascalCase(st.Relation),
+				StructName: names[st.TypeName],
+			})
+		}
+
+		mode := withoutExpiry
+		if st.Expiration {
+			mode = withExpiry
+		}
 		if st.IsWildcard {
-			fields = append(fields, jen.Id(fieldName+"Wildcard").Bool())
+			fields[i].Wildcard = true
+			fields[i].WildcardExpiry |= mode
+		} else {
+			fields[i].Expiry |= mode
 		}
 	}
 
+	return fields
+}
+
+// caveatSubjectTypes returns the subject types that may be written with the given caveat, or
+// without a caveat for an empty caveat.
+func caveatSubjectTypes(rel *ast.Relation, caveat string) []*ast.SubjectType {
+	var subjectTypes []*ast.SubjectType
+	for _, st := range rel.SubjectTypes {
+		if st.Caveat == caveat {
+			subjectTypes = append(subjectTypes, st)
+		}
+	}
+	return subjectTypes
+}
+
+// caveatSubjectFields returns the subject fields that may be written with the given caveat, or
+// without a caveat for an empty caveat.
+func caveatSubjectFields(sc *scope, rel *ast.Relation, caveat string) []subjectField {
+	return collectSubjectFields(sc, caveatSubjectTypes(rel, caveat))
+}
+
+// expires reports whether any of the subject types is written with an expiration.
+func expires(subjectTypes []*ast.SubjectType) bool {
+	for _, st := range subjectTypes {
+		if st.Expiration {
+			return true
+		}
+	}
+	return false
+}
+
+// expiryDoc returns the comment lines that document the expiresAt parameter of a write of the
+// subject fields. Subjects of types declared only `with expiration` must expire, so a zero
+// expiresAt is rejected for them.
+func expiryDoc(fields []subjectField) []string {
+	var required, optional, never []string
+	add := func(name string, m expiryModes) {
+		switch {
+		case m.required():
+			required = append(required, name)
+		case m.expires():
+			optional = append(optional, name)
+		case m != 0:
+			never = append(never, name)
+		}
+	}
+	for _, sf := range fields {
+		name := sf.TypeName
+		if sf.Relation != "" {
+			name += "#" + sf.Relation
+		}
+		add(name, sf.Expiry)
+		if sf.Wildcard {
+			add(sf.TypeName+":*", sf.WildcardExpiry)
+		}
+	}
+
+	switch {
+	case len(required) == 0 && len(never) == 0:
+		return []string{"The relations expire at expiresAt; a zero expiresAt creates relations that do not expire."}
+	case len(optional) == 0 && len(never) == 0:
+		return []string{"The relations expire at expiresAt, which must not be zero."}
+	}
+	var lines []string
+	if len(required) > 0 {
+		lines = append(lines, fmt.Sprintf("Relations of %s subjects expire at expiresAt, which must not be zero.", strings.Join(required, ", ")))
+	}
+	if len(optional) > 0 {
+		lines = append(lines, fmt.Sprintf("Relations of %s subjects expire at expiresAt; a zero expiresAt creates relations that do not expire.", strings.Join(optional, ", ")))
+	}
+	if len(never) > 0 {
+		lines = append(lines, fmt.Sprintf("Relations of %s subjects do not expire.", strings.Join(never, ", ")))
+	}
+	return lines
+}
+
+// requireExpiry returns a check that rejects a zero expiresAt if the subjects include any that
+// must expire, or nil if none of the fields requires an expiry.
+func requireExpiry(fields []subjectField, method string) jen.Code {
+	var names []string
+	var populated *jen.Statement
+	or := func(cond *jen.Statement) {
+		if populated == nil {
+			populated = cond
+		} else {
+			populated = populated.Op("||").Add(cond)
+		}
+	}
+	for _, sf := range fields {
+		if sf.Expiry.required() {
+			name := sf.TypeName
+			if sf.Relation != "" {
+				name += "#" + sf.Relation
+			}
+			names = append(names, name)
+			or(jen.Len(jen.Id("subjects").Dot(sf.Name)).Op(">").Lit(0))
+		}
+		if sf.Wildcard && sf.WildcardExpiry.required() {
+			names = append(names, sf.TypeName+":*")
+			or(jen.Id("subjects").Dot(sf.Name + "Wildcard"))
+		}
+	}
+	if populated == nil {
+		return nil
+	}
+
+	if len(names) > 1 {
+		populated = jen.Parens(populated)
+	}
+	message := fmt.Sprintf("%s: expiresAt must not be zero for %s subjects", method, strings.Join(names, ", "))
+	return jen.If(jen.Id("expiresAt").Dot("IsZero").Call().Op("&&").Add(populated)).Block(
+		jen.Return(jen.Lit(""), jen.Qual("errors", "New").Call(jen.Lit(message))),
+	)
+}
+
+// generateRelationObjectsStruct generates the input struct for a relation's subject types that
+// may be written without a caveat.
+func generateRelationObjectsStruct(f *jen.File, sc *scope, def *ast.Definition, rel *ast.Relation) {
+	structName := naming.RelationObjectsStructName(sc.local(def.Name), rel.Name)
+
 	f.Commentf("%s holds subjects for %s relation operations.", structName, rel.Name)
-	f.Type().Id(structName).Struct(fields...)
+	f.Type().Id(structName).Struct(subjectStructFields(sc, caveatSubjectFields(sc, rel, ""))...)
+	f.Line()
+}
+
+// generateCaveatedRelationObjectsStruct generates the input struct for subjects written with a caveat.
+func generateCaveatedRelationObjectsStruct(f *jen.File, sc *scope, def *ast.Definition, rel *ast.Relation, caveat string) {
+	structName := naming.CaveatedRelationObjectsStructName(sc.local(def.Name), rel.Name, sc.local(caveat))
+
+	f.Commentf("%s holds subjects for %s relations written with the %s caveat.", structName, rel.Name, caveat)
+	f.Type().Id(structName).Struct(subjectStructFields(sc, caveatSubjectFields(sc, rel, caveat))...)
 	f.Line()
 }
 
-// generateRelationMutation generates a Create or Delete {Relation}Relations method.
-// op must be "Create" or "Delete".
-func generateRelationMutation(f *jen.File, def *ast.Definition, rel *ast.Relation, op string) {
-	typeName := naming.TypeStructName(def.Name)
+func subjectStructFields(sc *scope, subjectFields []subjectField) []jen.Code {
+	var fields []jen.Code
+	for _, sf := range subjectFields {
+		fields = append(fields, jen.Id(sf.Name).Index().Add(sc.typeStruct(sf.TypeName)))
+		if sf.Wildcard {
+			fields = append(fields, jen.Id(sf.Name+"Wildcard").Bool())
+		}
+	}
+	return fields
+}
+
+// generateRelationMutation generates a Create, Touch or Delete {Relation}Relations method.
+// op must be "Create", "Touch" or "Delete".
+func generateRelationMutation(f *jen.File, sc *scope, def *ast.Definition, rel *ast.Relation, op string) {
+	typeName := naming.TypeStructName(sc.local(def.Name))
 	receiver := naming.ReceiverName(typeName)
 	methodName := op + naming.ToPascalCase(rel.Name) + "Relations"
-	structName := naming.RelationObjectsStructName(def.Name, rel.Name)
-	relConst := naming.RelationConstName(def.Name, rel.Name)
-	engineMethod := op + "Relations"
+	structName := naming.RelationObjectsStructName(sc.local(def.Name), rel.Name)
+
+	params := []jen.Code{
+		jen.Id("ctx").Qual("context", "Context"),
+		jen.Id("subjects").Id(structName),
+	}
+	fields := caveatSubjectFields(sc, rel, "")
+	expiring := op != "Delete" && expires(caveatSubjectTypes(rel, ""))
+	if expiring {
+		params = append(params, jen.Id("expiresAt").Qual("time", "Time"))
+	}
+	params = append(params, preconditionsParam())
+
+	body := relationMutationBody(sc, def, rel, fields, op, methodName, nil)
+
+	f.Commentf("%s %s %s relations for this %s and returns the ZedToken of the write.", methodName, writeOpVerbs[op], rel.Name, def.Name)
+	if expiring {
+		for _, line := range expiryDoc(fields) {
+			f.Comment(line)
+		}
+	}
+	f.Comment(preconditionsDoc)
+	f.Func().Params(jen.Id(receiver).Id(typeName)).Id(methodName).Params(params...).
+		Params(jen.Qual(authzPkg, "ZedToken"), jen.Error()).Block(body...)
+	f.Line()
+}
+
+// preconditionsDoc documents the atomic write of generated mutation methods and their
+// preconditions parameter.
+const preconditionsDoc = "All subjects are written atomically, and only if all preconditions hold; otherwise it fails with an *authz.PreconditionFailedError."
+
+func preconditionsParam() jen.Code {
+	return jen.Id("preconditions").Op("...").Qual(authzPkg, "Precondition")
+}
+
+// generateCaveatedRelationWrite generates the Create, Touch or Delete {Relation}RelationsWith{Caveat}
+// method. op must be "Create", "Touch" or "Delete".
+func generateCaveatedRelationWrite(f *jen.File, sc *scope, def *ast.Definition, rel *ast.Relation, caveat, op string) {
+	typeName := naming.TypeStructName(sc.local(def.Name))
+	receiver := naming.ReceiverName(typeName)
+	methodName := op + naming.ToPascalCase(rel.Name) + "RelationsWith" + naming.ToPascalCase(sc.local(caveat))
+	structName := naming.CaveatedRelationObjectsStructName(sc.local(def.Name), rel.Name, sc.local(caveat))
+
+	params := []jen.Code{
+		jen.Id("ctx").Qual("context", "Context"),
+		jen.Id("subjects").Id(structName),
+	}
+	fields := caveatSubjectFields(sc, rel, caveat)
+	expiring := op != "Delete" && expires(caveatSubjectTypes(rel, caveat))
+	if op != "Delete" {
+		params = append(params, jen.Id("caveatContext").Add(sc.caveatContext(caveat)))
+	}
+	if expiring {
+		params = append(params, jen.Id("expiresAt").Qual("time", "Time"))
+	}
+	params = append(params, preconditionsParam())
+
+	body := relationMutationBody(sc, def, rel, fields, op, methodName, jen.Id("caveatContext").Dot(sc.caveatMethod()).Call())
+
+	if op == "Delete" {
+		f.Commentf("%s %s %s relations of this %s written with the %s caveat.", methodName, writeOpVerbs[op], rel.Name, def.Name, caveat)
+	} else {
+		f.Commentf("%s %s %s relations for this %s guarded by the %s caveat.", methodName, writeOpVerbs[op], rel.Name, def.Name, caveat)
+	}
+	if expiring {
+		for _, line := range expiryDoc(fields) {
+			f.Comment(line)
+		}
+	}
+	f.Comment(preconditionsDoc)
+	f.Func().Params(jen.Id(receiver).Id(typeName)).Id(methodName).Params(params...).
+		Params(jen.Qual(authzPkg, "ZedToken"), jen.Error()).Block(body...)
+	f.Line()
+}
+
+// relationMutationBody builds a body that applies the {op} of all subjects together with the
+// preconditions in one atomic write. The subjects of a single field are passed to the engine's
+// {op}Relations; otherwise one update per subject is collected in an authz.WriteBatch for
+// WriteRelationships. Create and Touch write caveat, which is nil for uncaveated relations,
+// and reject a zero expiresAt for subjects that must expire.
+func relationMutationBody(sc *scope, def *ast.Definition, rel *ast.Relation, fields []subjectField, op, methodName string, caveat jen.Code) []jen.Code {
+	receiver := naming.ReceiverName(naming.TypeStructName(sc.local(def.Name)))
+	expiring := op != "Delete" && slices.ContainsFunc(fields, func(sf subjectField) bool {
+		return sf.Expiry.expires() || sf.WildcardExpiry.expires()
+	})
 
 	var body []jen.Code
-	for _, st := range rel.SubjectTypes {
-		fieldName := naming.TypeStructName(st.TypeName)
-		typeConst := naming.TypeConstName(st.TypeName)
-		wildcardField := fieldName + "Wildcard"
+	if op != "Delete" {
+		if check := requireExpiry(fields, methodName); check != nil {
+			body = append(body, check)
+		}
+	}
 
-		body = append(body,
-			jen.If(jen.Len(jen.Id("subjects").Dot(fieldName)).Op(">").Lit(0)).Block(
-				jen.Id("ids").Op(":=").Make(jen.Index().Qual(authzPkg, "ID"), jen.Len(jen.Id("subjects").Dot(fieldName))),
-				jen.For(jen.Id("i").Op(",").Id("s").Op(":=").Range().Id("subjects").Dot(fieldName)).Block(
-					jen.Id("ids").Index(jen.Id("i")).Op("=").Qual(authzPkg, "ID").Call(jen.Id("s").Dot("id")),
-				),
-				jen.If(
-					jen.Err().Op(":=").Id(receiver).Dot("engine").Dot(engineMethod).Call(
-						jen.Id("ctx"),
-						jen.Id(receiver).Dot("resource").Call(),
-						jen.Id(relConst),
-						jen.Id(typeConst),
-						jen.Id("ids"),
-					),
-					jen.Err().Op("!=").Nil(),
-				).Block(
-					jen.Return(jen.Err()),
-				),
+	if len(fields) == 1 && !fields[0].Wildcard {
+		sf := fields[0]
+		args := []jen.Code{
+			jen.Id("ctx"),
+			jen.Id(receiver).Dot(sc.resourceMethod()).Call(),
+			jen.Id(naming.RelationConstName(sc.local(def.Name), rel.Name)),
+			sc.typeConst(sf.TypeName),
+			subjectRelationArg(sf),
+			jen.Id("ids"),
+		}
+		if op != "Delete" {
+			if caveat == nil {
+				caveat = jen.Nil()
+			}
+			args = append(args, caveat, sf.Expiry.arg())
+		}
+		args = append(args, jen.Id("preconditions").Op("..."))
+
+		return append(body,
+			jen.If(jen.Len(jen.Id("subjects").Dot(sf.Name)).Op("==").Lit(0)).Block(
+				jen.Return(jen.Lit(""), jen.Nil()),
+			),
+			jen.Id("ids").Op(":=").Make(jen.Index().Qual(authzPkg, "ID"), jen.Len(jen.Id("subjects").Dot(sf.Name))),
+			jen.For(jen.Id("i").Op(",").Id("s").Op(":=").Range().Id("subjects").Dot(sf.Name)).Block(
+				jen.Id("ids").Index(jen.Id("i")).Op("=").Qual(authzPkg, "ID").Call(sc.id(jen.Id("s"))),
 			),
+			jen.Return(jen.Id(receiver).Dot("engine").Dot(op+"Relations").Call(args...)),
 		)
+	}
 
-		if st.IsWildcard {
+	body = append(body, jen.Var().Id("batch").Qual(authzPkg, "WriteBatch"))
+	body = append(body, relationshipWrites(sc, def, rel, fields, op, jen.Id("batch"), jen.Id(receiver).Dot(sc.resourceMethod()).Call(), caveat, expiring)...)
+	return append(body,
+		jen.If(jen.Id("batch").Dot("Len").Call().Op("==").Lit(0)).Block(
+			jen.Return(jen.Lit(""), jen.Nil()),
+		),
+		jen.Return(jen.Id(receiver).Dot("engine").Dot("WriteRelationships").Call(
+			jen.Id("ctx"),
+			jen.Id("batch").Dot("Updates").Call(),
+			jen.Id("preconditions").Op("..."),
+		)),
+	)
+}
+
+// relationshipWrites builds the statements that add an {op} update of the relation of resource to
+// batch for each subject of the fields. Create and Touch updates carry caveat unless it is nil,
+// and expiresAt for the subjects that may expire if expiring is set.
+func relationshipWrites(sc *scope, def *ast.Definition, rel *ast.Relation, fields []subjectField, op string, batch, resource, caveat jen.Code, expiring bool) []jen.Code {
+	write := func(sf subjectField, id jen.Code, expiry expiryModes) jen.Code {
+		relationship := jen.Dict{
+			jen.Id("Resource"):    resource,
+			jen.Id("Relation"):    jen.Id(naming.RelationConstName(sc.local(def.Name), rel.Name)),
+			jen.Id("SubjectType"): sc.typeConst(sf.TypeName),
+			jen.Id("SubjectID"):   id,
+		}
+		if sf.Relation != "" {
+			relationship[jen.Id("SubjectRelation")] = subjectRelationArg(sf)
+		}
+		if caveat != nil && op != "Delete" {
+			relationship[jen.Id("Caveat")] = caveat
+		}
+		if expiring && expiry.expires() {
+			relationship[jen.Id("ExpiresAt")] = jen.Id("expiresAt")
+		}
+		return jen.Add(batch).Dot(op).Call(jen.Qual(authzPkg, "RelationshipObject").Values(relationship))
+	}
+
+	var writes []jen.Code
+	for _, sf := range fields {
+		writes = append(writes,
+			jen.For(jen.Id("_").Op(",").Id("s").Op(":=").Range().Id("subjects").Dot(sf.Name)).Block(
+				write(sf, jen.Qual(authzPkg, "ID").Call(sc.id(jen.Id("s"))), sf.Expiry),
+			),
+		)
+		if sf.Wildcard {
+			writes = append(writes,
+				jen.If(jen.Id("subjects").Dot(sf.Name+"Wildcard")).Block(
+					write(sf, jen.Qual(authzPkg, "ID").Call(jen.Lit("*")), sf.WildcardExpiry),
+				),
+			)
+		}
+	}
+	return writes
+}
+
+// writeOpVerbs describes what each write operation does, for generated doc comments.
+var writeOpVerbs = map[string]string{
+	"Create": "creates",
+	"Touch":  "creates or overwrites",
+	"Delete": "deletes",
+}
+
+// generateTxRelationWrite generates a Tx.{Op}{Definition}{Relation}Relations method that adds
+// writes to the transaction instead of writing them immediately. op must be "Create", "Touch"
+// or "Delete"; a non-empty caveat generates the ...With{Caveat} variant.
+func generateTxRelationWrite(f *jen.File, sc *scope, def *ast.Definition, rel *ast.Relation, op, caveat string) {
+	typeName := naming.TypeStructName(sc.local(def.Name))
+	methodName := op + typeName + naming.ToPascalCase(rel.Name) + "Relations"
+	structName := naming.RelationObjectsStructName(sc.local(def.Name), rel.Name)
+	if caveat != "" {
+		methodName += "With" + naming.ToPascalCase(sc.local(caveat))
+		structName = naming.CaveatedRelationObjectsStructName(sc.local(def.Name), rel.Name, sc.local(caveat))
+	}
+	fields := caveatSubjectFields(sc, rel, caveat)
+	subjectTypes := caveatSubjectTypes(rel, caveat)
+
+	params := []jen.Code{
+		jen.Id("resource").Id(typeName),
+		jen.Id("subjects").Id(structName),
+	}
+	var caveatArg jen.Code
+	if caveat != "" && op != "Delete" {
+		params = append(params, jen.Id("caveatContext").Add(sc.caveatContext(caveat)))
+		caveatArg = jen.Id("caveatContext").Dot(sc.caveatMethod()).Call()
+	}
+	expiring := op != "Delete" && expires(subjectTypes)
+	if expiring {
+		params = append(params, jen.Id("expiresAt").Qual("time", "Time"))
+	}
+
+	body := relationshipWrites(sc, def, rel, fields, op, jen.Id("tx").Dot("batch"), jen.Id("resource").Dot(sc.resourceMethod()).Call(), caveatArg, expiring)
+	body = append(body, jen.Return(jen.Id("tx")))
+
+	switch {
+	case caveat == "":
+		f.Commentf("%s %s %s relations of resource when the transaction commits.", methodName, writeOpVerbs[op], rel.Name)
+	case op == "Delete":
+		f.Commentf("%s %s %s relations of resource written with the %s caveat when the transaction commits.", methodName, writeOpVerbs[op], rel.Name, caveat)
+	default:
+		f.Commentf("%s %s %s relations of resource guarded by the %s caveat when the transaction commits.", methodName, writeOpVerbs[op], rel.Name, caveat)
+	}
+	if expiring {
+		for _, line := range expiryDoc(fields) {
+			f.Comment(line)
+		}
+	}
+	f.Func().Params(jen.Id("tx").Op("*").Id("Tx")).Id(methodName).Params(params...).Op("*").Id("Tx").Block(body...)
+	f.Line()
+}
+
+// generatePreconditionBuilders generates the RequireAny{Relation}, RequireNo{Relation},
+// Require{Relation}Subjects and RequireNo{Relation}Subjects methods, which build write
+// preconditions on the relation of this resource. The ...Subjects methods take the plain objects
+// struct and are only generated if withSubjects is set.
+func generatePreconditionBuilders(f *jen.File, sc *scope, def *ast.Definition, rel *ast.Relation, withSubjects bool) {
+	typeName := naming.TypeStructName(sc.local(def.Name))
+	receiver := naming.ReceiverName(typeName)
+	relName := naming.ToPascalCase(rel.Name)
+	structName := naming.RelationObjectsStructName(sc.local(def.Name), rel.Name)
+
+	filter := func(sf *subjectField, id jen.Code) jen.Code {
+		values := jen.Dict{
+			jen.Id("ResourceType"): jen.String().Call(jen.Id(naming.TypeConstName(sc.local(def.Name)))),
+			jen.Id("ResourceID"):   jen.Id(receiver).Dot("id"),
+			jen.Id("Relation"):     jen.String().Call(jen.Id(naming.RelationConstName(sc.local(def.Name), rel.Name))),
+		}
+		if sf != nil {
+			values[jen.Id("SubjectType")] = jen.String().Call(sc.typeConst(sf.TypeName))
+			values[jen.Id("SubjectID")] = id
+			if sf.Relation != "" {
+				values[jen.Id("SubjectRelation")] = jen.Lit(sf.Relation)
+			}
+		}
+		return jen.Qual(authzPkg, "RelationshipFilter").Values(values)
+	}
+	precondition := func(operation string, sf *subjectField, id jen.Code) jen.Code {
+		return jen.Qual(authzPkg, "Precondition").Values(jen.Dict{
+			jen.Id("Operation"): jen.Qual(authzPkg, operation),
+			jen.Id("Filter"):    filter(sf, id),
+		})
+	}
+
+	for _, b := range []struct {
+		prefix, operation, doc string
+	}{
+		{"RequireAny", "PreconditionMustMatch", "requires this %s to have at least one %s relation."},
+		{"RequireNo", "PreconditionMustNotMatch", "requires this %s to have no %s relations."},
+	} {
+		methodName := b.prefix + relName
+		f.Commentf("%s "+b.doc, methodName, def.Name, rel.Name)
+		f.Func().Params(jen.Id(receiver).Id(typeName)).Id(methodName).Params().Qual(authzPkg, "Precondition").Block(
+			jen.Return(precondition(b.operation, nil, nil)),
+		)
+		f.Line()
+	}
+
+	if !withSubjects {
+		return
+	}
+	for _, b := range []struct {
+		prefix, operation, doc string
+	}{
+		{"Require", "PreconditionMustMatch", "requires each subject to hold the %s relation on this %s."},
+		{"RequireNo", "PreconditionMustNotMatch", "requires that none of the subjects holds the %s relation on this %s."},
+	} {
+		methodName := b.prefix + relName + "Subjects"
+		var body []jen.Code
+		body = append(body, jen.Var().Id("preconditions").Index().Qual(authzPkg, "Precondition"))
+		for _, sf := range caveatSubjectFields(sc, rel, "") {
 			body = append(body,
-				jen.If(jen.Id("subjects").Dot(wildcardField)).Block(
-					jen.If(
-						jen.Err().Op(":=").Id(receiver).Dot("engine").Dot(engineMethod).Call(
-							jen.Id("ctx"),
-							jen.Id(receiver).Dot("resource").Call(),
-							jen.Id(relConst),
-							jen.Id(typeConst),
-							jen.Index().Qual(authzPkg, "ID").Values(jen.Qual(authzPkg, "ID").Call(jen.Lit("*"))),
-						),
-						jen.Err().Op("!=").Nil(),
-					).Block(
-						jen.Return(jen.Err()),
-					),
+				jen.For(jen.Id("_").Op(",").Id("s").Op(":=").Range().Id("subjects").Dot(sf.Name)).Block(
+					jen.Id("preconditions").Op("=").Append(jen.Id("preconditions"), precondition(b.operation, &sf, sc.id(jen.Id("s")))),
 				),
 			)
+			if sf.Wildcard {
+				body = append(body,
+					jen.If(jen.Id("subjects").Dot(sf.Name+"Wildcard")).Block(
+						jen.Id("preconditions").Op("=").Append(jen.Id("preconditions"), precondition(b.operation, &sf, jen.Lit("*"))),
+					),
+				)
+			}
 		}
+		body = append(body, jen.Return(jen.Id("preconditions")))
+
+		f.Commentf("%s "+b.doc, methodName, rel.Name, def.Name)
+		f.Func().Params(jen.Id(receiver).Id(typeName)).Id(methodName).Params(
+			jen.Id("subjects").Id(structName),
+		).Index().Qual(authzPkg, "Precondition").Block(body...)
+		f.Line()
 	}
+}
 
-	body = append(body, jen.Return(jen.Nil()))
+// generateDeleteAllMethods generates DeleteAllRelations for definitions with relations and
+// DeleteAllSubjectRelations for definitions used as a subject type by any relation.
+func generateDeleteAllMethods(f *jen.File, sc *scope, schema *ast.Schema, def *ast.Definition) {
+	typeName := naming.TypeStructName(sc.local(def.Name))
+	receiver := naming.ReceiverName(typeName)
 
-	f.Commentf("%s %ss %s relations for this %s.", methodName, strings.ToLower(op), rel.Name, def.Name)
-	f.Func().Params(jen.Id(receiver).Id(typeName)).Id(methodName).Params(
+	deleteCall := func(filter jen.Dict) jen.Code {
+		return jen.List(jen.Id("result"), jen.Err()).Op(":=").Id(receiver).Dot("engine").Dot("DeleteRelationships").Call(
+			jen.Id("ctx"),
+			jen.Qual(authzPkg, "RelationshipFilter").Values(filter),
+			jen.Qual(authzPkg, "DeleteOptions").Values(),
+		)
+	}
+
+	if len(def.Relations) > 0 {
+		f.Commentf("DeleteAllRelations deletes every relationship of this %s, e.g. when the %s itself is deleted.", def.Name, def.Name)
+		f.Func().Params(jen.Id(receiver).Id(typeName)).Id("DeleteAllRelations").Params(
+			jen.Id("ctx").Qual("context", "Context"),
+		).Params(jen.Qual(authzPkg, "ZedToken"), jen.Error()).Block(
+			deleteCall(jen.Dict{
+				jen.Id("ResourceType"): jen.String().Call(jen.Id(naming.TypeConstName(sc.local(def.Name)))),
+				jen.Id("ResourceID"):   jen.Id(receiver).Dot("id"),
+			}),
+			jen.If(jen.Err().Op("!=").Nil()).Block(
+				jen.Return(jen.Lit(""), jen.Err()),
+			),
+			jen.Return(jen.Id("result").Dot("Token"), jen.Nil()),
+		)
+		f.Line()
+	}
+
+	var resourceTypes []jen.Code
+	for _, other := range schema.Definitions {
+		if subjectOf(other, def.Name) {
+			resourceTypes = append(resourceTypes, sc.typeConstValue(other.Name))
+		}
+	}
+	if len(resourceTypes) == 0 {
+		return
+	}
+
+	f.Commentf("DeleteAllSubjectRelations removes this %s from every relation it is a subject of,", def.Name)
+	f.Comment("directly or as a subject set such as group:eng#member, and returns the ZedToken of the last write.")
+	f.Func().Params(jen.Id(receiver).Id(typeName)).Id("DeleteAllSubjectRelations").Params(
 		jen.Id("ctx").Qual("context", "Context"),
-		jen.Id("subjects").Id(structName),
-	).Error().Block(body...)
+	).Params(jen.Qual(authzPkg, "ZedToken"), jen.Error()).Block(
+		jen.Var().Id("token").Qual(authzPkg, "ZedToken"),
+		jen.For(jen.Id("_").Op(",").Id("resourceType").Op(":=").Range().Index().Qual(authzPkg, "Type").Values(resourceTypes...)).Block(
+			deleteCall(jen.Dict{
+				jen.Id("ResourceType"): jen.String().Call(jen.Id("resourceType")),
+				jen.Id("SubjectType"):  jen.String().Call(jen.Id(naming.TypeConstName(sc.local(def.Name)))),
+				jen.Id("SubjectID"):    jen.Id(receiver).Dot("id"),
+			}),
+			jen.If(jen.Err().Op("!=").Nil()).Block(
+				jen.Return(jen.Lit(""), jen.Err()),
+			),
+			jen.Id("token").Op("=").Id("result").Dot("Token"),
+		),
+		jen.Return(jen.Id("token"), jen.Nil()),
+	)
 	f.Line()
 }
 
+// subjectOf reports whether any relation of def allows subjects of the given type.
+func subjectOf(def *ast.Definition, typeName string) bool {
+	for _, rel := range def.Relations {
+		for _, st := range rel.SubjectTypes {
+			if st.TypeName == typeName {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // generateReadRelation generates the Read{Relation}Relations method.
-func generateReadRelation(f *jen.File, def *ast.Definition, rel *ast.Relation, withRepository bool) {
-	typeName := naming.TypeStructName(def.Name)
+func generateReadRelation(f *jen.File, sc *scope, def *ast.Definition, rel *ast.Relation, withRepository bool) {
+	typeName := naming.TypeStructName(sc.local(def.Name))
 	receiver := naming.ReceiverName(typeName)
 	methodName := "Read" + naming.ToPascalCase(rel.Name) + "Relations"
-	structName := naming.RelationObjectsStructName(def.Name, rel.Name)
-	relConst := naming.RelationConstName(def.Name, rel.Name)
+	structName := naming.RelationObjectsStructName(sc.local(def.Name), rel.Name)
+	relConst := naming.RelationConstName(sc.local(def.Name), rel.Name)
 
 	var body []jen.Code
 	body = append(body, jen.Var().Id("result").Id(structName))
 
-	for _, st := range rel.SubjectTypes {
-		fieldName := naming.TypeStructName(st.TypeName)
-		typeConst := naming.TypeConstName(st.TypeName)
-		idsVar := "ids" + fieldName
+	for _, sf := range caveatSubjectFields(sc, rel, "") {
+		fieldName := sf.Name
+		relsVar := "rels" + fieldName
 		wildcardField := fieldName + "Wildcard"
 
-		newSubjectCall := newEntityCall(fieldName, receiver, withRepository)
+		newSubjectCall := newEntityCall(sc, sf.TypeName, receiver, withRepository)
 
 		loopBody := []jen.Code{
 			jen.Id("result").Dot(fieldName).Op("=").Append(
@@ -128,7 +683,7 @@ func generateReadRelation(f *jen.File, def *ast.Definition, rel *ast.Relation, w
 				newSubjectCall,
 			),
 		}
-		if st.IsWildcard {
+		if sf.Wildcard {
 			loopBody = []jen.Code{
 				jen.If(jen.Id("id").Op("==").Qual(authzPkg, "ID").Call(jen.Lit("*"))).Block(
 					jen.Id("result").Dot(wildcardField).Op("=").True(),
@@ -142,25 +697,140 @@ func generateReadRelation(f *jen.File, def *ast.Definition, rel *ast.Relation, w
 		}
 
 		body = append(body,
-			jen.List(jen.Id(idsVar), jen.Err()).Op(":=").Id(receiver).Dot("engine").Dot("ReadRelations").Call(
+			jen.List(jen.Id(relsVar), jen.Err()).Op(":=").Id(receiver).Dot("engine").Dot("ReadRelations").Call(
 				jen.Id("ctx"),
-				jen.Id(receiver).Dot("resource").Call(),
+				jen.Id(receiver).Dot(sc.resourceMethod()).Call(),
 				jen.Id(relConst),
-				jen.Id(typeConst),
+				sc.typeConst(sf.TypeName),
+				subjectRelationArg(sf),
 			),
 			jen.If(jen.Err().Op("!=").Nil()).Block(
 				jen.Return(jen.Id(structName).Values(), jen.Err()),
 			),
-			jen.For(jen.Id("_").Op(",").Id("id").Op(":=").Range().Id(idsVar)).Block(loopBody...),
+			jen.For(jen.Id("_").Op(",").Id("relationship").Op(":=").Range().Id(relsVar)).Block(
+				append([]jen.Code{jen.Id("id").Op(":=").Id("relationship").Dot("SubjectID")}, loopBody...)...,
+			),
 		)
 	}
 
 	body = append(body, jen.Return(jen.Id("result"), jen.Nil()))
 
 	f.Commentf("%s reads %s relations for this %s.", methodName, rel.Name, def.Name)
+	if len(uniqueSubjectTypes(caveatSubjectTypes(rel, ""))) < len(relationshipSubjectTypes(rel)) {
+		f.Commentf("Subject types that require a caveat are only returned by %sDetailed.", methodName)
+	}
 	f.Func().Params(jen.Id(receiver).Id(typeName)).Id(methodName).Params(
 		jen.Id("ctx").Qual("context", "Context"),
 	).Params(jen.Id(structName), jen.Error()).Block(body...)
 	f.Line()
 }
 
+// relationshipSubjectTypes returns the unique subject type names of a relation, in order.
+func relationshipSubjectTypes(rel *ast.Relation) []string {
+	return uniqueSubjectTypes(rel.SubjectTypes)
+}
+
+// uniqueSubjectTypes returns the unique type names of subjectTypes, in order.
+func uniqueSubjectTypes(subjectTypes []*ast.SubjectType) []string {
+	seen := make(map[string]bool)
+	var types []string
+	for _, st := range subjectTypes {
+		if !seen[st.TypeName] {
+			seen[st.TypeName] = true
+			types = append(types, st.TypeName)
+		}
+	}
+	return types
+}
+
+// generateRelationshipStruct generates the struct returned for each relationship by a detailed read.
+func generateRelationshipStruct(f *jen.File, sc *scope, def *ast.Definition, rel *ast.Relation) {
+	structName := naming.RelationshipStructName(sc.local(def.Name), rel.Name)
+
+	var fields []jen.Code
+	subjectTypes := relationshipSubjectTypes(rel)
+	names := sc.subjectNames(subjectTypes)
+	for _, st := range subjectTypes {
+		fields = append(fields, jen.Id(names[st]).Op("*").Add(sc.typeStruct(st)))
+	}
+	fields = append(fields,
+		jen.Id("SubjectType").Qual(authzPkg, "Type"),
+		jen.Id("SubjectRelation").Qual(authzPkg, "Relation").Comment(`e.g. "member" for group#member; empty for direct subjects`),
+		jen.Id("Wildcard").Bool().Comment("true for a wildcard subject such as user:*"),
+		jen.Id("Caveat").Op("*").Qual(authzPkg, "Caveat").Comment("nil when the relationship is not caveated"),
+		jen.Id("ExpiresAt").Qual("time", "Time").Comment("zero when the relationship does not expire"),
+	)
+
+	f.Commentf("%s is one %s relation of a %s with its caveat and expiry.", structName, rel.Name, def.Name)
+	f.Comment("Exactly one subject field is set, unless Wildcard is true.")
+	f.Type().Id(structName).Struct(fields...)
+	f.Line()
+}
+
+// generateReadRelationDetailed generates the Read{Relation}RelationsDetailed method.
+func generateReadRelationDetailed(f *jen.File, sc *scope, def *ast.Definition, rel *ast.Relation, withRepository bool) {
+	typeName := naming.TypeStructName(sc.local(def.Name))
+	receiver := naming.ReceiverName(typeName)
+	methodName := "Read" + naming.ToPascalCase(rel.Name) + "RelationsDetailed"
+	structName := naming.RelationshipStructName(sc.local(def.Name), rel.Name)
+	relConst := naming.RelationConstName(sc.local(def.Name), rel.Name)
+
+	var body []jen.Code
+	body = append(body, jen.Var().Id("result").Index().Id(structName))
+
+	for _, sf := range collectSubjectFields(sc, rel.SubjectTypes) {
+		relsVar := "rels" + sf.Name
+
+		setSubject := []jen.Code{
+			jen.Id("subject").Op(":=").Add(newEntityCall(sc, sf.TypeName, receiver, withRepository)),
+			jen.Id("item").Dot(sf.StructName).Op("=").Op("&").Id("subject"),
+		}
+		if sf.Wildcard {
+			setSubject = []jen.Code{
+				jen.If(jen.Id("id").Op("==").Qual(authzPkg, "ID").Call(jen.Lit("*"))).Block(
+					jen.Id("item").Dot("Wildcard").Op("=").True(),
+				).Else().Block(setSubject...),
+			}
+		}
+
+		loopBody := []jen.Code{
+			jen.Id("id").Op(":=").Id("relationship").Dot("SubjectID"),
+			jen.Id("item").Op(":=").Id(structName).Values(jen.Dict{
+				jen.Id("SubjectType"):     jen.Id("relationship").Dot("SubjectType"),
+				jen.Id("SubjectRelation"): jen.Id("relationship").Dot("SubjectRelation"),
+				jen.Id("Caveat"):          jen.Id("relationship").Dot("Caveat"),
+				jen.Id("ExpiresAt"):       jen.Id("relationship").Dot("ExpiresAt"),
+			}),
+		}
+		loopBody = append(loopBody, setSubject...)
+		loopBody = append(loopBody, jen.Id("result").Op("=").Append(jen.Id("result"), jen.Id("item")))
+
+		body = append(body,
+			jen.List(jen.Id(relsVar), jen.Err()).Op(":=").Id(receiver).Dot("engine").Dot("ReadRelations").Call(
+				jen.Id("ctx"),
+				jen.Id(receiver).Dot(sc.resourceMethod()).Call(),
+				jen.Id(relConst),
+				sc.typeConst(sf.TypeName),
+				subjectRelationArg(sf),
+			),
+			jen.If(jen.Err().Op("!=").Nil()).Block(
+				jen.Return(jen.Nil(), jen.Err()),
+			),
+			jen.For(jen.Id("_").Op(",").Id("relationship").Op(":=").Range().Id(relsVar)).Block(loopBody...),
+		)
+	}
+
+	body = append(body, jen.Return(jen.Id("result"), jen.Nil()))
+
+	f.Commentf("%s reads %s relations for this %s together with their caveats and expiry.", methodName, rel.Name, def.Name)
+	f.Func().Params(jen.Id(receiver).Id(typeName)).Id(methodName).Params(
+		jen.Id("ctx").Qual("context", "Context"),
+	).Params(jen.Index().Id(structName), jen.Error()).Block(body...)
+	f.Line()
+}
+
+// subjectRelationArg returns the subject relation passed to the engine for a subject field.
+// Direct subjects pass an empty relation.
+func subjectRelationArg(sf subjectField) jen.Code {
+	return jen.Lit(sf.Relation)
+}
@@ -8,10 +8,10 @@ import (
 
 // generateRepositoryMethods generates optional entity CRUD methods.
 // Only called when Options.WithRepository is true.
-func generateRepositoryMethods(f *jen.File, def *ast.Definition) {
-	typeName := naming.TypeStructName(def.Name)
+func generateRepositoryMethods(f *jen.File, sc *scope, def *ast.Definition) {
+	typeName := naming.TypeStructName(sc.local(def.Name))
 	receiver := naming.ReceiverName(typeName)
-	typeConst := naming.TypeConstName(def.Name)
+	typeConst := naming.TypeConstName(sc.local(def.Name))
 
 	// Create function (package-level)
 	createFunc := "Create" + typeName
@@ -0,0 +1,322 @@
+package codegen
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/dave/jennifer/jen"
+	"github.com/oitnes/authzed-codegen/internal/generator/analysis"
+	"github.com/oitnes/authzed-codegen/internal/generator/ast"
+	"github.com/oitnes/authzed-codegen/internal/generator/naming"
+)
+
+// goPackage is one generated Go package and the schema objects it holds.
+type goPackage struct {
+	Dir         string // slash-separated directory relative to the output, empty for the root
+	Name        string // Go package name
+	Path        string // import path; empty when everything is generated into one package
+	Definitions []*ast.Definition
+	Caveats     []*ast.Caveat
+}
+
+// layout assigns every definition and caveat to a generated package. Without
+// Options.SplitNamespaces there is a single package; with it, each namespace prefix such as
+// "bookingsvc" in "bookingsvc/booking" gets a sub-package and objects without a namespace stay
+// in the root package.
+type layout struct {
+	split    bool
+	packages []*goPackage
+	byPrefix map[string]*goPackage
+}
+
+func newLayout(schema *ast.Schema, opts Options) *layout {
+	l := &layout{split: opts.SplitNamespaces, byPrefix: make(map[string]*goPackage)}
+
+	pkg := func(name string) *goPackage {
+		prefix := l.prefix(name)
+		if p, ok := l.byPrefix[prefix]; ok {
+			return p
+		}
+		p := &goPackage{Dir: prefix, Name: opts.PackageName}
+		if l.split {
+			p.Path = opts.ImportPath
+			if prefix != "" {
+				p.Name = packageName(path.Base(prefix))
+				p.Path += "/" + prefix
+			}
+		}
+		l.byPrefix[prefix] = p
+		l.packages = append(l.packages, p)
+		return p
+	}
+
+	if !l.split {
+		pkg("")
+	}
+	for _, def := range schema.Definitions {
+		p := pkg(def.Name)
+		p.Definitions = append(p.Definitions, def)
+	}
+	for _, caveat := range schema.Caveats {
+		p := pkg(caveat.Name)
+		p.Caveats = append(p.Caveats, caveat)
+	}
+
+	sort.Slice(l.packages, func(i, j int) bool {
+		return l.packages[i].Dir < l.packages[j].Dir
+	})
+	return l
+}
+
+// prefix returns the namespace prefix that selects the package of a definition or caveat.
+func (l *layout) prefix(name string) string {
+	if !l.split {
+		return ""
+	}
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		return name[:i]
+	}
+	return ""
+}
+
+// packageOf returns the package that holds the definition or caveat name.
+func (l *layout) packageOf(name string) *goPackage {
+	return l.byPrefix[l.prefix(name)]
+}
+
+// checkImportCycles reports an error if the packages would import each other, which Go does
+// not allow. A package imports the packages of the subject types and caveats its definitions
+// refer to.
+func (l *layout) checkImportCycles(reach *analysis.Reachability) error {
+	if len(l.packages) < 2 {
+		return nil
+	}
+
+	imports := make(map[*goPackage][]*goPackage)
+	addImport := func(from *goPackage, name string) {
+		to := l.packageOf(name)
+		if to == nil || to == from {
+			return
+		}
+		for _, p := range imports[from] {
+			if p == to {
+				return
+			}
+		}
+		imports[from] = append(imports[from], to)
+	}
+	for _, p := range l.packages {
+		for _, def := range p.Definitions {
+			for _, rel := range def.Relations {
+				for _, st := range rel.SubjectTypes {
+					addImport(p, st.TypeName)
+					if st.Caveat != "" {
+						addImport(p, st.Caveat)
+					}
+				}
+			}
+			for _, perm := range def.Permissions {
+				for _, st := range reach.SubjectTypes(def.Name, perm.Name) {
+					addImport(p, st)
+				}
+			}
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make(map[*goPackage]int)
+	var stack []*goPackage
+	var visit func(p *goPackage) error
+	visit = func(p *goPackage) error {
+		state[p] = visiting
+		stack = append(stack, p)
+		for _, next := range imports[p] {
+			switch state[next] {
+			case visiting:
+				var cycle []string
+				for i := len(stack) - 1; i >= 0; i-- {
+					cycle = append([]string{stack[i].describe()}, cycle...)
+					if stack[i] == next {
+						break
+					}
+				}
+				cycle = append(cycle, next.describe())
+				return fmt.Errorf("splitting namespaces: packages would import each other: %s", strings.Join(cycle, " -> "))
+			case unvisited:
+				if err := visit(next); err != nil {
+					return err
+				}
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[p] = done
+		return nil
+	}
+	for _, p := range l.packages {
+		if state[p] == unvisited {
+			if err := visit(p); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// describe names the package in error messages.
+func (p *goPackage) describe() string {
+	if p.Dir == "" {
+		return "root package"
+	}
+	return p.Dir
+}
+
+// fileName returns the slash-separated output path of a file in the package.
+func (p *goPackage) fileName(name string) string {
+	if p.Dir == "" {
+		return name
+	}
+	return p.Dir + "/" + name
+}
+
+// newFile starts a generated file of the package.
+func (p *goPackage) newFile() *jen.File {
+	f := jen.NewFilePathName(p.Path, p.Name)
+	f.HeaderComment("Code generated by authzed-codegen. DO NOT EDIT.")
+	return f
+}
+
+// packageName turns a namespace into a valid Go package name.
+func packageName(namespace string) string {
+	name := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' {
+			return unicode.ToLower(r)
+		}
+		return '_'
+	}, namespace)
+	if name == "" || unicode.IsDigit(rune(name[0])) {
+		name = "ns_" + name
+	}
+	return name
+}
+
+// scope resolves the Go identifiers of schema objects from a file of one package. Objects of
+// the same package are referred to by their local name, objects of other packages are
+// qualified with their import path.
+type scope struct {
+	layout *layout
+	pkg    *goPackage
+}
+
+// local returns the name of a definition or caveat within its own package: the full name
+// without a split layout, the name without its namespace prefix with one. The naming
+// functions derive Go identifiers from it.
+func (sc *scope) local(name string) string {
+	if prefix := sc.layout.prefix(name); prefix != "" {
+		return name[len(prefix)+1:]
+	}
+	return name
+}
+
+// qual refers to the identifier id, declared in the package of the definition or caveat name.
+func (sc *scope) qual(name, id string) *jen.Statement {
+	pkg := sc.layout.packageOf(name)
+	if pkg == nil {
+		return jen.Id(id)
+	}
+	return jen.Qual(pkg.Path, id)
+}
+
+// typeStruct refers to the struct type of a definition.
+func (sc *scope) typeStruct(name string) *jen.Statement {
+	return sc.qual(name, naming.TypeStructName(sc.local(name)))
+}
+
+// typeConst refers to the type constant of a definition.
+func (sc *scope) typeConst(name string) *jen.Statement {
+	return sc.qual(name, naming.TypeConstName(sc.local(name)))
+}
+
+// typeConstValue refers to the type constant of a definition of the same package, or spells
+// out its value for other packages. This avoids imports against the direction of the subject
+// references, which would make packages import each other.
+func (sc *scope) typeConstValue(name string) *jen.Statement {
+	if sc.layout.packageOf(name) == sc.pkg {
+		return jen.Id(naming.TypeConstName(sc.local(name)))
+	}
+	return jen.Qual(authzPkg, "Type").Call(jen.Lit(name))
+}
+
+// newEntity refers to the constructor of a definition.
+func (sc *scope) newEntity(name string) *jen.Statement {
+	return sc.qual(name, "New"+naming.TypeStructName(sc.local(name)))
+}
+
+// caveatContext refers to the context struct of a caveat.
+func (sc *scope) caveatContext(name string) *jen.Statement {
+	return sc.qual(name, naming.CaveatContextStructName(sc.local(name)))
+}
+
+// resourceMethod is the name of the method that returns the authz.Resource of an entity. It
+// is exported with a split layout, where subjects are often declared in another package.
+func (sc *scope) resourceMethod() string {
+	if sc.layout.split {
+		return "Resource"
+	}
+	return "resource"
+}
+
+// caveatMethod is the name of the method that returns the *authz.Caveat of a caveat context,
+// exported with a split layout for the same reason as resourceMethod.
+func (sc *scope) caveatMethod() string {
+	if sc.layout.split {
+		return "Caveat"
+	}
+	return "caveat"
+}
+
+// id returns the identifier of the entity x as a string: its id field, or its ID method with
+// a split layout, where the entity may be declared in another package.
+func (sc *scope) id(x *jen.Statement) *jen.Statement {
+	if sc.layout.split {
+		return x.Dot("ID").Call()
+	}
+	return x.Dot("id")
+}
+
+// markerName is the name of the method that marks the subject types of a permission. With a
+// split layout it is exported, since subject types of other packages implement it, and
+// qualified with the full definition name, since one subject type may implement the
+// interfaces of equally named definitions in several packages.
+func (sc *scope) markerName(def *ast.Definition, perm *ast.Permission) string {
+	if sc.layout.split {
+		return "Is" + naming.SubjectInterfaceName(def.Name, perm.Name)
+	}
+	return "is" + naming.SubjectInterfaceName(def.Name, perm.Name)
+}
+
+// subjectNames returns the identifier used for each of the distinct subject type names in
+// struct fields and method names: the struct name of the type in its own package or, where
+// subject types of different packages share it, the struct name derived from the full type
+// name.
+func (sc *scope) subjectNames(typeNames []string) map[string]string {
+	count := make(map[string]int)
+	for _, name := range typeNames {
+		count[naming.TypeStructName(sc.local(name))]++
+	}
+	ids := make(map[string]string, len(typeNames))
+	for _, name := range typeNames {
+		id := naming.TypeStructName(sc.local(name))
+		if count[id] > 1 {
+			id = naming.TypeStructName(name)
+		}
+		ids[name] = id
+	}
+	return ids
+}
@@ -0,0 +1,228 @@
+package codegen
+
+import (
+	"github.com/dave/jennifer/jen"
+	"github.com/oitnes/authzed-codegen/internal/generator/ast"
+	"github.com/oitnes/authzed-codegen/internal/generator/naming"
+)
+
+// dispatcherReceiver is the receiver name of the generated Dispatcher methods.
+const dispatcherReceiver = "dp"
+
+// generateDispatcher generates the Dispatcher that routes watched relationship changes to
+// typed handlers, with its Client.Dispatcher constructor, Dispatch and Run. The typed events,
+// their On methods and the per-definition dispatch are generated alongside each definition.
+func generateDispatcher(f *jen.File, sc *scope, withRepository bool) {
+	dp := dispatcherReceiver
+
+	fields := []jen.Code{jen.Id("engine").Qual(authzPkg, "Engine")}
+	initFields := jen.Dict{jen.Id("engine"): jen.Id("c").Dot("engine")}
+	if withRepository {
+		fields = append(fields, jen.Id("repo").Qual(authzPkg, "Repository"))
+		initFields[jen.Id("repo")] = jen.Id("c").Dot("repo")
+	}
+	fields = append(fields, jen.Line())
+
+	var watchedTypes []jen.Code
+	var cases []jen.Code
+	for _, def := range sc.pkg.Definitions {
+		if len(def.Relations) == 0 {
+			continue
+		}
+		typeConst := naming.TypeConstName(sc.local(def.Name))
+		watchedTypes = append(watchedTypes, jen.Id(typeConst))
+		cases = append(cases, jen.Case(jen.Id(typeConst)).Block(
+			jen.Err().Op("=").Id(dp).Dot(dispatchMethodName(sc, def)).Call(jen.Id("ctx"), jen.Id("event").Dot("Token"), jen.Id("change")),
+		))
+		for _, rel := range def.Relations {
+			for _, eventName := range []string{naming.RelationAddedEventName(sc.local(def.Name), rel.Name), naming.RelationRemovedEventName(sc.local(def.Name), rel.Name)} {
+				fields = append(fields, jen.Id("on"+eventName).Index().Func().Params(jen.Qual("context", "Context"), jen.Id(eventName)).Error())
+			}
+		}
+	}
+
+	f.Comment("Dispatcher routes relationship changes to the typed handlers registered with its On methods.")
+	f.Comment("Register handlers before calling Dispatch or Run; registration is not safe for concurrent use.")
+	f.Type().Id("Dispatcher").Struct(fields...)
+	f.Line()
+
+	f.Comment("Dispatcher creates a Dispatcher whose events carry entities backed by the client's engine.")
+	f.Func().Params(jen.Id("c").Op("*").Id("Client")).Id("Dispatcher").Params().Op("*").Id("Dispatcher").Block(
+		jen.Return(jen.Op("&").Id("Dispatcher").Values(initFields)),
+	)
+	f.Line()
+
+	f.Comment("Dispatch calls the handlers registered for each change in event, in order, and stops at")
+	f.Comment("the first handler error. Changes to relations without a generated event are ignored.")
+	f.Func().Params(jen.Id(dp).Op("*").Id("Dispatcher")).Id("Dispatch").Params(
+		jen.Id("ctx").Qual("context", "Context"),
+		jen.Id("event").Qual(authzPkg, "WatchEvent"),
+	).Error().Block(
+		jen.For(jen.Id("_").Op(",").Id("change").Op(":=").Range().Id("event").Dot("Changes")).Block(
+			jen.Var().Err().Error(),
+			jen.Switch(jen.Id("change").Dot("Relationship").Dot("Resource").Dot("Type")).Block(cases...),
+			jen.If(jen.Err().Op("!=").Nil()).Block(
+				jen.Return(jen.Err()),
+			),
+		),
+		jen.Return(jen.Nil()),
+	)
+	f.Line()
+
+	f.Comment("Run watches the relationships of every definition from token and dispatches each event")
+	f.Comment("until ctx is done, the watch fails or a handler returns an error. It returns the token of")
+	f.Comment("the last event that was fully dispatched, from which a later Run can resume.")
+	f.Func().Params(jen.Id(dp).Op("*").Id("Dispatcher")).Id("Run").Params(
+		jen.Id("ctx").Qual("context", "Context"),
+		jen.Id("watcher").Qual(authzPkg, "Watcher"),
+		jen.Id("token").Qual(authzPkg, "ZedToken"),
+	).Params(jen.Qual(authzPkg, "ZedToken"), jen.Error()).Block(
+		jen.For(jen.Id("event").Op(",").Err().Op(":=").Range().Id("watcher").Dot("Watch").Call(
+			append([]jen.Code{jen.Id("ctx"), jen.Id("token")}, watchedTypes...)...,
+		)).Block(
+			jen.If(jen.Err().Op("!=").Nil()).Block(
+				jen.Return(jen.Id("token"), jen.Err()),
+			),
+			jen.If(jen.Err().Op(":=").Id(dp).Dot("Dispatch").Call(jen.Id("ctx"), jen.Id("event")), jen.Err().Op("!=").Nil()).Block(
+				jen.Return(jen.Id("token"), jen.Err()),
+			),
+			jen.Id("token").Op("=").Id("event").Dot("Token"),
+		),
+		jen.Return(jen.Id("token"), jen.Id("ctx").Dot("Err").Call()),
+	)
+	f.Line()
+
+	f.Comment("dispatchTo calls each handler with event and returns the first error.")
+	f.Func().Id("dispatchTo").Types(jen.Id("E").Any()).Params(
+		jen.Id("ctx").Qual("context", "Context"),
+		jen.Id("handlers").Index().Func().Params(jen.Qual("context", "Context"), jen.Id("E")).Error(),
+		jen.Id("event").Id("E"),
+	).Error().Block(
+		jen.For(jen.Id("_").Op(",").Id("handler").Op(":=").Range().Id("handlers")).Block(
+			jen.If(jen.Err().Op(":=").Id("handler").Call(jen.Id("ctx"), jen.Id("event")), jen.Err().Op("!=").Nil()).Block(
+				jen.Return(jen.Err()),
+			),
+		),
+		jen.Return(jen.Nil()),
+	)
+	f.Line()
+}
+
+func dispatchMethodName(sc *scope, def *ast.Definition) string {
+	return "dispatch" + naming.TypeStructName(sc.local(def.Name))
+}
+
+// generateWatchEvents generates the Added and Removed events of each relation of the
+// definition, the Dispatcher methods that register their handlers, and the method that
+// turns a change to one of the definition's relationships into its typed event.
+func generateWatchEvents(f *jen.File, sc *scope, def *ast.Definition, withRepository bool) {
+	if len(def.Relations) == 0 {
+		return
+	}
+	typeName := naming.TypeStructName(sc.local(def.Name))
+	dp := dispatcherReceiver
+
+	for _, rel := range def.Relations {
+		structName := naming.RelationshipStructName(sc.local(def.Name), rel.Name)
+		events := []struct{ name, verb string }{
+			{naming.RelationAddedEventName(sc.local(def.Name), rel.Name), "created or touched"},
+			{naming.RelationRemovedEventName(sc.local(def.Name), rel.Name), "deleted"},
+		}
+		for _, event := range events {
+			f.Commentf("%s reports that a %s relationship of a %s was %s.", event.name, rel.Name, def.Name, event.verb)
+			f.Type().Id(event.name).Struct(
+				jen.Id("Resource").Id(typeName),
+				jen.Id(structName),
+				jen.Id("Token").Qual(authzPkg, "ZedToken").Comment("revision the change is current through"),
+			)
+			f.Line()
+		}
+		for _, event := range events {
+			f.Commentf("On%s registers handler for %s events.", event.name, event.name)
+			f.Func().Params(jen.Id(dp).Op("*").Id("Dispatcher")).Id("On"+event.name).Params(
+				jen.Id("handler").Func().Params(jen.Id("ctx").Qual("context", "Context"), jen.Id("event").Id(event.name)).Error(),
+			).Op("*").Id("Dispatcher").Block(
+				jen.Id(dp).Dot("on"+event.name).Op("=").Append(jen.Id(dp).Dot("on"+event.name), jen.Id("handler")),
+				jen.Return(jen.Id(dp)),
+			)
+			f.Line()
+		}
+	}
+
+	resourceArgs := []jen.Code{jen.String().Call(jen.Id("relationship").Dot("Resource").Dot("ID")), jen.Id(dp).Dot("engine")}
+	if withRepository {
+		resourceArgs = append(resourceArgs, jen.Id(dp).Dot("repo"))
+	}
+
+	var relationCases []jen.Code
+	for _, rel := range def.Relations {
+		structName := naming.RelationshipStructName(sc.local(def.Name), rel.Name)
+		addedName := naming.RelationAddedEventName(sc.local(def.Name), rel.Name)
+		removedName := naming.RelationRemovedEventName(sc.local(def.Name), rel.Name)
+
+		var subjectCases []jen.Code
+		subjectTypes := relationshipSubjectTypes(rel)
+		names := sc.subjectNames(subjectTypes)
+		for _, st := range subjectTypes {
+			setSubject := []jen.Code{
+				jen.Id("subject").Op(":=").Add(newEntityCall(sc, st, dp, withRepository)),
+				jen.Id("item").Dot(names[st]).Op("=").Op("&").Id("subject"),
+			}
+			if allowsWildcard(rel, st) {
+				setSubject = []jen.Code{
+					jen.If(jen.Id("id").Op("==").Qual(authzPkg, "ID").Call(jen.Lit("*"))).Block(
+						jen.Id("item").Dot("Wildcard").Op("=").True(),
+					).Else().Block(setSubject...),
+				}
+			}
+			subjectCases = append(subjectCases, jen.Case(sc.typeConst(st)).Block(setSubject...))
+		}
+
+		eventValues := func(eventName string) *jen.Statement {
+			return jen.Id(eventName).Values(jen.Dict{
+				jen.Id("Resource"): jen.Id("resource"),
+				jen.Id(structName): jen.Id("item"),
+				jen.Id("Token"):    jen.Id("token"),
+			})
+		}
+
+		relationCases = append(relationCases, jen.Case(jen.Id(naming.RelationConstName(sc.local(def.Name), rel.Name))).Block(
+			jen.Id("id").Op(":=").Id("relationship").Dot("SubjectID"),
+			jen.Id("item").Op(":=").Id(structName).Values(jen.Dict{
+				jen.Id("SubjectType"):     jen.Id("relationship").Dot("SubjectType"),
+				jen.Id("SubjectRelation"): jen.Id("relationship").Dot("SubjectRelation"),
+				jen.Id("Caveat"):          jen.Id("relationship").Dot("Caveat"),
+				jen.Id("ExpiresAt"):       jen.Id("relationship").Dot("ExpiresAt"),
+			}),
+			jen.Switch(jen.Id("relationship").Dot("SubjectType")).Block(subjectCases...),
+			jen.If(jen.Id("change").Dot("Operation").Op("==").Qual(authzPkg, "WriteDelete")).Block(
+				jen.Return(jen.Id("dispatchTo").Call(jen.Id("ctx"), jen.Id(dp).Dot("on"+removedName), eventValues(removedName))),
+			),
+			jen.Return(jen.Id("dispatchTo").Call(jen.Id("ctx"), jen.Id(dp).Dot("on"+addedName), eventValues(addedName))),
+		))
+	}
+
+	methodName := dispatchMethodName(sc, def)
+	f.Commentf("%s calls the handlers registered for a change to a %s relationship.", methodName, def.Name)
+	f.Func().Params(jen.Id(dp).Op("*").Id("Dispatcher")).Id(methodName).Params(
+		jen.Id("ctx").Qual("context", "Context"),
+		jen.Id("token").Qual(authzPkg, "ZedToken"),
+		jen.Id("change").Qual(authzPkg, "RelationshipChange"),
+	).Error().Block(
+		jen.Id("relationship").Op(":=").Id("change").Dot("Relationship"),
+		jen.Id("resource").Op(":=").Id("New"+typeName).Call(resourceArgs...),
+		jen.Switch(jen.Id("relationship").Dot("Relation")).Block(relationCases...),
+		jen.Return(jen.Nil()),
+	)
+	f.Line()
+}
+
+// allowsWildcard reports whether rel accepts a wildcard subject of typeName.
+func allowsWildcard(rel *ast.Relation, typeName string) bool {
+	for _, st := range rel.SubjectTypes {
+		if st.TypeName == typeName && st.IsWildcard {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,22 @@
+package generator
+
+import (
+	"fmt"
+
+	"github.com/oitnes/authzed-codegen/internal/generator/diff"
+)
+
+// Diff loads and validates the old and new schemas that the paths name, each a file, a
+// directory or a glob, and returns the changes between them.
+func Diff(oldPath, newPath string) ([]diff.Change, error) {
+	before, err := loadSchema(oldPath)
+	if err != nil {
+		return nil, fmt.Errorf("old schema: %w", err)
+	}
+	after, err := loadSchema(newPath)
+	if err != nil {
+		return nil, fmt.Errorf("new schema: %w", err)
+	}
+
+	return diff.Compare(before, after), nil
+}
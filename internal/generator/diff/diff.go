@@ -0,0 +1,256 @@
+// Package diff compares two versions of a schema and classifies each change by what it
+// breaks: relationships already stored in SpiceDB, callers of the generated Go code, or
+// nothing.
+package diff
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/oitnes/authzed-codegen/internal/generator/analysis"
+	"github.com/oitnes/authzed-codegen/internal/generator/ast"
+	"github.com/oitnes/authzed-codegen/internal/generator/printer"
+)
+
+// Kind classifies a change.
+type Kind string
+
+const (
+	// Additive changes keep existing relationships valid and generated code compiling.
+	Additive Kind = "additive"
+	// BreakingAPI changes remove or change generated Go types, fields or functions.
+	BreakingAPI Kind = "breaking-api"
+	// BreakingData changes make relationships that the old schema allowed invalid. They
+	// usually break the generated API as well.
+	BreakingData Kind = "breaking-data"
+)
+
+// Breaking reports whether the change needs more than a deploy of the new schema.
+func (k Kind) Breaking() bool {
+	return k != Additive
+}
+
+// Change is a single difference between two schemas.
+type Change struct {
+	Kind    Kind   `json:"kind"`
+	Object  string `json:"object"` // e.g. "doc", "doc#viewer", "caveat ip_allowlist" or "use expiration"
+	Message string `json:"message"`
+}
+
+// String formats the change as kind: object: message.
+func (c Change) String() string {
+	return fmt.Sprintf("%s: %s: %s", c.Kind, c.Object, c.Message)
+}
+
+// Compare returns the changes from the schema before to the schema after: use flags first,
+// then caveats, then definitions, each in the order of before followed by what after adds.
+// Both schemas must be valid.
+func Compare(before, after *ast.Schema) []Change {
+	c := &comparer{
+		oldReach: analysis.ComputeReachability(before),
+		newReach: analysis.ComputeReachability(after),
+	}
+
+	c.useFlags(before, after)
+	c.caveats(before.Caveats, after.Caveats)
+	c.definitions(before.Definitions, after.Definitions)
+
+	return c.changes
+}
+
+type comparer struct {
+	oldReach *analysis.Reachability
+	newReach *analysis.Reachability
+	changes  []Change
+}
+
+func (c *comparer) add(kind Kind, object, format string, args ...any) {
+	c.changes = append(c.changes, Change{Kind: kind, Object: object, Message: fmt.Sprintf(format, args...)})
+}
+
+func (c *comparer) useFlags(before, after *ast.Schema) {
+	for _, flag := range before.UseFlags {
+		if !after.Uses(flag.Name) {
+			c.add(BreakingData, "use "+flag.Name, "removed; relationships that rely on the feature become invalid")
+		}
+	}
+	for _, flag := range after.UseFlags {
+		if !before.Uses(flag.Name) {
+			c.add(Additive, "use "+flag.Name, "added")
+		}
+	}
+}
+
+func (c *comparer) caveats(before, after []*ast.Caveat) {
+	newByName := make(map[string]*ast.Caveat, len(after))
+	for _, caveat := range after {
+		newByName[caveat.Name] = caveat
+	}
+
+	oldNames := make(map[string]bool, len(before))
+	for _, oldCaveat := range before {
+		oldNames[oldCaveat.Name] = true
+		object := "caveat " + oldCaveat.Name
+
+		newCaveat, ok := newByName[oldCaveat.Name]
+		if !ok {
+			c.add(BreakingData, object, "removed; relationships written with it become invalid")
+			continue
+		}
+		c.caveatParameters(object, oldCaveat.Parameters, newCaveat.Parameters)
+		if strings.Join(strings.Fields(oldCaveat.Expression), " ") != strings.Join(strings.Fields(newCaveat.Expression), " ") {
+			c.add(Additive, object, "expression changed")
+		}
+	}
+
+	for _, caveat := range after {
+		if !oldNames[caveat.Name] {
+			c.add(Additive, "caveat "+caveat.Name, "added")
+		}
+	}
+}
+
+func (c *comparer) caveatParameters(object string, before, after []*ast.CaveatParameter) {
+	newByName := make(map[string]*ast.CaveatParameter, len(after))
+	for _, param := range after {
+		newByName[param.Name] = param
+	}
+
+	oldNames := make(map[string]bool, len(before))
+	for _, oldParam := range before {
+		oldNames[oldParam.Name] = true
+
+		newParam, ok := newByName[oldParam.Name]
+		switch {
+		case !ok:
+			c.add(BreakingAPI, object, "parameter %s removed", oldParam.Name)
+		case oldParam.Type.String() != newParam.Type.String():
+			c.add(BreakingData, object, "parameter %s changed type from %s to %s; stored caveat contexts may no longer match",
+				oldParam.Name, oldParam.Type, newParam.Type)
+		}
+	}
+
+	for _, param := range after {
+		if !oldNames[param.Name] {
+			c.add(Additive, object, "parameter %s %s added", param.Name, param.Type)
+		}
+	}
+}
+
+func (c *comparer) definitions(before, after []*ast.Definition) {
+	newByName := make(map[string]*ast.Definition, len(after))
+	for _, def := range after {
+		newByName[def.Name] = def
+	}
+
+	oldNames := make(map[string]bool, len(before))
+	for _, oldDef := range before {
+		oldNames[oldDef.Name] = true
+
+		newDef, ok := newByName[oldDef.Name]
+		if !ok {
+			c.add(BreakingData, oldDef.Name, "definition removed; its relationships become invalid")
+			continue
+		}
+		c.relations(oldDef, newDef)
+		c.permissions(oldDef, newDef)
+	}
+
+	for _, def := range after {
+		if !oldNames[def.Name] {
+			c.add(Additive, def.Name, "definition added")
+		}
+	}
+}
+
+func (c *comparer) relations(oldDef, newDef *ast.Definition) {
+	newByName := make(map[string]*ast.Relation, len(newDef.Relations))
+	for _, rel := range newDef.Relations {
+		newByName[rel.Name] = rel
+	}
+
+	oldNames := make(map[string]bool, len(oldDef.Relations))
+	for _, oldRel := range oldDef.Relations {
+		oldNames[oldRel.Name] = true
+		object := oldDef.Name + "#" + oldRel.Name
+
+		newRel, ok := newByName[oldRel.Name]
+		if !ok {
+			c.add(BreakingData, object, "relation removed; its relationships become invalid")
+			continue
+		}
+
+		oldTypes := subjectTypes(oldRel)
+		newTypes := subjectTypes(newRel)
+		for _, st := range oldTypes {
+			if !slices.Contains(newTypes, st) {
+				c.add(BreakingData, object, "subject type %s removed; relationships with it become invalid", st)
+			}
+		}
+		for _, st := range newTypes {
+			if !slices.Contains(oldTypes, st) {
+				c.add(Additive, object, "subject type %s added", st)
+			}
+		}
+	}
+
+	for _, rel := range newDef.Relations {
+		if !oldNames[rel.Name] {
+			c.add(Additive, newDef.Name+"#"+rel.Name, "relation added")
+		}
+	}
+}
+
+// permissions compares permissions by expression and by the subject types that can hold
+// them, since those decide which Check and Lookup functions are generated. Reachability
+// can change even if the expression did not, through the relations it refers to.
+func (c *comparer) permissions(oldDef, newDef *ast.Definition) {
+	newByName := make(map[string]*ast.Permission, len(newDef.Permissions))
+	for _, perm := range newDef.Permissions {
+		newByName[perm.Name] = perm
+	}
+
+	oldNames := make(map[string]bool, len(oldDef.Permissions))
+	for _, oldPerm := range oldDef.Permissions {
+		oldNames[oldPerm.Name] = true
+		object := oldDef.Name + "#" + oldPerm.Name
+
+		newPerm, ok := newByName[oldPerm.Name]
+		if !ok {
+			c.add(BreakingAPI, object, "permission removed")
+			continue
+		}
+
+		oldTypes := c.oldReach.SubjectTypes(oldDef.Name, oldPerm.Name)
+		newTypes := c.newReach.SubjectTypes(newDef.Name, newPerm.Name)
+		for _, st := range oldTypes {
+			if !slices.Contains(newTypes, st) {
+				c.add(BreakingAPI, object, "can no longer be granted to %s; its check and lookup functions for %s are removed", st, st)
+			}
+		}
+		for _, st := range newTypes {
+			if !slices.Contains(oldTypes, st) {
+				c.add(Additive, object, "can now be granted to %s", st)
+			}
+		}
+
+		if oldExpr, newExpr := printer.Expression(oldPerm.Expression), printer.Expression(newPerm.Expression); oldExpr != newExpr {
+			c.add(Additive, object, "expression changed from %q to %q", oldExpr, newExpr)
+		}
+	}
+
+	for _, perm := range newDef.Permissions {
+		if !oldNames[perm.Name] {
+			c.add(Additive, newDef.Name+"#"+perm.Name, "permission added")
+		}
+	}
+}
+
+func subjectTypes(rel *ast.Relation) []string {
+	types := make([]string, len(rel.SubjectTypes))
+	for i, st := range rel.SubjectTypes {
+		types[i] = printer.SubjectType(st)
+	}
+	return types
+}
@@ -0,0 +1,175 @@
+package diff
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/oitnes/authzed-codegen/internal/generator/ast"
+	"github.com/oitnes/authzed-codegen/internal/generator/parser"
+	zedlexer "github.com/oitnes/authzed-codegen/internal/generator/zed_lexer"
+)
+
+func mustParse(t *testing.T, input string) *ast.Schema {
+	t.Helper()
+	tokens, err := zedlexer.Lex(input)
+	if err != nil {
+		t.Fatalf("Lex() error: %v", err)
+	}
+	schema, err := parser.Parse(tokens)
+	if err != nil {
+		t.Fatalf("Parse() error: %v", err)
+	}
+	return schema
+}
+
+func TestCompareIdentical(t *testing.T) {
+	schema := `definition user {}
+
+definition doc {
+	relation owner: user
+	permission view = owner
+}`
+	if changes := Compare(mustParse(t, schema), mustParse(t, schema)); len(changes) != 0 {
+		t.Errorf("expected no changes, got %v", changes)
+	}
+}
+
+func TestCompareIgnoresFormattingAndComments(t *testing.T) {
+	before := mustParse(t, `definition user {}
+definition doc { relation owner: user
+	permission view = (owner) }`)
+	after := mustParse(t, `// users
+definition user {}
+
+definition doc {
+	relation owner: user // the owner
+	permission view = owner
+}`)
+	if changes := Compare(before, after); len(changes) != 0 {
+		t.Errorf("expected no changes, got %v", changes)
+	}
+}
+
+func TestCompareClassifiesChanges(t *testing.T) {
+	before := mustParse(t, `use expiration
+
+caveat on_weekday(day int) {
+	day < 6
+}
+
+caveat in_region(region string, allowed list<string>) {
+	region in allowed
+}
+
+definition user {}
+
+definition team {
+	relation member: user
+}
+
+definition folder {}
+
+definition doc {
+	relation owner: user
+	relation viewer: user | user:* | team#member
+	relation parent: folder
+
+	permission edit = owner
+	permission view = viewer + edit
+	permission share = owner
+}`)
+	after := mustParse(t, `caveat in_region(region int, zone string) {
+	region == 1
+}
+
+caveat on_holiday(day int) {
+	day == 0
+}
+
+definition user {}
+
+definition team {
+	relation member: user
+}
+
+definition doc {
+	relation owner: user
+	relation viewer: user | team#member with on_holiday
+	relation editor: user
+
+	permission edit = owner + editor
+	permission view = edit
+}
+
+definition bot {}`)
+
+	want := []Change{
+		{BreakingData, "use expiration", "removed; relationships that rely on the feature become invalid"},
+		{BreakingData, "caveat on_weekday", "removed; relationships written with it become invalid"},
+		{BreakingData, "caveat in_region", "parameter region changed type from string to int; stored caveat contexts may no longer match"},
+		{BreakingAPI, "caveat in_region", "parameter allowed removed"},
+		{Additive, "caveat in_region", "parameter zone string added"},
+		{Additive, "caveat in_region", "expression changed"},
+		{Additive, "caveat on_holiday", "added"},
+		{BreakingData, "folder", "definition removed; its relationships become invalid"},
+		{BreakingData, "doc#viewer", "subject type user:* removed; relationships with it become invalid"},
+		{BreakingData, "doc#viewer", "subject type team#member removed; relationships with it become invalid"},
+		{Additive, "doc#viewer", "subject type team#member with on_holiday added"},
+		{BreakingData, "doc#parent", "relation removed; its relationships become invalid"},
+		{Additive, "doc#editor", "relation added"},
+		{Additive, "doc#edit", `expression changed from "owner" to "owner + editor"`},
+		{Additive, "doc#view", `expression changed from "viewer + edit" to "edit"`},
+		{BreakingAPI, "doc#share", "permission removed"},
+		{Additive, "bot", "definition added"},
+	}
+	if got := Compare(before, after); !reflect.DeepEqual(got, want) {
+		t.Errorf("Compare() =\n%v\nwant\n%v", got, want)
+	}
+}
+
+func TestComparePermissionSubjectTypes(t *testing.T) {
+	before := mustParse(t, `definition user {}
+definition service {}
+
+definition doc {
+	relation owner: user
+	relation reader: service
+	permission view = owner + reader
+}`)
+	after := mustParse(t, `definition user {}
+definition service {}
+definition bot {}
+
+definition doc {
+	relation owner: user | bot
+	relation reader: service
+	permission view = owner
+}`)
+
+	want := []Change{
+		{Additive, "doc#owner", "subject type bot added"},
+		{BreakingAPI, "doc#view", "can no longer be granted to service; its check and lookup functions for service are removed"},
+		{Additive, "doc#view", "can now be granted to bot"},
+		{Additive, "doc#view", `expression changed from "owner + reader" to "owner"`},
+		{Additive, "bot", "definition added"},
+	}
+	if got := Compare(before, after); !reflect.DeepEqual(got, want) {
+		t.Errorf("Compare() =\n%v\nwant\n%v", got, want)
+	}
+}
+
+func TestKindBreaking(t *testing.T) {
+	if Additive.Breaking() {
+		t.Error("Additive.Breaking() = true")
+	}
+	if !BreakingAPI.Breaking() || !BreakingData.Breaking() {
+		t.Error("breaking kinds report Breaking() = false")
+	}
+}
+
+func TestChangeString(t *testing.T) {
+	c := Change{Kind: BreakingAPI, Object: "doc#share", Message: "permission removed"}
+	if got, want := c.String(), "breaking-api: doc#share: permission removed"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,58 @@
+package generator
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/oitnes/authzed-codegen/internal/generator/diff"
+)
+
+// writeSchema writes content to name in dir and returns its path.
+func writeSchema(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestDiff(t *testing.T) {
+	dir := t.TempDir()
+	writeSchema(t, dir, "users.zed", "definition user {}")
+	changes, err := Diff(
+		writeSchema(t, dir, "old.zed", "import \"users.zed\"\ndefinition doc { relation owner: user }"),
+		writeSchema(t, dir, "new.zed", "import \"users.zed\"\ndefinition doc { relation owner: user\nrelation viewer: user }"),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := diff.Change{Kind: diff.Additive, Object: "doc#viewer", Message: "relation added"}
+	if len(changes) != 1 || changes[0] != want {
+		t.Errorf("Diff() = %v, want [%v]", changes, want)
+	}
+}
+
+func TestDiffInvalidSchema(t *testing.T) {
+	tests := []struct {
+		name    string
+		old     string
+		new     string
+		wantErr string
+	}{
+		{"old parse error", "definition {", "definition user {}", "old schema: parsing schema"},
+		{"new validation error", "definition user {}", "definition doc { relation owner: nobody }", "new schema: validating schema"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			_, err := Diff(writeSchema(t, dir, "old.zed", tt.old), writeSchema(t, dir, "new.zed", tt.new))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Diff() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,25 @@
+package generator
+
+import (
+	"fmt"
+
+	"github.com/oitnes/authzed-codegen/internal/generator/parser"
+	"github.com/oitnes/authzed-codegen/internal/generator/printer"
+	zedlexer "github.com/oitnes/authzed-codegen/internal/generator/zed_lexer"
+)
+
+// Format returns schemaContent in canonical form, keeping its comments. The schema only has
+// to be syntactically valid; references are not checked.
+func Format(schemaContent string) ([]byte, error) {
+	tokens, err := zedlexer.Lex(schemaContent)
+	if err != nil {
+		return nil, fmt.Errorf("lexing schema: %w", err)
+	}
+
+	schema, err := parser.Parse(tokens)
+	if err != nil {
+		return nil, fmt.Errorf("parsing schema: %w", err)
+	}
+
+	return printer.Print(schema), nil
+}
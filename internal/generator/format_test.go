@@ -0,0 +1,52 @@
+package generator
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	got, err := Format("definition user{}\n// docs\ndefinition doc{relation owner:user\npermission view=owner}")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := `definition user {}
+
+// docs
+definition doc {
+	relation owner: user
+
+	permission view = owner
+}
+`
+	if string(got) != want {
+		t.Errorf("Format() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestFormatDoesNotValidateReferences(t *testing.T) {
+	if _, err := Format("definition doc { relation owner: nobody }"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestFormatErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantErr string
+	}{
+		{"lex error", "definition doc { @ }", "lexing schema"},
+		{"parse error", "definition doc { relation }", "parsing schema"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Format(tt.input)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Format() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,372 @@
+package generator
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// runGenerated generates the schema into a package named permissions, adds test as a test file
+// of that package and runs it with go test. The package is generated inside this module so that
+// it can use pkg/authz and the memory engine; the leading underscore keeps it out of ./...
+func runGenerated(t *testing.T, schema, test string) {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("compiles generated code")
+	}
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go tool not found")
+	}
+
+	dir, err := os.MkdirTemp(".", "_generated")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	pkgDir := filepath.Join(dir, "permissions")
+	if err := GenerateFromString(schema, Config{OutputPath: pkgDir, PackageName: "permissions"}); err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(pkgDir, "generated_test.go"), []byte(test), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(goTool, "test", "./"+filepath.ToSlash(pkgDir))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("go test of generated code failed: %v\n%s", err, out)
+	}
+}
+
+const caveatedRelationsSchema = `
+caveat on_weekday(day int) {
+	day < 6
+}
+
+definition user {}
+
+definition group {}
+
+definition document {
+	relation viewer: user with on_weekday
+	relation editor: user | group with on_weekday
+	permission view = viewer + editor
+}
+`
+
+func TestGeneratedCaveatedRelations(t *testing.T) {
+	runGenerated(t, caveatedRelationsSchema, `package permissions
+
+import (
+	"context"
+	"testing"
+
+	"github.com/oitnes/authzed-codegen/pkg/authz/memory"
+)
+
+func TestCaveatedRelations(t *testing.T) {
+	ctx := context.Background()
+	engine, err := memory.NewEngine(schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := NewDocument("readme", engine)
+	alice := NewUser("alice", engine)
+	eng := NewGroup("eng", engine)
+
+	if _, err := doc.CreateEditorRelations(ctx, DocumentEditorObjects{User: []User{alice}}); err != nil {
+		t.Fatalf("CreateEditorRelations: %v", err)
+	}
+	if _, err := doc.CreateEditorRelationsWithOnWeekday(ctx, DocumentEditorWithOnWeekdayObjects{Group: []Group{eng}}, OnWeekdayCaveatContext{}); err != nil {
+		t.Fatalf("CreateEditorRelationsWithOnWeekday: %v", err)
+	}
+	if _, err := doc.CreateViewerRelationsWithOnWeekday(ctx, DocumentViewerWithOnWeekdayObjects{User: []User{alice}}, OnWeekdayCaveatContext{}); err != nil {
+		t.Fatalf("CreateViewerRelationsWithOnWeekday: %v", err)
+	}
+
+	editors, err := doc.ReadEditorRelationsDetailed(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(editors) != 2 {
+		t.Fatalf("ReadEditorRelationsDetailed() returned %d relations, want 2", len(editors))
+	}
+
+	if _, err := doc.DeleteViewerRelationsWithOnWeekday(ctx, DocumentViewerWithOnWeekdayObjects{User: []User{alice}}); err != nil {
+		t.Fatalf("DeleteViewerRelationsWithOnWeekday: %v", err)
+	}
+	viewers, err := doc.ReadViewerRelationsDetailed(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(viewers) != 0 {
+		t.Fatalf("ReadViewerRelationsDetailed() returned %d relations after delete, want 0", len(viewers))
+	}
+}
+
+const schema = `+"`"+caveatedRelationsSchema+"`"+`
+`)
+}
+
+const mixedExpirationSchema = `
+use expiration
+
+definition user {}
+
+definition group {
+	relation member: user
+}
+
+definition document {
+	relation guest: user with expiration
+	relation viewer: user | group#member with expiration
+	permission view = guest + viewer
+}
+`
+
+func TestGeneratedMixedExpiration(t *testing.T) {
+	runGenerated(t, mixedExpirationSchema, `package permissions
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/oitnes/authzed-codegen/pkg/authz/memory"
+)
+
+func TestMixedExpiration(t *testing.T) {
+	ctx := context.Background()
+	engine, err := memory.NewEngine(schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := NewDocument("readme", engine)
+	alice := NewUser("alice", engine)
+	eng := NewGroup("eng", engine)
+	expiresAt := time.Now().Add(time.Hour)
+
+	if _, err := doc.CreateViewerRelations(ctx, DocumentViewerObjects{User: []User{alice}, GroupMember: []Group{eng}}, expiresAt); err != nil {
+		t.Fatalf("CreateViewerRelations: %v", err)
+	}
+	viewers, err := doc.ReadViewerRelationsDetailed(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range viewers {
+		if expiring := !v.ExpiresAt.IsZero(); expiring != (v.Group != nil) {
+			t.Errorf("viewer %+v: expiring = %v, want it only for group members", v, expiring)
+		}
+	}
+
+	if _, err := doc.TouchViewerRelations(ctx, DocumentViewerObjects{User: []User{alice}}, time.Time{}); err != nil {
+		t.Fatalf("TouchViewerRelations without expiry for users: %v", err)
+	}
+	if _, err := doc.TouchViewerRelations(ctx, DocumentViewerObjects{GroupMember: []Group{eng}}, time.Time{}); err == nil {
+		t.Error("TouchViewerRelations with a zero expiresAt for group members succeeded")
+	}
+	if _, err := doc.CreateGuestRelations(ctx, DocumentGuestObjects{User: []User{alice}}, time.Time{}); err == nil {
+		t.Error("CreateGuestRelations with a zero expiresAt succeeded")
+	}
+
+	tx := NewClient(engine).Tx().TouchDocumentViewerRelations(doc, DocumentViewerObjects{User: []User{alice}, GroupMember: []Group{eng}}, expiresAt)
+	if _, err := tx.Commit(ctx); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+}
+
+const schema = `+"`"+mixedExpirationSchema+"`"+`
+`)
+}
+
+const bulkCheckSchema = `
+definition user {}
+
+definition document {
+	relation viewer: user
+	permission view = viewer
+}
+`
+
+func TestGeneratedCheckManyChunks(t *testing.T) {
+	runGenerated(t, bulkCheckSchema, `package permissions
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/oitnes/authzed-codegen/pkg/authz"
+	"github.com/oitnes/authzed-codegen/pkg/authz/memory"
+)
+
+func TestCheckManyChunks(t *testing.T) {
+	ctx := context.Background()
+	engine, err := memory.NewEngine(schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice := NewUser("alice", engine)
+	bob := NewUser("bob", engine)
+
+	// Two subjects per resource need more checks than fit in one bulk request.
+	docs := make([]Document, authz.MaxBulkCheckItems/2+100)
+	for i := range docs {
+		docs[i] = NewDocument(fmt.Sprint(i), engine)
+	}
+	last := docs[len(docs)-1]
+	if _, err := last.CreateViewerRelations(ctx, DocumentViewerObjects{User: []User{bob}}); err != nil {
+		t.Fatal(err)
+	}
+
+	allowed, err := CheckManyDocumentsWithView(ctx, engine, docs, CheckDocumentViewInputs{User: []User{alice, bob}})
+	if err != nil {
+		t.Fatalf("CheckManyDocumentsWithView: %v", err)
+	}
+	for i, ok := range allowed {
+		if ok != (i == len(docs)-1) {
+			t.Errorf("allowed[%d] = %v", i, ok)
+		}
+	}
+}
+
+const schema = `+"`"+bulkCheckSchema+"`"+`
+`)
+}
+
+const conditionalCheckSchema = `
+caveat on_weekday(day int) {
+	day < 6
+}
+
+definition user {}
+
+definition document {
+	relation viewer: user | user with on_weekday
+	permission view = viewer
+}
+`
+
+func TestGeneratedCheckResultChunksAndMissingFields(t *testing.T) {
+	runGenerated(t, conditionalCheckSchema, `package permissions
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/oitnes/authzed-codegen/pkg/authz"
+	"github.com/oitnes/authzed-codegen/pkg/authz/memory"
+)
+
+func TestCheckResult(t *testing.T) {
+	ctx := context.Background()
+	engine, err := memory.NewEngine(schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := NewDocument("readme", engine)
+
+	users := make([]User, authz.MaxBulkCheckItems+100)
+	for i := range users {
+		users[i] = NewUser(fmt.Sprint(i), engine)
+	}
+	if _, err := doc.CreateViewerRelationsWithOnWeekday(ctx, DocumentViewerWithOnWeekdayObjects{User: users[:2]}, OnWeekdayCaveatContext{}); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := doc.CheckViewResult(ctx, CheckDocumentViewInputs{User: users}, nil)
+	if err != nil {
+		t.Fatalf("CheckViewResult: %v", err)
+	}
+	if !res.Conditional() || !reflect.DeepEqual(res.MissingFields, []string{"day"}) {
+		t.Errorf("CheckViewResult() = %+v, want conditional on day", res)
+	}
+
+	if _, err := doc.CreateViewerRelations(ctx, DocumentViewerObjects{User: users[len(users)-1:]}); err != nil {
+		t.Fatal(err)
+	}
+	allowed, err := doc.CheckView(ctx, CheckDocumentViewInputs{User: users})
+	if err != nil {
+		t.Fatalf("CheckView: %v", err)
+	}
+	if !allowed {
+		t.Error("CheckView() = false, want true for the subject in the last bulk request")
+	}
+}
+
+const schema = `+"`"+conditionalCheckSchema+"`"+`
+`)
+}
+
+const atomicWriteSchema = `
+definition user {}
+
+definition group {
+	relation member: user
+}
+
+definition document {
+	relation viewer: user | group#member
+	permission view = viewer
+}
+`
+
+func TestGeneratedAtomicRelationWrites(t *testing.T) {
+	runGenerated(t, atomicWriteSchema, `package permissions
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/oitnes/authzed-codegen/pkg/authz"
+	"github.com/oitnes/authzed-codegen/pkg/authz/memory"
+)
+
+func TestAtomicRelationWrites(t *testing.T) {
+	ctx := context.Background()
+	engine, err := memory.NewEngine(schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := NewDocument("readme", engine)
+	alice := NewUser("alice", engine)
+	eng := NewGroup("eng", engine)
+
+	if _, err := doc.CreateViewerRelations(ctx, DocumentViewerObjects{GroupMember: []Group{eng}}); err != nil {
+		t.Fatal(err)
+	}
+	// The group relationship exists, so the write fails and must not create the user one either.
+	if _, err := doc.CreateViewerRelations(ctx, DocumentViewerObjects{User: []User{alice}, GroupMember: []Group{eng}}); err == nil {
+		t.Fatal("CreateViewerRelations of an existing relationship succeeded")
+	}
+	viewers, err := doc.ReadViewerRelations(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(viewers.User) != 0 {
+		t.Errorf("failed CreateViewerRelations wrote users %v", viewers.User)
+	}
+
+	// The precondition guards the writes of every subject type.
+	_, err = doc.TouchViewerRelations(ctx, DocumentViewerObjects{User: []User{alice}, GroupMember: []Group{eng}}, doc.RequireNoViewer())
+	var failed *authz.PreconditionFailedError
+	if !errors.As(err, &failed) {
+		t.Fatalf("TouchViewerRelations() error = %v, want a precondition failure", err)
+	}
+	if viewers, err := doc.ReadViewerRelations(ctx); err != nil || len(viewers.User) != 0 {
+		t.Errorf("ReadViewerRelations() = %v, %v after a failed precondition, want no users", viewers, err)
+	}
+
+	if _, err := doc.DeleteViewerRelations(ctx, DocumentViewerObjects{GroupMember: []Group{eng}}, doc.RequireAnyViewer()); err != nil {
+		t.Fatalf("DeleteViewerRelations: %v", err)
+	}
+}
+
+const schema = `+"`"+atomicWriteSchema+"`"+`
+`)
+}
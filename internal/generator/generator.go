@@ -1,56 +1,75 @@
 package generator
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 	"unicode"
 
+	"github.com/oitnes/authzed-codegen/internal/generator/ast"
 	"github.com/oitnes/authzed-codegen/internal/generator/codegen"
-	"github.com/oitnes/authzed-codegen/internal/generator/parser"
-	zedlexer "github.com/oitnes/authzed-codegen/internal/generator/zed_lexer"
+	"github.com/oitnes/authzed-codegen/internal/generator/loader"
+	"github.com/oitnes/authzed-codegen/internal/generator/validator"
 )
 
 // Config holds the configuration for the code generation pipeline.
 type Config struct {
-	SchemaPath     string
+	SchemaPath     string // A schema file, a directory of .zed files, or a glob
 	OutputPath     string
 	PackageName    string
 	WithRepository bool
 	CleanPackage   bool
+
+	// SplitNamespaces generates each namespace into a sub-package of OutputPath.
+	SplitNamespaces bool
+	// ImportPath is the import path of OutputPath, from which the generated packages import
+	// each other's types. When empty, it is derived from the nearest go.mod above OutputPath.
+	ImportPath string
 }
 
-// Generate runs the full pipeline: read schema → lex → parse → generate → write.
+// Generate runs the full pipeline: read schema files → lex → parse → merge → generate → write.
 func Generate(cfg Config) error {
-	content, err := os.ReadFile(cfg.SchemaPath)
+	schema, err := loadSchema(cfg.SchemaPath)
 	if err != nil {
-		return fmt.Errorf("reading schema: %w", err)
+		return err
 	}
 
-	return GenerateFromString(string(content), cfg)
+	return generate(schema, cfg)
 }
 
 // GenerateFromString runs the pipeline from a schema string.
 func GenerateFromString(schemaContent string, cfg Config) error {
-	tokens, err := zedlexer.Lex(schemaContent)
+	schema, err := parseSchema(schemaContent)
 	if err != nil {
-		return fmt.Errorf("lexing schema: %w", err)
+		return err
 	}
 
-	schema, err := parser.Parse(tokens)
-	if err != nil {
-		return fmt.Errorf("parsing schema: %w", err)
-	}
+	return generate(schema, cfg)
+}
 
+func generate(schema *ast.Schema, cfg Config) error {
 	packageName := cfg.PackageName
 	if packageName == "" {
 		packageName = sanitizePackageName(filepath.Base(cfg.OutputPath))
 	}
 
+	importPath := cfg.ImportPath
+	if cfg.SplitNamespaces && importPath == "" {
+		var err error
+		if importPath, err = moduleImportPath(cfg.OutputPath); err != nil {
+			return fmt.Errorf("determining import path of %s: %w", cfg.OutputPath, err)
+		}
+	}
+
 	files, err := codegen.Generate(schema, codegen.Options{
-		PackageName:    packageName,
-		WithRepository: cfg.WithRepository,
+		PackageName:     packageName,
+		WithRepository:  cfg.WithRepository,
+		SplitNamespaces: cfg.SplitNamespaces,
+		ImportPath:      importPath,
 	})
 	if err != nil {
 		return fmt.Errorf("generating code: %w", err)
@@ -67,7 +86,10 @@ func GenerateFromString(schemaContent string, cfg Config) error {
 	}
 
 	for _, file := range files {
-		filePath := filepath.Join(cfg.OutputPath, file.Name)
+		filePath := filepath.Join(cfg.OutputPath, filepath.FromSlash(file.Name))
+		if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+			return fmt.Errorf("creating output directory: %w", err)
+		}
 		if err := os.WriteFile(filePath, []byte(file.Content), 0644); err != nil {
 			return fmt.Errorf("writing %s: %w", file.Name, err)
 		}
@@ -76,6 +98,74 @@ func GenerateFromString(schemaContent string, cfg Config) error {
 	return nil
 }
 
+// moduleImportPath derives the import path of dir from the module path declared in the
+// nearest go.mod in dir or one of its parents. dir need not exist yet.
+func moduleImportPath(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+
+	for moduleDir := dir; ; moduleDir = filepath.Dir(moduleDir) {
+		content, err := os.ReadFile(filepath.Join(moduleDir, "go.mod"))
+		if err == nil {
+			modulePath := modulePath(content)
+			if modulePath == "" {
+				return "", fmt.Errorf("no module path in %s", filepath.Join(moduleDir, "go.mod"))
+			}
+			rel, err := filepath.Rel(moduleDir, dir)
+			if err != nil {
+				return "", err
+			}
+			return path.Join(modulePath, filepath.ToSlash(rel)), nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+		if filepath.Dir(moduleDir) == moduleDir {
+			return "", errors.New("no go.mod found; pass the import path explicitly")
+		}
+	}
+}
+
+// modulePath returns the module path declared in the content of a go.mod file, or "".
+func modulePath(gomod []byte) string {
+	for _, line := range strings.Split(string(gomod), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == "module" {
+			return strings.Trim(fields[1], "\"`")
+		}
+	}
+	return ""
+}
+
+// loadSchema loads and validates the schema files that path names, with their imports.
+func loadSchema(path string) (*ast.Schema, error) {
+	schema, err := loader.Load(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validator.Validate(schema); err != nil {
+		return nil, fmt.Errorf("validating schema: %w", err)
+	}
+	return schema, nil
+}
+
+// parseSchema lexes, parses and validates schemaContent. Imports are resolved relative to
+// the working directory.
+func parseSchema(schemaContent string) (*ast.Schema, error) {
+	schema, err := loader.LoadString("", schemaContent)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validator.Validate(schema); err != nil {
+		return nil, fmt.Errorf("validating schema: %w", err)
+	}
+	return schema, nil
+}
+
 // sanitizePackageName ensures the directory name is a valid Go package name.
 func sanitizePackageName(name string) string {
 	name = strings.ToLower(name)
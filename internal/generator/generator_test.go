@@ -102,6 +102,101 @@ func TestGenerateDefaultPackageName(t *testing.T) {
 	}
 }
 
+func TestGenerateFromSchemaDirectory(t *testing.T) {
+	schemaDir := t.TempDir()
+	writeSchema(t, schemaDir, "common.zed", `partial owned {
+	relation owner: user
+	permission manage = owner
+}
+
+definition user {}`)
+	writeSchema(t, schemaDir, "booking.zed", `import "common.zed"
+
+definition bookingsvc/booking {
+	...owned
+}`)
+	outputDir := t.TempDir()
+
+	err := Generate(Config{
+		SchemaPath:  schemaDir,
+		OutputPath:  outputDir,
+		PackageName: "permissions",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(outputDir, "bookingsvc_booking.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"CreateOwnerRelations", "CheckManage"} {
+		if !strings.Contains(string(content), want) {
+			t.Errorf("expected %q in generated booking file", want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, "user.go")); err != nil {
+		t.Errorf("expected user.go to be generated: %v", err)
+	}
+}
+
+func TestGenerateSplitNamespaces(t *testing.T) {
+	moduleDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(moduleDir, "go.mod"), []byte("module example.com/app\n\ngo 1.24\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	outputDir := filepath.Join(moduleDir, "internal", "perms")
+
+	err := GenerateFromString(`definition user {}
+
+definition bookingsvc/booking {
+	relation owner: user
+}`, Config{
+		OutputPath:      outputDir,
+		SplitNamespaces: true,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(outputDir, "bookingsvc", "booking.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"package bookingsvc", `"example.com/app/internal/perms"`, "User []perms.User"} {
+		if !strings.Contains(string(content), want) {
+			t.Errorf("expected %q in generated booking file", want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, "user.go")); err != nil {
+		t.Errorf("expected user.go in the root package: %v", err)
+	}
+}
+
+func TestModuleImportPath(t *testing.T) {
+	moduleDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(moduleDir, "go.mod"), []byte("// app\nmodule \"example.com/app\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		dir  string
+		want string
+	}{
+		{moduleDir, "example.com/app"},
+		{filepath.Join(moduleDir, "gen", "perms"), "example.com/app/gen/perms"},
+	}
+	for _, tt := range tests {
+		got, err := moduleImportPath(tt.dir)
+		if err != nil {
+			t.Fatalf("moduleImportPath(%q) error: %v", tt.dir, err)
+		}
+		if got != tt.want {
+			t.Errorf("moduleImportPath(%q) = %q, want %q", tt.dir, got, tt.want)
+		}
+	}
+}
+
 func TestGenerateMissingSchemaFile(t *testing.T) {
 	err := Generate(Config{
 		SchemaPath:  "/nonexistent/path/schema.zed",
@@ -143,6 +238,24 @@ func TestGenerateFromStringParseError(t *testing.T) {
 	}
 }
 
+func TestGenerateFromStringValidationError(t *testing.T) {
+	err := GenerateFromString(`definition doc {
+	relation owner: user
+	permission view = viewer
+}`, Config{
+		OutputPath:  t.TempDir(),
+		PackageName: "test",
+	})
+	if err == nil {
+		t.Fatal("expected error for undefined type and relation")
+	}
+	for _, want := range []string{"validating schema", "line 2, column 18", "line 3, column 20"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected %q in error, got: %v", want, err)
+		}
+	}
+}
+
 func TestGenerateFromStringMkdirError(t *testing.T) {
 	err := GenerateFromString("definition user {}", Config{
 		OutputPath:  "/dev/null/impossible",
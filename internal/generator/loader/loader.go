@@ -0,0 +1,292 @@
+// Package loader builds one schema out of several schema files. It expands a schema path
+// that names a file, a directory or a glob, follows the import directives of each file,
+// merges the files, and expands partial definitions into the definitions that include them.
+package loader
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/oitnes/authzed-codegen/internal/generator/ast"
+	"github.com/oitnes/authzed-codegen/internal/generator/parser"
+	zedlexer "github.com/oitnes/authzed-codegen/internal/generator/zed_lexer"
+)
+
+// Diagnostic is a single problem found while loading a schema. Its position names the file.
+type Diagnostic struct {
+	Pos     ast.Pos
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s", d.Pos, d.Message)
+}
+
+// Error reports every problem found in one stage of loading: lexing, parsing or resolving
+// imports and partials. Loading stops after the first stage with problems, since each stage
+// needs the output of the previous one to be complete.
+type Error struct {
+	Diagnostics []Diagnostic
+}
+
+func (e *Error) Error() string {
+	if len(e.Diagnostics) == 1 {
+		return e.Diagnostics[0].String()
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d errors:", len(e.Diagnostics))
+	for _, d := range e.Diagnostics {
+		b.WriteString("\n  ")
+		b.WriteString(d.String())
+	}
+	return b.String()
+}
+
+// Files returns the schema files that path names: path itself if it is a file, the .zed
+// files below it if it is a directory, or the files matching it if it is a glob, in
+// lexical order.
+func Files(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	switch {
+	case err == nil && !info.IsDir():
+		return []string{path}, nil
+	case err == nil:
+		var files []string
+		err := filepath.WalkDir(path, func(file string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !entry.IsDir() && filepath.Ext(file) == ".zed" {
+				files = append(files, file)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(files) == 0 {
+			return nil, fmt.Errorf("no .zed files in %s", path)
+		}
+		return files, nil
+	case !strings.ContainsAny(path, `*?[\`):
+		return nil, err
+	}
+
+	matches, err := filepath.Glob(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema pattern %q: %w", path, err)
+	}
+	var files []string
+	for _, match := range matches {
+		if info, err := os.Stat(match); err == nil && !info.IsDir() {
+			files = append(files, match)
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no schema files match %q", path)
+	}
+	return files, nil
+}
+
+// Load reads the schema files that path names (see Files) and the files they import, and
+// returns them merged into one schema with partials expanded. Every position names the file
+// it comes from. Problems in the schema text are reported as an *Error, wrapped with the
+// stage that found them.
+func Load(path string) (*ast.Schema, error) {
+	files, err := Files(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading schema: %w", err)
+	}
+
+	l := newLoader()
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("reading schema: %w", err)
+		}
+		l.add(file, string(content))
+	}
+	return l.merge()
+}
+
+// LoadString is like Load for a single schema given as content. Positions name file, which
+// may be empty, and imports are resolved relative to its directory.
+func LoadString(file, content string) (*ast.Schema, error) {
+	l := newLoader()
+	l.add(file, content)
+	return l.merge()
+}
+
+type loader struct {
+	loaded  map[string]bool // absolute paths of the files added so far
+	schemas []*ast.Schema   // parsed files, each after the files it imports
+
+	lexDiagnostics     []Diagnostic
+	parseDiagnostics   []Diagnostic
+	resolveDiagnostics []Diagnostic
+}
+
+func newLoader() *loader {
+	return &loader{loaded: make(map[string]bool)}
+}
+
+// add parses one file and, before it, the files it imports. Files already added are skipped,
+// so a file imported from several places, or matched by the schema path as well as
+// imported, is loaded once, and import cycles end.
+func (l *loader) add(file, content string) {
+	if file != "" {
+		key, err := filepath.Abs(file)
+		if err != nil {
+			key = filepath.Clean(file)
+		}
+		if l.loaded[key] {
+			return
+		}
+		l.loaded[key] = true
+	}
+
+	tokens, err := zedlexer.Lex(content)
+	if err != nil {
+		var lexErr *zedlexer.Error
+		if !errors.As(err, &lexErr) {
+			l.lexDiagnostics = append(l.lexDiagnostics, Diagnostic{Pos: ast.Pos{File: file}, Message: err.Error()})
+			return
+		}
+		for _, t := range lexErr.Illegal {
+			l.lexDiagnostics = append(l.lexDiagnostics, Diagnostic{
+				Pos:     ast.Pos{File: file, Line: t.Line, Column: t.Column},
+				Message: fmt.Sprintf("illegal token %q", t.Literal),
+			})
+		}
+		return
+	}
+
+	schema, errs := parser.ParseFile(file, tokens)
+	if len(errs) > 0 {
+		for _, e := range errs {
+			l.parseDiagnostics = append(l.parseDiagnostics, Diagnostic{
+				Pos:     ast.Pos{File: file, Line: e.Line, Column: e.Column},
+				Message: e.Message,
+			})
+		}
+		return
+	}
+
+	for _, imp := range schema.Imports {
+		path := imp.Path
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(filepath.Dir(file), path)
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			l.resolveDiagnostics = append(l.resolveDiagnostics, Diagnostic{
+				Pos:     imp.Pos,
+				Message: fmt.Sprintf("importing %q: %v", imp.Path, err),
+			})
+			continue
+		}
+		l.add(path, string(content))
+	}
+
+	l.schemas = append(l.schemas, schema)
+}
+
+// merge combines the parsed files in load order and expands partials.
+func (l *loader) merge() (*ast.Schema, error) {
+	if len(l.lexDiagnostics) > 0 {
+		return nil, fmt.Errorf("lexing schema: %w", &Error{Diagnostics: l.lexDiagnostics})
+	}
+	if len(l.parseDiagnostics) > 0 {
+		return nil, fmt.Errorf("parsing schema: %w", &Error{Diagnostics: l.parseDiagnostics})
+	}
+	if len(l.resolveDiagnostics) > 0 {
+		return nil, fmt.Errorf("resolving schema: %w", &Error{Diagnostics: l.resolveDiagnostics})
+	}
+
+	merged := &ast.Schema{}
+	x := &expander{partials: make(map[string]*ast.Definition), visiting: make(map[string]bool), seen: make(map[Diagnostic]bool)}
+	for _, schema := range l.schemas {
+		for _, flag := range schema.UseFlags {
+			if !merged.Uses(flag.Name) {
+				merged.UseFlags = append(merged.UseFlags, flag)
+			}
+		}
+		merged.Caveats = append(merged.Caveats, schema.Caveats...)
+		merged.Definitions = append(merged.Definitions, schema.Definitions...)
+
+		for _, partial := range schema.Partials {
+			if first, ok := x.partials[partial.Name]; ok {
+				x.report(partial.Pos, "duplicate partial %q, first declared at %s", partial.Name, first.Pos)
+				continue
+			}
+			x.partials[partial.Name] = partial
+		}
+	}
+
+	for _, def := range merged.Definitions {
+		def.Relations, def.Permissions = x.members(def)
+		def.PartialRefs = nil
+	}
+
+	if len(x.diagnostics) > 0 {
+		return nil, fmt.Errorf("resolving schema: %w", &Error{Diagnostics: x.diagnostics})
+	}
+	return merged, nil
+}
+
+// expander resolves partial references.
+type expander struct {
+	partials    map[string]*ast.Definition
+	visiting    map[string]bool // partials being expanded, to detect cycles
+	seen        map[Diagnostic]bool
+	diagnostics []Diagnostic
+}
+
+func (x *expander) report(pos ast.Pos, format string, args ...any) {
+	d := Diagnostic{Pos: pos, Message: fmt.Sprintf(format, args...)}
+	if !x.seen[d] {
+		x.seen[d] = true
+		x.diagnostics = append(x.diagnostics, d)
+	}
+}
+
+// members returns the relations and permissions of def: those of the partials it includes,
+// expanded recursively and in the order of the references, followed by its own. Members
+// taken from a partial are copies that keep the partial's positions.
+func (x *expander) members(def *ast.Definition) ([]*ast.Relation, []*ast.Permission) {
+	var relations []*ast.Relation
+	var permissions []*ast.Permission
+
+	for _, ref := range def.PartialRefs {
+		partial, ok := x.partials[ref.Name]
+		if !ok {
+			x.report(ref.Pos, "undefined partial %q", ref.Name)
+			continue
+		}
+		if x.visiting[ref.Name] {
+			x.report(ref.Pos, "partial %q includes itself", ref.Name)
+			continue
+		}
+
+		x.visiting[ref.Name] = true
+		partialRelations, partialPermissions := x.members(partial)
+		delete(x.visiting, ref.Name)
+
+		for _, rel := range partialRelations {
+			r := *rel
+			relations = append(relations, &r)
+		}
+		for _, perm := range partialPermissions {
+			p := *perm
+			permissions = append(permissions, &p)
+		}
+	}
+
+	return append(relations, def.Relations...), append(permissions, def.Permissions...)
+}
@@ -0,0 +1,322 @@
+package loader
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/oitnes/authzed-codegen/internal/generator/ast"
+)
+
+// writeFiles creates the files, given by slash-separated path relative to a temporary
+// directory, and returns the directory.
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func definitionNames(schema *ast.Schema) []string {
+	var names []string
+	for _, def := range schema.Definitions {
+		names = append(names, def.Name)
+	}
+	return names
+}
+
+func memberNames(def *ast.Definition) []string {
+	var names []string
+	for _, rel := range def.Relations {
+		names = append(names, rel.Name)
+	}
+	for _, perm := range def.Permissions {
+		names = append(names, perm.Name)
+	}
+	return names
+}
+
+func loadError(t *testing.T, err error) *Error {
+	t.Helper()
+	var loadErr *Error
+	if !errors.As(err, &loadErr) {
+		t.Fatalf("expected a *loader.Error, got %v", err)
+	}
+	return loadErr
+}
+
+func TestFiles(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"schema/b.zed":        "",
+		"schema/a.zed":        "",
+		"schema/nested/c.zed": "",
+		"schema/notes.txt":    "",
+	})
+
+	tests := []struct {
+		name string
+		path string
+		want []string
+	}{
+		{"file", "schema/a.zed", []string{"schema/a.zed"}},
+		{"directory", "schema", []string{"schema/a.zed", "schema/b.zed", "schema/nested/c.zed"}},
+		{"glob", "schema/*.zed", []string{"schema/a.zed", "schema/b.zed"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Files(filepath.Join(dir, filepath.FromSlash(tt.path)))
+			if err != nil {
+				t.Fatalf("Files() error: %v", err)
+			}
+			var want []string
+			for _, file := range tt.want {
+				want = append(want, filepath.Join(dir, filepath.FromSlash(file)))
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Files() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestFilesErrors(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"empty/notes.txt": ""})
+
+	for _, path := range []string{"missing.zed", "empty", "*.zed"} {
+		if _, err := Files(filepath.Join(dir, path)); err == nil {
+			t.Errorf("Files(%q) succeeded, want an error", path)
+		}
+	}
+}
+
+func TestLoadMergesFilesAndImports(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"common/users.zed": `use expiration
+
+definition user {}`,
+		"services/booking.zed": `import "../common/users.zed"
+
+definition bookingsvc/booking {
+	relation owner: user with expiration
+}`,
+		"services/menu.zed": `import "../common/users.zed"
+use expiration
+
+definition menusvc/order {
+	relation creator: user
+}`,
+	})
+
+	schema, err := Load(filepath.Join(dir, "services"))
+	if err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+
+	if got, want := definitionNames(schema), []string{"user", "bookingsvc/booking", "menusvc/order"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("definitions = %v, want %v", got, want)
+	}
+	if len(schema.UseFlags) != 1 || !schema.Uses("expiration") {
+		t.Errorf("UseFlags = %+v, want one expiration flag", schema.UseFlags)
+	}
+	if len(schema.Imports) != 0 {
+		t.Errorf("Imports = %+v, want none after loading", schema.Imports)
+	}
+
+	owner := schema.Definitions[1].Relations[0]
+	if want := filepath.Join(dir, "services", "booking.zed"); owner.Pos.File != want || owner.Pos.Line != 4 {
+		t.Errorf("owner position = %v, want line 4 of %s", owner.Pos, want)
+	}
+	if want := filepath.Join(dir, "common", "users.zed"); schema.Definitions[0].Pos.File != want {
+		t.Errorf("user position = %v, want %s", schema.Definitions[0].Pos, want)
+	}
+}
+
+func TestLoadImportCycle(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"a.zed": `import "b.zed"
+definition a { relation b: b }`,
+		"b.zed": `import "a.zed"
+definition b { relation a: a }`,
+	})
+
+	schema, err := Load(filepath.Join(dir, "a.zed"))
+	if err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+	if got, want := definitionNames(schema), []string{"b", "a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("definitions = %v, want %v", got, want)
+	}
+}
+
+func TestLoadExpandsPartials(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"partials.zed": `partial viewable {
+	relation viewer: user
+	permission view = viewer + edit
+}
+
+partial editable {
+	...viewable
+	relation editor: user
+	permission edit = editor
+}`,
+		"schema.zed": `import "partials.zed"
+
+definition user {}
+
+definition doc {
+	...editable
+	relation owner: user
+	permission delete = owner
+}
+
+definition folder {
+	...viewable
+	permission edit = nil
+}`,
+	})
+
+	schema, err := Load(filepath.Join(dir, "schema.zed"))
+	if err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+	if len(schema.Partials) != 0 {
+		t.Errorf("Partials = %+v, want none after loading", schema.Partials)
+	}
+
+	doc, folder := schema.Definitions[1], schema.Definitions[2]
+	if got, want := memberNames(doc), []string{"viewer", "editor", "owner", "view", "edit", "delete"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("doc members = %v, want %v", got, want)
+	}
+	if got, want := memberNames(folder), []string{"viewer", "view", "edit"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("folder members = %v, want %v", got, want)
+	}
+	if len(doc.PartialRefs) != 0 {
+		t.Errorf("doc PartialRefs = %+v, want none after loading", doc.PartialRefs)
+	}
+
+	if doc.Relations[0] == folder.Relations[0] {
+		t.Error("definitions share the relation of a partial, want copies")
+	}
+	if want := filepath.Join(dir, "partials.zed"); doc.Relations[0].Pos.File != want {
+		t.Errorf("included relation position = %v, want it in %s", doc.Relations[0].Pos, want)
+	}
+}
+
+func TestLoadString(t *testing.T) {
+	schema, err := LoadString("", `partial owned { relation owner: user }
+definition user {}
+definition doc { ...owned }`)
+	if err != nil {
+		t.Fatalf("LoadString() error: %v", err)
+	}
+	if got := memberNames(schema.Definitions[1]); !reflect.DeepEqual(got, []string{"owner"}) {
+		t.Errorf("doc members = %v, want [owner]", got)
+	}
+	if pos := schema.Definitions[1].Pos; pos.File != "" || pos.Line != 3 {
+		t.Errorf("doc position = %+v, want line 3 without a file", pos)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		stage string
+		want  []string
+	}{
+		{
+			name:  "illegal tokens in several files",
+			files: map[string]string{"a.zed": "definition a { @ }", "b.zed": "definition b $"},
+			stage: "lexing schema",
+			want:  []string{`a.zed:1:16: illegal token "@"`, `b.zed:1:14: illegal token "$"`},
+		},
+		{
+			name:  "syntax error",
+			files: map[string]string{"a.zed": "definition a {}", "b.zed": "definition {}"},
+			stage: "parsing schema",
+			want:  []string{"b.zed:1:12: expected token type IDENTIFIER"},
+		},
+		{
+			name:  "missing import",
+			files: map[string]string{"a.zed": `import "missing.zed"`, "b.zed": "definition b {}"},
+			stage: "resolving schema",
+			want:  []string{`a.zed:1:8: importing "missing.zed"`},
+		},
+		{
+			name:  "undefined partial",
+			files: map[string]string{"a.zed": "definition a {\n\t...missing\n}"},
+			stage: "resolving schema",
+			want:  []string{`a.zed:2:5: undefined partial "missing"`},
+		},
+		{
+			name:  "partial cycle",
+			files: map[string]string{"a.zed": "partial p { ...q }\npartial q { ...p }\ndefinition a { ...p }"},
+			stage: "resolving schema",
+			want:  []string{`a.zed:2:16: partial "p" includes itself`},
+		},
+		{
+			name:  "duplicate partial across files",
+			files: map[string]string{"a.zed": "partial p {}", "b.zed": "partial p {}"},
+			stage: "resolving schema",
+			want:  []string{`b.zed:1:9: duplicate partial "p", first declared at `},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeFiles(t, tt.files)
+			_, err := Load(filepath.Join(dir, "*.zed"))
+			if err == nil {
+				t.Fatal("Load() succeeded, want an error")
+			}
+			if !strings.HasPrefix(err.Error(), tt.stage+": ") {
+				t.Errorf("error = %v, want the %q stage", err, tt.stage)
+			}
+
+			diagnostics := loadError(t, err).Diagnostics
+			if len(diagnostics) != len(tt.want) {
+				t.Fatalf("got %d diagnostics, want %d: %v", len(diagnostics), len(tt.want), diagnostics)
+			}
+			for i, want := range tt.want {
+				if got := diagnostics[i].String(); !strings.HasPrefix(got, filepath.Join(dir, want)) {
+					t.Errorf("diagnostic %d = %q, want prefix %q", i, got, filepath.Join(dir, want))
+				}
+			}
+		})
+	}
+}
+
+func TestLoadMissingFile(t *testing.T) {
+	_, err := Load(filepath.Join(t.TempDir(), "missing.zed"))
+	if err == nil || !strings.Contains(err.Error(), "reading schema") {
+		t.Errorf("Load() error = %v, want a reading schema error", err)
+	}
+}
+
+func TestErrorMessage(t *testing.T) {
+	single := &Error{Diagnostics: []Diagnostic{{Pos: ast.Pos{File: "a.zed", Line: 2, Column: 4}, Message: "bad"}}}
+	if got, want := single.Error(), "a.zed:2:4: bad"; got != want {
+		t.Errorf("single Error() = %q, want %q", got, want)
+	}
+
+	multiple := &Error{Diagnostics: []Diagnostic{
+		{Pos: ast.Pos{File: "a.zed", Line: 1, Column: 1}, Message: "first"},
+		{Pos: ast.Pos{Line: 3, Column: 2}, Message: "second"},
+	}}
+	if got, want := multiple.Error(), "2 errors:\n  a.zed:1:1: first\n  line 3, column 2: second"; got != want {
+		t.Errorf("multiple Error() = %q, want %q", got, want)
+	}
+}
@@ -79,12 +79,54 @@ func RelationObjectsStructName(defName, relName string) string {
 	return ToPascalCase(defName) + ToPascalCase(relName) + "Objects"
 }
 
+// RelationshipStructName generates the struct name for one relationship returned by a detailed read.
+// e.g., def="public_forum", rel="owner" -> "PublicForumOwnerRelationship"
+func RelationshipStructName(defName, relName string) string {
+	return ToPascalCase(defName) + ToPascalCase(relName) + "Relationship"
+}
+
+// RelationAddedEventName generates the watch event name for a created or touched relationship.
+// e.g., def="document", rel="viewer" -> "DocumentViewerAdded"
+func RelationAddedEventName(defName, relName string) string {
+	return ToPascalCase(defName) + ToPascalCase(relName) + "Added"
+}
+
+// RelationRemovedEventName generates the watch event name for a deleted relationship.
+// e.g., def="document", rel="viewer" -> "DocumentViewerRemoved"
+func RelationRemovedEventName(defName, relName string) string {
+	return ToPascalCase(defName) + ToPascalCase(relName) + "Removed"
+}
+
 // CheckInputStructName generates the input struct name for permission checks.
 // e.g., def="public_forum", perm="view" -> "CheckPublicForumViewInputs"
 func CheckInputStructName(defName, permName string) string {
 	return "Check" + ToPascalCase(defName) + ToPascalCase(permName) + "Inputs"
 }
 
+// SubjectInterfaceName generates the name of the interface implemented by the subject types of a permission.
+// e.g., def="public_forum", perm="view" -> "PublicForumViewSubject"
+func SubjectInterfaceName(defName, permName string) string {
+	return ToPascalCase(defName) + ToPascalCase(permName) + "Subject"
+}
+
+// CaveatConstName generates the constant name for a caveat.
+// e.g., "ip_allowlist" -> "CaveatIpAllowlist"
+func CaveatConstName(caveatName string) string {
+	return "Caveat" + ToPascalCase(caveatName)
+}
+
+// CaveatContextStructName generates the context struct name for a caveat.
+// e.g., "ip_allowlist" -> "IpAllowlistCaveatContext"
+func CaveatContextStructName(caveatName string) string {
+	return ToPascalCase(caveatName) + "CaveatContext"
+}
+
+// CaveatedRelationObjectsStructName generates the input struct name for caveated relation writes.
+// e.g., def="document", rel="viewer", caveat="ip_allowlist" -> "DocumentViewerWithIpAllowlistObjects"
+func CaveatedRelationObjectsStructName(defName, relName, caveatName string) string {
+	return ToPascalCase(defName) + ToPascalCase(relName) + "With" + ToPascalCase(caveatName) + "Objects"
+}
+
 // ReceiverName generates a short receiver variable name from a type name.
 // Uses the lowercase initials of each PascalCase word, max 3 chars.
 // e.g., "PublicForum" -> "pf", "BookingsvcBooking" -> "bb", "User" -> "u"
@@ -143,6 +143,23 @@ func TestRelationObjectsStructName(t *testing.T) {
 	}
 }
 
+func TestRelationshipStructName(t *testing.T) {
+	got := RelationshipStructName("bookingsvc/booking", "creator")
+	want := "BookingsvcBookingCreatorRelationship"
+	if got != want {
+		t.Errorf("RelationshipStructName() = %q, want %q", got, want)
+	}
+}
+
+func TestRelationEventNames(t *testing.T) {
+	if got, want := RelationAddedEventName("bookingsvc/booking", "creator"), "BookingsvcBookingCreatorAdded"; got != want {
+		t.Errorf("RelationAddedEventName() = %q, want %q", got, want)
+	}
+	if got, want := RelationRemovedEventName("document", "viewer"), "DocumentViewerRemoved"; got != want {
+		t.Errorf("RelationRemovedEventName() = %q, want %q", got, want)
+	}
+}
+
 func TestCheckInputStructName(t *testing.T) {
 	tests := []struct {
 		defName  string
@@ -162,6 +179,41 @@ func TestCheckInputStructName(t *testing.T) {
 	}
 }
 
+func TestSubjectInterfaceName(t *testing.T) {
+	if got, want := SubjectInterfaceName("bookingsvc/booking", "change_owner"), "BookingsvcBookingChangeOwnerSubject"; got != want {
+		t.Errorf("SubjectInterfaceName() = %q, want %q", got, want)
+	}
+}
+
+func TestCaveatNames(t *testing.T) {
+	tests := []struct {
+		caveat      string
+		wantConst   string
+		wantContext string
+	}{
+		{"ip_allowlist", "CaveatIpAllowlist", "IpAllowlistCaveatContext"},
+		{"bookingsvc/on_shift", "CaveatBookingsvcOnShift", "BookingsvcOnShiftCaveatContext"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.caveat, func(t *testing.T) {
+			if got := CaveatConstName(tt.caveat); got != tt.wantConst {
+				t.Errorf("CaveatConstName(%q) = %q, want %q", tt.caveat, got, tt.wantConst)
+			}
+			if got := CaveatContextStructName(tt.caveat); got != tt.wantContext {
+				t.Errorf("CaveatContextStructName(%q) = %q, want %q", tt.caveat, got, tt.wantContext)
+			}
+		})
+	}
+}
+
+func TestCaveatedRelationObjectsStructName(t *testing.T) {
+	got := CaveatedRelationObjectsStructName("document", "viewer", "ip_allowlist")
+	want := "DocumentViewerWithIpAllowlistObjects"
+	if got != want {
+		t.Errorf("CaveatedRelationObjectsStructName() = %q, want %q", got, want)
+	}
+}
+
 func TestTypeStructName(t *testing.T) {
 	tests := []struct {
 		input string
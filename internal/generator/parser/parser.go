@@ -1,7 +1,9 @@
 package parser
 
 import (
+	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/oitnes/authzed-codegen/internal/generator/ast"
 	zedlexer "github.com/oitnes/authzed-codegen/internal/generator/zed_lexer"
@@ -9,57 +11,230 @@ import (
 
 // ParseError represents an error encountered during parsing with location info.
 type ParseError struct {
+	File    string // set by ParseFile
 	Line    int
 	Column  int
 	Message string
 }
 
 func (e *ParseError) Error() string {
-	return fmt.Sprintf("parse error at line %d, column %d: %s", e.Line, e.Column, e.Message)
+	return fmt.Sprintf("parse error at %s: %s", ast.Pos{File: e.File, Line: e.Line, Column: e.Column}, e.Message)
 }
 
 type parser struct {
-	tokens []zedlexer.Token
-	pos    int
+	file     string           // recorded in every position
+	tokens   []zedlexer.Token // tokens other than comments
+	pos      int
+	leading  map[int][]string // comments on the lines before tokens[i]
+	trailing map[int][]string // comments after tokens[i] on its line
 }
 
-// Parse converts a slice of tokens into an AST Schema.
+// newParser separates the comments from the other tokens. A comment that follows a token on
+// the same line trails that token; any other comment leads the next token.
+func newParser(tokens []zedlexer.Token) *parser {
+	p := &parser{
+		leading:  make(map[int][]string),
+		trailing: make(map[int][]string),
+	}
+
+	var pending []string
+	lastLine := 0 // line the previous pending comment ends on
+	for _, t := range tokens {
+		if t.Type != zedlexer.COMMENT {
+			if len(pending) > 0 {
+				p.leading[len(p.tokens)] = pending
+				pending = nil
+			}
+			p.tokens = append(p.tokens, t)
+			continue
+		}
+
+		if last := len(p.tokens) - 1; last >= 0 && len(pending) == 0 && p.tokens[last].Line == t.Line {
+			p.trailing[last] = append(p.trailing[last], t.Literal)
+		} else {
+			if len(pending) > 0 && t.Line > lastLine+1 {
+				pending = append(pending, "")
+			}
+			pending = append(pending, t.Literal)
+			lastLine = t.Line + strings.Count(t.Literal, "\n")
+		}
+	}
+	if len(pending) > 0 {
+		p.leading[len(p.tokens)] = pending
+	}
+
+	return p
+}
+
+// Parse converts a slice of tokens into an AST Schema. It stops at the first syntax error.
 func Parse(tokens []zedlexer.Token) (*ast.Schema, error) {
-	p := &parser{tokens: tokens, pos: 0}
-	return p.parseSchema()
+	schema, errs := ParseAll(tokens)
+	if len(errs) > 0 {
+		return nil, errs[0]
+	}
+	return schema, nil
 }
 
-func (p *parser) parseSchema() (*ast.Schema, error) {
+// ParseAll is like Parse, but recovers from a syntax error by skipping to the next top-level
+// declaration. It returns every error found, in input order, and the declarations that parsed.
+func ParseAll(tokens []zedlexer.Token) (*ast.Schema, []*ParseError) {
+	return newParser(tokens).parseSchema()
+}
+
+// ParseFile is like ParseAll for the tokens of a schema file, recording file in the position
+// of every node and error.
+func ParseFile(file string, tokens []zedlexer.Token) (*ast.Schema, []*ParseError) {
+	p := newParser(tokens)
+	p.file = file
+
+	schema, errs := p.parseSchema()
+	for _, e := range errs {
+		e.File = file
+	}
+	return schema, errs
+}
+
+func (p *parser) parseSchema() (*ast.Schema, []*ParseError) {
 	schema := &ast.Schema{}
+	var errs []*ParseError
 
 	for !p.isAtEnd() {
+		start := p.pos
+
+		var err error
 		switch p.peek().Type {
 		case zedlexer.DEFINITION:
-			def, err := p.parseDefinition()
-			if err != nil {
-				return nil, err
+			var def *ast.Definition
+			if def, err = p.parseDefinition(); err == nil {
+				schema.Definitions = append(schema.Definitions, def)
 			}
-			schema.Definitions = append(schema.Definitions, def)
 		case zedlexer.CAVEAT:
-			if err := p.skipCaveat(); err != nil {
-				return nil, err
+			var caveat *ast.Caveat
+			if caveat, err = p.parseCaveat(); err == nil {
+				schema.Caveats = append(schema.Caveats, caveat)
+			}
+		case zedlexer.PARTIAL:
+			var partial *ast.Definition
+			if partial, err = p.parsePartial(); err == nil {
+				schema.Partials = append(schema.Partials, partial)
+			}
+		case zedlexer.USE:
+			var flag *ast.UseFlag
+			if flag, err = p.parseUseFlag(); err == nil {
+				schema.UseFlags = append(schema.UseFlags, flag)
+			}
+		case zedlexer.IMPORT:
+			var imp *ast.Import
+			if imp, err = p.parseImport(); err == nil {
+				schema.Imports = append(schema.Imports, imp)
 			}
-		case zedlexer.EOF:
-			return schema, nil
 		default:
-			return nil, p.errorf("expected 'definition' or 'caveat', got %q", p.peek().Literal)
+			err = p.errorf("expected 'definition', 'partial', 'caveat', 'use' or 'import', got %q", p.peek().Literal)
+		}
+
+		if err != nil {
+			var parseErr *ParseError
+			if !errors.As(err, &parseErr) {
+				parseErr = &ParseError{Message: err.Error()}
+			}
+			errs = append(errs, parseErr)
+			p.synchronize(start)
 		}
 	}
+	schema.EndComments = p.leading[p.pos]
 
-	return schema, nil
+	return schema, errs
+}
+
+// synchronize skips to the start of the next top-level declaration after an error in the
+// declaration that started at start, always making progress.
+func (p *parser) synchronize(start int) {
+	if p.pos == start {
+		p.advance()
+	}
+	for !p.isAtEnd() {
+		if p.atDeclaration() {
+			return
+		}
+		p.advance()
+	}
+}
+
+// atDeclaration reports whether the next token starts a top-level declaration. Since 'use',
+// 'import' and 'partial' may also be names, they only count when followed by what their
+// declaration expects.
+func (p *parser) atDeclaration() bool {
+	next := func(i int) zedlexer.TokenType {
+		if p.pos+i >= len(p.tokens) {
+			return zedlexer.EOF
+		}
+		return p.tokens[p.pos+i].Type
+	}
+
+	switch next(0) {
+	case zedlexer.DEFINITION, zedlexer.CAVEAT:
+		return true
+	case zedlexer.USE:
+		return isName(next(1))
+	case zedlexer.IMPORT:
+		return next(1) == zedlexer.STRING
+	case zedlexer.PARTIAL:
+		return isName(next(1)) && next(2) == zedlexer.LBRACE
+	}
+	return false
+}
+
+// parseUseFlag parses a use directive: use feature
+func (p *parser) parseUseFlag() (*ast.UseFlag, error) {
+	start := p.pos
+	if _, err := p.expect(zedlexer.USE); err != nil {
+		return nil, err
+	}
+
+	nameToken, err := p.expectName()
+	if err != nil {
+		return nil, err
+	}
+
+	return &ast.UseFlag{Name: nameToken.Literal, Pos: p.posOf(nameToken), Comments: p.commentsOf(start, p.pos)}, nil
+}
+
+// parseImport parses an import directive: import "path"
+func (p *parser) parseImport() (*ast.Import, error) {
+	start := p.pos
+	if _, err := p.expect(zedlexer.IMPORT); err != nil {
+		return nil, err
+	}
+
+	pathToken, err := p.expect(zedlexer.STRING)
+	if err != nil {
+		return nil, err
+	}
+	if pathToken.Literal == "" {
+		return nil, p.errorfAtPrev("empty import path")
+	}
+
+	return &ast.Import{Path: pathToken.Literal, Pos: p.posOf(pathToken), Comments: p.commentsOf(start, p.pos)}, nil
 }
 
 func (p *parser) parseDefinition() (*ast.Definition, error) {
-	if _, err := p.expect(zedlexer.DEFINITION); err != nil {
+	return p.parseDefinitionOf(zedlexer.DEFINITION)
+}
+
+// parsePartial parses a partial definition, whose body is that of a definition:
+// partial name { ... }
+func (p *parser) parsePartial() (*ast.Definition, error) {
+	return p.parseDefinitionOf(zedlexer.PARTIAL)
+}
+
+// parseDefinitionOf parses a definition introduced by the keyword token type.
+func (p *parser) parseDefinitionOf(keyword zedlexer.TokenType) (*ast.Definition, error) {
+	start := p.pos
+	if _, err := p.expect(keyword); err != nil {
 		return nil, err
 	}
 
-	nameToken, err := p.expect(zedlexer.IDENTIFIER)
+	nameToken, err := p.expectName()
 	if err != nil {
 		return nil, err
 	}
@@ -68,7 +243,7 @@ func (p *parser) parseDefinition() (*ast.Definition, error) {
 		return nil, err
 	}
 
-	def := &ast.Definition{Name: nameToken.Literal}
+	def := &ast.Definition{Name: nameToken.Literal, Pos: p.posOf(nameToken), Comments: p.commentsOf(start, p.pos)}
 
 	for !p.isAtEnd() && p.peek().Type != zedlexer.RBRACE {
 		switch p.peek().Type {
@@ -84,24 +259,47 @@ func (p *parser) parseDefinition() (*ast.Definition, error) {
 				return nil, err
 			}
 			def.Permissions = append(def.Permissions, perm)
+		case zedlexer.ELLIPSIS:
+			ref, err := p.parsePartialRef()
+			if err != nil {
+				return nil, err
+			}
+			def.PartialRefs = append(def.PartialRefs, ref)
 		default:
-			return nil, p.errorf("expected 'relation' or 'permission', got %q", p.peek().Literal)
+			return nil, p.errorf("expected 'relation', 'permission' or '...', got %q", p.peek().Literal)
 		}
 	}
 
 	if _, err := p.expect(zedlexer.RBRACE); err != nil {
 		return nil, err
 	}
+	def.EndComments = p.commentsOf(p.pos-1, p.pos)
 
 	return def, nil
 }
 
+// parsePartialRef parses the inclusion of a partial: ...name
+func (p *parser) parsePartialRef() (*ast.PartialRef, error) {
+	start := p.pos
+	if _, err := p.expect(zedlexer.ELLIPSIS); err != nil {
+		return nil, err
+	}
+
+	nameToken, err := p.expectName()
+	if err != nil {
+		return nil, err
+	}
+
+	return &ast.PartialRef{Name: nameToken.Literal, Pos: p.posOf(nameToken), Comments: p.commentsOf(start, p.pos)}, nil
+}
+
 func (p *parser) parseRelation() (*ast.Relation, error) {
+	start := p.pos
 	if _, err := p.expect(zedlexer.RELATION); err != nil {
 		return nil, err
 	}
 
-	nameToken, err := p.expect(zedlexer.IDENTIFIER)
+	nameToken, err := p.expectName()
 	if err != nil {
 		return nil, err
 	}
@@ -110,7 +308,7 @@ func (p *parser) parseRelation() (*ast.Relation, error) {
 		return nil, err
 	}
 
-	rel := &ast.Relation{Name: nameToken.Literal}
+	rel := &ast.Relation{Name: nameToken.Literal, Pos: p.posOf(nameToken)}
 
 	subjectType, err := p.parseSubjectType()
 	if err != nil {
@@ -126,32 +324,78 @@ func (p *parser) parseRelation() (*ast.Relation, error) {
 		}
 		rel.SubjectTypes = append(rel.SubjectTypes, subjectType)
 	}
+	rel.Comments = p.commentsOf(start, p.pos)
 
 	return rel, nil
 }
 
 func (p *parser) parseSubjectType() (*ast.SubjectType, error) {
-	typeToken, err := p.expect(zedlexer.IDENTIFIER)
+	typeToken, err := p.expectName()
 	if err != nil {
 		return nil, err
 	}
 
-	st := &ast.SubjectType{TypeName: typeToken.Literal}
+	st := &ast.SubjectType{TypeName: typeToken.Literal, Pos: p.posOf(typeToken)}
 
-	if !p.isAtEnd() && p.peek().Type == zedlexer.WILDCARD {
+	switch {
+	case !p.isAtEnd() && p.peek().Type == zedlexer.WILDCARD:
 		p.advance()
 		st.IsWildcard = true
+	case !p.isAtEnd() && p.peek().Type == zedlexer.HASH:
+		p.advance()
+		relationToken, err := p.expectName()
+		if err != nil {
+			return nil, err
+		}
+		st.Relation = relationToken.Literal
+	}
+
+	if !p.isAtEnd() && p.peek().Type == zedlexer.WITH {
+		p.advance()
+		if err := p.parseSubjectTraits(st); err != nil {
+			return nil, err
+		}
 	}
 
 	return st, nil
 }
 
+// parseSubjectTraits parses what follows "with" in a subject type: a caveat name, the
+// expiration trait, or both as "caveat and expiration".
+func (p *parser) parseSubjectTraits(st *ast.SubjectType) error {
+	traitToken, err := p.expectName()
+	if err != nil {
+		return err
+	}
+	if traitToken.Literal == "expiration" {
+		st.Expiration = true
+		return nil
+	}
+	st.Caveat = traitToken.Literal
+
+	if p.isAtEnd() || p.peek().Type != zedlexer.IDENTIFIER || p.peek().Literal != "and" {
+		return nil
+	}
+	p.advance()
+
+	expirationToken, err := p.expect(zedlexer.IDENTIFIER)
+	if err != nil {
+		return err
+	}
+	if expirationToken.Literal != "expiration" {
+		return p.errorfAtPrev("expected 'expiration' after 'and', got %q", expirationToken.Literal)
+	}
+	st.Expiration = true
+	return nil
+}
+
 func (p *parser) parsePermission() (*ast.Permission, error) {
+	start := p.pos
 	if _, err := p.expect(zedlexer.PERMISSION); err != nil {
 		return nil, err
 	}
 
-	nameToken, err := p.expect(zedlexer.IDENTIFIER)
+	nameToken, err := p.expectName()
 	if err != nil {
 		return nil, err
 	}
@@ -165,15 +409,22 @@ func (p *parser) parsePermission() (*ast.Permission, error) {
 		return nil, err
 	}
 
-	return &ast.Permission{Name: nameToken.Literal, Expression: expr}, nil
+	return &ast.Permission{
+		Name:       nameToken.Literal,
+		Expression: expr,
+		Pos:        p.posOf(nameToken),
+		Comments:   p.commentsOf(start, p.pos),
+	}, nil
 }
 
-// Expression parsing with operator precedence (lowest to highest):
+// Expression parsing with operator precedence (lowest to highest), matching SpiceDB's
+// grammar. All binary operators are left-associative, so "a - b - c" is "(a - b) - c"
+// and "a - b + c" is "a - (b + c)".
 // 1. Exclusion (-)
 // 2. Intersection (&)
 // 3. Union (+)
-// 4. Arrow (->)
-// 5. Primary (identifier or grouped expression)
+// 4. Arrow (-> or .any()/.all()), whose left side must be a bare relation name
+// 5. Primary (identifier, nil or grouped expression)
 
 func (p *parser) parseExpression() (ast.Expr, error) {
 	return p.parseExclusion()
@@ -186,12 +437,12 @@ func (p *parser) parseExclusion() (ast.Expr, error) {
 	}
 
 	for !p.isAtEnd() && p.peek().Type == zedlexer.MINUS {
-		p.advance()
+		op := p.advance()
 		right, err := p.parseIntersection()
 		if err != nil {
 			return nil, err
 		}
-		left = &ast.ExclusionExpr{Left: left, Right: right}
+		left = &ast.ExclusionExpr{Left: left, Right: right, Pos: p.posOf(op)}
 	}
 
 	return left, nil
@@ -204,12 +455,12 @@ func (p *parser) parseIntersection() (ast.Expr, error) {
 	}
 
 	for !p.isAtEnd() && p.peek().Type == zedlexer.AND {
-		p.advance()
+		op := p.advance()
 		right, err := p.parseUnion()
 		if err != nil {
 			return nil, err
 		}
-		left = &ast.IntersectionExpr{Left: left, Right: right}
+		left = &ast.IntersectionExpr{Left: left, Right: right, Pos: p.posOf(op)}
 	}
 
 	return left, nil
@@ -222,43 +473,111 @@ func (p *parser) parseUnion() (ast.Expr, error) {
 	}
 
 	for !p.isAtEnd() && p.peek().Type == zedlexer.PLUS {
-		p.advance()
+		op := p.advance()
 		right, err := p.parseArrow()
 		if err != nil {
 			return nil, err
 		}
-		left = &ast.UnionExpr{Left: left, Right: right}
+		left = &ast.UnionExpr{Left: left, Right: right, Pos: p.posOf(op)}
 	}
 
 	return left, nil
 }
 
 func (p *parser) parseArrow() (ast.Expr, error) {
+	bareIdentifier := !p.isAtEnd() && p.peek().Type != zedlexer.NIL && isName(p.peek().Type)
+
 	left, err := p.parsePrimary()
 	if err != nil {
 		return nil, err
 	}
 
-	if !p.isAtEnd() && p.peek().Type == zedlexer.ARROW {
-		p.advance()
+	if !p.atArrow() {
+		return left, nil
+	}
+	arrowToken := p.advance()
 
-		permToken, err := p.expect(zedlexer.IDENTIFIER)
-		if err != nil {
-			return nil, err
-		}
+	relRef, ok := left.(*ast.RelationRef)
+	if !ok || !bareIdentifier {
+		return nil, p.errorfAtPrev("arrow operator requires a relation name on the left side")
+	}
 
-		relRef, ok := left.(*ast.RelationRef)
-		if !ok {
-			return nil, p.errorfAtPrev("arrow operator requires a relation reference on the left side")
-		}
+	var expr ast.Expr
+	if arrowToken.Type == zedlexer.PERIOD {
+		expr, err = p.parseArrowFunction(relRef)
+	} else {
+		expr, err = p.parseArrowTarget(relRef)
+	}
+	if err != nil {
+		return nil, err
+	}
 
-		return &ast.ArrowExpr{
-			Relation:   relRef.Name,
-			Permission: permToken.Literal,
-		}, nil
+	if p.atArrow() {
+		return nil, p.errorf("nested arrows are not supported")
 	}
 
-	return left, nil
+	return expr, nil
+}
+
+// atArrow reports whether the next token starts an arrow: "->" or "." for a functioned arrow.
+func (p *parser) atArrow() bool {
+	if p.isAtEnd() {
+		return false
+	}
+	t := p.peek().Type
+	return t == zedlexer.ARROW || t == zedlexer.PERIOD
+}
+
+// parseArrowTarget parses the permission name after "relation->".
+func (p *parser) parseArrowTarget(relRef *ast.RelationRef) (ast.Expr, error) {
+	permToken, err := p.expectName()
+	if err != nil {
+		return nil, err
+	}
+
+	return &ast.ArrowExpr{
+		Relation:      relRef.Name,
+		Permission:    permToken.Literal,
+		Pos:           relRef.Pos,
+		PermissionPos: p.posOf(permToken),
+	}, nil
+}
+
+// parseArrowFunction parses the function call after "relation.": any(permission) or all(permission).
+func (p *parser) parseArrowFunction(relRef *ast.RelationRef) (ast.Expr, error) {
+	funcToken, err := p.expect(zedlexer.IDENTIFIER)
+	if err != nil {
+		return nil, err
+	}
+
+	var function ast.ArrowFunction
+	switch funcToken.Literal {
+	case "any":
+		function = ast.ArrowFunctionAny
+	case "all":
+		function = ast.ArrowFunctionAll
+	default:
+		return nil, p.errorfAtPrev("unknown arrow function %q, expected any or all", funcToken.Literal)
+	}
+
+	if _, err := p.expect(zedlexer.LBRACKETS); err != nil {
+		return nil, err
+	}
+	permToken, err := p.expectName()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(zedlexer.RBRACKETS); err != nil {
+		return nil, err
+	}
+
+	return &ast.FunctionedArrowExpr{
+		Relation:      relRef.Name,
+		Function:      function,
+		Permission:    permToken.Literal,
+		Pos:           relRef.Pos,
+		PermissionPos: p.posOf(permToken),
+	}, nil
 }
 
 func (p *parser) parsePrimary() (ast.Expr, error) {
@@ -274,47 +593,146 @@ func (p *parser) parsePrimary() (ast.Expr, error) {
 		return expr, nil
 	}
 
-	if !p.isAtEnd() && p.peek().Type == zedlexer.IDENTIFIER {
+	if !p.isAtEnd() && p.peek().Type == zedlexer.NIL {
 		token := p.advance()
-		return &ast.RelationRef{Name: token.Literal}, nil
+		return &ast.NilExpr{Pos: p.posOf(token)}, nil
 	}
 
-	return nil, p.errorf("expected identifier or '(' in expression")
+	if !p.isAtEnd() && isName(p.peek().Type) {
+		token := p.advance()
+		return &ast.RelationRef{Name: token.Literal, Pos: p.posOf(token)}, nil
+	}
+
+	return nil, p.errorf("expected identifier, nil or '(' in expression")
 }
 
-// skipCaveat skips a caveat block by brace-matching.
-func (p *parser) skipCaveat() error {
+// parseCaveat parses a caveat definition: caveat name(param type, ...) { expression }
+func (p *parser) parseCaveat() (*ast.Caveat, error) {
+	start := p.pos
 	if _, err := p.expect(zedlexer.CAVEAT); err != nil {
-		return err
+		return nil, err
 	}
 
-	// Skip tokens until we find the opening brace
-	depth := 0
-	for !p.isAtEnd() {
-		if p.peek().Type == zedlexer.LBRACE {
-			depth++
-			p.advance()
+	nameToken, err := p.expectName()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := p.expect(zedlexer.LBRACKETS); err != nil {
+		return nil, err
+	}
+
+	caveat := &ast.Caveat{Name: nameToken.Literal, Pos: p.posOf(nameToken)}
+
+	for {
+		param, err := p.parseCaveatParameter()
+		if err != nil {
+			return nil, err
+		}
+		caveat.Parameters = append(caveat.Parameters, param)
+
+		if p.isAtEnd() || p.peek().Type != zedlexer.COMMA {
 			break
 		}
 		p.advance()
 	}
 
-	// Skip until matching closing brace
-	for !p.isAtEnd() && depth > 0 {
-		switch p.peek().Type {
-		case zedlexer.LBRACE:
-			depth++
-		case zedlexer.RBRACE:
-			depth--
+	if _, err := p.expect(zedlexer.RBRACKETS); err != nil {
+		return nil, err
+	}
+
+	if _, err := p.expect(zedlexer.LBRACE); err != nil {
+		return nil, err
+	}
+	caveat.Comments = p.commentsOf(start, p.pos)
+
+	exprToken, err := p.expect(zedlexer.CAVEAT_EXPRESSION)
+	if err != nil {
+		return nil, err
+	}
+	if exprToken.Literal == "" {
+		return nil, p.errorfAtPrev("missing expression for caveat %q", caveat.Name)
+	}
+	caveat.Expression = exprToken.Literal
+
+	if _, err := p.expect(zedlexer.RBRACE); err != nil {
+		return nil, err
+	}
+	caveat.EndComments = p.commentsOf(p.pos-1, p.pos)
+
+	return caveat, nil
+}
+
+func (p *parser) parseCaveatParameter() (*ast.CaveatParameter, error) {
+	nameToken, err := p.expectName()
+	if err != nil {
+		return nil, err
+	}
+
+	paramType, err := p.parseCaveatParameterType()
+	if err != nil {
+		return nil, err
+	}
+
+	return &ast.CaveatParameter{Name: nameToken.Literal, Type: paramType, Pos: p.posOf(nameToken)}, nil
+}
+
+func (p *parser) parseCaveatParameterType() (*ast.CaveatParameterType, error) {
+	typeToken, err := p.expect(zedlexer.IDENTIFIER)
+	if err != nil {
+		return nil, err
+	}
+
+	paramType := &ast.CaveatParameterType{Name: typeToken.Literal, Pos: p.posOf(typeToken)}
+
+	if p.isAtEnd() || p.peek().Type != zedlexer.LESS {
+		return paramType, nil
+	}
+	p.advance()
+
+	for {
+		typeArg, err := p.parseCaveatParameterType()
+		if err != nil {
+			return nil, err
+		}
+		paramType.TypeArgs = append(paramType.TypeArgs, typeArg)
+
+		if p.isAtEnd() || p.peek().Type != zedlexer.COMMA {
+			break
 		}
 		p.advance()
 	}
 
-	return nil
+	if _, err := p.expect(zedlexer.GREATER); err != nil {
+		return nil, err
+	}
+
+	return paramType, nil
 }
 
 // Helper methods
 
+// commentsOf returns the comments of the node made of tokens[start:end]: those leading its
+// first token, and those within it or trailing its last token.
+func (p *parser) commentsOf(start, end int) ast.Comments {
+	comments := ast.Comments{Leading: p.leading[start]}
+	for i := start; i < end; i++ {
+		if i > start {
+			for _, c := range p.leading[i] {
+				if c != "" {
+					comments.Trailing = append(comments.Trailing, c)
+				}
+			}
+		}
+		comments.Trailing = append(comments.Trailing, p.trailing[i]...)
+	}
+	return comments
+}
+
+func (p *parser) posOf(token zedlexer.Token) ast.Pos {
+	return ast.Pos{File: p.file, Line: token.Line, Column: token.Column}
+}
+
 func (p *parser) peek() zedlexer.Token {
 	if p.isAtEnd() {
 		return zedlexer.Token{Type: zedlexer.EOF}
@@ -335,9 +753,7 @@ func (p *parser) isAtEnd() bool {
 
 func (p *parser) expect(tokenType zedlexer.TokenType) (zedlexer.Token, error) {
 	if p.isAtEnd() {
-		return zedlexer.Token{}, &ParseError{
-			Message: fmt.Sprintf("unexpected end of input, expected token type %v", tokenType),
-		}
+		return zedlexer.Token{}, p.errorfAtPrev("unexpected end of input, expected token type %v", tokenType)
 	}
 
 	token := p.peek()
@@ -352,7 +768,29 @@ func (p *parser) expect(tokenType zedlexer.TokenType) (zedlexer.Token, error) {
 	return p.advance(), nil
 }
 
+// expectName consumes a name: an identifier, or a keyword that SpiceDB only reserves where
+// it starts syntax.
+func (p *parser) expectName() (zedlexer.Token, error) {
+	if !p.isAtEnd() && p.peek().Type != zedlexer.IDENTIFIER && isName(p.peek().Type) {
+		return p.advance(), nil
+	}
+	return p.expect(zedlexer.IDENTIFIER)
+}
+
+// isName reports whether a token of type t can be a name.
+func isName(t zedlexer.TokenType) bool {
+	switch t {
+	case zedlexer.IDENTIFIER, zedlexer.WITH, zedlexer.NIL, zedlexer.USE, zedlexer.IMPORT, zedlexer.PARTIAL:
+		return true
+	}
+	return false
+}
+
+// errorf reports an error at the next token or, at the end of input, at the last one.
 func (p *parser) errorf(format string, args ...any) *ParseError {
+	if p.isAtEnd() {
+		return p.errorfAtPrev(format, args...)
+	}
 	token := p.peek()
 	return &ParseError{
 		Line:    token.Line,
@@ -1,6 +1,8 @@
 package parser
 
 import (
+	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/oitnes/authzed-codegen/internal/generator/ast"
@@ -116,6 +118,85 @@ func TestParseRelationWithWildcard(t *testing.T) {
 	}
 }
 
+func TestParseRelationWithSubjectRelation(t *testing.T) {
+	tokens := mustLex(t, `definition doc {
+		relation viewer: user | group#member with ip_check
+	}`)
+	schema, err := Parse(tokens)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	rel := schema.Definitions[0].Relations[0]
+	if len(rel.SubjectTypes) != 2 {
+		t.Fatalf("expected 2 subject types, got %d", len(rel.SubjectTypes))
+	}
+	if rel.SubjectTypes[0].Relation != "" {
+		t.Errorf("expected no subject relation on first subject, got %q", rel.SubjectTypes[0].Relation)
+	}
+	st := rel.SubjectTypes[1]
+	if st.TypeName != "group" || st.Relation != "member" || st.Caveat != "ip_check" {
+		t.Errorf("expected group#member with ip_check, got %+v", st)
+	}
+}
+
+func TestParseRelationSubjectRelationErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"missing relation name", "definition doc { relation viewer: group# }"},
+		{"wildcard with relation", "definition doc { relation viewer: group#member:* }"},
+		{"relation after wildcard", "definition doc { relation viewer: group:*#member }"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens := mustLex(t, tt.input)
+			if _, err := Parse(tokens); err == nil {
+				t.Fatal("expected parse error")
+			}
+		})
+	}
+}
+
+func TestParsePositions(t *testing.T) {
+	tokens := mustLex(t, `definition doc {
+	relation owner: user
+	permission view = owner + parent->view
+}`)
+	schema, err := Parse(tokens)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	def := schema.Definitions[0]
+	if def.Pos != (ast.Pos{Line: 1, Column: 12}) {
+		t.Errorf("definition Pos = %+v", def.Pos)
+	}
+	if def.Relations[0].Pos != (ast.Pos{Line: 2, Column: 11}) {
+		t.Errorf("relation Pos = %+v", def.Relations[0].Pos)
+	}
+	if def.Relations[0].SubjectTypes[0].Pos != (ast.Pos{Line: 2, Column: 18}) {
+		t.Errorf("subject type Pos = %+v", def.Relations[0].SubjectTypes[0].Pos)
+	}
+
+	perm := def.Permissions[0]
+	if perm.Pos != (ast.Pos{Line: 3, Column: 13}) {
+		t.Errorf("permission Pos = %+v", perm.Pos)
+	}
+	union := perm.Expression.(*ast.UnionExpr)
+	if union.Pos != (ast.Pos{Line: 3, Column: 26}) {
+		t.Errorf("union Pos = %+v", union.Pos)
+	}
+	if ref := union.Left.(*ast.RelationRef); ref.Pos != (ast.Pos{Line: 3, Column: 20}) {
+		t.Errorf("relation ref Pos = %+v", ref.Pos)
+	}
+	arrow := union.Right.(*ast.ArrowExpr)
+	if arrow.Pos != (ast.Pos{Line: 3, Column: 28}) || arrow.PermissionPos != (ast.Pos{Line: 3, Column: 36}) {
+		t.Errorf("arrow Pos = %+v, PermissionPos = %+v", arrow.Pos, arrow.PermissionPos)
+	}
+}
+
 func TestParseSimplePermission(t *testing.T) {
 	tokens := mustLex(t, `definition doc {
 		relation owner: user
@@ -283,6 +364,155 @@ func TestParseComplexNestedExpression(t *testing.T) {
 	assertRelRef(t, union.Right, "member")
 }
 
+// exprString renders an expression as an S-expression so that tree shape can be
+// compared as a string, e.g. "(- a (+ b c))".
+func exprString(expr ast.Expr) string {
+	switch e := expr.(type) {
+	case *ast.RelationRef:
+		return e.Name
+	case *ast.ArrowExpr:
+		return e.Relation + "->" + e.Permission
+	case *ast.FunctionedArrowExpr:
+		return e.Relation + "." + e.Function.String() + "(" + e.Permission + ")"
+	case *ast.NilExpr:
+		return "nil"
+	case *ast.UnionExpr:
+		return "(+ " + exprString(e.Left) + " " + exprString(e.Right) + ")"
+	case *ast.IntersectionExpr:
+		return "(& " + exprString(e.Left) + " " + exprString(e.Right) + ")"
+	case *ast.ExclusionExpr:
+		return "(- " + exprString(e.Left) + " " + exprString(e.Right) + ")"
+	default:
+		return fmt.Sprintf("%T", expr)
+	}
+}
+
+func parsePermissionExpr(t *testing.T, expr string) (ast.Expr, error) {
+	t.Helper()
+	tokens := mustLex(t, "definition doc {\n\tpermission p = "+expr+"\n}")
+	schema, err := Parse(tokens)
+	if err != nil {
+		return nil, err
+	}
+	return schema.Definitions[0].Permissions[0].Expression, nil
+}
+
+// TestParsePrecedenceConformance pins expression trees to the ones SpiceDB's schema
+// parser builds for the same input (see pkg/schemadsl/parser/tests in SpiceDB).
+func TestParsePrecedenceConformance(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"a + b + c", "(+ (+ a b) c)"},
+		{"a & b & c", "(& (& a b) c)"},
+		{"a - b - c", "(- (- a b) c)"},
+		{"a + b & c", "(& (+ a b) c)"},
+		{"a & b + c", "(& a (+ b c))"},
+		{"a + b - c", "(- (+ a b) c)"},
+		{"a - b + c", "(- a (+ b c))"},
+		{"a & b - c", "(- (& a b) c)"},
+		{"a - b & c", "(- a (& b c))"},
+		{"a + b & c - d", "(- (& (+ a b) c) d)"},
+		{"a - b & c + d", "(- a (& b (+ c d)))"},
+		{"a - (b - c)", "(- a (- b c))"},
+		{"(a - b) + c", "(+ (- a b) c)"},
+		{"((a))", "a"},
+		{"parent->view + a", "(+ parent->view a)"},
+		{"a & parent->view - b->c", "(- (& a parent->view) b->c)"},
+		{"baz + meh + (a->b - c->d) + (maz & beh)", "(+ (+ (+ baz meh) (- a->b c->d)) (& maz beh))"},
+		{"parent.all(member) + a", "(+ parent.all(member) a)"},
+		{"a - parent.any(view) & b", "(- a (& parent.any(view) b))"},
+		{"nil", "nil"},
+		{"foo + nil + bar", "(+ (+ foo nil) bar)"},
+		{"(a + b + nil) - c - nil", "(- (- (+ (+ a b) nil) c) nil)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			expr, err := parsePermissionExpr(t, tt.expr)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := exprString(expr); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseFunctionedArrowExpression(t *testing.T) {
+	tokens := mustLex(t, `definition document {
+		relation approver: user
+		permission approve = approver.all(member)
+	}`)
+	schema, err := Parse(tokens)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	arrow, ok := schema.Definitions[0].Permissions[0].Expression.(*ast.FunctionedArrowExpr)
+	if !ok {
+		t.Fatalf("expected FunctionedArrowExpr, got %T", schema.Definitions[0].Permissions[0].Expression)
+	}
+	if arrow.Relation != "approver" || arrow.Function != ast.ArrowFunctionAll || arrow.Permission != "member" {
+		t.Errorf("got %s.%s(%s), want approver.all(member)", arrow.Relation, arrow.Function, arrow.Permission)
+	}
+	if want := (ast.Pos{Line: 3, Column: 24}); arrow.Pos != want {
+		t.Errorf("Pos = %+v, want %+v", arrow.Pos, want)
+	}
+	if want := (ast.Pos{Line: 3, Column: 37}); arrow.PermissionPos != want {
+		t.Errorf("PermissionPos = %+v, want %+v", arrow.PermissionPos, want)
+	}
+}
+
+func TestParseNilExpression(t *testing.T) {
+	tokens := mustLex(t, `definition document {
+		permission nothing = nil
+	}`)
+	schema, err := Parse(tokens)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	n, ok := schema.Definitions[0].Permissions[0].Expression.(*ast.NilExpr)
+	if !ok {
+		t.Fatalf("expected NilExpr, got %T", schema.Definitions[0].Permissions[0].Expression)
+	}
+	if want := (ast.Pos{Line: 2, Column: 24}); n.Pos != want {
+		t.Errorf("Pos = %+v, want %+v", n.Pos, want)
+	}
+}
+
+func TestParseArrowConformanceErrors(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr string
+	}{
+		{"(a)->b", "arrow operator requires a relation name on the left side"},
+		{"(a + b)->c", "arrow operator requires a relation name on the left side"},
+		{"a->(b)", "expected token type"},
+		{"a->b->c", "nested arrows are not supported"},
+		{"a.all(b)->c", "nested arrows are not supported"},
+		{"a->b.any(c)", "nested arrows are not supported"},
+		{"(a).all(b)", "arrow operator requires a relation name on the left side"},
+		{"nil->b", "arrow operator requires a relation name on the left side"},
+		{"a.some(b)", `unknown arrow function "some", expected any or all`},
+		{"a.all(b", "expected token type"},
+		{"a.all b", "expected token type"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := parsePermissionExpr(t, tt.expr)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error %q does not contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func TestParseMultipleDefinitions(t *testing.T) {
 	tokens := mustLex(t, `
 		definition user {}
@@ -546,21 +776,14 @@ func TestParseSchemaEOFToken(t *testing.T) {
 	}
 }
 
-func TestParseSkipCaveat(t *testing.T) {
-	// Construct tokens manually since the lexer can't handle caveat body syntax
-	tokens := []zedlexer.Token{
-		tok(zedlexer.CAVEAT, "caveat"),
-		tok(zedlexer.IDENTIFIER, "some_caveat"),
-		tok(zedlexer.IDENTIFIER, "param"),
-		tok(zedlexer.IDENTIFIER, "int"),
-		tok(zedlexer.LBRACE, "{"),
-		tok(zedlexer.IDENTIFIER, "param"),
-		tok(zedlexer.RBRACE, "}"),
-		tok(zedlexer.DEFINITION, "definition"),
-		tok(zedlexer.IDENTIFIER, "user"),
-		tok(zedlexer.LBRACE, "{"),
-		tok(zedlexer.RBRACE, "}"),
-	}
+func TestParseCaveat(t *testing.T) {
+	tokens := mustLex(t, `
+		caveat ip_check(allowed list<string>, ip string, limits map<list<int>>) {
+			ip in allowed
+		}
+
+		definition user {}
+	`)
 	schema, err := Parse(tokens)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
@@ -568,31 +791,149 @@ func TestParseSkipCaveat(t *testing.T) {
 	if len(schema.Definitions) != 1 {
 		t.Fatalf("expected 1 definition after caveat, got %d", len(schema.Definitions))
 	}
-	if schema.Definitions[0].Name != "user" {
-		t.Errorf("expected definition 'user', got %q", schema.Definitions[0].Name)
+	if len(schema.Caveats) != 1 {
+		t.Fatalf("expected 1 caveat, got %d", len(schema.Caveats))
+	}
+
+	caveat := schema.Caveats[0]
+	if caveat.Name != "ip_check" {
+		t.Errorf("expected caveat name 'ip_check', got %q", caveat.Name)
+	}
+	if caveat.Expression != "ip in allowed" {
+		t.Errorf("expected expression 'ip in allowed', got %q", caveat.Expression)
+	}
+	if len(caveat.Parameters) != 3 {
+		t.Fatalf("expected 3 parameters, got %d", len(caveat.Parameters))
+	}
+
+	wantParams := []struct{ name, typ string }{
+		{"allowed", "list<string>"},
+		{"ip", "string"},
+		{"limits", "map<list<int>>"},
+	}
+	for i, want := range wantParams {
+		param := caveat.Parameters[i]
+		if param.Name != want.name {
+			t.Errorf("param[%d] name = %q, want %q", i, param.Name, want.name)
+		}
+		if got := param.Type.String(); got != want.typ {
+			t.Errorf("param[%d] type = %q, want %q", i, got, want.typ)
+		}
 	}
 }
 
-func TestParseSkipCaveatWithNestedBraces(t *testing.T) {
-	// Construct tokens manually since the lexer filters caveats
-	tokens := []zedlexer.Token{
-		tok(zedlexer.CAVEAT, "caveat"),
-		tok(zedlexer.IDENTIFIER, "name"),
-		tok(zedlexer.LBRACE, "{"),
-		tok(zedlexer.LBRACE, "{"),
-		tok(zedlexer.RBRACE, "}"),
-		tok(zedlexer.RBRACE, "}"),
-		tok(zedlexer.DEFINITION, "definition"),
-		tok(zedlexer.IDENTIFIER, "user"),
-		tok(zedlexer.LBRACE, "{"),
-		tok(zedlexer.RBRACE, "}"),
+func TestParseRelationWithCaveat(t *testing.T) {
+	tokens := mustLex(t, `definition doc {
+		relation viewer: user | user with ip_check | user:* with ip_check
+	}`)
+	schema, err := Parse(tokens)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	rel := schema.Definitions[0].Relations[0]
+	if len(rel.SubjectTypes) != 3 {
+		t.Fatalf("expected 3 subject types, got %d", len(rel.SubjectTypes))
+	}
+	if rel.SubjectTypes[0].Caveat != "" {
+		t.Errorf("expected no caveat on first subject, got %q", rel.SubjectTypes[0].Caveat)
+	}
+	if rel.SubjectTypes[1].Caveat != "ip_check" || rel.SubjectTypes[1].IsWildcard {
+		t.Errorf("expected caveated non-wildcard subject, got %+v", rel.SubjectTypes[1])
 	}
+	if rel.SubjectTypes[2].Caveat != "ip_check" || !rel.SubjectTypes[2].IsWildcard {
+		t.Errorf("expected caveated wildcard subject, got %+v", rel.SubjectTypes[2])
+	}
+}
+
+func TestParseRelationWithExpiration(t *testing.T) {
+	tokens := mustLex(t, `use expiration
+
+	definition doc {
+		relation viewer: user | user with expiration | group#member with ip_check and expiration
+	}`)
 	schema, err := Parse(tokens)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	if len(schema.Definitions) != 1 {
-		t.Fatalf("expected 1 definition, got %d", len(schema.Definitions))
+	if len(schema.UseFlags) != 1 || schema.UseFlags[0].Name != "expiration" {
+		t.Fatalf("expected use expiration flag, got %+v", schema.UseFlags)
+	}
+	if want := (ast.Pos{Line: 1, Column: 5}); schema.UseFlags[0].Pos != want {
+		t.Errorf("use flag Pos = %+v, want %+v", schema.UseFlags[0].Pos, want)
+	}
+	if !schema.Uses("expiration") {
+		t.Error("expected Uses(expiration) to be true")
+	}
+
+	rel := schema.Definitions[0].Relations[0]
+	if len(rel.SubjectTypes) != 3 {
+		t.Fatalf("expected 3 subject types, got %d", len(rel.SubjectTypes))
+	}
+	if rel.SubjectTypes[0].Expiration {
+		t.Errorf("expected no expiration on first subject, got %+v", rel.SubjectTypes[0])
+	}
+	if !rel.SubjectTypes[1].Expiration || rel.SubjectTypes[1].Caveat != "" {
+		t.Errorf("expected expiring uncaveated subject, got %+v", rel.SubjectTypes[1])
+	}
+	if !rel.SubjectTypes[2].Expiration || rel.SubjectTypes[2].Caveat != "ip_check" || rel.SubjectTypes[2].Relation != "member" {
+		t.Errorf("expected expiring caveated subject set, got %+v", rel.SubjectTypes[2])
+	}
+}
+
+func TestParseRelationWithExpirationErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"use without feature", "use"},
+		{"and without expiration", "definition doc { relation viewer: user with ip_check and }"},
+		{"and with other trait", "definition doc { relation viewer: user with ip_check and other }"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(mustLex(t, tt.input)); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
+
+func TestParseRelationWithCaveatMissingName(t *testing.T) {
+	tokens := mustLex(t, `definition doc {
+		relation viewer: user with
+	}`)
+	if _, err := Parse(tokens); err == nil {
+		t.Fatal("expected error for missing caveat name after 'with'")
+	}
+}
+
+func TestParseCaveatErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"missing name", "caveat (a int) { a }"},
+		{"missing parameter list", "caveat c { a }"},
+		{"empty parameter list", "caveat c() { a }"},
+		{"missing parameter type", "caveat c(a) { a }"},
+		{"missing comma", "caveat c(a int b int) { a }"},
+		{"unclosed generic", "caveat c(a list<int) { a }"},
+		{"missing generic argument", "caveat c(a list<>) { a }"},
+		{"missing body", "caveat c(a int)"},
+		{"empty expression", "caveat c(a int) {}"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, err := zedlexer.Lex(tt.input)
+			if err != nil {
+				return // rejected by the lexer already
+			}
+			if _, err := Parse(tokens); err == nil {
+				t.Error("expected parse error, got nil")
+			}
+		})
 	}
 }
 
@@ -911,30 +1252,27 @@ func TestParseDefinitionErrorPropagation(t *testing.T) {
 	}
 }
 
-func TestParseSkipCaveatAtEnd(t *testing.T) {
-	// Caveat without any braces — hits isAtEnd before finding opening brace
+func TestParseCaveatAtEnd(t *testing.T) {
+	// Caveat header without a body
 	tokens := []zedlexer.Token{
 		tok(zedlexer.CAVEAT, "caveat"),
 		tok(zedlexer.IDENTIFIER, "name"),
 	}
-	schema, err := Parse(tokens)
-	if err != nil {
-		t.Fatalf("unexpected error: %v", err)
-	}
-	if len(schema.Definitions) != 0 {
-		t.Errorf("expected 0 definitions, got %d", len(schema.Definitions))
+	_, err := Parse(tokens)
+	if err == nil {
+		t.Fatal("expected error for incomplete caveat")
 	}
 }
 
 // Tests below exercise internal parser methods directly to cover
 // defensive error paths that are unreachable via the public API.
 
-func TestInternalSkipCaveatExpectFails(t *testing.T) {
-	// Call skipCaveat when next token is not CAVEAT
+func TestInternalParseCaveatExpectFails(t *testing.T) {
+	// Call parseCaveat when next token is not CAVEAT
 	p := &parser{tokens: []zedlexer.Token{tok(zedlexer.IDENTIFIER, "x")}, pos: 0}
-	err := p.skipCaveat()
+	_, err := p.parseCaveat()
 	if err == nil {
-		t.Fatal("expected error from skipCaveat when token is not CAVEAT")
+		t.Fatal("expected error from parseCaveat when token is not CAVEAT")
 	}
 }
 
@@ -977,17 +1315,402 @@ func TestInternalErrorfAtPrevPosZero(t *testing.T) {
 	}
 }
 
-func TestParseSchemaSkipCaveatErrorPropagation(t *testing.T) {
-	// Caveat token followed by EOF — skipCaveat succeeds but caveat is incomplete
-	// This tests that the schema loop handles caveat correctly even at end
+func TestParseSchemaCaveatErrorPropagation(t *testing.T) {
+	// Caveat token followed by EOF — parseCaveat fails and the schema loop returns the error
 	tokens := []zedlexer.Token{
 		tok(zedlexer.CAVEAT, "caveat"),
 	}
+	_, err := Parse(tokens)
+	if err == nil {
+		t.Fatal("expected error for caveat keyword without a definition")
+	}
+}
+
+func TestParseAllRecoversAtNextDeclaration(t *testing.T) {
+	tokens := mustLex(t, `definition user {}
+
+definition broken {
+	relation owner user
+}
+
+definition doc {
+	relation owner: user
+	permission = owner
+definition folder {}
+
+garbage
+`)
+	schema, errs := ParseAll(tokens)
+
+	want := []struct{ line, column int }{{4, 17}, {9, 13}, {12, 1}}
+	if len(errs) != len(want) {
+		t.Fatalf("ParseAll() returned %d errors, want %d: %v", len(errs), len(want), errs)
+	}
+	for i, w := range want {
+		if errs[i].Line != w.line || errs[i].Column != w.column {
+			t.Errorf("error %d at line %d, column %d, want line %d, column %d: %s", i, errs[i].Line, errs[i].Column, w.line, w.column, errs[i].Message)
+		}
+	}
+
+	var names []string
+	for _, def := range schema.Definitions {
+		names = append(names, def.Name)
+	}
+	if got := strings.Join(names, ","); got != "user,folder" {
+		t.Errorf("parsed definitions = %s, want user,folder", got)
+	}
+}
+
+func TestParseWithAsName(t *testing.T) {
+	tokens := mustLex(t, `caveat with(limit int) {
+	limit > 0
+}
+
+definition with {
+	relation member: user
+}
+
+definition doc {
+	relation with: with#member | user with with
+	permission view = with + with->member
+}`)
+	schema, err := Parse(tokens)
+	if err != nil {
+		t.Fatalf("Parse() error: %v", err)
+	}
+
+	if len(schema.Caveats) != 1 || schema.Caveats[0].Name != "with" {
+		t.Errorf("Caveats = %+v, want with", schema.Caveats)
+	}
+	if len(schema.Definitions) != 2 || schema.Definitions[0].Name != "with" {
+		t.Fatalf("Definitions = %+v, want with and doc", schema.Definitions)
+	}
+
+	rel := schema.Definitions[1].Relations[0]
+	if rel.Name != "with" || len(rel.SubjectTypes) != 2 {
+		t.Fatalf("relation = %q with %d subject types, want with with 2", rel.Name, len(rel.SubjectTypes))
+	}
+	if st := rel.SubjectTypes[0]; st.TypeName != "with" || st.Relation != "member" {
+		t.Errorf("subject type = %+v, want with#member", st)
+	}
+	if st := rel.SubjectTypes[1]; st.TypeName != "user" || st.Caveat != "with" {
+		t.Errorf("subject type = %+v, want user with with", st)
+	}
+
+	union, ok := schema.Definitions[1].Permissions[0].Expression.(*ast.UnionExpr)
+	if !ok {
+		t.Fatalf("expected UnionExpr, got %T", schema.Definitions[1].Permissions[0].Expression)
+	}
+	if ref, ok := union.Left.(*ast.RelationRef); !ok || ref.Name != "with" {
+		t.Errorf("left = %#v, want relation with", union.Left)
+	}
+	if arrow, ok := union.Right.(*ast.ArrowExpr); !ok || arrow.Relation != "with" || arrow.Permission != "member" {
+		t.Errorf("right = %#v, want with->member", union.Right)
+	}
+}
+
+func TestParseNilAsName(t *testing.T) {
+	tokens := mustLex(t, `definition nil {
+	relation member: user
+	permission nil = member
+}
+
+definition doc {
+	relation parent: nil#nil
+	relation nil: user
+	permission view = parent->nil + parent.all(nil)
+	permission none = nil
+}`)
+	schema, err := Parse(tokens)
+	if err != nil {
+		t.Fatalf("Parse() error: %v", err)
+	}
+
+	if len(schema.Definitions) != 2 || schema.Definitions[0].Name != "nil" || schema.Definitions[0].Permissions[0].Name != "nil" {
+		t.Fatalf("Definitions = %+v, want nil with permission nil, and doc", schema.Definitions)
+	}
+
+	doc := schema.Definitions[1]
+	if st := doc.Relations[0].SubjectTypes[0]; st.TypeName != "nil" || st.Relation != "nil" {
+		t.Errorf("subject type = %+v, want nil#nil", st)
+	}
+	if doc.Relations[1].Name != "nil" {
+		t.Errorf("relation = %q, want nil", doc.Relations[1].Name)
+	}
+
+	union, ok := doc.Permissions[0].Expression.(*ast.UnionExpr)
+	if !ok {
+		t.Fatalf("expected UnionExpr, got %T", doc.Permissions[0].Expression)
+	}
+	if arrow, ok := union.Left.(*ast.ArrowExpr); !ok || arrow.Permission != "nil" {
+		t.Errorf("left = %#v, want parent->nil", union.Left)
+	}
+	if arrow, ok := union.Right.(*ast.FunctionedArrowExpr); !ok || arrow.Permission != "nil" {
+		t.Errorf("right = %#v, want parent.all(nil)", union.Right)
+	}
+
+	// In an expression, nil is still the empty permission rather than the relation.
+	if _, ok := doc.Permissions[1].Expression.(*ast.NilExpr); !ok {
+		t.Errorf("expected NilExpr, got %T", doc.Permissions[1].Expression)
+	}
+}
+
+func TestParseUseAsName(t *testing.T) {
+	tokens := mustLex(t, `use expiration
+
+caveat use(use int) {
+	use > 0
+}
+
+definition use {
+	relation use: user
+}
+
+definition doc {
+	relation use: use#use | use with use and expiration
+	permission view = use + use->use
+}`)
+	schema, err := Parse(tokens)
+	if err != nil {
+		t.Fatalf("Parse() error: %v", err)
+	}
+
+	if len(schema.UseFlags) != 1 || schema.UseFlags[0].Name != "expiration" {
+		t.Errorf("UseFlags = %+v, want expiration", schema.UseFlags)
+	}
+	if len(schema.Caveats) != 1 || schema.Caveats[0].Name != "use" || schema.Caveats[0].Parameters[0].Name != "use" {
+		t.Errorf("Caveats = %+v, want use(use int)", schema.Caveats)
+	}
+	if len(schema.Definitions) != 2 || schema.Definitions[0].Name != "use" || schema.Definitions[0].Relations[0].Name != "use" {
+		t.Fatalf("Definitions = %+v, want use with relation use, and doc", schema.Definitions)
+	}
+
+	rel := schema.Definitions[1].Relations[0]
+	if rel.Name != "use" || len(rel.SubjectTypes) != 2 {
+		t.Fatalf("relation = %q with %d subject types, want use with 2", rel.Name, len(rel.SubjectTypes))
+	}
+	if st := rel.SubjectTypes[0]; st.TypeName != "use" || st.Relation != "use" {
+		t.Errorf("subject type = %+v, want use#use", st)
+	}
+	if st := rel.SubjectTypes[1]; st.TypeName != "use" || st.Caveat != "use" || !st.Expiration {
+		t.Errorf("subject type = %+v, want use with use and expiration", st)
+	}
+
+	union, ok := schema.Definitions[1].Permissions[0].Expression.(*ast.UnionExpr)
+	if !ok {
+		t.Fatalf("expected UnionExpr, got %T", schema.Definitions[1].Permissions[0].Expression)
+	}
+	if ref, ok := union.Left.(*ast.RelationRef); !ok || ref.Name != "use" {
+		t.Errorf("left = %#v, want relation use", union.Left)
+	}
+	if arrow, ok := union.Right.(*ast.ArrowExpr); !ok || arrow.Relation != "use" || arrow.Permission != "use" {
+		t.Errorf("right = %#v, want use->use", union.Right)
+	}
+}
+
+func TestParseAllRecoveryKeepsUseAsName(t *testing.T) {
+	tokens := mustLex(t, `definition doc {
+	relation owner user
+	relation use: user
+	permission view = use
+}
+
+definition folder {}`)
+	schema, errs := ParseAll(tokens)
+
+	if len(errs) != 1 || errs[0].Line != 2 {
+		t.Fatalf("ParseAll() errors = %v, want one on line 2", errs)
+	}
+	if len(schema.UseFlags) != 0 {
+		t.Errorf("UseFlags = %+v, want none", schema.UseFlags)
+	}
+	if len(schema.Definitions) != 1 || schema.Definitions[0].Name != "folder" {
+		t.Errorf("Definitions = %+v, want folder", schema.Definitions)
+	}
+}
+
+func TestParseImportAndPartialAsNames(t *testing.T) {
+	tokens := mustLex(t, `import "./common.zed"
+
+partial import {
+	relation partial: user
+}
+
+definition partial {
+	...import
+	relation import: partial#partial
+	permission view = import->partial + partial
+}`)
+	schema, err := Parse(tokens)
+	if err != nil {
+		t.Fatalf("Parse() error: %v", err)
+	}
+
+	if len(schema.Imports) != 1 || schema.Imports[0].Path != "./common.zed" {
+		t.Errorf("Imports = %+v, want ./common.zed", schema.Imports)
+	}
+	if len(schema.Partials) != 1 || schema.Partials[0].Name != "import" || schema.Partials[0].Relations[0].Name != "partial" {
+		t.Fatalf("Partials = %+v, want import with relation partial", schema.Partials)
+	}
+
+	def := schema.Definitions[0]
+	if def.Name != "partial" || len(def.PartialRefs) != 1 || def.PartialRefs[0].Name != "import" {
+		t.Fatalf("definition = %q including %+v, want partial including import", def.Name, def.PartialRefs)
+	}
+	if rel := def.Relations[0]; rel.Name != "import" || rel.SubjectTypes[0].TypeName != "partial" || rel.SubjectTypes[0].Relation != "partial" {
+		t.Errorf("relation = %+v, want import: partial#partial", rel)
+	}
+
+	union, ok := def.Permissions[0].Expression.(*ast.UnionExpr)
+	if !ok {
+		t.Fatalf("expected UnionExpr, got %T", def.Permissions[0].Expression)
+	}
+	if arrow, ok := union.Left.(*ast.ArrowExpr); !ok || arrow.Relation != "import" || arrow.Permission != "partial" {
+		t.Errorf("left = %#v, want import->partial", union.Left)
+	}
+	if ref, ok := union.Right.(*ast.RelationRef); !ok || ref.Name != "partial" {
+		t.Errorf("right = %#v, want relation partial", union.Right)
+	}
+}
+
+func TestParseAllRecoveryKeepsImportAndPartialAsNames(t *testing.T) {
+	tokens := mustLex(t, `definition doc {
+	relation owner user
+	relation partial: user
+	permission import = partial
+}
+
+partial viewable {}`)
+	schema, errs := ParseAll(tokens)
+
+	if len(errs) != 1 || errs[0].Line != 2 {
+		t.Fatalf("ParseAll() errors = %v, want one on line 2", errs)
+	}
+	if len(schema.Imports) != 0 {
+		t.Errorf("Imports = %+v, want none", schema.Imports)
+	}
+	if len(schema.Partials) != 1 || schema.Partials[0].Name != "viewable" {
+		t.Errorf("Partials = %+v, want viewable", schema.Partials)
+	}
+}
+
+func TestParseAttachesComments(t *testing.T) {
+	tokens := mustLex(t, `// Users sign in with SSO.
+definition user {}
+
+/* Documents. */
+definition doc { // header
+	// Who owns it.
+	relation owner: user // exactly one
+	permission view = owner /* inline */ + owner
+	// nothing else yet
+} // end
+
+// trailing file comment
+`)
 	schema, err := Parse(tokens)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	if len(schema.Definitions) != 0 {
-		t.Errorf("expected 0 definitions, got %d", len(schema.Definitions))
+
+	user, doc := schema.Definitions[0], schema.Definitions[1]
+	check := func(name string, got, want []string) {
+		t.Helper()
+		if strings.Join(got, "|") != strings.Join(want, "|") {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+	check("user leading", user.Comments.Leading, []string{"// Users sign in with SSO."})
+	check("doc leading", doc.Comments.Leading, []string{"/* Documents. */"})
+	check("doc header trailing", doc.Comments.Trailing, []string{"// header"})
+	check("owner leading", doc.Relations[0].Comments.Leading, []string{"// Who owns it."})
+	check("owner trailing", doc.Relations[0].Comments.Trailing, []string{"// exactly one"})
+	check("view trailing", doc.Permissions[0].Comments.Trailing, []string{"/* inline */"})
+	check("doc end leading", doc.EndComments.Leading, []string{"// nothing else yet"})
+	check("doc end trailing", doc.EndComments.Trailing, []string{"// end"})
+	check("schema end", schema.EndComments, []string{"// trailing file comment"})
+}
+
+func TestParseImportsAndPartials(t *testing.T) {
+	tokens := mustLex(t, `import "./common.zed"
+
+partial viewable {
+	relation viewer: user
+	permission view = viewer
+}
+
+definition doc {
+	...viewable
+	relation owner: user
+	...editable
+}`)
+	schema, err := Parse(tokens)
+	if err != nil {
+		t.Fatalf("Parse() error: %v", err)
+	}
+
+	if len(schema.Imports) != 1 || schema.Imports[0].Path != "./common.zed" {
+		t.Fatalf("Imports = %+v, want ./common.zed", schema.Imports)
+	}
+	if pos := schema.Imports[0].Pos; pos.Line != 1 || pos.Column != 8 {
+		t.Errorf("import position = %v, want line 1, column 8", pos)
+	}
+
+	if len(schema.Partials) != 1 || schema.Partials[0].Name != "viewable" {
+		t.Fatalf("Partials = %+v, want viewable", schema.Partials)
+	}
+	if partial := schema.Partials[0]; len(partial.Relations) != 1 || len(partial.Permissions) != 1 {
+		t.Errorf("partial viewable has %d relations and %d permissions, want 1 and 1", len(partial.Relations), len(partial.Permissions))
+	}
+
+	doc := schema.Definitions[0]
+	var refs []string
+	for _, ref := range doc.PartialRefs {
+		refs = append(refs, ref.Name)
+	}
+	if got := strings.Join(refs, ","); got != "viewable,editable" {
+		t.Errorf("PartialRefs = %s, want viewable,editable", got)
+	}
+	if len(doc.Relations) != 1 {
+		t.Errorf("doc has %d relations, want 1", len(doc.Relations))
+	}
+}
+
+func TestParseImportErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"missing path", "import common", "expected token type STRING"},
+		{"empty path", `import ""`, "empty import path"},
+		{"missing partial name", "definition doc { ... }", "expected token type IDENTIFIER"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(mustLex(t, tt.input))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Parse() error = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseFileRecordsFile(t *testing.T) {
+	schema, errs := ParseFile("schema/doc.zed", mustLex(t, "definition doc {\n\trelation owner: user\n}\n\ndefinition {}"))
+	if len(errs) != 1 {
+		t.Fatalf("ParseFile() returned %d errors, want 1: %v", len(errs), errs)
+	}
+	if got, want := errs[0].Error(), "parse error at schema/doc.zed:5:12: "; !strings.HasPrefix(got, want) {
+		t.Errorf("error = %q, want prefix %q", got, want)
+	}
+
+	rel := schema.Definitions[0].Relations[0]
+	if want := (ast.Pos{File: "schema/doc.zed", Line: 2, Column: 11}); rel.Pos != want {
+		t.Errorf("relation position = %+v, want %+v", rel.Pos, want)
+	}
+	if got := rel.SubjectTypes[0].Pos.File; got != "schema/doc.zed" {
+		t.Errorf("subject type file = %q, want schema/doc.zed", got)
 	}
 }
@@ -0,0 +1,244 @@
+// Package printer renders a parsed schema as canonical schema text: use directives first,
+// then imports, caveats, partials and definitions, each separated by a blank line; partial
+// references before relations and relations before permissions; tab indentation; single spaces around operators; and only the parentheses
+// that operator precedence requires. Comments are kept with the nodes they are attached to.
+package printer
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/oitnes/authzed-codegen/internal/generator/ast"
+)
+
+// Print renders schema as canonical schema text ending in a newline.
+func Print(schema *ast.Schema) []byte {
+	p := &printer{}
+
+	for _, flag := range schema.UseFlags {
+		p.leading(flag.Comments, "")
+		p.line("", "use "+flag.Name, flag.Comments.Trailing)
+	}
+
+	for i, imp := range schema.Imports {
+		if i == 0 {
+			p.blankLine()
+		}
+		p.leading(imp.Comments, "")
+		p.line("", "import "+strconv.Quote(imp.Path), imp.Comments.Trailing)
+	}
+
+	for _, caveat := range schema.Caveats {
+		p.blankLine()
+		p.caveat(caveat)
+	}
+
+	for _, partial := range schema.Partials {
+		p.blankLine()
+		p.definition("partial", partial)
+	}
+
+	for _, def := range schema.Definitions {
+		p.blankLine()
+		p.definition("definition", def)
+	}
+
+	if len(schema.EndComments) > 0 {
+		p.blankLine()
+		for _, c := range schema.EndComments {
+			p.line("", c, nil)
+		}
+	}
+
+	return []byte(p.b.String())
+}
+
+type printer struct {
+	b strings.Builder
+}
+
+// blankLine separates top-level declarations, except at the start of the output.
+func (p *printer) blankLine() {
+	if p.b.Len() > 0 {
+		p.b.WriteString("\n")
+	}
+}
+
+// line writes one indented line followed by the trailing comments. Empty text is a blank line.
+func (p *printer) line(indent, text string, trailing []string) {
+	if text == "" {
+		p.b.WriteString("\n")
+		return
+	}
+	p.b.WriteString(indent)
+	p.b.WriteString(text)
+	for _, c := range trailing {
+		p.b.WriteString(" ")
+		p.b.WriteString(c)
+	}
+	p.b.WriteString("\n")
+}
+
+func (p *printer) leading(comments ast.Comments, indent string) {
+	for _, c := range comments.Leading {
+		p.line(indent, c, nil)
+	}
+}
+
+// definition renders a definition or partial, introduced by keyword.
+func (p *printer) definition(keyword string, def *ast.Definition) {
+	p.leading(def.Comments, "")
+	header := keyword + " " + def.Name + " {"
+
+	if len(def.PartialRefs) == 0 && len(def.Relations) == 0 && len(def.Permissions) == 0 && len(def.EndComments.Leading) == 0 {
+		p.line("", header+"}", append(append([]string(nil), def.Comments.Trailing...), def.EndComments.Trailing...))
+		return
+	}
+
+	p.line("", header, def.Comments.Trailing)
+	for _, ref := range def.PartialRefs {
+		p.leading(ref.Comments, "\t")
+		p.line("\t", "..."+ref.Name, ref.Comments.Trailing)
+	}
+	if len(def.PartialRefs) > 0 && len(def.Relations)+len(def.Permissions) > 0 {
+		p.b.WriteString("\n")
+	}
+	for _, rel := range def.Relations {
+		p.leading(rel.Comments, "\t")
+		p.line("\t", relation(rel), rel.Comments.Trailing)
+	}
+	if len(def.Relations) > 0 && len(def.Permissions) > 0 {
+		p.b.WriteString("\n")
+	}
+	for _, perm := range def.Permissions {
+		p.leading(perm.Comments, "\t")
+		p.line("\t", "permission "+perm.Name+" = "+Expression(perm.Expression), perm.Comments.Trailing)
+	}
+	p.leading(def.EndComments, "\t")
+	p.line("", "}", def.EndComments.Trailing)
+}
+
+func (p *printer) caveat(caveat *ast.Caveat) {
+	p.leading(caveat.Comments, "")
+
+	params := make([]string, len(caveat.Parameters))
+	for i, param := range caveat.Parameters {
+		params[i] = param.Name + " " + param.Type.String()
+	}
+	p.line("", "caveat "+caveat.Name+"("+strings.Join(params, ", ")+") {", caveat.Comments.Trailing)
+
+	for _, l := range dedent(caveat.Expression) {
+		p.line("\t", l, nil)
+	}
+
+	p.leading(caveat.EndComments, "\t")
+	p.line("", "}", caveat.EndComments.Trailing)
+}
+
+// dedent splits a caveat expression into lines and removes the indentation its lines share.
+// The first line never has any, since the expression starts at its first character.
+func dedent(expression string) []string {
+	lines := strings.Split(strings.TrimSpace(expression), "\n")
+	for i := range lines {
+		lines[i] = strings.TrimRight(lines[i], " \t\r")
+	}
+
+	common := -1
+	for _, l := range lines[1:] {
+		if l == "" {
+			continue
+		}
+		indent := len(l) - len(strings.TrimLeft(l, " \t"))
+		if common < 0 || indent < common {
+			common = indent
+		}
+	}
+	if common > 0 {
+		for i := 1; i < len(lines); i++ {
+			if len(lines[i]) >= common {
+				lines[i] = lines[i][common:]
+			}
+		}
+	}
+	return lines
+}
+
+func relation(rel *ast.Relation) string {
+	types := make([]string, len(rel.SubjectTypes))
+	for i, st := range rel.SubjectTypes {
+		types[i] = SubjectType(st)
+	}
+	return "relation " + rel.Name + ": " + strings.Join(types, " | ")
+}
+
+// SubjectType renders a subject type of a relation as written in a schema, e.g.
+// "group#member" or "user with ip_allowlist and expiration".
+func SubjectType(st *ast.SubjectType) string {
+	s := st.TypeName
+	switch {
+	case st.IsWildcard:
+		s += ":*"
+	case st.Relation != "":
+		s += "#" + st.Relation
+	}
+
+	switch {
+	case st.Caveat != "" && st.Expiration:
+		s += " with " + st.Caveat + " and expiration"
+	case st.Caveat != "":
+		s += " with " + st.Caveat
+	case st.Expiration:
+		s += " with expiration"
+	}
+	return s
+}
+
+// Operator precedence, from lowest to highest, as in the parser.
+const (
+	precExclusion = iota + 1
+	precIntersection
+	precUnion
+	precPrimary
+)
+
+// Expression renders a permission expression with only the parentheses it needs.
+func Expression(expr ast.Expr) string {
+	return expression(expr, 0)
+}
+
+// expression renders expr, parenthesized if its precedence is below minPrec.
+func expression(expr ast.Expr, minPrec int) string {
+	var s string
+	var prec int
+
+	switch e := expr.(type) {
+	case *ast.ExclusionExpr:
+		prec = precExclusion
+		s = binary(e.Left, " - ", e.Right, prec)
+	case *ast.IntersectionExpr:
+		prec = precIntersection
+		s = binary(e.Left, " & ", e.Right, prec)
+	case *ast.UnionExpr:
+		prec = precUnion
+		s = binary(e.Left, " + ", e.Right, prec)
+	case *ast.ArrowExpr:
+		prec, s = precPrimary, e.Relation+"->"+e.Permission
+	case *ast.FunctionedArrowExpr:
+		prec, s = precPrimary, e.Relation+"."+e.Function.String()+"("+e.Permission+")"
+	case *ast.NilExpr:
+		prec, s = precPrimary, "nil"
+	case *ast.RelationRef:
+		prec, s = precPrimary, e.Name
+	}
+
+	if prec < minPrec {
+		return "(" + s + ")"
+	}
+	return s
+}
+
+// binary renders a left-associative operator: the right operand needs parentheses even at
+// the operator's own precedence to keep its grouping.
+func binary(left ast.Expr, op string, right ast.Expr, prec int) string {
+	return expression(left, prec) + op + expression(right, prec+1)
+}
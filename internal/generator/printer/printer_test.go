@@ -0,0 +1,197 @@
+package printer
+
+import (
+	"os"
+	"testing"
+
+	"github.com/oitnes/authzed-codegen/internal/generator/ast"
+	"github.com/oitnes/authzed-codegen/internal/generator/parser"
+	zedlexer "github.com/oitnes/authzed-codegen/internal/generator/zed_lexer"
+)
+
+func mustParse(t *testing.T, input string) *ast.Schema {
+	t.Helper()
+	tokens, err := zedlexer.Lex(input)
+	if err != nil {
+		t.Fatalf("Lex() error: %v", err)
+	}
+	schema, err := parser.Parse(tokens)
+	if err != nil {
+		t.Fatalf("Parse() error: %v", err)
+	}
+	return schema
+}
+
+func TestPrintCanonicalLayout(t *testing.T) {
+	input := `definition user{}
+caveat   ip_allowlist( user_ip ipaddress,allowed list<ipaddress> ) {
+    allowed.exists(a, a == user_ip)
+}
+use expiration
+definition   doc {
+  permission view=viewer+owner
+    relation owner:user
+  relation viewer : user|user:* | group#member with ip_allowlist|user with ip_allowlist and expiration
+}
+definition group {relation member: user with expiration}
+`
+	want := `use expiration
+
+caveat ip_allowlist(user_ip ipaddress, allowed list<ipaddress>) {
+	allowed.exists(a, a == user_ip)
+}
+
+definition user {}
+
+definition doc {
+	relation owner: user
+	relation viewer: user | user:* | group#member with ip_allowlist | user with ip_allowlist and expiration
+
+	permission view = viewer + owner
+}
+
+definition group {
+	relation member: user with expiration
+}
+`
+	if got := string(Print(mustParse(t, input))); got != want {
+		t.Errorf("Print() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestPrintExpressions(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"a + b + c", "a + b + c"},
+		{"a + (b + c)", "a + (b + c)"},
+		{"(a + b) & c", "a + b & c"},
+		{"a + (b & c)", "a + (b & c)"},
+		{"a - (b - c)", "a - (b - c)"},
+		{"(a - b) - c", "a - b - c"},
+		{"a & (b - c)", "a & (b - c)"},
+		{"(((a)))", "a"},
+		{"parent->view + parent.any(view) - parent.all(edit)", "parent->view + parent.any(view) - parent.all(edit)"},
+		{"nil", "nil"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			schema := mustParse(t, "definition doc { permission p = "+tt.input+" }")
+			if got := expression(schema.Definitions[0].Permissions[0].Expression, 0); got != tt.want {
+				t.Errorf("expression() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrintKeepsComments(t *testing.T) {
+	input := `// Package header.
+
+// user is anyone who signs in.
+definition user {} // no relations
+
+/* documents */
+definition doc { // header
+	// who owns it
+	relation owner: user // usually one
+	relation viewer: user /* direct */ | user:*
+
+	permission view = owner + viewer // everyone
+	// more to come
+} // end of doc
+
+// trailing notes
+`
+	got := string(Print(mustParse(t, input)))
+	want := `// Package header.
+
+// user is anyone who signs in.
+definition user {} // no relations
+
+/* documents */
+definition doc { // header
+	// who owns it
+	relation owner: user // usually one
+	relation viewer: user | user:* /* direct */
+
+	permission view = owner + viewer // everyone
+	// more to come
+} // end of doc
+
+// trailing notes
+`
+	if got != want {
+		t.Errorf("Print() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestPrintIsIdempotent(t *testing.T) {
+	for _, path := range []string{
+		"../../../test_data/example_1/schema.zed",
+		"../../../test_data/example_2/schema.zed",
+		"../../../test_data/example_5/schema.zed",
+	} {
+		t.Run(path, func(t *testing.T) {
+			content, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("reading schema: %v", err)
+			}
+
+			once := Print(mustParse(t, string(content)))
+			twice := Print(mustParse(t, string(once)))
+			if string(once) != string(twice) {
+				t.Errorf("formatting is not idempotent:\n%s\nthen\n%s", once, twice)
+			}
+		})
+	}
+}
+
+func TestDedent(t *testing.T) {
+	got := dedent("a > 1 &&\n        b < 2 &&\n          c\n")
+	want := []string{"a > 1 &&", "b < 2 &&", "  c"}
+	if len(got) != len(want) {
+		t.Fatalf("dedent() = %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("dedent()[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestPrintImportsAndPartials(t *testing.T) {
+	input := `definition doc { relation owner: user
+...viewable }
+import "./common.zed"
+partial viewable { ...listable relation viewer: user permission view = viewer }
+use expiration
+import "./users.zed" // users
+partial listable {}
+`
+	want := `use expiration
+
+import "./common.zed"
+import "./users.zed" // users
+
+partial viewable {
+	...listable
+
+	relation viewer: user
+
+	permission view = viewer
+}
+
+partial listable {}
+
+definition doc {
+	...viewable
+
+	relation owner: user
+}
+`
+	if got := string(Print(mustParse(t, input))); got != want {
+		t.Errorf("Print() =\n%s\nwant\n%s", got, want)
+	}
+}
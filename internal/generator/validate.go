@@ -0,0 +1,123 @@
+package generator
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/oitnes/authzed-codegen/internal/generator/analysis"
+	"github.com/oitnes/authzed-codegen/internal/generator/ast"
+	"github.com/oitnes/authzed-codegen/internal/generator/loader"
+	"github.com/oitnes/authzed-codegen/internal/generator/validator"
+)
+
+// Severity classifies a diagnostic. Only errors make a schema invalid.
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// Diagnostic is a single problem found in a schema file.
+type Diagnostic struct {
+	File     string   `json:"file"`
+	Line     int      `json:"line"`
+	Column   int      `json:"column"`
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+}
+
+// String formats the diagnostic as file:line:column: severity: message.
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s:%d:%d: %s: %s", d.File, d.Line, d.Column, d.Severity, d.Message)
+}
+
+// HasErrors reports whether any of the diagnostics is an error.
+func HasErrors(diagnostics []Diagnostic) bool {
+	for _, d := range diagnostics {
+		if d.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateFile loads and checks the schema that path names, without generating code. A
+// directory or glob is checked as one schema merged from its files, and imports are
+// followed; diagnostics name the file they were found in. The error is reserved for
+// failing to read the schema files.
+func ValidateFile(path string) ([]Diagnostic, error) {
+	schema, err := loader.Load(path)
+	var loadErr *loader.Error
+	if err != nil && !errors.As(err, &loadErr) {
+		return nil, err
+	}
+
+	return validate(path, schema, err), nil
+}
+
+// ValidateString checks schemaContent, attributing diagnostics to file. It reports every
+// illegal token, or else every syntax error, or else every import and partial that cannot
+// be resolved, or else every semantic problem, since each stage needs the output of the
+// previous one to be complete. Warnings point out permissions that no subject can ever hold.
+func ValidateString(file, schemaContent string) []Diagnostic {
+	schema, err := loader.LoadString(file, schemaContent)
+	return validate(file, schema, err)
+}
+
+// validate reports loadErr, the error of loading schema, or else the problems of schema.
+// Positions without a file are attributed to file.
+func validate(file string, schema *ast.Schema, loadErr error) []Diagnostic {
+	var diagnostics []Diagnostic
+	report := func(pos ast.Pos, severity Severity, message string) {
+		if pos.File == "" {
+			pos.File = file
+		}
+		diagnostics = append(diagnostics, Diagnostic{
+			File:     pos.File,
+			Line:     pos.Line,
+			Column:   pos.Column,
+			Severity: severity,
+			Message:  message,
+		})
+	}
+
+	if loadErr != nil {
+		var lErr *loader.Error
+		if !errors.As(loadErr, &lErr) {
+			report(ast.Pos{}, SeverityError, loadErr.Error())
+			return diagnostics
+		}
+		for _, d := range lErr.Diagnostics {
+			report(d.Pos, SeverityError, d.Message)
+		}
+		return diagnostics
+	}
+
+	if err := validator.Validate(schema); err != nil {
+		var validationErr *validator.Error
+		if !errors.As(err, &validationErr) {
+			report(ast.Pos{}, SeverityError, err.Error())
+			return diagnostics
+		}
+		for _, d := range validationErr.Diagnostics {
+			report(d.Pos, SeverityError, d.Message)
+		}
+		return diagnostics
+	}
+
+	reach := analysis.ComputeReachability(schema)
+	for _, def := range schema.Definitions {
+		for _, perm := range def.Permissions {
+			if _, isNil := perm.Expression.(*ast.NilExpr); isNil {
+				continue
+			}
+			if len(reach.SubjectTypes(def.Name, perm.Name)) == 0 {
+				report(perm.Pos, SeverityWarning,
+					fmt.Sprintf("permission %s#%s can never be granted to any subject", def.Name, perm.Name))
+			}
+		}
+	}
+
+	return diagnostics
+}
@@ -0,0 +1,158 @@
+package generator
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateStringValid(t *testing.T) {
+	diagnostics := ValidateString("schema.zed", `definition user {}
+
+definition doc {
+	relation owner: user
+	permission view = owner
+	permission archive = nil
+}`)
+	if len(diagnostics) != 0 {
+		t.Errorf("expected no diagnostics, got %v", diagnostics)
+	}
+}
+
+func TestValidateStringLexErrors(t *testing.T) {
+	diagnostics := ValidateString("schema.zed", "definition user { @ }\ndefinition doc $")
+	want := []Diagnostic{
+		{File: "schema.zed", Line: 1, Column: 19, Severity: SeverityError, Message: `illegal token "@"`},
+		{File: "schema.zed", Line: 2, Column: 16, Severity: SeverityError, Message: `illegal token "$"`},
+	}
+	if !reflect.DeepEqual(diagnostics, want) {
+		t.Errorf("ValidateString() = %v, want %v", diagnostics, want)
+	}
+}
+
+func TestValidateStringParseErrors(t *testing.T) {
+	diagnostics := ValidateString("schema.zed", `definition doc {
+	relation owner user
+}
+
+definition folder {
+	permission = owner
+}`)
+	if len(diagnostics) != 2 {
+		t.Fatalf("expected 2 diagnostics, got %v", diagnostics)
+	}
+	if got := diagnostics[0].String(); !strings.HasPrefix(got, "schema.zed:2:17: error: ") {
+		t.Errorf("diagnostic 0 = %q", got)
+	}
+	if got := diagnostics[1].String(); !strings.HasPrefix(got, "schema.zed:6:13: error: ") {
+		t.Errorf("diagnostic 1 = %q", got)
+	}
+	if !HasErrors(diagnostics) {
+		t.Error("HasErrors() = false, want true")
+	}
+}
+
+func TestValidateStringTruncated(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+		want   string
+	}{
+		{"definition", "definition doc {\n\trelation owner: user", "trunc.zed:2:18: error: unexpected end of input"},
+		{"permission", "definition doc {\n\tpermission view =", "trunc.zed:2:18: error: expected identifier"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diagnostics := ValidateString("trunc.zed", tt.schema)
+			if len(diagnostics) != 1 {
+				t.Fatalf("expected 1 diagnostic, got %v", diagnostics)
+			}
+			if diagnostics[0].Line == 0 {
+				t.Errorf("diagnostic has no line: %v", diagnostics[0])
+			}
+			if got := diagnostics[0].String(); !strings.HasPrefix(got, tt.want) {
+				t.Errorf("diagnostic = %q, want prefix %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateStringSemanticErrorsAndWarnings(t *testing.T) {
+	diagnostics := ValidateString("schema.zed", `definition user {}
+
+definition doc {
+	relation owner: user
+	relation viewer: group
+	permission view = owner + editor
+}`)
+	want := []string{
+		`schema.zed:5:19: error: relation doc#viewer references undefined type "group"`,
+		`schema.zed:6:28: error: permission doc#view references undefined relation or permission "editor"`,
+	}
+	if len(diagnostics) != len(want) {
+		t.Fatalf("expected %d diagnostics, got %v", len(want), diagnostics)
+	}
+	for i, w := range want {
+		if got := diagnostics[i].String(); got != w {
+			t.Errorf("diagnostic %d = %q, want %q", i, got, w)
+		}
+	}
+
+	diagnostics = ValidateString("schema.zed", `definition user {}
+
+definition team {}
+
+definition doc {
+	relation owner: user
+	relation team: team
+	permission manage = owner & team
+}`)
+	if len(diagnostics) != 1 || diagnostics[0].Severity != SeverityWarning || diagnostics[0].Line != 8 {
+		t.Fatalf("expected one warning on line 8, got %v", diagnostics)
+	}
+	if HasErrors(diagnostics) {
+		t.Error("HasErrors() = true for warnings only")
+	}
+}
+
+func TestValidateFileMissing(t *testing.T) {
+	_, err := ValidateFile(filepath.Join(t.TempDir(), "missing.zed"))
+	if err == nil || !strings.Contains(err.Error(), "reading schema") {
+		t.Errorf("expected reading schema error, got %v", err)
+	}
+}
+
+func TestValidateFileNamesFileOfEachDiagnostic(t *testing.T) {
+	dir := t.TempDir()
+	common := writeSchema(t, dir, "common.zed", "definition user {}")
+	booking := writeSchema(t, dir, "booking.zed", `definition user {}
+
+definition booking {
+	relation owner: employee
+}`)
+
+	diagnostics, err := ValidateFile(filepath.Join(dir, "*.zed"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []Diagnostic{
+		{File: booking, Line: 4, Column: 18, Severity: SeverityError, Message: `relation booking#owner references undefined type "employee"`},
+		{File: common, Line: 1, Column: 12, Severity: SeverityError, Message: `duplicate definition "user", first declared at ` + booking + ":1:12"},
+	}
+	if !reflect.DeepEqual(diagnostics, want) {
+		t.Errorf("ValidateFile() =\n%v\nwant\n%v", diagnostics, want)
+	}
+}
+
+func TestValidateStringUnresolvedImport(t *testing.T) {
+	diagnostics := ValidateString("schema.zed", `import "missing.zed"`)
+	if len(diagnostics) != 1 {
+		t.Fatalf("expected 1 diagnostic, got %v", diagnostics)
+	}
+	if got := diagnostics[0].String(); !strings.HasPrefix(got, `schema.zed:1:8: error: importing "missing.zed"`) {
+		t.Errorf("diagnostic = %q", got)
+	}
+}
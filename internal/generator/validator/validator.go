@@ -0,0 +1,282 @@
+// Package validator checks a parsed schema for semantic errors that the parser cannot
+// see, such as references to undefined types, relations, permissions and caveats.
+package validator
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/oitnes/authzed-codegen/internal/generator/ast"
+	"github.com/oitnes/authzed-codegen/internal/generator/printer"
+)
+
+// Diagnostic is a single problem found in a schema.
+type Diagnostic struct {
+	Pos     ast.Pos
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s", d.Pos, d.Message)
+}
+
+// Error reports every problem found in a schema, ordered by file and position.
+type Error struct {
+	Diagnostics []Diagnostic
+}
+
+func (e *Error) Error() string {
+	if len(e.Diagnostics) == 1 {
+		return "validation error at " + e.Diagnostics[0].String()
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d validation errors:", len(e.Diagnostics))
+	for _, d := range e.Diagnostics {
+		b.WriteString("\n  ")
+		b.WriteString(d.String())
+	}
+	return b.String()
+}
+
+// caveatTypeArity maps each caveat parameter type to the number of type arguments it takes.
+var caveatTypeArity = map[string]int{
+	"any":       0,
+	"bool":      0,
+	"bytes":     0,
+	"double":    0,
+	"duration":  0,
+	"int":       0,
+	"ipaddress": 0,
+	"string":    0,
+	"timestamp": 0,
+	"uint":      0,
+	"list":      1,
+	"map":       1,
+}
+
+// useFlags lists the features a schema may enable with "use".
+var useFlags = map[string]bool{
+	"expiration": true,
+}
+
+type validator struct {
+	schema      *ast.Schema
+	definitions map[string]*definition
+	caveats     map[string]*ast.Caveat
+	diagnostics []Diagnostic
+}
+
+// definition indexes the members of one object type.
+type definition struct {
+	def         *ast.Definition
+	relations   map[string]*ast.Relation
+	permissions map[string]*ast.Permission
+}
+
+func (d *definition) hasMember(name string) bool {
+	return d.relations[name] != nil || d.permissions[name] != nil
+}
+
+// memberPos returns the position of the relation or permission name.
+func (d *definition) memberPos(name string) ast.Pos {
+	if rel := d.relations[name]; rel != nil {
+		return rel.Pos
+	}
+	return d.permissions[name].Pos
+}
+
+// Validate checks the schema and returns an *Error listing every problem, or nil.
+func Validate(schema *ast.Schema) error {
+	v := &validator{
+		schema:      schema,
+		definitions: make(map[string]*definition),
+		caveats:     make(map[string]*ast.Caveat),
+	}
+
+	for _, flag := range schema.UseFlags {
+		if !useFlags[flag.Name] {
+			v.report(flag.Pos, "unknown use flag %q", flag.Name)
+		}
+	}
+
+	v.indexCaveats(schema.Caveats)
+	v.indexDefinitions(schema.Definitions)
+
+	for _, c := range schema.Caveats {
+		v.validateCaveat(c)
+	}
+	for _, def := range schema.Definitions {
+		d := v.definitions[def.Name]
+		for _, rel := range def.Relations {
+			v.validateRelation(d, rel)
+		}
+		for _, perm := range def.Permissions {
+			v.validateExpr(d, perm, perm.Expression)
+		}
+	}
+
+	if len(v.diagnostics) == 0 {
+		return nil
+	}
+	sort.SliceStable(v.diagnostics, func(i, j int) bool {
+		a, b := v.diagnostics[i].Pos, v.diagnostics[j].Pos
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return &Error{Diagnostics: v.diagnostics}
+}
+
+func (v *validator) report(pos ast.Pos, format string, args ...any) {
+	v.diagnostics = append(v.diagnostics, Diagnostic{Pos: pos, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) indexCaveats(caveats []*ast.Caveat) {
+	for _, c := range caveats {
+		if first, ok := v.caveats[c.Name]; ok {
+			v.report(c.Pos, "duplicate caveat %q, first declared at %s", c.Name, first.Pos)
+			continue
+		}
+		v.caveats[c.Name] = c
+	}
+}
+
+func (v *validator) indexDefinitions(defs []*ast.Definition) {
+	for _, def := range defs {
+		d, ok := v.definitions[def.Name]
+		if ok {
+			v.report(def.Pos, "duplicate definition %q, first declared at %s", def.Name, d.def.Pos)
+		} else {
+			d = &definition{
+				def:         def,
+				relations:   make(map[string]*ast.Relation),
+				permissions: make(map[string]*ast.Permission),
+			}
+			v.definitions[def.Name] = d
+		}
+
+		for _, rel := range def.Relations {
+			if d.hasMember(rel.Name) {
+				v.report(rel.Pos, "duplicate relation or permission %q in definition %q, first declared at %s", rel.Name, def.Name, d.memberPos(rel.Name))
+				continue
+			}
+			d.relations[rel.Name] = rel
+		}
+		for _, perm := range def.Permissions {
+			if d.hasMember(perm.Name) {
+				v.report(perm.Pos, "duplicate relation or permission %q in definition %q, first declared at %s", perm.Name, def.Name, d.memberPos(perm.Name))
+				continue
+			}
+			d.permissions[perm.Name] = perm
+		}
+	}
+}
+
+func (v *validator) validateCaveat(c *ast.Caveat) {
+	seen := make(map[string]bool)
+	for _, param := range c.Parameters {
+		if seen[param.Name] {
+			v.report(param.Pos, "duplicate parameter %q in caveat %q", param.Name, c.Name)
+		}
+		seen[param.Name] = true
+		v.validateCaveatType(param.Type)
+	}
+}
+
+func (v *validator) validateCaveatType(t *ast.CaveatParameterType) {
+	arity, ok := caveatTypeArity[t.Name]
+	if !ok {
+		v.report(t.Pos, "unknown caveat parameter type %q", t.Name)
+		return
+	}
+	if len(t.TypeArgs) != arity {
+		v.report(t.Pos, "caveat parameter type %q takes %d type argument(s), got %d", t.Name, arity, len(t.TypeArgs))
+	}
+	for _, arg := range t.TypeArgs {
+		v.validateCaveatType(arg)
+	}
+}
+
+func (v *validator) validateRelation(d *definition, rel *ast.Relation) {
+	seen := make(map[string]bool)
+	for _, st := range rel.SubjectTypes {
+		key := printer.SubjectType(st)
+		if seen[key] {
+			v.report(st.Pos, "duplicate subject type %q in relation %s#%s", key, d.def.Name, rel.Name)
+		}
+		seen[key] = true
+
+		target, ok := v.definitions[st.TypeName]
+		if !ok {
+			v.report(st.Pos, "relation %s#%s references undefined type %q", d.def.Name, rel.Name, st.TypeName)
+		} else if st.Relation != "" && !target.hasMember(st.Relation) {
+			v.report(st.Pos, "relation %s#%s references undefined relation or permission %s#%s", d.def.Name, rel.Name, st.TypeName, st.Relation)
+		}
+
+		if st.Caveat != "" && v.caveats[st.Caveat] == nil {
+			v.report(st.Pos, "relation %s#%s references undefined caveat %q", d.def.Name, rel.Name, st.Caveat)
+		}
+		if st.Expiration && !v.schema.Uses("expiration") {
+			v.report(st.Pos, "relation %s#%s uses expiration, which requires \"use expiration\" in the schema", d.def.Name, rel.Name)
+		}
+	}
+}
+
+func (v *validator) validateExpr(d *definition, perm *ast.Permission, expr ast.Expr) {
+	switch e := expr.(type) {
+	case *ast.UnionExpr:
+		v.validateExpr(d, perm, e.Left)
+		v.validateExpr(d, perm, e.Right)
+	case *ast.IntersectionExpr:
+		v.validateExpr(d, perm, e.Left)
+		v.validateExpr(d, perm, e.Right)
+	case *ast.ExclusionExpr:
+		v.validateExpr(d, perm, e.Left)
+		v.validateExpr(d, perm, e.Right)
+	case *ast.RelationRef:
+		if !d.hasMember(e.Name) {
+			v.report(e.Pos, "permission %s#%s references undefined relation or permission %q", d.def.Name, perm.Name, e.Name)
+		}
+	case *ast.ArrowExpr:
+		v.validateArrow(d, perm, e.Relation, e.Permission, e.Pos, e.PermissionPos)
+	case *ast.FunctionedArrowExpr:
+		v.validateArrow(d, perm, e.Relation, e.Permission, e.Pos, e.PermissionPos)
+	}
+}
+
+// validateArrow checks that the left side of an arrow, plain or functioned, is a relation
+// without wildcard subjects and that at least one of its subject types defines the target.
+func (v *validator) validateArrow(d *definition, perm *ast.Permission, relation, target string, pos, targetPos ast.Pos) {
+	rel, ok := d.relations[relation]
+	if !ok {
+		if d.permissions[relation] != nil {
+			v.report(pos, "permission %s#%s uses permission %q on the left side of an arrow; only relations are allowed", d.def.Name, perm.Name, relation)
+		} else {
+			v.report(pos, "permission %s#%s references undefined relation %q", d.def.Name, perm.Name, relation)
+		}
+		return
+	}
+
+	found := false
+	checked := false
+	for _, st := range rel.SubjectTypes {
+		if st.IsWildcard {
+			v.report(pos, "permission %s#%s arrows over relation %q, which allows wildcard subject %s:*", d.def.Name, perm.Name, relation, st.TypeName)
+			return
+		}
+		if targetDef, ok := v.definitions[st.TypeName]; ok {
+			checked = true
+			found = found || targetDef.hasMember(target)
+		}
+	}
+
+	if checked && !found {
+		v.report(targetPos, "permission %s#%s arrows to %q, which is not defined on any subject type of relation %q", d.def.Name, perm.Name, target, relation)
+	}
+}
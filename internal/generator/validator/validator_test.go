@@ -0,0 +1,164 @@
+package validator
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/oitnes/authzed-codegen/internal/generator/ast"
+	"github.com/oitnes/authzed-codegen/internal/generator/parser"
+	zedlexer "github.com/oitnes/authzed-codegen/internal/generator/zed_lexer"
+)
+
+func mustParse(t *testing.T, input string) *ast.Schema {
+	t.Helper()
+	tokens, err := zedlexer.Lex(input)
+	if err != nil {
+		t.Fatalf("Lex() error: %v", err)
+	}
+	schema, err := parser.Parse(tokens)
+	if err != nil {
+		t.Fatalf("Parse() error: %v", err)
+	}
+	return schema
+}
+
+func mustDiagnostics(t *testing.T, input string) []Diagnostic {
+	t.Helper()
+	err := Validate(mustParse(t, input))
+	if err == nil {
+		t.Fatal("expected validation error")
+	}
+	var verr *Error
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected *Error, got %T", err)
+	}
+	return verr.Diagnostics
+}
+
+func TestValidateValidSchema(t *testing.T) {
+	schema := mustParse(t, `
+use expiration
+
+caveat ip_check(allowed list<string>, ip ipaddress) { ip in allowed }
+
+definition user {}
+
+definition group {
+	relation member: user | group#member
+}
+
+definition folder {
+	relation viewer: user | user:* | group#member with ip_check | user with expiration | group#member with ip_check and expiration
+	permission view = viewer
+}
+
+definition document {
+	relation parent: folder
+	relation owner: user
+	permission edit = owner
+	permission view = edit + parent->view
+	permission approve = parent.all(view) - nil
+	permission browse = parent.any(view)
+}`)
+
+	if err := Validate(schema); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestValidateReportsEveryProblemWithPosition(t *testing.T) {
+	diagnostics := mustDiagnostics(t, `definition user {}
+definition doc {
+	relation owner: usr
+	relation owner: user
+	permission view = viewer + owner
+	permission edit = owner - banned
+}`)
+
+	want := []struct {
+		line, column int
+		message      string
+	}{
+		{3, 18, `undefined type "usr"`},
+		{4, 11, `duplicate relation or permission "owner"`},
+		{5, 20, `undefined relation or permission "viewer"`},
+		{6, 28, `undefined relation or permission "banned"`},
+	}
+
+	if len(diagnostics) != len(want) {
+		t.Fatalf("got %d diagnostics, want %d: %v", len(diagnostics), len(want), diagnostics)
+	}
+	for i, w := range want {
+		d := diagnostics[i]
+		if d.Pos.Line != w.line || d.Pos.Column != w.column || !strings.Contains(d.Message, w.message) {
+			t.Errorf("diagnostic[%d] = %s, want line %d, column %d: ...%s...", i, d, w.line, w.column, w.message)
+		}
+	}
+}
+
+func TestValidateProblems(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"duplicate definition", "definition user {} definition user {}", `duplicate definition "user"`},
+		{"duplicate caveat", "caveat c(a int) { a > 0 } caveat c(a int) { a > 0 }", `duplicate caveat "c"`},
+		{"duplicate caveat parameter", "caveat c(a int, a int) { a > 0 }", `duplicate parameter "a"`},
+		{"unknown caveat type", "caveat c(a integer) { a > 0 }", `unknown caveat parameter type "integer"`},
+		{"caveat type arity", "caveat c(a list) { a > 0 }", `takes 1 type argument(s), got 0`},
+		{"duplicate subject type", "definition user {} definition doc { relation viewer: user | user }", `duplicate subject type "user"`},
+		{"duplicate expiring subject type", "use expiration definition user {} definition doc { relation viewer: user with expiration | user with expiration }", `duplicate subject type "user with expiration"`},
+		{"expiration without use flag", "definition user {} definition doc { relation viewer: user with expiration }", `requires "use expiration"`},
+		{"unknown use flag", "use teleportation definition user {}", `unknown use flag "teleportation"`},
+		{"undefined subject relation", "definition group {} definition doc { relation viewer: group#member }", "undefined relation or permission group#member"},
+		{"undefined caveat", "definition user {} definition doc { relation viewer: user with c }", `undefined caveat "c"`},
+		{"duplicate permission name", "definition user {} definition doc { relation view: user permission view = view }", `duplicate relation or permission "view"`},
+		{"arrow over undefined relation", "definition doc { permission view = parent->view }", `undefined relation "parent"`},
+		{"arrow over permission", "definition user {} definition doc { relation owner: user permission edit = owner permission view = edit->view }", "only relations are allowed"},
+		{"arrow over wildcard", "definition user { relation self: user } definition doc { relation viewer: user:* permission view = viewer->self }", "wildcard subject user:*"},
+		{"arrow target missing", "definition folder {} definition doc { relation parent: folder permission view = parent->view }", `arrows to "view"`},
+		{"functioned arrow over undefined relation", "definition doc { permission view = parent.any(view) }", `undefined relation "parent"`},
+		{"functioned arrow over wildcard", "definition user { relation self: user } definition doc { relation viewer: user:* permission view = viewer.all(self) }", "wildcard subject user:*"},
+		{"functioned arrow target missing", "definition folder {} definition doc { relation parent: folder permission view = parent.all(view) }", `arrows to "view"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diagnostics := mustDiagnostics(t, tt.input)
+			if !strings.Contains(diagnostics[0].Message, tt.want) {
+				t.Errorf("got %q, want it to contain %q", diagnostics[0].Message, tt.want)
+			}
+		})
+	}
+}
+
+func TestErrorMessage(t *testing.T) {
+	single := &Error{Diagnostics: []Diagnostic{{Pos: ast.Pos{Line: 2, Column: 4}, Message: "bad"}}}
+	if got := single.Error(); got != "validation error at line 2, column 4: bad" {
+		t.Errorf("single Error() = %q", got)
+	}
+
+	multiple := &Error{Diagnostics: []Diagnostic{
+		{Pos: ast.Pos{Line: 1, Column: 1}, Message: "first"},
+		{Pos: ast.Pos{Line: 3, Column: 2}, Message: "second"},
+	}}
+	want := "2 validation errors:\n  line 1, column 1: first\n  line 3, column 2: second"
+	if got := multiple.Error(); got != want {
+		t.Errorf("multiple Error() = %q, want %q", got, want)
+	}
+}
+
+func TestValidateDuplicateAcrossFiles(t *testing.T) {
+	schema := &ast.Schema{Definitions: []*ast.Definition{
+		{Name: "user", Pos: ast.Pos{File: "common.zed", Line: 1, Column: 12}},
+		{Name: "user", Pos: ast.Pos{File: "booking.zed", Line: 3, Column: 12}},
+	}}
+
+	err := Validate(schema)
+	want := `validation error at booking.zed:3:12: duplicate definition "user", first declared at common.zed:1:12`
+	if err == nil || err.Error() != want {
+		t.Errorf("Validate() error = %v, want %s", err, want)
+	}
+}
@@ -2,6 +2,7 @@ package zedlexer
 
 import (
 	"fmt"
+	"strings"
 	"unicode"
 )
 
@@ -23,15 +24,73 @@ const (
 	EQUAL
 	ARROW
 	WILDCARD
+	COMMA
+	LESS
+	GREATER
+	HASH
+	PERIOD
+	ELLIPSIS
 
 	IDENTIFIER
+	STRING
 	DEFINITION
 	RELATION
 	PERMISSION
 	CAVEAT
+	WITH
+	NIL
+	USE
+	IMPORT
+	PARTIAL
 	COMMENT
+
+	CAVEAT_EXPRESSION
 )
 
+var tokenTypeNames = map[TokenType]string{
+	ILLEGAL:           "ILLEGAL",
+	EOF:               "EOF",
+	LBRACE:            "'{'",
+	RBRACE:            "'}'",
+	LBRACKETS:         "'('",
+	RBRACKETS:         "')'",
+	COLON:             "':'",
+	OR:                "'|'",
+	AND:               "'&'",
+	PLUS:              "'+'",
+	MINUS:             "'-'",
+	EQUAL:             "'='",
+	ARROW:             "'->'",
+	WILDCARD:          "':*'",
+	COMMA:             "','",
+	LESS:              "'<'",
+	GREATER:           "'>'",
+	HASH:              "'#'",
+	PERIOD:            "'.'",
+	ELLIPSIS:          "'...'",
+	IDENTIFIER:        "IDENTIFIER",
+	STRING:            "STRING",
+	DEFINITION:        "'definition'",
+	RELATION:          "'relation'",
+	PERMISSION:        "'permission'",
+	CAVEAT:            "'caveat'",
+	WITH:              "'with'",
+	NIL:               "'nil'",
+	USE:               "'use'",
+	IMPORT:            "'import'",
+	PARTIAL:           "'partial'",
+	COMMENT:           "COMMENT",
+	CAVEAT_EXPRESSION: "CAVEAT_EXPRESSION",
+}
+
+// String returns the symbol or keyword of the token type, quoted, or its upper-case name.
+func (t TokenType) String() string {
+	if name, ok := tokenTypeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("TokenType(%d)", int(t))
+}
+
 type Token struct {
 	Type    TokenType
 	Literal string
@@ -47,25 +106,46 @@ const (
 	star       = 42 //   *
 )
 
+// Error reports every illegal token found by Lex, in input order.
+type Error struct {
+	Illegal []Token
+}
+
+func (e *Error) Error() string {
+	if len(e.Illegal) == 1 {
+		t := e.Illegal[0]
+		return fmt.Sprintf("illegal token %q at line %d, column %d", t.Literal, t.Line, t.Column)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d illegal tokens:", len(e.Illegal))
+	for _, t := range e.Illegal {
+		fmt.Fprintf(&b, "\n  line %d, column %d: %q", t.Line, t.Column, t.Literal)
+	}
+	return b.String()
+}
+
 type lexer struct {
 	InputCode string
 
 	pos    int // cursor throw InputCode
 	line   int // current line number
 	column int // current column number
+
+	caveatHeader bool // inside "caveat name(...)" before its opening brace
+	caveatBody   bool // next token is the raw caveat expression
 }
 
+// Lex splits inputCode into tokens. Comments are kept as COMMENT tokens holding the
+// comment text, so that the parser can attach them to the nodes they document.
 func Lex(inputCode string) ([]Token, error) {
 	lexer := lexer{InputCode: inputCode}
 	lexTokens := lexer.Lex()
 
-	if have, t := haveIllegal(lexTokens); have {
-		return lexTokens, fmt.Errorf("lexer found illigal tokens. line: %d, col: %d, literal: %s", t.Column, t.Line, t.Literal)
+	if illegal := illegalTokens(lexTokens); len(illegal) > 0 {
+		return lexTokens, &Error{Illegal: illegal}
 	}
 
-	lexTokens = filterComments(lexTokens)
-	lexTokens = filterCaveats(lexTokens)
-
 	return lexTokens, nil
 }
 
@@ -74,6 +154,8 @@ func (l *lexer) Lex() []Token {
 	l.line = 1
 	l.column = 1
 	l.pos = 0
+	l.caveatHeader = false
+	l.caveatBody = false
 
 	var tokens []Token
 
@@ -91,6 +173,11 @@ func (l *lexer) readToken() Token {
 		l.skip()
 	}
 
+	if l.caveatBody {
+		l.caveatBody = false
+		return l.readCaveatExpression()
+	}
+
 	char := l.peek()
 
 	// if skipped all, return as EOF
@@ -105,6 +192,10 @@ func (l *lexer) readToken() Token {
 		return l.handleSlash(line, column)
 	case '{':
 		l.skip()
+		if l.caveatHeader {
+			l.caveatHeader = false
+			l.caveatBody = true
+		}
 		return Token{LBRACE, "{", line, column}
 	case '}':
 		l.skip()
@@ -129,6 +220,27 @@ func (l *lexer) readToken() Token {
 	case '=':
 		l.skip()
 		return Token{EQUAL, "=", line, column}
+	case ',':
+		l.skip()
+		return Token{COMMA, ",", line, column}
+	case '#':
+		l.skip()
+		return Token{HASH, "#", line, column}
+	case '.':
+		if strings.HasPrefix(l.InputCode[l.pos:], "...") {
+			l.skipComplicatedSymbol("...")
+			return Token{ELLIPSIS, "...", line, column}
+		}
+		l.skip()
+		return Token{PERIOD, ".", line, column}
+	case '"':
+		return l.readString(line, column)
+	case '<':
+		l.skip()
+		return Token{LESS, "<", line, column}
+	case '>':
+		l.skip()
+		return Token{GREATER, ">", line, column}
 	case '-':
 		return l.handleMinus(char, line, column)
 	default:
@@ -226,14 +338,15 @@ func (l *lexer) haveNextN(n int) bool {
 
 // handleSlash handles slash characters for comments
 func (l *lexer) handleSlash(line, column int) Token {
+	start := l.pos
 	if l.peekForward() == slash {
 		l.skipLineComment()
-		return Token{COMMENT, "//", line, column}
+		return Token{COMMENT, strings.TrimRight(l.InputCode[start:l.pos], " \t\r"), line, column}
 	} else if l.peekForward() == star {
 		if !l.skipComplexComment() {
 			return Token{ILLEGAL, "unterminated block comment", line, column}
 		}
-		return Token{COMMENT, "/*", line, column}
+		return Token{COMMENT, l.InputCode[start:l.pos], line, column}
 	} else {
 		l.skip()
 		return Token{ILLEGAL, "/", line, column}
@@ -271,12 +384,23 @@ func (l *lexer) handleDefault(char rune, line, column int) Token {
 		switch literal {
 		case "caveat":
 			tokenType = CAVEAT
+			l.caveatHeader = true
+		case "with":
+			tokenType = WITH
 		case "definition":
 			tokenType = DEFINITION
 		case "relation":
 			tokenType = RELATION
 		case "permission":
 			tokenType = PERMISSION
+		case "nil":
+			tokenType = NIL
+		case "use":
+			tokenType = USE
+		case "import":
+			tokenType = IMPORT
+		case "partial":
+			tokenType = PARTIAL
 		}
 
 		return Token{tokenType, literal, line, column}
@@ -285,3 +409,78 @@ func (l *lexer) handleDefault(char rune, line, column int) Token {
 		return Token{ILLEGAL, string(char), line, column}
 	}
 }
+
+// readString reads a double-quoted string, such as an import path. The literal is the
+// unquoted text, with backslash escapes resolved.
+func (l *lexer) readString(line, column int) Token {
+	l.skip() // skip opening quote
+
+	var b strings.Builder
+	for !l.isEndOfLine(l.peek()) {
+		switch l.peek() {
+		case '"':
+			l.skip()
+			return Token{STRING, b.String(), line, column}
+		case '\\':
+			l.skip()
+			if l.isEndOfLine(l.peek()) {
+				continue
+			}
+		}
+		b.WriteByte(l.InputCode[l.pos])
+		l.skip()
+	}
+
+	return Token{ILLEGAL, "unterminated string literal", line, column}
+}
+
+// readCaveatExpression reads the raw CEL expression of a caveat body up to, but not including,
+// the closing brace that matches the caveat's opening brace. Braces inside string literals are ignored.
+func (l *lexer) readCaveatExpression() Token {
+	line, column := l.line, l.column
+	start := l.pos
+	end := l.pos
+	depth := 0
+
+	for l.peek() != endChar {
+		switch char := l.peek(); char {
+		case '{':
+			depth++
+		case '}':
+			if depth == 0 {
+				return Token{CAVEAT_EXPRESSION, l.InputCode[start:end], line, column}
+			}
+			depth--
+		case '"', '\'':
+			if !l.skipStringLiteral(char) {
+				return Token{ILLEGAL, "unterminated string literal in caveat expression", line, column}
+			}
+			end = l.pos
+			continue
+		}
+
+		l.skip()
+		if !unicode.IsSpace(rune(l.InputCode[l.pos-1])) {
+			end = l.pos
+		}
+	}
+
+	return Token{ILLEGAL, "unterminated caveat expression", line, column}
+}
+
+// skipStringLiteral moves the cursor past a quoted string literal, honoring backslash escapes.
+func (l *lexer) skipStringLiteral(quote rune) bool {
+	l.skip() // skip opening quote
+	for l.peek() != endChar {
+		switch l.peek() {
+		case '\\':
+			l.skip()
+		case quote:
+			l.skip()
+			return true
+		}
+		l.skip()
+	}
+
+	return false
+}
@@ -1,6 +1,7 @@
 package zedlexer
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -39,6 +40,14 @@ func TestLex(t *testing.T) {
 				{PERMISSION, "permission", 1, 21},
 			},
 		},
+		{
+			name:  "use directive",
+			input: "use expiration",
+			want: []Token{
+				{USE, "use", 1, 1},
+				{IDENTIFIER, "expiration", 1, 5},
+			},
+		},
 		{
 			name:  "caveat keyword",
 			input: "caveat",
@@ -65,16 +74,18 @@ func TestLex(t *testing.T) {
 			},
 		},
 		{
-			name:  "line comment filtered",
-			input: "// comment\nidentifier",
+			name:  "line comment kept",
+			input: "// comment  \nidentifier",
 			want: []Token{
+				{COMMENT, "// comment", 1, 1},
 				{IDENTIFIER, "identifier", 2, 1},
 			},
 		},
 		{
-			name:  "block comment filtered",
+			name:  "block comment kept",
 			input: "/* block comment */\nidentifier",
 			want: []Token{
+				{COMMENT, "/* block comment */", 1, 1},
 				{IDENTIFIER, "identifier", 2, 1},
 			},
 		},
@@ -83,6 +94,7 @@ func TestLex(t *testing.T) {
 			input: "definition /* inline */ user",
 			want: []Token{
 				{DEFINITION, "definition", 1, 1},
+				{COMMENT, "/* inline */", 1, 12},
 				{IDENTIFIER, "user", 1, 25},
 			},
 		},
@@ -141,13 +153,69 @@ func TestLex(t *testing.T) {
 	}
 }
 
+func TestLexSubjectRelation(t *testing.T) {
+	got, err := Lex("relation viewer: user | group#member")
+	if err != nil {
+		t.Fatalf("Lex() error: %v", err)
+	}
+
+	want := []Token{
+		{RELATION, "relation", 1, 1},
+		{IDENTIFIER, "viewer", 1, 10},
+		{COLON, ":", 1, 16},
+		{IDENTIFIER, "user", 1, 18},
+		{OR, "|", 1, 23},
+		{IDENTIFIER, "group", 1, 25},
+		{HASH, "#", 1, 30},
+		{IDENTIFIER, "member", 1, 31},
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("Lex() returned %d tokens, want %d\ngot:  %v", len(got), len(want), got)
+	}
+	for i, token := range got {
+		if token != want[i] {
+			t.Errorf("token[%d] = %+v, want %+v", i, token, want[i])
+		}
+	}
+}
+
+func TestLexArrowFunctionAndNil(t *testing.T) {
+	got, err := Lex("permission p = parent.all(member) + nil")
+	if err != nil {
+		t.Fatalf("Lex() error: %v", err)
+	}
+
+	want := []Token{
+		{PERMISSION, "permission", 1, 1},
+		{IDENTIFIER, "p", 1, 12},
+		{EQUAL, "=", 1, 14},
+		{IDENTIFIER, "parent", 1, 16},
+		{PERIOD, ".", 1, 22},
+		{IDENTIFIER, "all", 1, 23},
+		{LBRACKETS, "(", 1, 26},
+		{IDENTIFIER, "member", 1, 27},
+		{RBRACKETS, ")", 1, 33},
+		{PLUS, "+", 1, 35},
+		{NIL, "nil", 1, 37},
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("Lex() returned %d tokens, want %d\ngot:  %v", len(got), len(want), got)
+	}
+	for i, token := range got {
+		if token != want[i] {
+			t.Errorf("token[%d] = %+v, want %+v", i, token, want[i])
+		}
+	}
+}
+
 func TestLexIllegalTokenReturnsError(t *testing.T) {
 	tests := []struct {
 		name  string
 		input string
 	}{
 		{"at sign", "@"},
-		{"hash", "#"},
 		{"exclamation", "!"},
 		{"bare slash", "/"},
 		{"illegal in context", "definition user { @ }"},
@@ -190,75 +258,132 @@ func TestLexLineColumnTracking(t *testing.T) {
 	}
 }
 
-func TestFilterComments(t *testing.T) {
-	tokens := []Token{
-		{DEFINITION, "definition", 1, 1},
-		{COMMENT, "//", 1, 12},
-		{IDENTIFIER, "user", 2, 1},
-		{COMMENT, "/*", 2, 6},
+func TestLexCaveat(t *testing.T) {
+	input := "caveat ip_check(allowed list<string>, ip string) {\n  ip in allowed && {\"k\": \"}\"}.k != \"\"\n}"
+	got, err := Lex(input)
+	if err != nil {
+		t.Fatalf("Lex() error: %v", err)
 	}
 
-	got := filterComments(tokens)
-
-	if len(got) != 2 {
-		t.Fatalf("filterComments returned %d tokens, want 2", len(got))
+	want := []Token{
+		{CAVEAT, "caveat", 1, 1},
+		{IDENTIFIER, "ip_check", 1, 8},
+		{LBRACKETS, "(", 1, 16},
+		{IDENTIFIER, "allowed", 1, 17},
+		{IDENTIFIER, "list", 1, 25},
+		{LESS, "<", 1, 29},
+		{IDENTIFIER, "string", 1, 30},
+		{GREATER, ">", 1, 36},
+		{COMMA, ",", 1, 37},
+		{IDENTIFIER, "ip", 1, 39},
+		{IDENTIFIER, "string", 1, 42},
+		{RBRACKETS, ")", 1, 48},
+		{LBRACE, "{", 1, 50},
+		{CAVEAT_EXPRESSION, `ip in allowed && {"k": "}"}.k != ""`, 2, 3},
+		{RBRACE, "}", 3, 1},
 	}
-	if got[0].Type != DEFINITION {
-		t.Errorf("token[0].Type = %v, want DEFINITION", got[0].Type)
+
+	if len(got) != len(want) {
+		t.Fatalf("Lex() returned %d tokens, want %d\ngot:  %v", len(got), len(want), got)
 	}
-	if got[1].Type != IDENTIFIER {
-		t.Errorf("token[1].Type = %v, want IDENTIFIER", got[1].Type)
+	for i, token := range got {
+		if token != want[i] {
+			t.Errorf("token[%d] = %+v, want %+v", i, token, want[i])
+		}
 	}
 }
 
-func TestFilterCaveats(t *testing.T) {
-	tokens := []Token{
-		{DEFINITION, "definition", 1, 1},
-		{CAVEAT, "caveat", 2, 1},
+func TestLexCaveatReference(t *testing.T) {
+	got, err := Lex("relation viewer: user with ip_check")
+	if err != nil {
+		t.Fatalf("Lex() error: %v", err)
 	}
 
-	got := filterCaveats(tokens)
+	if len(got) != 6 {
+		t.Fatalf("got %d tokens, want 6\ntokens: %v", len(got), got)
+	}
+	if got[4].Type != WITH {
+		t.Errorf("token[4].Type = %v, want WITH", got[4].Type)
+	}
+	if got[5].Type != IDENTIFIER || got[5].Literal != "ip_check" {
+		t.Errorf("token[5] = %+v, want IDENTIFIER 'ip_check'", got[5])
+	}
+}
 
-	// Current implementation is a passthrough (TODO)
-	if len(got) != len(tokens) {
-		t.Errorf("filterCaveats returned %d tokens, want %d", len(got), len(tokens))
+func TestLexCaveatUnterminated(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"missing closing brace", "caveat c(a int) { a == 1"},
+		{"unterminated string", "caveat c(a string) { a == 'x }"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Lex(tt.input); err == nil {
+				t.Error("expected error for unterminated caveat, got nil")
+			}
+		})
 	}
 }
 
-func TestHaveIllegal(t *testing.T) {
+func TestIllegalTokens(t *testing.T) {
 	t.Run("no illegal tokens", func(t *testing.T) {
 		tokens := []Token{
 			{DEFINITION, "definition", 1, 1},
 			{IDENTIFIER, "user", 1, 12},
 		}
-		have, _ := haveIllegal(tokens)
-		if have {
-			t.Error("expected no illegal tokens")
+		if illegal := illegalTokens(tokens); len(illegal) != 0 {
+			t.Errorf("expected no illegal tokens, got %v", illegal)
 		}
 	})
 
-	t.Run("has illegal token", func(t *testing.T) {
+	t.Run("has illegal tokens", func(t *testing.T) {
 		tokens := []Token{
 			{DEFINITION, "definition", 1, 1},
 			{ILLEGAL, "@", 1, 12},
+			{ILLEGAL, "$", 2, 3},
 		}
-		have, tok := haveIllegal(tokens)
-		if !have {
-			t.Error("expected illegal token to be found")
+		illegal := illegalTokens(tokens)
+		if len(illegal) != 2 {
+			t.Fatalf("expected 2 illegal tokens, got %v", illegal)
 		}
-		if tok.Literal != "@" {
-			t.Errorf("expected illegal literal '@', got %q", tok.Literal)
+		if illegal[0].Literal != "@" || illegal[1].Literal != "$" {
+			t.Errorf("expected illegal literals '@' and '$', got %v", illegal)
 		}
 	})
 
 	t.Run("empty tokens", func(t *testing.T) {
-		have, _ := haveIllegal(nil)
-		if have {
+		if illegal := illegalTokens(nil); len(illegal) != 0 {
 			t.Error("expected no illegal tokens for nil input")
 		}
 	})
 }
 
+func TestLexError(t *testing.T) {
+	_, err := Lex("definition user {\n  @ relation owner: user $\n}")
+	lexErr, ok := err.(*Error)
+	if !ok {
+		t.Fatalf("expected *Error, got %T (%v)", err, err)
+	}
+	want := []Token{
+		{ILLEGAL, "@", 2, 3},
+		{ILLEGAL, "$", 2, 26},
+	}
+	if len(lexErr.Illegal) != len(want) {
+		t.Fatalf("got %d illegal tokens, want %d: %v", len(lexErr.Illegal), len(want), lexErr.Illegal)
+	}
+	for i := range want {
+		if lexErr.Illegal[i] != want[i] {
+			t.Errorf("illegal token %d = %+v, want %+v", i, lexErr.Illegal[i], want[i])
+		}
+	}
+	if got := (&Error{Illegal: want[:1]}).Error(); got != `illegal token "@" at line 2, column 3` {
+		t.Errorf("Error() = %q", got)
+	}
+}
+
 func TestLexBlockCommentMultiline(t *testing.T) {
 	input := "definition /* multi\nline\ncomment */ user"
 	got, err := Lex(input)
@@ -266,14 +391,17 @@ func TestLexBlockCommentMultiline(t *testing.T) {
 		t.Fatalf("Lex() error: %v", err)
 	}
 
-	if len(got) != 2 {
-		t.Fatalf("got %d tokens, want 2\ntokens: %v", len(got), got)
+	if len(got) != 3 {
+		t.Fatalf("got %d tokens, want 3\ntokens: %v", len(got), got)
 	}
 	if got[0].Type != DEFINITION {
 		t.Errorf("token[0].Type = %v, want DEFINITION", got[0].Type)
 	}
-	if got[1].Type != IDENTIFIER || got[1].Literal != "user" {
-		t.Errorf("token[1] = %+v, want IDENTIFIER 'user'", got[1])
+	if got[1].Type != COMMENT || got[1].Literal != "/* multi\nline\ncomment */" {
+		t.Errorf("token[1] = %+v, want the whole block COMMENT", got[1])
+	}
+	if got[2].Type != IDENTIFIER || got[2].Literal != "user" || got[2].Line != 3 {
+		t.Errorf("token[2] = %+v, want IDENTIFIER 'user' on line 3", got[2])
 	}
 }
 
@@ -283,3 +411,59 @@ func TestLexBlockCommentAtEndOfInput(t *testing.T) {
 		t.Fatal("expected error for unterminated block comment")
 	}
 }
+
+func TestTokenTypeString(t *testing.T) {
+	tests := map[TokenType]string{
+		COLON:         "':'",
+		DEFINITION:    "'definition'",
+		IDENTIFIER:    "IDENTIFIER",
+		TokenType(99): "TokenType(99)",
+	}
+	for tokenType, want := range tests {
+		if got := tokenType.String(); got != want {
+			t.Errorf("TokenType(%d).String() = %q, want %q", int(tokenType), got, want)
+		}
+	}
+}
+
+func TestLexImportAndPartial(t *testing.T) {
+	got, err := Lex(`import "./common \"v2\".zed"
+partial viewable {}
+definition doc { ...viewable }`)
+	if err != nil {
+		t.Fatalf("Lex() error: %v", err)
+	}
+
+	want := []Token{
+		{IMPORT, "import", 1, 1},
+		{STRING, `./common "v2".zed`, 1, 8},
+		{PARTIAL, "partial", 2, 1},
+		{IDENTIFIER, "viewable", 2, 9},
+		{LBRACE, "{", 2, 18},
+		{RBRACE, "}", 2, 19},
+		{DEFINITION, "definition", 3, 1},
+		{IDENTIFIER, "doc", 3, 12},
+		{LBRACE, "{", 3, 16},
+		{ELLIPSIS, "...", 3, 18},
+		{IDENTIFIER, "viewable", 3, 21},
+		{RBRACE, "}", 3, 30},
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("Lex() returned %d tokens, want %d\ngot:  %v", len(got), len(want), got)
+	}
+	for i, token := range got {
+		if token != want[i] {
+			t.Errorf("token[%d] = %+v, want %+v", i, token, want[i])
+		}
+	}
+}
+
+func TestLexUnterminatedString(t *testing.T) {
+	for _, input := range []string{`import "common.zed`, "import \"common.zed\nuse expiration", `import "common.zed\`} {
+		_, err := Lex(input)
+		if err == nil || !strings.Contains(err.Error(), "unterminated string literal") {
+			t.Errorf("Lex(%q) error = %v, want an unterminated string literal", input, err)
+		}
+	}
+}
@@ -1,27 +1,11 @@
 package zedlexer
 
-func filterComments(inputTokens []Token) (outputTokens []Token) {
-	for _, t := range inputTokens {
-		if t.Type == COMMENT {
-			continue
-		}
-		outputTokens = append(outputTokens, t)
-	}
-
-	return
-}
-
-func filterCaveats(inputTokens []Token) []Token {
-	// TODO: add filter to delete Caveat Definitions from tokens set (internal)
-	return inputTokens
-}
-
-func haveIllegal(inputTokens []Token) (bool, Token) {
+func illegalTokens(inputTokens []Token) (illegal []Token) {
 	for _, t := range inputTokens {
 		if t.Type == ILLEGAL {
-			return true, t
+			illegal = append(illegal, t)
 		}
 	}
 
-	return false, Token{}
+	return
 }
@@ -1,6 +1,10 @@
 package authz
 
-import "context"
+import (
+	"context"
+	"iter"
+	"time"
+)
 
 // Type represents a SpiceDB object type name.
 type Type string
@@ -14,6 +18,18 @@ type Permission string
 // Relation represents a relation name in SpiceDB.
 type Relation string
 
+// CaveatName represents a caveat name in SpiceDB.
+type CaveatName string
+
+// Caveat binds a named caveat and its (possibly partial) context to a relationship.
+type Caveat struct {
+	Name    CaveatName
+	Context map[string]any
+}
+
+// Cursor is an opaque position in a paginated read. The empty cursor starts at the beginning.
+type Cursor string
+
 // Resource identifies a specific object in SpiceDB.
 type Resource struct {
 	Type Type
@@ -22,43 +38,148 @@ type Resource struct {
 
 // PermissionCheck represents a single permission check in a bulk operation.
 type PermissionCheck struct {
-	Resource    Resource
-	Permission  Permission
-	SubjectType Type
-	SubjectID   ID
+	Resource      Resource
+	Permission    Permission
+	SubjectType   Type
+	SubjectID     ID
+	CaveatContext map[string]any
+}
+
+// MaxBulkCheckItems is the number of checks generated code sends in one bulk request. It
+// matches SpiceDB's default limit on the items of a bulk check.
+const MaxBulkCheckItems = 1000
+
+// Permissionship is the outcome of a permission check.
+type Permissionship int
+
+const (
+	// PermissionshipDenied means the subject does not have the permission.
+	PermissionshipDenied Permissionship = iota
+	// PermissionshipAllowed means the subject has the permission.
+	PermissionshipAllowed
+	// PermissionshipConditional means the answer depends on caveat context that was not supplied.
+	PermissionshipConditional
+)
+
+// String returns a lower-case name for the permissionship.
+func (p Permissionship) String() string {
+	switch p {
+	case PermissionshipAllowed:
+		return "allowed"
+	case PermissionshipConditional:
+		return "conditional"
+	default:
+		return "denied"
+	}
 }
 
-// RelationshipObject represents a relationship for bulk import/export operations.
+// CheckResult is the three-state result of a permission check. When the result is
+// conditional, MissingFields lists the caveat context fields needed to decide it.
+type CheckResult struct {
+	Permissionship Permissionship
+	MissingFields  []string
+}
+
+// Allowed reports whether the permission was granted.
+func (r CheckResult) Allowed() bool { return r.Permissionship == PermissionshipAllowed }
+
+// Denied reports whether the permission was refused.
+func (r CheckResult) Denied() bool { return r.Permissionship == PermissionshipDenied }
+
+// Conditional reports whether the result depends on missing caveat context.
+func (r CheckResult) Conditional() bool { return r.Permissionship == PermissionshipConditional }
+
+// BulkCheckResult is the outcome of one PermissionCheck in a bulk check. When the check
+// itself failed, Err is set and the CheckResult is the zero value, which is not allowed.
+type BulkCheckResult struct {
+	CheckResult
+	Err error
+}
+
+// RelationshipObject represents a relationship with its caveat and expiry, as read from
+// SpiceDB or written in bulk.
 type RelationshipObject struct {
-	Resource    Resource
-	Relation    Relation
-	SubjectType Type
-	SubjectID   ID
+	Resource        Resource
+	Relation        Relation
+	SubjectType     Type
+	SubjectID       ID
+	SubjectRelation Relation // empty for direct subjects, e.g. "member" for group:eng#member
+	Caveat          *Caveat
+	ExpiresAt       time.Time // zero for relationships that do not expire
 }
 
-// RelationshipFilter specifies criteria for exporting relationships.
+// RelationshipFilter specifies criteria for exporting relationships and for write
+// preconditions. Empty fields match anything. SubjectID and SubjectRelation are only
+// honored together with SubjectType.
 type RelationshipFilter struct {
-	ResourceType string
-	ResourceID   string
-	Relation     string
-	SubjectType  string
+	ResourceType    string
+	ResourceID      string
+	Relation        string
+	SubjectType     string
+	SubjectID       string
+	SubjectRelation string
+}
+
+// DeleteOptions bounds a filter-based delete (see Engine.DeleteRelationships).
+type DeleteOptions struct {
+	// Limit caps the number of relationships one call deletes. Zero deletes every matching
+	// relationship, in several writes if the engine cannot delete them all at once.
+	Limit uint32
+	// AllowPartial makes a call that matches more than Limit relationships delete Limit of
+	// them and report Complete as false, instead of failing without deleting anything.
+	AllowPartial bool
+}
+
+// DeleteResult is the outcome of a filter-based delete.
+type DeleteResult struct {
+	Token    ZedToken // revision of the last write
+	Deleted  uint64   // number of relationships deleted
+	Complete bool     // false if a partial delete left matching relationships behind
 }
 
 // Engine defines the interface for SpiceDB authorization operations.
 // Generated code calls these methods via constructor-injected instances.
+// Reads and checks honor the Consistency carried by ctx (see WithConsistency).
 type Engine interface {
-	// Core relation operations
-	CreateRelations(ctx context.Context, resource Resource, relation Relation, subjectType Type, subjectIDs []ID) error
-	ReadRelations(ctx context.Context, resource Resource, relation Relation, subjectType Type) ([]ID, error)
-	DeleteRelations(ctx context.Context, resource Resource, relation Relation, subjectType Type, subjectIDs []ID) error
+	// Core relation operations. subjectRelation selects subject sets such as group#member;
+	// an empty subjectRelation refers to the subjects themselves. A non-zero expiresAt writes
+	// relationships that expire at that time. CreateRelations fails if a relationship already
+	// exists; TouchRelations overwrites its caveat and expiry instead, so retrying it is safe.
+	// Writes return the ZedToken of the revision they were applied at, and fail with a
+	// *PreconditionFailedError without writing anything if one of their preconditions does
+	// not hold. Reads return each relationship with its caveat and expiry.
+	CreateRelations(ctx context.Context, resource Resource, relation Relation, subjectType Type, subjectRelation Relation, subjectIDs []ID, caveat *Caveat, expiresAt time.Time, preconditions ...Precondition) (ZedToken, error)
+	TouchRelations(ctx context.Context, resource Resource, relation Relation, subjectType Type, subjectRelation Relation, subjectIDs []ID, caveat *Caveat, expiresAt time.Time, preconditions ...Precondition) (ZedToken, error)
+	ReadRelations(ctx context.Context, resource Resource, relation Relation, subjectType Type, subjectRelation Relation) ([]RelationshipObject, error)
+	DeleteRelations(ctx context.Context, resource Resource, relation Relation, subjectType Type, subjectRelation Relation, subjectIDs []ID, preconditions ...Precondition) (ZedToken, error)
+
+	// DeleteRelationships deletes every relationship matching filter, which must set
+	// ResourceType. Preconditions are checked before the first write.
+	DeleteRelationships(ctx context.Context, filter RelationshipFilter, opts DeleteOptions, preconditions ...Precondition) (DeleteResult, error)
+
+	// WriteRelationships applies all updates atomically in one write (see WriteBatch).
+	// A relationship may appear at most once per write.
+	WriteRelationships(ctx context.Context, updates []RelationshipUpdate, preconditions ...Precondition) (ZedToken, error)
 
 	// Core permission operations
-	CheckPermission(ctx context.Context, resource Resource, permission Permission, subjectType Type, subjectID ID) (bool, error)
+	CheckPermission(ctx context.Context, resource Resource, permission Permission, subjectType Type, subjectID ID, caveatContext map[string]any) (CheckResult, error)
 	LookupResources(ctx context.Context, resourceType Type, permission Permission, subjectType Type, subjectID ID) ([]ID, error)
 	LookupSubjects(ctx context.Context, resource Resource, permission Permission, subjectType Type) ([]ID, error)
 
-	// Bulk operations
-	CheckBulkPermission(ctx context.Context, checks []PermissionCheck) ([]bool, error)
+	// Streaming and paginated reads, for results too large to hold in memory. Streams yield
+	// results as they arrive and end after yielding the first error. Pages return at most
+	// limit results (all of them for a zero limit) and the cursor to pass for the next page;
+	// an empty cursor means there are no more results.
+	LookupResourcesSeq(ctx context.Context, resourceType Type, permission Permission, subjectType Type, subjectID ID) iter.Seq2[ID, error]
+	LookupResourcesPage(ctx context.Context, resourceType Type, permission Permission, subjectType Type, subjectID ID, limit uint32, cursor Cursor) ([]ID, Cursor, error)
+	LookupSubjectsSeq(ctx context.Context, resource Resource, permission Permission, subjectType Type) iter.Seq2[ID, error]
+	ReadRelationsSeq(ctx context.Context, resource Resource, relation Relation, subjectType Type, subjectRelation Relation) iter.Seq2[RelationshipObject, error]
+	ReadRelationsPage(ctx context.Context, resource Resource, relation Relation, subjectType Type, subjectRelation Relation, limit uint32, cursor Cursor) ([]RelationshipObject, Cursor, error)
+	ExportBulkRelationshipsSeq(ctx context.Context, filter RelationshipFilter) iter.Seq2[RelationshipObject, error]
+
+	// Bulk operations. CheckBulkPermission returns one result per check, in order; its error
+	// is reserved for failures of the whole request.
+	CheckBulkPermission(ctx context.Context, checks []PermissionCheck) ([]BulkCheckResult, error)
 	ExportBulkRelationships(ctx context.Context, filter RelationshipFilter) ([]RelationshipObject, error)
 	ImportBulkRelationships(ctx context.Context, relationships []RelationshipObject) error
 }
@@ -0,0 +1,78 @@
+package authz
+
+import "fmt"
+
+// WriteOperation is the kind of change a RelationshipUpdate makes.
+type WriteOperation int
+
+const (
+	// WriteCreate creates a relationship and fails if it already exists.
+	WriteCreate WriteOperation = iota
+	// WriteTouch creates a relationship or overwrites its caveat and expiry if it exists.
+	WriteTouch
+	// WriteDelete deletes a relationship if it exists.
+	WriteDelete
+)
+
+// String returns a lower-case name for the operation.
+func (o WriteOperation) String() string {
+	switch o {
+	case WriteCreate:
+		return "create"
+	case WriteTouch:
+		return "touch"
+	case WriteDelete:
+		return "delete"
+	default:
+		return fmt.Sprintf("WriteOperation(%d)", int(o))
+	}
+}
+
+// RelationshipUpdate is one change in an atomic write.
+type RelationshipUpdate struct {
+	Operation    WriteOperation
+	Relationship RelationshipObject
+}
+
+// WriteBatch collects relationship updates that are committed together with
+// Engine.WriteRelationships, so that either all of them apply or none do.
+// The zero value is an empty batch ready to use.
+type WriteBatch struct {
+	updates       []RelationshipUpdate
+	preconditions []Precondition
+}
+
+// Create adds the creation of rel to the batch.
+func (b *WriteBatch) Create(rel RelationshipObject) {
+	b.updates = append(b.updates, RelationshipUpdate{Operation: WriteCreate, Relationship: rel})
+}
+
+// Touch adds the creation or overwrite of rel to the batch.
+func (b *WriteBatch) Touch(rel RelationshipObject) {
+	b.updates = append(b.updates, RelationshipUpdate{Operation: WriteTouch, Relationship: rel})
+}
+
+// Delete adds the deletion of rel to the batch. Its caveat and expiry are ignored.
+func (b *WriteBatch) Delete(rel RelationshipObject) {
+	b.updates = append(b.updates, RelationshipUpdate{Operation: WriteDelete, Relationship: rel})
+}
+
+// Require adds preconditions that must hold for the batch to be written.
+func (b *WriteBatch) Require(preconditions ...Precondition) {
+	b.preconditions = append(b.preconditions, preconditions...)
+}
+
+// Updates returns the collected updates in the order they were added.
+func (b *WriteBatch) Updates() []RelationshipUpdate {
+	return b.updates
+}
+
+// Len returns the number of collected updates.
+func (b *WriteBatch) Len() int {
+	return len(b.updates)
+}
+
+// Preconditions returns the collected preconditions.
+func (b *WriteBatch) Preconditions() []Precondition {
+	return b.preconditions
+}
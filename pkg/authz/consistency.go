@@ -0,0 +1,64 @@
+package authz
+
+import "context"
+
+// ZedToken is an opaque SpiceDB revision token returned by writes. Store it next to the
+// resource and pass it back with AtLeastAsFresh to avoid the "new enemy" problem.
+type ZedToken string
+
+// ConsistencyMode selects how fresh the data used by a read or check must be.
+type ConsistencyMode int
+
+const (
+	// ConsistencyDefault defers to the engine's configured consistency.
+	ConsistencyDefault ConsistencyMode = iota
+	// ConsistencyMinimizeLatency uses whatever data is fastest to read.
+	ConsistencyMinimizeLatency
+	// ConsistencyAtLeastAsFresh uses data at least as fresh as the given ZedToken.
+	ConsistencyAtLeastAsFresh
+	// ConsistencyAtExactSnapshot uses data exactly at the given ZedToken.
+	ConsistencyAtExactSnapshot
+	// ConsistencyFullyConsistent uses the most recent data. It is the slowest mode.
+	ConsistencyFullyConsistent
+)
+
+// Consistency describes the consistency requirement of a read or check.
+// The zero value defers to the engine's configured consistency.
+type Consistency struct {
+	Mode  ConsistencyMode
+	Token ZedToken // required for AtLeastAsFresh and AtExactSnapshot
+}
+
+// MinimizeLatency returns a Consistency that favors speed over freshness.
+func MinimizeLatency() Consistency {
+	return Consistency{Mode: ConsistencyMinimizeLatency}
+}
+
+// AtLeastAsFresh returns a Consistency that sees at least the writes up to token.
+func AtLeastAsFresh(token ZedToken) Consistency {
+	return Consistency{Mode: ConsistencyAtLeastAsFresh, Token: token}
+}
+
+// AtExactSnapshot returns a Consistency that reads the snapshot identified by token.
+func AtExactSnapshot(token ZedToken) Consistency {
+	return Consistency{Mode: ConsistencyAtExactSnapshot, Token: token}
+}
+
+// FullyConsistent returns a Consistency that always reads the latest data.
+func FullyConsistent() Consistency {
+	return Consistency{Mode: ConsistencyFullyConsistent}
+}
+
+type consistencyKey struct{}
+
+// WithConsistency returns a context that carries c. Engines use it for every read and
+// check made with that context, in preference to their configured default.
+func WithConsistency(ctx context.Context, c Consistency) context.Context {
+	return context.WithValue(ctx, consistencyKey{}, c)
+}
+
+// ConsistencyFromContext returns the consistency set by WithConsistency, if any.
+func ConsistencyFromContext(ctx context.Context) (Consistency, bool) {
+	c, ok := ctx.Value(consistencyKey{}).(Consistency)
+	return c, ok
+}
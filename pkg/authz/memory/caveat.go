@@ -0,0 +1,217 @@
+package memory
+
+import (
+	"fmt"
+	"net/netip"
+	"sort"
+	"time"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/oitnes/authzed-codegen/internal/generator/ast"
+	"github.com/oitnes/authzed-codegen/pkg/authz"
+)
+
+// caveat is a compiled caveat expression.
+type caveat struct {
+	name       string
+	parameters map[string]*ast.CaveatParameterType
+	program    cel.Program
+}
+
+// compileCaveat type-checks a caveat expression against its declared parameters.
+func compileCaveat(c *ast.Caveat) (*caveat, error) {
+	opts := []cel.EnvOption{
+		cel.Function("in_cidr",
+			cel.MemberOverload("ipaddress_in_cidr_string",
+				[]*cel.Type{cel.StringType, cel.StringType}, cel.BoolType,
+				cel.BinaryBinding(inCIDR),
+			),
+		),
+	}
+
+	parameters := make(map[string]*ast.CaveatParameterType, len(c.Parameters))
+	for _, param := range c.Parameters {
+		celType, err := celTypeOf(param.Type)
+		if err != nil {
+			return nil, fmt.Errorf("caveat %s: parameter %s: %w", c.Name, param.Name, err)
+		}
+		parameters[param.Name] = param.Type
+		opts = append(opts, cel.Variable(param.Name, celType))
+	}
+
+	env, err := cel.NewEnv(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("caveat %s: %w", c.Name, err)
+	}
+
+	checked, issues := env.Compile(c.Expression)
+	if issues.Err() != nil {
+		return nil, fmt.Errorf("caveat %s: %w", c.Name, issues.Err())
+	}
+	if !checked.OutputType().IsExactType(cel.BoolType) {
+		return nil, fmt.Errorf("caveat %s: expression must be bool, got %s", c.Name, checked.OutputType())
+	}
+
+	program, err := env.Program(checked, cel.EvalOptions(cel.OptPartialEval))
+	if err != nil {
+		return nil, fmt.Errorf("caveat %s: %w", c.Name, err)
+	}
+
+	return &caveat{name: c.Name, parameters: parameters, program: program}, nil
+}
+
+// evaluate runs the caveat with the relationship's stored context merged over the
+// check-time context, as SpiceDB does. Parameters absent from both are treated as
+// unknown: if the expression cannot be decided without them the result is conditional.
+func (c *caveat) evaluate(relationshipContext, checkContext map[string]any) (authz.CheckResult, error) {
+	vars := make(map[string]any, len(c.parameters))
+	for _, source := range []map[string]any{checkContext, relationshipContext} {
+		for name, value := range source {
+			paramType, ok := c.parameters[name]
+			if !ok {
+				continue
+			}
+			converted, err := celValueOf(paramType, value)
+			if err != nil {
+				return authz.CheckResult{}, fmt.Errorf("caveat %s: context field %q: %w", c.name, name, err)
+			}
+			vars[name] = converted
+		}
+	}
+
+	var unknowns []*cel.AttributePatternType
+	for name := range c.parameters {
+		if _, ok := vars[name]; !ok {
+			unknowns = append(unknowns, cel.AttributePattern(name))
+		}
+	}
+
+	activation, err := cel.PartialVars(vars, unknowns...)
+	if err != nil {
+		return authz.CheckResult{}, fmt.Errorf("caveat %s: %w", c.name, err)
+	}
+
+	out, _, err := c.program.Eval(activation)
+	if err != nil {
+		return authz.CheckResult{}, fmt.Errorf("caveat %s: %w", c.name, err)
+	}
+
+	if unknown, ok := out.(*types.Unknown); ok {
+		return authz.CheckResult{
+			Permissionship: authz.PermissionshipConditional,
+			MissingFields:  missingFields(unknown),
+		}, nil
+	}
+
+	allowed, ok := out.Value().(bool)
+	if !ok {
+		return authz.CheckResult{}, fmt.Errorf("caveat %s: expression returned %s, want bool", c.name, out.Type())
+	}
+	if allowed {
+		return authz.CheckResult{Permissionship: authz.PermissionshipAllowed}, nil
+	}
+	return authz.CheckResult{Permissionship: authz.PermissionshipDenied}, nil
+}
+
+// missingFields returns the sorted names of the variables an unknown result depends on.
+func missingFields(unknown *types.Unknown) []string {
+	seen := make(map[string]bool)
+	var fields []string
+	for _, id := range unknown.IDs() {
+		trails, _ := unknown.GetAttributeTrails(id)
+		for _, trail := range trails {
+			if name := trail.Variable(); !seen[name] {
+				seen[name] = true
+				fields = append(fields, name)
+			}
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// celTypeOf maps a caveat parameter type to its CEL type. ipaddress values are
+// represented as strings and support the in_cidr member function.
+func celTypeOf(t *ast.CaveatParameterType) (*cel.Type, error) {
+	switch t.Name {
+	case "int":
+		return cel.IntType, nil
+	case "uint":
+		return cel.UintType, nil
+	case "bool":
+		return cel.BoolType, nil
+	case "string", "ipaddress":
+		return cel.StringType, nil
+	case "double":
+		return cel.DoubleType, nil
+	case "bytes":
+		return cel.BytesType, nil
+	case "duration":
+		return cel.DurationType, nil
+	case "timestamp":
+		return cel.TimestampType, nil
+	case "any":
+		return cel.DynType, nil
+	case "list":
+		elem, err := celTypeArg(t)
+		if err != nil {
+			return nil, err
+		}
+		return cel.ListType(elem), nil
+	case "map":
+		elem, err := celTypeArg(t)
+		if err != nil {
+			return nil, err
+		}
+		return cel.MapType(cel.StringType, elem), nil
+	default:
+		return nil, fmt.Errorf("unknown caveat parameter type %q", t.Name)
+	}
+}
+
+func celTypeArg(t *ast.CaveatParameterType) (*cel.Type, error) {
+	if len(t.TypeArgs) != 1 {
+		return nil, fmt.Errorf("type %s expects exactly one type argument", t.Name)
+	}
+	return celTypeOf(t.TypeArgs[0])
+}
+
+// celValueOf converts a context value to the Go value CEL expects for the parameter type.
+// Timestamps and durations are accepted in their string forms as well, which is how they
+// round-trip through SpiceDB's JSON-like context.
+func celValueOf(t *ast.CaveatParameterType, value any) (any, error) {
+	switch t.Name {
+	case "timestamp":
+		if s, ok := value.(string); ok {
+			return time.Parse(time.RFC3339Nano, s)
+		}
+	case "duration":
+		if s, ok := value.(string); ok {
+			return time.ParseDuration(s)
+		}
+	case "int":
+		if f, ok := value.(float64); ok && f == float64(int64(f)) {
+			return int64(f), nil
+		}
+	case "uint":
+		if f, ok := value.(float64); ok && f >= 0 && f == float64(uint64(f)) {
+			return uint64(f), nil
+		}
+	}
+	return value, nil
+}
+
+// inCIDR implements ipaddress.in_cidr(cidr).
+func inCIDR(lhs, rhs ref.Val) ref.Val {
+	addr, err := netip.ParseAddr(fmt.Sprint(lhs.Value()))
+	if err != nil {
+		return types.NewErr("invalid ip address %q", lhs.Value())
+	}
+	prefix, err := netip.ParsePrefix(fmt.Sprint(rhs.Value()))
+	if err != nil {
+		return types.NewErr("invalid cidr %q", rhs.Value())
+	}
+	return types.Bool(prefix.Contains(addr))
+}
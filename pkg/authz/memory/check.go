@@ -0,0 +1,345 @@
+package memory
+
+import (
+	"fmt"
+	"iter"
+	"sort"
+	"time"
+
+	"github.com/oitnes/authzed-codegen/internal/generator/ast"
+	"github.com/oitnes/authzed-codegen/pkg/authz"
+)
+
+// maxDepth bounds recursion through relations and arrows, mirroring SpiceDB's
+// default dispatch depth limit. Exceeding it usually means a relationship cycle.
+const maxDepth = 50
+
+// checker evaluates permissions against a snapshot of the relationship store.
+type checker struct {
+	schema        *schema
+	relationships map[objectRelation]map[subjectRef]stored
+	context       map[string]any
+	now           time.Time
+}
+
+// related yields the unexpired subjects of key with their caveats.
+func (c *checker) related(key objectRelation) iter.Seq2[subjectRef, *authz.Caveat] {
+	return func(yield func(subjectRef, *authz.Caveat) bool) {
+		for subject, s := range c.relationships[key] {
+			if s.expired(c.now) {
+				continue
+			}
+			if !yield(subject, s.caveat) {
+				return
+			}
+		}
+	}
+}
+
+// check evaluates the relation or permission name on resource for subject.
+func (c *checker) check(resource authz.Resource, name authz.Relation, subject subjectRef, depth int) (authz.CheckResult, error) {
+	if depth > maxDepth {
+		return authz.CheckResult{}, fmt.Errorf("max depth %d exceeded checking %s:%s#%s", maxDepth, resource.Type, resource.ID, name)
+	}
+
+	def, ok := c.schema.definitions[resource.Type]
+	if !ok {
+		return denied(), nil
+	}
+	if expr, ok := def.permissions[name]; ok {
+		return c.eval(resource, expr, subject, depth)
+	}
+	if _, ok := def.relations[name]; ok {
+		return c.checkRelation(resource, name, subject, depth)
+	}
+	return denied(), nil
+}
+
+// checkRelation evaluates a relation: the subject matches directly, through a wildcard,
+// or through a subject set such as group:eng#member.
+func (c *checker) checkRelation(resource authz.Resource, relation authz.Relation, subject subjectRef, depth int) (authz.CheckResult, error) {
+	result := denied()
+
+	for candidate, cav := range c.related(objectRelation{resource, relation}) {
+		var res authz.CheckResult
+		switch {
+		case candidate == subject:
+			res = allowed()
+		case candidate.id == "*" && candidate.typ == subject.typ && subject.relation == "":
+			res = allowed()
+		case candidate.relation != "":
+			var err error
+			res, err = c.check(authz.Resource{Type: candidate.typ, ID: candidate.id}, candidate.relation, subject, depth+1)
+			if err != nil {
+				return authz.CheckResult{}, err
+			}
+		default:
+			continue
+		}
+
+		res, err := c.applyCaveat(res, cav)
+		if err != nil {
+			return authz.CheckResult{}, err
+		}
+		if result = union(result, res); result.Allowed() {
+			return result, nil
+		}
+	}
+
+	return result, nil
+}
+
+// eval evaluates a permission expression.
+func (c *checker) eval(resource authz.Resource, expr ast.Expr, subject subjectRef, depth int) (authz.CheckResult, error) {
+	switch e := expr.(type) {
+	case *ast.RelationRef:
+		return c.check(resource, authz.Relation(e.Name), subject, depth+1)
+
+	case *ast.UnionExpr:
+		left, err := c.eval(resource, e.Left, subject, depth)
+		if err != nil || left.Allowed() {
+			return left, err
+		}
+		right, err := c.eval(resource, e.Right, subject, depth)
+		if err != nil {
+			return authz.CheckResult{}, err
+		}
+		return union(left, right), nil
+
+	case *ast.IntersectionExpr:
+		left, err := c.eval(resource, e.Left, subject, depth)
+		if err != nil || left.Denied() {
+			return left, err
+		}
+		right, err := c.eval(resource, e.Right, subject, depth)
+		if err != nil {
+			return authz.CheckResult{}, err
+		}
+		return intersection(left, right), nil
+
+	case *ast.ExclusionExpr:
+		left, err := c.eval(resource, e.Left, subject, depth)
+		if err != nil || left.Denied() {
+			return left, err
+		}
+		right, err := c.eval(resource, e.Right, subject, depth)
+		if err != nil {
+			return authz.CheckResult{}, err
+		}
+		return exclusion(left, right), nil
+
+	case *ast.ArrowExpr:
+		return c.evalArrow(resource, e.Relation, e.Permission, subject, depth)
+
+	case *ast.FunctionedArrowExpr:
+		if e.Function == ast.ArrowFunctionAll {
+			return c.evalArrowAll(resource, e.Relation, e.Permission, subject, depth)
+		}
+		return c.evalArrow(resource, e.Relation, e.Permission, subject, depth)
+
+	case *ast.NilExpr:
+		return denied(), nil
+
+	default:
+		return authz.CheckResult{}, fmt.Errorf("unsupported expression %T", expr)
+	}
+}
+
+// evalArrow walks every object related through relation and evaluates permission on it,
+// granting if any of them does. Objects whose type lacks the permission are skipped, as in SpiceDB.
+func (c *checker) evalArrow(resource authz.Resource, relation, permission string, subject subjectRef, depth int) (authz.CheckResult, error) {
+	result := denied()
+
+	for candidate, cav := range c.related(objectRelation{resource, authz.Relation(relation)}) {
+		if candidate.id == "*" {
+			continue
+		}
+		def, ok := c.schema.definitions[candidate.typ]
+		if !ok || !def.hasMember(authz.Relation(permission)) {
+			continue
+		}
+
+		res, err := c.check(authz.Resource{Type: candidate.typ, ID: candidate.id}, authz.Relation(permission), subject, depth+1)
+		if err != nil {
+			return authz.CheckResult{}, err
+		}
+		if res, err = c.applyCaveat(res, cav); err != nil {
+			return authz.CheckResult{}, err
+		}
+		if result = union(result, res); result.Allowed() {
+			return result, nil
+		}
+	}
+
+	return result, nil
+}
+
+// evalArrowAll evaluates relation.all(permission): every object related through relation
+// must grant the permission. As in SpiceDB, it is denied when there are no related objects
+// or when a related object's type lacks the permission.
+func (c *checker) evalArrowAll(resource authz.Resource, relation, permission string, subject subjectRef, depth int) (authz.CheckResult, error) {
+	result := allowed()
+	found := false
+	for candidate, cav := range c.related(objectRelation{resource, authz.Relation(relation)}) {
+		found = true
+		def, ok := c.schema.definitions[candidate.typ]
+		if candidate.id == "*" || !ok || !def.hasMember(authz.Relation(permission)) {
+			return denied(), nil
+		}
+
+		res, err := c.check(authz.Resource{Type: candidate.typ, ID: candidate.id}, authz.Relation(permission), subject, depth+1)
+		if err != nil {
+			return authz.CheckResult{}, err
+		}
+		if res, err = c.applyCaveat(res, cav); err != nil {
+			return authz.CheckResult{}, err
+		}
+		if result = intersection(result, res); result.Denied() {
+			return result, nil
+		}
+	}
+
+	if !found {
+		return denied(), nil
+	}
+	return result, nil
+}
+
+// applyCaveat intersects res with the caveat attached to the relationship that produced it.
+func (c *checker) applyCaveat(res authz.CheckResult, cav *authz.Caveat) (authz.CheckResult, error) {
+	if cav == nil || res.Denied() {
+		return res, nil
+	}
+
+	compiled, ok := c.schema.caveats[cav.Name]
+	if !ok {
+		return authz.CheckResult{}, fmt.Errorf("caveat %q not found", cav.Name)
+	}
+	caveatResult, err := compiled.evaluate(cav.Context, c.context)
+	if err != nil {
+		return authz.CheckResult{}, err
+	}
+
+	return intersection(res, caveatResult), nil
+}
+
+// reachableSubjects collects the IDs of subjectType that can be reached from name on
+// resource by following relations, subject sets and arrows. These are the only subjects
+// that can have the permission; each must still be checked.
+func (c *checker) reachableSubjects(resource authz.Resource, name authz.Relation, subjectType authz.Type, visited map[objectRelation]bool, out map[authz.ID]bool) {
+	key := objectRelation{resource, name}
+	if visited[key] {
+		return
+	}
+	visited[key] = true
+
+	def, ok := c.schema.definitions[resource.Type]
+	if !ok {
+		return
+	}
+	if expr, ok := def.permissions[name]; ok {
+		c.reachableFromExpr(resource, expr, subjectType, visited, out)
+		return
+	}
+
+	for candidate := range c.related(key) {
+		if candidate.relation != "" {
+			c.reachableSubjects(authz.Resource{Type: candidate.typ, ID: candidate.id}, candidate.relation, subjectType, visited, out)
+			continue
+		}
+		if candidate.typ == subjectType {
+			out[candidate.id] = true
+		}
+	}
+}
+
+func (c *checker) reachableFromExpr(resource authz.Resource, expr ast.Expr, subjectType authz.Type, visited map[objectRelation]bool, out map[authz.ID]bool) {
+	switch e := expr.(type) {
+	case *ast.RelationRef:
+		c.reachableSubjects(resource, authz.Relation(e.Name), subjectType, visited, out)
+	case *ast.UnionExpr:
+		c.reachableFromExpr(resource, e.Left, subjectType, visited, out)
+		c.reachableFromExpr(resource, e.Right, subjectType, visited, out)
+	case *ast.IntersectionExpr:
+		c.reachableFromExpr(resource, e.Left, subjectType, visited, out)
+		c.reachableFromExpr(resource, e.Right, subjectType, visited, out)
+	case *ast.ExclusionExpr:
+		// Subjects only found on the excluded side can never have the permission.
+		c.reachableFromExpr(resource, e.Left, subjectType, visited, out)
+	case *ast.ArrowExpr:
+		c.reachableThroughArrow(resource, e.Relation, e.Permission, subjectType, visited, out)
+	case *ast.FunctionedArrowExpr:
+		c.reachableThroughArrow(resource, e.Relation, e.Permission, subjectType, visited, out)
+	}
+}
+
+func (c *checker) reachableThroughArrow(resource authz.Resource, relation, permission string, subjectType authz.Type, visited map[objectRelation]bool, out map[authz.ID]bool) {
+	for candidate := range c.related(objectRelation{resource, authz.Relation(relation)}) {
+		if candidate.id != "*" {
+			c.reachableSubjects(authz.Resource{Type: candidate.typ, ID: candidate.id}, authz.Relation(permission), subjectType, visited, out)
+		}
+	}
+}
+
+func allowed() authz.CheckResult {
+	return authz.CheckResult{Permissionship: authz.PermissionshipAllowed}
+}
+
+func denied() authz.CheckResult {
+	return authz.CheckResult{Permissionship: authz.PermissionshipDenied}
+}
+
+// conditional returns a conditional result missing the fields of the conditional inputs.
+func conditional(results ...authz.CheckResult) authz.CheckResult {
+	seen := make(map[string]bool)
+	var fields []string
+	for _, r := range results {
+		if !r.Conditional() {
+			continue
+		}
+		for _, f := range r.MissingFields {
+			if !seen[f] {
+				seen[f] = true
+				fields = append(fields, f)
+			}
+		}
+	}
+	sort.Strings(fields)
+	return authz.CheckResult{Permissionship: authz.PermissionshipConditional, MissingFields: fields}
+}
+
+// union combines results with OR semantics.
+func union(a, b authz.CheckResult) authz.CheckResult {
+	switch {
+	case a.Allowed() || b.Allowed():
+		return allowed()
+	case a.Denied() && b.Denied():
+		return denied()
+	default:
+		return conditional(a, b)
+	}
+}
+
+// intersection combines results with AND semantics.
+func intersection(a, b authz.CheckResult) authz.CheckResult {
+	switch {
+	case a.Denied() || b.Denied():
+		return denied()
+	case a.Allowed() && b.Allowed():
+		return allowed()
+	default:
+		return conditional(a, b)
+	}
+}
+
+// exclusion computes a minus b.
+func exclusion(a, b authz.CheckResult) authz.CheckResult {
+	switch {
+	case a.Denied() || b.Allowed():
+		return denied()
+	case a.Allowed() && b.Denied():
+		return allowed()
+	default:
+		return conditional(a, b)
+	}
+}
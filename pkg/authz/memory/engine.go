@@ -0,0 +1,682 @@
+// Package memory provides an in-memory authz.Engine for tests. It evaluates a schema
+// the way SpiceDB does (unions, intersections, exclusions, arrows, subject relations,
+// wildcards and caveats) without a running SpiceDB.
+package memory
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"maps"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/oitnes/authzed-codegen/internal/generator/parser"
+	zedlexer "github.com/oitnes/authzed-codegen/internal/generator/zed_lexer"
+	"github.com/oitnes/authzed-codegen/pkg/authz"
+)
+
+// Engine implements authz.Engine over an in-memory relationship store. It is safe for
+// concurrent use. Every read sees the latest write, so consistency options are accepted
+// and ignored.
+type Engine struct {
+	mu            sync.RWMutex
+	schema        *schema
+	relationships map[objectRelation]map[subjectRef]stored
+	revision      uint64
+	now           func() time.Time
+
+	// history holds the changes of each revision; revision r is history[r-1]. changed is
+	// closed and replaced whenever a revision is committed, to wake up watchers.
+	history []authz.WatchEvent
+	changed chan struct{}
+}
+
+var (
+	_ authz.Engine  = (*Engine)(nil)
+	_ authz.Watcher = (*Engine)(nil)
+)
+
+// NewEngine creates an Engine for the given schema text, which must be a single
+// self-contained schema: imports and partials are rejected, so that the engine does not
+// depend on the files around the test that creates it. The schema is checked with the
+// code generator's validator, so it is rejected if code generation would reject it.
+func NewEngine(schemaText string) (*Engine, error) {
+	tokens, err := zedlexer.Lex(schemaText)
+	if err != nil {
+		return nil, fmt.Errorf("lexing schema: %w", err)
+	}
+	parsed, err := parser.Parse(tokens)
+	if err != nil {
+		return nil, fmt.Errorf("parsing schema: %w", err)
+	}
+
+	if len(parsed.Imports) > 0 {
+		imp := parsed.Imports[0]
+		return nil, fmt.Errorf("import %q at %s: the in-memory engine does not resolve imports; pass the whole schema as one text", imp.Path, imp.Pos)
+	}
+	if len(parsed.Partials) > 0 {
+		partial := parsed.Partials[0]
+		return nil, fmt.Errorf("partial %s at %s: the in-memory engine does not support partials; pass the schema with partials expanded", partial.Name, partial.Pos)
+	}
+	for _, def := range parsed.Definitions {
+		if len(def.PartialRefs) > 0 {
+			ref := def.PartialRefs[0]
+			return nil, fmt.Errorf("partial reference ...%s at %s: the in-memory engine does not support partials; pass the schema with partials expanded", ref.Name, ref.Pos)
+		}
+	}
+
+	compiled, err := compileSchema(parsed)
+	if err != nil {
+		return nil, fmt.Errorf("compiling schema: %w", err)
+	}
+
+	return &Engine{
+		schema:        compiled,
+		relationships: make(map[objectRelation]map[subjectRef]stored),
+		now:           time.Now,
+		changed:       make(chan struct{}),
+	}, nil
+}
+
+// subjectRef identifies a subject or subject set, e.g. user:alice or group:eng#member.
+type subjectRef struct {
+	typ      authz.Type
+	id       authz.ID
+	relation authz.Relation
+}
+
+func (s subjectRef) String() string {
+	if s.relation == "" {
+		return fmt.Sprintf("%s:%s", s.typ, s.id)
+	}
+	return fmt.Sprintf("%s:%s#%s", s.typ, s.id, s.relation)
+}
+
+// objectRelation identifies the relationships of one resource under one relation.
+type objectRelation struct {
+	resource authz.Resource
+	relation authz.Relation
+}
+
+// stored is what the store keeps for one relationship besides its key.
+type stored struct {
+	caveat    *authz.Caveat
+	expiresAt time.Time // zero when the relationship does not expire
+}
+
+// expired reports whether the relationship has expired at now. Expired relationships
+// are treated as absent, as in SpiceDB.
+func (s stored) expired(now time.Time) bool {
+	return !s.expiresAt.IsZero() && !now.Before(s.expiresAt)
+}
+
+// relationship is one stored relationship.
+type relationship struct {
+	resource  authz.Resource
+	relation  authz.Relation
+	subject   subjectRef
+	caveat    *authz.Caveat
+	expiresAt time.Time
+}
+
+func (r relationship) subjectString() string {
+	switch {
+	case r.caveat != nil && !r.expiresAt.IsZero():
+		return fmt.Sprintf("%s with %s and expiration", r.subject, r.caveat.Name)
+	case r.caveat != nil:
+		return fmt.Sprintf("%s with %s", r.subject, r.caveat.Name)
+	case !r.expiresAt.IsZero():
+		return fmt.Sprintf("%s with expiration", r.subject)
+	default:
+		return r.subject.String()
+	}
+}
+
+func (r relationship) String() string {
+	return fmt.Sprintf("%s:%s#%s@%s", r.resource.Type, r.resource.ID, r.relation, r.subject)
+}
+
+func (r relationship) object() authz.RelationshipObject {
+	return authz.RelationshipObject{
+		Resource:        r.resource,
+		Relation:        r.relation,
+		SubjectType:     r.subject.typ,
+		SubjectID:       r.subject.id,
+		SubjectRelation: r.subject.relation,
+		Caveat:          cloneCaveat(r.caveat),
+		ExpiresAt:       r.expiresAt,
+	}
+}
+
+func relationshipFromObject(o authz.RelationshipObject) relationship {
+	return relationship{
+		resource:  o.Resource,
+		relation:  o.Relation,
+		subject:   subjectRef{typ: o.SubjectType, id: o.SubjectID, relation: o.SubjectRelation},
+		caveat:    o.Caveat,
+		expiresAt: o.ExpiresAt,
+	}
+}
+
+func cloneCaveat(c *authz.Caveat) *authz.Caveat {
+	if c == nil {
+		return nil
+	}
+	return &authz.Caveat{Name: c.Name, Context: maps.Clone(c.Context)}
+}
+
+// token returns the ZedToken for the current revision. Callers must hold e.mu.
+func (e *Engine) token() authz.ZedToken {
+	return authz.ZedToken(strconv.FormatUint(e.revision, 10))
+}
+
+// write validates and applies updates atomically if all preconditions hold. Like SpiceDB,
+// a create fails if the relationship already exists and has not expired, and a relationship
+// may appear at most once per write.
+func (e *Engine) write(updates []authz.RelationshipUpdate, preconditions []authz.Precondition) (authz.ZedToken, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := e.now()
+	if err := e.checkPreconditions(preconditions, now); err != nil {
+		return "", err
+	}
+
+	seen := make(map[relationshipKey]bool, len(updates))
+	for _, u := range updates {
+		r := relationshipFromObject(u.Relationship)
+		key := r.key()
+		if seen[key] {
+			return "", fmt.Errorf("relationship %s appears more than once in the write", r)
+		}
+		seen[key] = true
+
+		switch u.Operation {
+		case authz.WriteCreate, authz.WriteTouch:
+			if err := e.schema.validateRelationship(r); err != nil {
+				return "", err
+			}
+			existing, exists := e.relationships[key.objectRelation][key.subject]
+			if u.Operation == authz.WriteCreate && exists && !existing.expired(now) {
+				return "", fmt.Errorf("relationship %s already exists", r)
+			}
+		case authz.WriteDelete:
+		default:
+			return "", fmt.Errorf("unknown write operation %s", u.Operation)
+		}
+	}
+
+	var changes []authz.RelationshipChange
+	for _, u := range updates {
+		r := relationshipFromObject(u.Relationship)
+		key := objectRelation{r.resource, r.relation}
+		if u.Operation == authz.WriteDelete {
+			existing, exists := e.relationships[key][r.subject]
+			if !exists {
+				continue
+			}
+			r.caveat, r.expiresAt = existing.caveat, existing.expiresAt
+			changes = append(changes, authz.RelationshipChange{Operation: authz.WriteDelete, Relationship: r.object()})
+			delete(e.relationships[key], r.subject)
+			if len(e.relationships[key]) == 0 {
+				delete(e.relationships, key)
+			}
+			continue
+		}
+
+		subjects, ok := e.relationships[key]
+		if !ok {
+			subjects = make(map[subjectRef]stored)
+			e.relationships[key] = subjects
+		}
+		subjects[r.subject] = stored{caveat: cloneCaveat(r.caveat), expiresAt: r.expiresAt}
+		changes = append(changes, authz.RelationshipChange{Operation: u.Operation, Relationship: r.object()})
+	}
+
+	return e.commit(changes), nil
+}
+
+// commit records changes as a new revision, wakes up watchers and returns the revision's
+// ZedToken. Callers must hold e.mu for writing.
+func (e *Engine) commit(changes []authz.RelationshipChange) authz.ZedToken {
+	e.revision++
+	token := e.token()
+	e.history = append(e.history, authz.WatchEvent{Changes: changes, Token: token})
+	close(e.changed)
+	e.changed = make(chan struct{})
+	return token
+}
+
+// checkPreconditions returns a *authz.PreconditionFailedError for the first precondition
+// that does not hold. Callers must hold e.mu.
+func (e *Engine) checkPreconditions(preconditions []authz.Precondition, now time.Time) error {
+	for _, p := range preconditions {
+		if e.anyMatch(p.Filter, now) != (p.Operation == authz.PreconditionMustMatch) {
+			return &authz.PreconditionFailedError{Precondition: &p}
+		}
+	}
+	return nil
+}
+
+// anyMatch reports whether an unexpired relationship matches filter. Callers must hold e.mu.
+func (e *Engine) anyMatch(filter authz.RelationshipFilter, now time.Time) bool {
+	for key, subjects := range e.relationships {
+		for subject, s := range subjects {
+			if matchesFilter(filter, key, subject) && !s.expired(now) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchesFilter reports whether the relationship of subject to key matches filter.
+func matchesFilter(filter authz.RelationshipFilter, key objectRelation, subject subjectRef) bool {
+	switch {
+	case filter.ResourceType != "" && string(key.resource.Type) != filter.ResourceType,
+		filter.ResourceID != "" && string(key.resource.ID) != filter.ResourceID,
+		filter.Relation != "" && string(key.relation) != filter.Relation:
+		return false
+	case filter.SubjectType == "":
+		return true
+	default:
+		return string(subject.typ) == filter.SubjectType &&
+			(filter.SubjectID == "" || string(subject.id) == filter.SubjectID) &&
+			(filter.SubjectRelation == "" || string(subject.relation) == filter.SubjectRelation)
+	}
+}
+
+// relationshipKey identifies a relationship regardless of its caveat.
+type relationshipKey struct {
+	objectRelation
+	subject subjectRef
+}
+
+func (k relationshipKey) String() string {
+	return relationship{resource: k.resource, relation: k.relation, subject: k.subject}.String()
+}
+
+func (r relationship) key() relationshipKey {
+	return relationshipKey{objectRelation{r.resource, r.relation}, r.subject}
+}
+
+func (e *Engine) CreateRelations(ctx context.Context, resource authz.Resource, relation authz.Relation, subjectType authz.Type, subjectRelation authz.Relation, subjectIDs []authz.ID, caveat *authz.Caveat, expiresAt time.Time, preconditions ...authz.Precondition) (authz.ZedToken, error) {
+	return e.write(relationUpdates(authz.WriteCreate, resource, relation, subjectType, subjectRelation, subjectIDs, caveat, expiresAt), preconditions)
+}
+
+// TouchRelations creates relationships or overwrites the caveat and expiry of existing ones.
+func (e *Engine) TouchRelations(ctx context.Context, resource authz.Resource, relation authz.Relation, subjectType authz.Type, subjectRelation authz.Relation, subjectIDs []authz.ID, caveat *authz.Caveat, expiresAt time.Time, preconditions ...authz.Precondition) (authz.ZedToken, error) {
+	return e.write(relationUpdates(authz.WriteTouch, resource, relation, subjectType, subjectRelation, subjectIDs, caveat, expiresAt), preconditions)
+}
+
+// relationUpdates returns one update per subject ID.
+func relationUpdates(op authz.WriteOperation, resource authz.Resource, relation authz.Relation, subjectType authz.Type, subjectRelation authz.Relation, subjectIDs []authz.ID, caveat *authz.Caveat, expiresAt time.Time) []authz.RelationshipUpdate {
+	updates := make([]authz.RelationshipUpdate, len(subjectIDs))
+	for i, id := range subjectIDs {
+		updates[i] = authz.RelationshipUpdate{
+			Operation: op,
+			Relationship: authz.RelationshipObject{
+				Resource:        resource,
+				Relation:        relation,
+				SubjectType:     subjectType,
+				SubjectID:       id,
+				SubjectRelation: subjectRelation,
+				Caveat:          caveat,
+				ExpiresAt:       expiresAt,
+			},
+		}
+	}
+	return updates
+}
+
+func (e *Engine) ReadRelations(ctx context.Context, resource authz.Resource, relation authz.Relation, subjectType authz.Type, subjectRelation authz.Relation) ([]authz.RelationshipObject, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	now := e.now()
+	var objects []authz.RelationshipObject
+	for subject, s := range e.relationships[objectRelation{resource, relation}] {
+		if subject.typ == subjectType && subject.relation == subjectRelation && !s.expired(now) {
+			r := relationship{resource: resource, relation: relation, subject: subject, caveat: s.caveat, expiresAt: s.expiresAt}
+			objects = append(objects, r.object())
+		}
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].SubjectID < objects[j].SubjectID })
+
+	return objects, nil
+}
+
+func (e *Engine) DeleteRelations(ctx context.Context, resource authz.Resource, relation authz.Relation, subjectType authz.Type, subjectRelation authz.Relation, subjectIDs []authz.ID, preconditions ...authz.Precondition) (authz.ZedToken, error) {
+	return e.write(relationUpdates(authz.WriteDelete, resource, relation, subjectType, subjectRelation, subjectIDs, nil, time.Time{}), preconditions)
+}
+
+// DeleteRelationships deletes matching relationships atomically if the preconditions hold.
+// A partial delete removes the first Limit matches in the order ExportBulkRelationships
+// returns them.
+func (e *Engine) DeleteRelationships(ctx context.Context, filter authz.RelationshipFilter, opts authz.DeleteOptions, preconditions ...authz.Precondition) (authz.DeleteResult, error) {
+	if filter.ResourceType == "" {
+		return authz.DeleteResult{}, fmt.Errorf("relationship filter for delete must set a resource type")
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := e.now()
+	if err := e.checkPreconditions(preconditions, now); err != nil {
+		return authz.DeleteResult{}, err
+	}
+
+	// Like SpiceDB, expired relationships are neither deleted nor counted against the limit.
+	var matches []relationshipKey
+	for key, subjects := range e.relationships {
+		for subject, s := range subjects {
+			if matchesFilter(filter, key, subject) && !s.expired(now) {
+				matches = append(matches, relationshipKey{key, subject})
+			}
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].String() < matches[j].String() })
+
+	complete := true
+	if opts.Limit != 0 && len(matches) > int(opts.Limit) {
+		if !opts.AllowPartial {
+			return authz.DeleteResult{}, fmt.Errorf("%d relationships match the filter, more than the limit of %d", len(matches), opts.Limit)
+		}
+		matches, complete = matches[:opts.Limit], false
+	}
+
+	changes := make([]authz.RelationshipChange, len(matches))
+	for i, m := range matches {
+		s := e.relationships[m.objectRelation][m.subject]
+		r := relationship{resource: m.resource, relation: m.relation, subject: m.subject, caveat: s.caveat, expiresAt: s.expiresAt}
+		changes[i] = authz.RelationshipChange{Operation: authz.WriteDelete, Relationship: r.object()}
+
+		delete(e.relationships[m.objectRelation], m.subject)
+		if len(e.relationships[m.objectRelation]) == 0 {
+			delete(e.relationships, m.objectRelation)
+		}
+	}
+	token := e.commit(changes)
+
+	return authz.DeleteResult{Token: token, Deleted: uint64(len(matches)), Complete: complete}, nil
+}
+
+// WriteRelationships applies all updates atomically: if any of them is invalid or a
+// precondition does not hold, none apply.
+func (e *Engine) WriteRelationships(ctx context.Context, updates []authz.RelationshipUpdate, preconditions ...authz.Precondition) (authz.ZedToken, error) {
+	return e.write(updates, preconditions)
+}
+
+// CheckPermission evaluates permission for the subject. Caveats whose parameters are
+// missing from both the relationship and caveatContext produce a conditional result.
+func (e *Engine) CheckPermission(ctx context.Context, resource authz.Resource, permission authz.Permission, subjectType authz.Type, subjectID authz.ID, caveatContext map[string]any) (authz.CheckResult, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if err := e.validateCheck(resource.Type, permission, subjectType); err != nil {
+		return authz.CheckResult{}, err
+	}
+
+	return e.checker(caveatContext).check(resource, authz.Relation(permission), subjectRef{typ: subjectType, id: subjectID}, 0)
+}
+
+// LookupResources returns the resources of resourceType on which the subject has the
+// permission. Like SpiceDB, conditional results are included.
+func (e *Engine) LookupResources(ctx context.Context, resourceType authz.Type, permission authz.Permission, subjectType authz.Type, subjectID authz.ID) ([]authz.ID, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if err := e.validateCheck(resourceType, permission, subjectType); err != nil {
+		return nil, err
+	}
+
+	candidates := make(map[authz.ID]bool)
+	for key := range e.relationships {
+		if key.resource.Type == resourceType {
+			candidates[key.resource.ID] = true
+		}
+	}
+
+	c := e.checker(nil)
+	subject := subjectRef{typ: subjectType, id: subjectID}
+	var ids []authz.ID
+	for id := range candidates {
+		res, err := c.check(authz.Resource{Type: resourceType, ID: id}, authz.Relation(permission), subject, 0)
+		if err != nil {
+			return nil, err
+		}
+		if !res.Denied() {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	return ids, nil
+}
+
+// LookupSubjects returns the subjects of subjectType that have the permission on the
+// resource. A wildcard grant is reported as the subject ID "*". Like SpiceDB, conditional
+// results are included.
+func (e *Engine) LookupSubjects(ctx context.Context, resource authz.Resource, permission authz.Permission, subjectType authz.Type) ([]authz.ID, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if err := e.validateCheck(resource.Type, permission, subjectType); err != nil {
+		return nil, err
+	}
+
+	c := e.checker(nil)
+	candidates := make(map[authz.ID]bool)
+	c.reachableSubjects(resource, authz.Relation(permission), subjectType, make(map[objectRelation]bool), candidates)
+
+	var ids []authz.ID
+	for id := range candidates {
+		res, err := c.check(resource, authz.Relation(permission), subjectRef{typ: subjectType, id: id}, 0)
+		if err != nil {
+			return nil, err
+		}
+		if !res.Denied() {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	return ids, nil
+}
+
+// CheckBulkPermission checks each item independently. Items that fail to evaluate carry
+// their error, matching the SpiceDB engine. Like SpiceDB, it rejects requests of more than
+// authz.MaxBulkCheckItems items.
+func (e *Engine) CheckBulkPermission(ctx context.Context, checks []authz.PermissionCheck) ([]authz.BulkCheckResult, error) {
+	if len(checks) > authz.MaxBulkCheckItems {
+		return nil, fmt.Errorf("bulk check of %d items exceeds the limit of %d", len(checks), authz.MaxBulkCheckItems)
+	}
+	results := make([]authz.BulkCheckResult, len(checks))
+	for i, check := range checks {
+		results[i].CheckResult, results[i].Err = e.CheckPermission(ctx, check.Resource, check.Permission, check.SubjectType, check.SubjectID, check.CaveatContext)
+	}
+	return results, nil
+}
+
+func (e *Engine) ExportBulkRelationships(ctx context.Context, filter authz.RelationshipFilter) ([]authz.RelationshipObject, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	now := e.now()
+	var rels []relationship
+	for key, subjects := range e.relationships {
+		for subject, s := range subjects {
+			if !matchesFilter(filter, key, subject) || s.expired(now) {
+				continue
+			}
+			rels = append(rels, relationship{resource: key.resource, relation: key.relation, subject: subject, caveat: s.caveat, expiresAt: s.expiresAt})
+		}
+	}
+	sort.Slice(rels, func(i, j int) bool { return rels[i].String() < rels[j].String() })
+
+	objects := make([]authz.RelationshipObject, len(rels))
+	for i, r := range rels {
+		objects[i] = r.object()
+	}
+	return objects, nil
+}
+
+// ImportBulkRelationships writes all relationships atomically. Like SpiceDB, it fails
+// if any of them already exists.
+func (e *Engine) ImportBulkRelationships(ctx context.Context, relationships []authz.RelationshipObject) error {
+	updates := make([]authz.RelationshipUpdate, len(relationships))
+	for i, r := range relationships {
+		updates[i] = authz.RelationshipUpdate{Operation: authz.WriteCreate, Relationship: r}
+	}
+	_, err := e.write(updates, nil)
+	return err
+}
+
+// validateCheck rejects checks and lookups against types or permissions missing from the schema.
+func (e *Engine) validateCheck(resourceType authz.Type, permission authz.Permission, subjectType authz.Type) error {
+	def, ok := e.schema.definitions[resourceType]
+	if !ok {
+		return fmt.Errorf("object definition %q not found", resourceType)
+	}
+	if !def.hasMember(authz.Relation(permission)) {
+		return fmt.Errorf("relation or permission %s#%s not found", resourceType, permission)
+	}
+	if _, ok := e.schema.definitions[subjectType]; !ok {
+		return fmt.Errorf("object definition %q not found", subjectType)
+	}
+	return nil
+}
+
+// checker returns an evaluator over the current relationships. Callers must hold e.mu.
+func (e *Engine) checker(caveatContext map[string]any) *checker {
+	return &checker{schema: e.schema, relationships: e.relationships, context: caveatContext, now: e.now()}
+}
+
+// LookupResourcesSeq yields the results of LookupResources.
+func (e *Engine) LookupResourcesSeq(ctx context.Context, resourceType authz.Type, permission authz.Permission, subjectType authz.Type, subjectID authz.ID) iter.Seq2[authz.ID, error] {
+	return seq(e.LookupResources(ctx, resourceType, permission, subjectType, subjectID))
+}
+
+// LookupResourcesPage returns the results of LookupResources after cursor, which is the
+// last ID of the previous page.
+func (e *Engine) LookupResourcesPage(ctx context.Context, resourceType authz.Type, permission authz.Permission, subjectType authz.Type, subjectID authz.ID, limit uint32, cursor authz.Cursor) ([]authz.ID, authz.Cursor, error) {
+	ids, err := e.LookupResources(ctx, resourceType, permission, subjectType, subjectID)
+	if err != nil {
+		return nil, "", err
+	}
+	ids, next := page(ids, func(id authz.ID) authz.ID { return id }, limit, cursor)
+	return ids, next, nil
+}
+
+// LookupSubjectsSeq yields the results of LookupSubjects.
+func (e *Engine) LookupSubjectsSeq(ctx context.Context, resource authz.Resource, permission authz.Permission, subjectType authz.Type) iter.Seq2[authz.ID, error] {
+	return seq(e.LookupSubjects(ctx, resource, permission, subjectType))
+}
+
+// ReadRelationsSeq yields the results of ReadRelations.
+func (e *Engine) ReadRelationsSeq(ctx context.Context, resource authz.Resource, relation authz.Relation, subjectType authz.Type, subjectRelation authz.Relation) iter.Seq2[authz.RelationshipObject, error] {
+	return seq(e.ReadRelations(ctx, resource, relation, subjectType, subjectRelation))
+}
+
+// ReadRelationsPage returns the results of ReadRelations after cursor, which is the last
+// subject ID of the previous page.
+func (e *Engine) ReadRelationsPage(ctx context.Context, resource authz.Resource, relation authz.Relation, subjectType authz.Type, subjectRelation authz.Relation, limit uint32, cursor authz.Cursor) ([]authz.RelationshipObject, authz.Cursor, error) {
+	rels, err := e.ReadRelations(ctx, resource, relation, subjectType, subjectRelation)
+	if err != nil {
+		return nil, "", err
+	}
+	rels, next := page(rels, func(r authz.RelationshipObject) authz.ID { return r.SubjectID }, limit, cursor)
+	return rels, next, nil
+}
+
+// ExportBulkRelationshipsSeq yields the results of ExportBulkRelationships.
+func (e *Engine) ExportBulkRelationshipsSeq(ctx context.Context, filter authz.RelationshipFilter) iter.Seq2[authz.RelationshipObject, error] {
+	return seq(e.ExportBulkRelationships(ctx, filter))
+}
+
+// Watch yields the changes of each write committed after token. The in-memory feed never
+// disconnects, so the only error it yields is for a token this engine did not issue.
+func (e *Engine) Watch(ctx context.Context, token authz.ZedToken, objectTypes ...authz.Type) iter.Seq2[authz.WatchEvent, error] {
+	return func(yield func(authz.WatchEvent, error) bool) {
+		e.mu.RLock()
+		next := e.revision
+		e.mu.RUnlock()
+		if token != "" {
+			revision, err := strconv.ParseUint(string(token), 10, 64)
+			if err != nil || revision > next {
+				yield(authz.WatchEvent{}, fmt.Errorf("unknown ZedToken %q", token))
+				return
+			}
+			next = revision
+		}
+
+		for {
+			e.mu.RLock()
+			events, changed := e.history[next:], e.changed
+			e.mu.RUnlock()
+
+			if len(events) == 0 {
+				select {
+				case <-ctx.Done():
+					return
+				case <-changed:
+				}
+				continue
+			}
+			for _, event := range events {
+				next++
+				event.Changes = changesOfTypes(event.Changes, objectTypes)
+				if len(event.Changes) > 0 && !yield(event, nil) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// changesOfTypes returns the changes to resources of objectTypes, or all changes when
+// objectTypes is empty.
+func changesOfTypes(changes []authz.RelationshipChange, objectTypes []authz.Type) []authz.RelationshipChange {
+	if len(objectTypes) == 0 {
+		return changes
+	}
+	var filtered []authz.RelationshipChange
+	for _, change := range changes {
+		if slices.Contains(objectTypes, change.Relationship.Resource.Type) {
+			filtered = append(filtered, change)
+		}
+	}
+	return filtered
+}
+
+// seq yields results, or only err if it is not nil.
+func seq[T any](results []T, err error) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		if err != nil {
+			var zero T
+			yield(zero, err)
+			return
+		}
+		for _, result := range results {
+			if !yield(result, nil) {
+				return
+			}
+		}
+	}
+}
+
+// page returns at most limit of the results whose id sorts after cursor, and the cursor of
+// the next page, which is empty when no results remain. results must be sorted by id.
+func page[T any](results []T, id func(T) authz.ID, limit uint32, cursor authz.Cursor) ([]T, authz.Cursor) {
+	start := sort.Search(len(results), func(i int) bool { return string(id(results[i])) > string(cursor) })
+	results = results[start:]
+	if limit == 0 || len(results) <= int(limit) {
+		return results, ""
+	}
+	results = results[:limit]
+	return results, authz.Cursor(id(results[len(results)-1]))
+}
@@ -0,0 +1,819 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oitnes/authzed-codegen/pkg/authz"
+)
+
+const testSchema = `
+use expiration
+
+caveat ip_allowed(allowed_cidr string, user_ip ipaddress) {
+	user_ip.in_cidr(allowed_cidr)
+}
+
+definition user {}
+
+definition group {
+	relation member: user | group#member
+}
+
+definition folder {
+	relation owner: user
+	relation viewer: user | user:* | group#member
+	permission view = owner + viewer
+}
+
+definition document {
+	relation parent: folder
+	relation owner: user
+	relation editor: user | user with ip_allowed
+	relation viewer: user | user:* | group#member
+	relation banned: user
+	relation approver: group
+	relation guest: user with expiration
+	permission edit = owner + editor
+	permission view = (viewer + edit + guest + parent->view) - banned
+	permission review = viewer & editor
+	permission approve = approver.all(member)
+	permission comment = approver.any(member)
+	permission archive = nil
+}
+`
+
+func newTestEngine(t *testing.T) *Engine {
+	t.Helper()
+	e, err := NewEngine(testSchema)
+	if err != nil {
+		t.Fatalf("NewEngine() error: %v", err)
+	}
+	return e
+}
+
+func doc(id string) authz.Resource    { return authz.Resource{Type: "document", ID: authz.ID(id)} }
+func folder(id string) authz.Resource { return authz.Resource{Type: "folder", ID: authz.ID(id)} }
+func group(id string) authz.Resource  { return authz.Resource{Type: "group", ID: authz.ID(id)} }
+
+func mustCreate(t *testing.T, e *Engine, resource authz.Resource, relation authz.Relation, subjectType authz.Type, subjectRelation authz.Relation, ids ...authz.ID) {
+	t.Helper()
+	if _, err := e.CreateRelations(context.Background(), resource, relation, subjectType, subjectRelation, ids, nil, time.Time{}); err != nil {
+		t.Fatalf("CreateRelations(%s:%s#%s) error: %v", resource.Type, resource.ID, relation, err)
+	}
+}
+
+func assertCheck(t *testing.T, e *Engine, resource authz.Resource, permission authz.Permission, userID authz.ID, caveatContext map[string]any, want authz.Permissionship) {
+	t.Helper()
+	got, err := e.CheckPermission(context.Background(), resource, permission, "user", userID, caveatContext)
+	if err != nil {
+		t.Fatalf("CheckPermission(%s:%s#%s@user:%s) error: %v", resource.Type, resource.ID, permission, userID, err)
+	}
+	if got.Permissionship != want {
+		t.Errorf("CheckPermission(%s:%s#%s@user:%s) = %s, want %s", resource.Type, resource.ID, permission, userID, got.Permissionship, want)
+	}
+}
+
+func subjectIDs(rels []authz.RelationshipObject) []authz.ID {
+	ids := make([]authz.ID, len(rels))
+	for i, r := range rels {
+		ids[i] = r.SubjectID
+	}
+	return ids
+}
+
+func TestReadRelationsMetadata(t *testing.T) {
+	e := newTestEngine(t)
+	ctx := context.Background()
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	caveat := &authz.Caveat{Name: "ip_allowed", Context: map[string]any{"allowed_cidr": "10.0.0.0/8"}}
+
+	if _, err := e.CreateRelations(ctx, doc("1"), "editor", "user", "", []authz.ID{"alice"}, caveat, time.Time{}); err != nil {
+		t.Fatalf("CreateRelations() error: %v", err)
+	}
+	if _, err := e.CreateRelations(ctx, doc("1"), "guest", "user", "", []authz.ID{"bob"}, nil, expiresAt); err != nil {
+		t.Fatalf("CreateRelations() error: %v", err)
+	}
+
+	rels, err := e.ReadRelations(ctx, doc("1"), "editor", "user", "")
+	if err != nil {
+		t.Fatalf("ReadRelations() error: %v", err)
+	}
+	want := []authz.RelationshipObject{{Resource: doc("1"), Relation: "editor", SubjectType: "user", SubjectID: "alice", Caveat: caveat}}
+	if !reflect.DeepEqual(rels, want) {
+		t.Errorf("ReadRelations(editor) = %+v, want %+v", rels, want)
+	}
+
+	rels, err = e.ReadRelations(ctx, doc("1"), "guest", "user", "")
+	if err != nil {
+		t.Fatalf("ReadRelations() error: %v", err)
+	}
+	if len(rels) != 1 || !rels[0].ExpiresAt.Equal(expiresAt) || rels[0].Caveat != nil {
+		t.Errorf("ReadRelations(guest) = %+v, want bob expiring at %v", rels, expiresAt)
+	}
+}
+
+func TestCheckOperators(t *testing.T) {
+	e := newTestEngine(t)
+	mustCreate(t, e, doc("1"), "owner", "user", "", "alice")
+	mustCreate(t, e, doc("1"), "editor", "user", "", "bob", "carol")
+	mustCreate(t, e, doc("1"), "viewer", "user", "", "carol", "dave")
+	mustCreate(t, e, doc("1"), "banned", "user", "", "dave")
+
+	assertCheck(t, e, doc("1"), "view", "alice", nil, authz.PermissionshipAllowed)
+	assertCheck(t, e, doc("1"), "view", "bob", nil, authz.PermissionshipAllowed)
+	assertCheck(t, e, doc("1"), "view", "dave", nil, authz.PermissionshipDenied)
+	assertCheck(t, e, doc("1"), "view", "erin", nil, authz.PermissionshipDenied)
+
+	assertCheck(t, e, doc("1"), "review", "carol", nil, authz.PermissionshipAllowed)
+	assertCheck(t, e, doc("1"), "review", "bob", nil, authz.PermissionshipDenied)
+}
+
+func TestCheckArrowAndSubjectSets(t *testing.T) {
+	e := newTestEngine(t)
+	mustCreate(t, e, doc("1"), "parent", "folder", "", "f")
+	mustCreate(t, e, folder("f"), "viewer", "group", "member", "eng")
+	mustCreate(t, e, group("eng"), "member", "group", "member", "backend")
+	mustCreate(t, e, group("backend"), "member", "user", "", "alice")
+
+	assertCheck(t, e, doc("1"), "view", "alice", nil, authz.PermissionshipAllowed)
+	assertCheck(t, e, doc("1"), "view", "bob", nil, authz.PermissionshipDenied)
+
+	ids, err := e.LookupResources(context.Background(), "document", "view", "user", "alice")
+	if err != nil {
+		t.Fatalf("LookupResources() error: %v", err)
+	}
+	if !reflect.DeepEqual(ids, []authz.ID{"1"}) {
+		t.Errorf("LookupResources() = %v, want [1]", ids)
+	}
+
+	ids, err = e.LookupSubjects(context.Background(), doc("1"), "view", "user")
+	if err != nil {
+		t.Fatalf("LookupSubjects() error: %v", err)
+	}
+	if !reflect.DeepEqual(ids, []authz.ID{"alice"}) {
+		t.Errorf("LookupSubjects() = %v, want [alice]", ids)
+	}
+}
+
+func TestCheckArrowFunctionsAndNil(t *testing.T) {
+	e := newTestEngine(t)
+	mustCreate(t, e, doc("1"), "approver", "group", "", "eng", "legal")
+	mustCreate(t, e, doc("1"), "owner", "user", "", "alice")
+	mustCreate(t, e, group("eng"), "member", "user", "", "alice", "bob")
+	mustCreate(t, e, group("legal"), "member", "user", "", "alice")
+
+	assertCheck(t, e, doc("1"), "approve", "alice", nil, authz.PermissionshipAllowed)
+	assertCheck(t, e, doc("1"), "approve", "bob", nil, authz.PermissionshipDenied)
+	assertCheck(t, e, doc("1"), "comment", "bob", nil, authz.PermissionshipAllowed)
+	assertCheck(t, e, doc("1"), "comment", "carol", nil, authz.PermissionshipDenied)
+	assertCheck(t, e, doc("1"), "archive", "alice", nil, authz.PermissionshipDenied)
+
+	// With nothing to walk, .all() grants nothing.
+	assertCheck(t, e, doc("2"), "approve", "alice", nil, authz.PermissionshipDenied)
+
+	ids, err := e.LookupSubjects(context.Background(), doc("1"), "approve", "user")
+	if err != nil {
+		t.Fatalf("LookupSubjects() error: %v", err)
+	}
+	if !reflect.DeepEqual(ids, []authz.ID{"alice"}) {
+		t.Errorf("LookupSubjects() = %v, want [alice]", ids)
+	}
+}
+
+func TestCheckWildcardWithExclusion(t *testing.T) {
+	e := newTestEngine(t)
+	mustCreate(t, e, doc("1"), "viewer", "user", "", "*")
+	mustCreate(t, e, doc("1"), "banned", "user", "", "mallory")
+	mustCreate(t, e, doc("1"), "owner", "user", "", "alice")
+
+	assertCheck(t, e, doc("1"), "view", "anyone", nil, authz.PermissionshipAllowed)
+	assertCheck(t, e, doc("1"), "view", "mallory", nil, authz.PermissionshipDenied)
+
+	ids, err := e.LookupSubjects(context.Background(), doc("1"), "view", "user")
+	if err != nil {
+		t.Fatalf("LookupSubjects() error: %v", err)
+	}
+	if !reflect.DeepEqual(ids, []authz.ID{"*", "alice"}) {
+		t.Errorf("LookupSubjects() = %v, want [* alice]", ids)
+	}
+}
+
+func TestCheckCaveats(t *testing.T) {
+	e := newTestEngine(t)
+	caveat := &authz.Caveat{Name: "ip_allowed", Context: map[string]any{"allowed_cidr": "10.0.0.0/8"}}
+	if _, err := e.CreateRelations(context.Background(), doc("1"), "editor", "user", "", []authz.ID{"alice"}, caveat, time.Time{}); err != nil {
+		t.Fatalf("CreateRelations() error: %v", err)
+	}
+
+	got, err := e.CheckPermission(context.Background(), doc("1"), "edit", "user", "alice", nil)
+	if err != nil {
+		t.Fatalf("CheckPermission() error: %v", err)
+	}
+	if !got.Conditional() || !reflect.DeepEqual(got.MissingFields, []string{"user_ip"}) {
+		t.Errorf("CheckPermission() = %+v, want conditional on [user_ip]", got)
+	}
+
+	assertCheck(t, e, doc("1"), "edit", "alice", map[string]any{"user_ip": "10.1.2.3"}, authz.PermissionshipAllowed)
+	assertCheck(t, e, doc("1"), "edit", "alice", map[string]any{"user_ip": "192.168.0.1"}, authz.PermissionshipDenied)
+
+	// The relationship's stored context takes precedence over the check context.
+	assertCheck(t, e, doc("1"), "edit", "alice", map[string]any{"user_ip": "192.168.0.1", "allowed_cidr": "192.168.0.0/16"}, authz.PermissionshipDenied)
+
+	ids, err := e.LookupResources(context.Background(), "document", "edit", "user", "alice")
+	if err != nil {
+		t.Fatalf("LookupResources() error: %v", err)
+	}
+	if !reflect.DeepEqual(ids, []authz.ID{"1"}) {
+		t.Errorf("LookupResources() = %v, want conditional resource [1]", ids)
+	}
+}
+
+func TestWriteValidation(t *testing.T) {
+	e := newTestEngine(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		resource authz.Resource
+		relation authz.Relation
+		subject  authz.Type
+		subRel   authz.Relation
+		id       authz.ID
+		caveat   *authz.Caveat
+		wantErr  string
+	}{
+		{"unknown type", authz.Resource{Type: "nope", ID: "1"}, "owner", "user", "", "a", nil, "not found"},
+		{"unknown relation", doc("1"), "nope", "user", "", "a", nil, "not found"},
+		{"permission", doc("1"), "view", "user", "", "a", nil, "permission"},
+		{"disallowed subject", doc("1"), "owner", "group", "", "g", nil, "not allowed"},
+		{"disallowed wildcard", doc("1"), "owner", "user", "", "*", nil, "not allowed"},
+		{"missing caveat", doc("1"), "viewer", "user", "", "a", &authz.Caveat{Name: "ip_allowed"}, "not allowed"},
+		{"disallowed subject relation", doc("1"), "owner", "group", "member", "g", nil, "not allowed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := e.CreateRelations(ctx, tt.resource, tt.relation, tt.subject, tt.subRel, []authz.ID{tt.id}, tt.caveat, time.Time{})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("CreateRelations() error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestExpiringRelationships(t *testing.T) {
+	e := newTestEngine(t)
+	ctx := context.Background()
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	e.now = func() time.Time { return now }
+
+	if _, err := e.CreateRelations(ctx, doc("1"), "guest", "user", "", []authz.ID{"alice"}, nil, now.Add(time.Hour)); err != nil {
+		t.Fatalf("CreateRelations() error: %v", err)
+	}
+	if _, err := e.CreateRelations(ctx, doc("1"), "guest", "user", "", []authz.ID{"bob"}, nil, time.Time{}); err == nil || !strings.Contains(err.Error(), "not allowed") {
+		t.Errorf("CreateRelations() without expiration error = %v, want not allowed", err)
+	}
+	if _, err := e.CreateRelations(ctx, doc("1"), "viewer", "user", "", []authz.ID{"bob"}, nil, now.Add(time.Hour)); err == nil || !strings.Contains(err.Error(), "not allowed") {
+		t.Errorf("CreateRelations() with unexpected expiration error = %v, want not allowed", err)
+	}
+
+	assertCheck(t, e, doc("1"), "view", "alice", nil, authz.PermissionshipAllowed)
+	exported, err := e.ExportBulkRelationships(ctx, authz.RelationshipFilter{Relation: "guest"})
+	if err != nil {
+		t.Fatalf("ExportBulkRelationships() error: %v", err)
+	}
+	if len(exported) != 1 || !exported[0].ExpiresAt.Equal(now.Add(time.Hour)) {
+		t.Errorf("ExportBulkRelationships() = %+v, want alice expiring in an hour", exported)
+	}
+
+	now = now.Add(time.Hour)
+	assertCheck(t, e, doc("1"), "view", "alice", nil, authz.PermissionshipDenied)
+	rels, err := e.ReadRelations(ctx, doc("1"), "guest", "user", "")
+	if err != nil {
+		t.Fatalf("ReadRelations() error: %v", err)
+	}
+	if len(rels) != 0 {
+		t.Errorf("ReadRelations() = %v, want none after expiry", rels)
+	}
+
+	// An expired relationship no longer blocks creating it again.
+	if _, err := e.CreateRelations(ctx, doc("1"), "guest", "user", "", []authz.ID{"alice"}, nil, now.Add(time.Hour)); err != nil {
+		t.Fatalf("CreateRelations() after expiry error: %v", err)
+	}
+	assertCheck(t, e, doc("1"), "view", "alice", nil, authz.PermissionshipAllowed)
+}
+
+func TestCreateExistingFails(t *testing.T) {
+	e := newTestEngine(t)
+	mustCreate(t, e, doc("1"), "owner", "user", "", "alice")
+
+	if _, err := e.CreateRelations(context.Background(), doc("1"), "owner", "user", "", []authz.ID{"bob", "alice"}, nil, time.Time{}); err == nil {
+		t.Fatal("expected error creating an existing relationship")
+	}
+	// The failed write must not have been partially applied.
+	assertCheck(t, e, doc("1"), "edit", "bob", nil, authz.PermissionshipDenied)
+}
+
+func TestWriteRelationships(t *testing.T) {
+	e := newTestEngine(t)
+	ctx := context.Background()
+	mustCreate(t, e, doc("1"), "owner", "user", "", "alice")
+	owner := func(id authz.ID) authz.RelationshipObject {
+		return authz.RelationshipObject{Resource: doc("1"), Relation: "owner", SubjectType: "user", SubjectID: id}
+	}
+
+	var batch authz.WriteBatch
+	batch.Create(authz.RelationshipObject{Resource: group("eng"), Relation: "member", SubjectType: "user", SubjectID: "bob"})
+	batch.Touch(owner("alice"))
+	batch.Delete(owner("carol"))
+	batch.Create(owner("alice"))
+	if _, err := e.WriteRelationships(ctx, batch.Updates()); err == nil || !strings.Contains(err.Error(), "more than once") {
+		t.Fatalf("WriteRelationships() with a duplicate error = %v, want more than once", err)
+	}
+
+	batch = authz.WriteBatch{}
+	batch.Create(authz.RelationshipObject{Resource: group("eng"), Relation: "member", SubjectType: "user", SubjectID: "bob"})
+	batch.Create(owner("alice"))
+	if _, err := e.WriteRelationships(ctx, batch.Updates()); err == nil {
+		t.Fatal("expected error creating an existing relationship")
+	}
+	// The failed write must not have been partially applied.
+	assertCheck(t, e, group("eng"), "member", "bob", nil, authz.PermissionshipDenied)
+
+	batch = authz.WriteBatch{}
+	batch.Create(authz.RelationshipObject{Resource: group("eng"), Relation: "member", SubjectType: "user", SubjectID: "bob"})
+	batch.Touch(owner("alice"))
+	batch.Touch(owner("carol"))
+	batch.Delete(owner("dave"))
+	token, err := e.WriteRelationships(ctx, batch.Updates())
+	if err != nil {
+		t.Fatalf("WriteRelationships() error: %v", err)
+	}
+	if token == "" {
+		t.Error("WriteRelationships() returned an empty token")
+	}
+	assertCheck(t, e, group("eng"), "member", "bob", nil, authz.PermissionshipAllowed)
+	assertCheck(t, e, doc("1"), "edit", "alice", nil, authz.PermissionshipAllowed)
+	assertCheck(t, e, doc("1"), "edit", "carol", nil, authz.PermissionshipAllowed)
+
+	batch = authz.WriteBatch{}
+	batch.Delete(owner("alice"))
+	if _, err := e.WriteRelationships(ctx, batch.Updates()); err != nil {
+		t.Fatalf("WriteRelationships() error: %v", err)
+	}
+	assertCheck(t, e, doc("1"), "edit", "alice", nil, authz.PermissionshipDenied)
+}
+
+func TestWritePreconditions(t *testing.T) {
+	e := newTestEngine(t)
+	ctx := context.Background()
+	noOwner := authz.Precondition{
+		Operation: authz.PreconditionMustNotMatch,
+		Filter:    authz.RelationshipFilter{ResourceType: "document", ResourceID: "1", Relation: "owner"},
+	}
+
+	if _, err := e.CreateRelations(ctx, doc("1"), "owner", "user", "", []authz.ID{"alice"}, nil, time.Time{}, noOwner); err != nil {
+		t.Fatalf("CreateRelations() error: %v", err)
+	}
+	_, err := e.CreateRelations(ctx, doc("1"), "owner", "user", "", []authz.ID{"bob"}, nil, time.Time{}, noOwner)
+	var failed *authz.PreconditionFailedError
+	if !errors.As(err, &failed) || failed.Precondition == nil || *failed.Precondition != noOwner {
+		t.Fatalf("CreateRelations() error = %v, want a PreconditionFailedError for %+v", err, noOwner)
+	}
+	assertCheck(t, e, doc("1"), "edit", "bob", nil, authz.PermissionshipDenied)
+
+	aliceOwns := authz.Precondition{
+		Operation: authz.PreconditionMustMatch,
+		Filter:    authz.RelationshipFilter{ResourceType: "document", ResourceID: "1", Relation: "owner", SubjectType: "user", SubjectID: "alice"},
+	}
+	var batch authz.WriteBatch
+	batch.Create(authz.RelationshipObject{Resource: doc("1"), Relation: "editor", SubjectType: "user", SubjectID: "bob"})
+	batch.Require(aliceOwns)
+	if _, err := e.WriteRelationships(ctx, batch.Updates(), batch.Preconditions()...); err != nil {
+		t.Fatalf("WriteRelationships() error: %v", err)
+	}
+	assertCheck(t, e, doc("1"), "edit", "bob", nil, authz.PermissionshipAllowed)
+
+	if _, err := e.DeleteRelations(ctx, doc("1"), "owner", "user", "", []authz.ID{"alice"}); err != nil {
+		t.Fatalf("DeleteRelations() error: %v", err)
+	}
+	if _, err := e.DeleteRelations(ctx, doc("1"), "editor", "user", "", []authz.ID{"bob"}, aliceOwns); !errors.As(err, &failed) {
+		t.Fatalf("DeleteRelations() error = %v, want a PreconditionFailedError", err)
+	}
+	assertCheck(t, e, doc("1"), "edit", "bob", nil, authz.PermissionshipAllowed)
+}
+
+func TestTouchRelations(t *testing.T) {
+	e := newTestEngine(t)
+	ctx := context.Background()
+	mustCreate(t, e, doc("1"), "owner", "user", "", "alice")
+
+	if _, err := e.TouchRelations(ctx, doc("1"), "owner", "user", "", []authz.ID{"alice", "bob"}, nil, time.Time{}); err != nil {
+		t.Fatalf("TouchRelations() error: %v", err)
+	}
+	// Touching again is idempotent.
+	if _, err := e.TouchRelations(ctx, doc("1"), "owner", "user", "", []authz.ID{"alice", "bob"}, nil, time.Time{}); err != nil {
+		t.Fatalf("TouchRelations() retry error: %v", err)
+	}
+	assertCheck(t, e, doc("1"), "edit", "bob", nil, authz.PermissionshipAllowed)
+
+	// Touch overwrites the caveat of an existing relationship.
+	caveat := &authz.Caveat{Name: "ip_allowed", Context: map[string]any{"allowed_cidr": "10.0.0.0/8"}}
+	mustCreate(t, e, doc("1"), "editor", "user", "", "carol")
+	if _, err := e.TouchRelations(ctx, doc("1"), "editor", "user", "", []authz.ID{"carol"}, caveat, time.Time{}); err != nil {
+		t.Fatalf("TouchRelations() error: %v", err)
+	}
+	rels, err := e.ReadRelations(ctx, doc("1"), "editor", "user", "")
+	if err != nil {
+		t.Fatalf("ReadRelations() error: %v", err)
+	}
+	if len(rels) != 1 || !reflect.DeepEqual(rels[0].Caveat, caveat) {
+		t.Errorf("ReadRelations() = %+v, want carol with the ip_allowed caveat", rels)
+	}
+}
+
+func TestReadDeleteAndTokens(t *testing.T) {
+	e := newTestEngine(t)
+	ctx := context.Background()
+
+	first, err := e.CreateRelations(ctx, doc("1"), "viewer", "user", "", []authz.ID{"b", "a"}, nil, time.Time{})
+	if err != nil {
+		t.Fatalf("CreateRelations() error: %v", err)
+	}
+	mustCreate(t, e, doc("1"), "viewer", "group", "member", "eng")
+
+	rels, err := e.ReadRelations(ctx, doc("1"), "viewer", "user", "")
+	if err != nil {
+		t.Fatalf("ReadRelations() error: %v", err)
+	}
+	if ids := subjectIDs(rels); !reflect.DeepEqual(ids, []authz.ID{"a", "b"}) {
+		t.Errorf("ReadRelations() = %v, want [a b]", ids)
+	}
+	rels, _ = e.ReadRelations(ctx, doc("1"), "viewer", "group", "member")
+	if ids := subjectIDs(rels); !reflect.DeepEqual(ids, []authz.ID{"eng"}) || rels[0].SubjectRelation != "member" {
+		t.Errorf("ReadRelations(group#member) = %+v, want group:eng#member", rels)
+	}
+
+	second, err := e.DeleteRelations(ctx, doc("1"), "viewer", "user", "", []authz.ID{"a"})
+	if err != nil {
+		t.Fatalf("DeleteRelations() error: %v", err)
+	}
+	if first == "" || second == "" || first == second {
+		t.Errorf("expected distinct non-empty tokens, got %q and %q", first, second)
+	}
+	assertCheck(t, e, doc("1"), "view", "a", nil, authz.PermissionshipDenied)
+	assertCheck(t, e, doc("1"), "view", "b", nil, authz.PermissionshipAllowed)
+}
+
+func TestLookupPagesAndStreams(t *testing.T) {
+	e := newTestEngine(t)
+	ctx := context.Background()
+	for _, id := range []string{"1", "2", "3", "4", "5"} {
+		mustCreate(t, e, doc(id), "viewer", "user", "", "alice")
+	}
+
+	var pages [][]authz.ID
+	var cursor authz.Cursor
+	for {
+		ids, next, err := e.LookupResourcesPage(ctx, "document", "view", "user", "alice", 2, cursor)
+		if err != nil {
+			t.Fatalf("LookupResourcesPage() error: %v", err)
+		}
+		pages = append(pages, ids)
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	want := [][]authz.ID{{"1", "2"}, {"3", "4"}, {"5"}}
+	if !reflect.DeepEqual(pages, want) {
+		t.Errorf("LookupResourcesPage() pages = %v, want %v", pages, want)
+	}
+
+	var streamed []authz.ID
+	for id, err := range e.LookupResourcesSeq(ctx, "document", "view", "user", "alice") {
+		if err != nil {
+			t.Fatalf("LookupResourcesSeq() error: %v", err)
+		}
+		streamed = append(streamed, id)
+		if len(streamed) == 3 {
+			break
+		}
+	}
+	if !reflect.DeepEqual(streamed, []authz.ID{"1", "2", "3"}) {
+		t.Errorf("LookupResourcesSeq() with early stop = %v, want [1 2 3]", streamed)
+	}
+
+	mustCreate(t, e, doc("1"), "viewer", "user", "", "bob", "carol")
+	rels, next, err := e.ReadRelationsPage(ctx, doc("1"), "viewer", "user", "", 2, "")
+	if err != nil {
+		t.Fatalf("ReadRelationsPage() error: %v", err)
+	}
+	if ids := subjectIDs(rels); !reflect.DeepEqual(ids, []authz.ID{"alice", "bob"}) || next != "bob" {
+		t.Errorf("ReadRelationsPage() = %v, %q, want [alice bob], \"bob\"", ids, next)
+	}
+	rels, next, _ = e.ReadRelationsPage(ctx, doc("1"), "viewer", "user", "", 2, next)
+	if ids := subjectIDs(rels); !reflect.DeepEqual(ids, []authz.ID{"carol"}) || next != "" {
+		t.Errorf("ReadRelationsPage() second page = %v, %q, want [carol] and no cursor", ids, next)
+	}
+
+	var errs int
+	for _, err := range e.LookupSubjectsSeq(ctx, doc("1"), "missing", "user") {
+		if err != nil {
+			errs++
+		}
+	}
+	if errs != 1 {
+		t.Errorf("LookupSubjectsSeq() for an unknown permission yielded %d errors, want 1", errs)
+	}
+}
+
+func TestDeleteRelationships(t *testing.T) {
+	e := newTestEngine(t)
+	ctx := context.Background()
+	mustCreate(t, e, doc("1"), "owner", "user", "", "alice")
+	mustCreate(t, e, doc("1"), "viewer", "user", "", "bob", "carol")
+	mustCreate(t, e, doc("1"), "viewer", "group", "member", "eng")
+	mustCreate(t, e, doc("2"), "viewer", "user", "", "bob")
+	mustCreate(t, e, group("eng"), "member", "user", "", "bob")
+
+	if _, err := e.DeleteRelationships(ctx, authz.RelationshipFilter{ResourceType: "document", ResourceID: "1"}, authz.DeleteOptions{Limit: 2}); err == nil {
+		t.Fatal("expected error deleting more relationships than the limit")
+	}
+
+	result, err := e.DeleteRelationships(ctx, authz.RelationshipFilter{ResourceType: "document", ResourceID: "1"}, authz.DeleteOptions{Limit: 2, AllowPartial: true})
+	if err != nil {
+		t.Fatalf("DeleteRelationships() error: %v", err)
+	}
+	if result.Deleted != 2 || result.Complete || result.Token == "" {
+		t.Errorf("partial DeleteRelationships() = %+v, want 2 deleted and incomplete", result)
+	}
+
+	result, err = e.DeleteRelationships(ctx, authz.RelationshipFilter{ResourceType: "document", ResourceID: "1"}, authz.DeleteOptions{})
+	if err != nil {
+		t.Fatalf("DeleteRelationships() error: %v", err)
+	}
+	if result.Deleted != 2 || !result.Complete {
+		t.Errorf("DeleteRelationships() = %+v, want the remaining 2 deleted", result)
+	}
+	remaining, _ := e.ExportBulkRelationships(ctx, authz.RelationshipFilter{ResourceType: "document", ResourceID: "1"})
+	if len(remaining) != 0 {
+		t.Errorf("relationships left on document:1: %+v", remaining)
+	}
+
+	// Removing a subject everywhere leaves other subjects alone.
+	for _, resourceType := range []string{"document", "group"} {
+		if _, err := e.DeleteRelationships(ctx, authz.RelationshipFilter{ResourceType: resourceType, SubjectType: "user", SubjectID: "bob"}, authz.DeleteOptions{}); err != nil {
+			t.Fatalf("DeleteRelationships() error: %v", err)
+		}
+	}
+	if remaining, _ := e.ExportBulkRelationships(ctx, authz.RelationshipFilter{}); len(remaining) != 0 {
+		t.Errorf("relationships left after removing bob: %+v", remaining)
+	}
+
+	if _, err := e.DeleteRelationships(ctx, authz.RelationshipFilter{}, authz.DeleteOptions{}); err == nil {
+		t.Error("expected error deleting without a resource type")
+	}
+}
+
+func TestDeleteRelationshipsSkipsExpired(t *testing.T) {
+	e := newTestEngine(t)
+	ctx := context.Background()
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	e.now = func() time.Time { return now }
+
+	start, err := e.CreateRelations(ctx, doc("1"), "guest", "user", "", []authz.ID{"alice"}, nil, now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("CreateRelations() error: %v", err)
+	}
+	if _, err := e.CreateRelations(ctx, doc("1"), "guest", "user", "", []authz.ID{"bob", "carol"}, nil, now.Add(2*time.Hour)); err != nil {
+		t.Fatalf("CreateRelations() error: %v", err)
+	}
+	now = now.Add(90 * time.Minute)
+
+	// Only bob and carol are left, so they fit the limit even without a partial delete.
+	result, err := e.DeleteRelationships(ctx, authz.RelationshipFilter{ResourceType: "document", Relation: "guest"}, authz.DeleteOptions{Limit: 2})
+	if err != nil {
+		t.Fatalf("DeleteRelationships() error: %v", err)
+	}
+	if result.Deleted != 2 || !result.Complete {
+		t.Errorf("DeleteRelationships() = %+v, want 2 deleted and complete", result)
+	}
+
+	for event, err := range e.Watch(ctx, start, "document") {
+		if err != nil {
+			t.Fatalf("Watch() error: %v", err)
+		}
+		if event.Token != result.Token {
+			continue
+		}
+		var deleted []string
+		for _, c := range event.Changes {
+			deleted = append(deleted, string(c.Relationship.SubjectID))
+		}
+		if got := strings.Join(deleted, ","); got != "bob,carol" {
+			t.Errorf("deleted subjects = %s, want bob,carol", got)
+		}
+		break
+	}
+}
+
+func TestWatch(t *testing.T) {
+	e := newTestEngine(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	start, err := e.CreateRelations(ctx, doc("1"), "owner", "user", "", []authz.ID{"alice"}, nil, time.Time{})
+	if err != nil {
+		t.Fatalf("CreateRelations() error: %v", err)
+	}
+	mustCreate(t, e, group("eng"), "member", "user", "", "bob")
+	deleted, err := e.DeleteRelations(ctx, doc("1"), "owner", "user", "", []authz.ID{"alice", "nobody"})
+	if err != nil {
+		t.Fatalf("DeleteRelations() error: %v", err)
+	}
+
+	events := make(chan authz.WatchEvent)
+	go func() {
+		defer close(events)
+		for event, err := range e.Watch(ctx, start, "document") {
+			if err != nil {
+				t.Errorf("Watch() error: %v", err)
+				return
+			}
+			events <- event
+		}
+	}()
+
+	// The group write is filtered out, and deleting a missing relationship is not a change.
+	event := <-events
+	wantChanges := []authz.RelationshipChange{{
+		Operation:    authz.WriteDelete,
+		Relationship: authz.RelationshipObject{Resource: doc("1"), Relation: "owner", SubjectType: "user", SubjectID: "alice"},
+	}}
+	if event.Token != deleted || !reflect.DeepEqual(event.Changes, wantChanges) {
+		t.Errorf("first event = %+v, want the delete at %q", event, deleted)
+	}
+
+	// A watcher waiting for changes wakes up on the next write.
+	touched, err := e.TouchRelations(ctx, doc("2"), "viewer", "user", "", []authz.ID{"carol"}, nil, time.Time{})
+	if err != nil {
+		t.Fatalf("TouchRelations() error: %v", err)
+	}
+	event = <-events
+	if event.Token != touched || len(event.Changes) != 1 || event.Changes[0].Operation != authz.WriteTouch || event.Changes[0].Relationship.SubjectID != "carol" {
+		t.Errorf("second event = %+v, want the touch of carol at %q", event, touched)
+	}
+
+	cancel()
+	if _, ok := <-events; ok {
+		t.Error("Watch() yielded an event after its context was canceled")
+	}
+
+	for _, err := range e.Watch(context.Background(), "999") {
+		if err == nil {
+			t.Error("expected error watching from an unknown token")
+		}
+		break
+	}
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	src := newTestEngine(t)
+	ctx := context.Background()
+	mustCreate(t, src, doc("1"), "viewer", "group", "member", "eng")
+	mustCreate(t, src, group("eng"), "member", "user", "", "alice")
+	caveat := &authz.Caveat{Name: "ip_allowed", Context: map[string]any{"allowed_cidr": "10.0.0.0/8"}}
+	if _, err := src.CreateRelations(ctx, doc("1"), "editor", "user", "", []authz.ID{"bob"}, caveat, time.Time{}); err != nil {
+		t.Fatalf("CreateRelations() error: %v", err)
+	}
+
+	exported, err := src.ExportBulkRelationships(ctx, authz.RelationshipFilter{})
+	if err != nil {
+		t.Fatalf("ExportBulkRelationships() error: %v", err)
+	}
+	if len(exported) != 3 {
+		t.Fatalf("exported %d relationships, want 3", len(exported))
+	}
+
+	filtered, _ := src.ExportBulkRelationships(ctx, authz.RelationshipFilter{ResourceType: "document", SubjectType: "group"})
+	if len(filtered) != 1 || filtered[0].SubjectRelation != "member" {
+		t.Errorf("filtered export = %+v, want the document#viewer@group:eng#member relationship", filtered)
+	}
+
+	dst := newTestEngine(t)
+	if err := dst.ImportBulkRelationships(ctx, exported); err != nil {
+		t.Fatalf("ImportBulkRelationships() error: %v", err)
+	}
+	reexported, _ := dst.ExportBulkRelationships(ctx, authz.RelationshipFilter{})
+	if !reflect.DeepEqual(exported, reexported) {
+		t.Errorf("round trip mismatch:\n got: %+v\nwant: %+v", reexported, exported)
+	}
+
+	if err := dst.ImportBulkRelationships(ctx, exported[:1]); err == nil {
+		t.Error("expected error importing an existing relationship")
+	}
+}
+
+func TestCheckBulkPermission(t *testing.T) {
+	e := newTestEngine(t)
+	mustCreate(t, e, doc("1"), "owner", "user", "", "alice")
+
+	got, err := e.CheckBulkPermission(context.Background(), []authz.PermissionCheck{
+		{Resource: doc("1"), Permission: "edit", SubjectType: "user", SubjectID: "alice"},
+		{Resource: doc("1"), Permission: "edit", SubjectType: "user", SubjectID: "bob"},
+		{Resource: doc("1"), Permission: "nope", SubjectType: "user", SubjectID: "alice"},
+	})
+	if err != nil {
+		t.Fatalf("CheckBulkPermission() error: %v", err)
+	}
+	if len(got) != 3 {
+		t.Fatalf("CheckBulkPermission() returned %d results, want 3", len(got))
+	}
+	if !got[0].Allowed() || got[0].Err != nil {
+		t.Errorf("result 0 = %+v, want allowed", got[0])
+	}
+	if !got[1].Denied() || got[1].Err != nil {
+		t.Errorf("result 1 = %+v, want denied", got[1])
+	}
+	if got[2].Err == nil || got[2].Allowed() {
+		t.Errorf("result 2 = %+v, want an error for the unknown permission", got[2])
+	}
+
+	tooMany := make([]authz.PermissionCheck, authz.MaxBulkCheckItems+1)
+	for i := range tooMany {
+		tooMany[i] = authz.PermissionCheck{Resource: doc("1"), Permission: "edit", SubjectType: "user", SubjectID: "alice"}
+	}
+	if _, err := e.CheckBulkPermission(context.Background(), tooMany); err == nil {
+		t.Errorf("CheckBulkPermission() of %d items succeeded, want an error", len(tooMany))
+	}
+}
+
+func TestCheckCycleExceedsDepth(t *testing.T) {
+	e := newTestEngine(t)
+	mustCreate(t, e, group("a"), "member", "group", "member", "b")
+	mustCreate(t, e, group("b"), "member", "group", "member", "a")
+
+	if _, err := e.CheckPermission(context.Background(), group("a"), "member", "user", "alice", nil); err == nil {
+		t.Fatal("expected max depth error for cyclic subject sets")
+	}
+}
+
+func TestNewEngineSchemaErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+	}{
+		{"syntax", "definition user {"},
+		{"undefined subject type", "definition doc { relation viewer: user }"},
+		{"undefined relation in permission", "definition user {} definition doc { permission view = viewer }"},
+		{"undefined arrow relation", "definition user {} definition doc { permission view = parent->view }"},
+		{"undefined subject relation", "definition group {} definition doc { relation viewer: group#member }"},
+		{"bad caveat expression", "caveat c(a int) { a + }"},
+		{"non-bool caveat", "caveat c(a int) { a + 1 }"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewEngine(tt.schema); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
+
+func TestNewEngineRejectsImportsAndPartials(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+		want   string
+	}{
+		{"import", `import "./common.zed"
+
+definition user {}`, `import "./common.zed" at line 1, column 8: the in-memory engine does not resolve imports`},
+		{"partial", `definition user {}
+
+partial owned {
+	relation owner: user
+}`, "partial owned at line 3, column 9: the in-memory engine does not support partials"},
+		{"partial reference", `definition user {}
+
+definition document {
+	...owned
+}`, "partial reference ...owned at line 4, column 5: the in-memory engine does not support partials"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewEngine(tt.schema)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("NewEngine() error = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
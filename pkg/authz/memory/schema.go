@@ -0,0 +1,110 @@
+package memory
+
+import (
+	"fmt"
+
+	"github.com/oitnes/authzed-codegen/internal/generator/ast"
+	"github.com/oitnes/authzed-codegen/internal/generator/validator"
+	"github.com/oitnes/authzed-codegen/pkg/authz"
+)
+
+// schema is the evaluated form of an ast.Schema.
+type schema struct {
+	definitions map[authz.Type]*definition
+	caveats     map[authz.CaveatName]*caveat
+}
+
+// definition indexes the relations and permissions of one object type.
+type definition struct {
+	name        authz.Type
+	relations   map[authz.Relation]*ast.Relation
+	permissions map[authz.Relation]ast.Expr
+}
+
+// hasMember reports whether name is a relation or permission of the definition.
+func (d *definition) hasMember(name authz.Relation) bool {
+	_, isRelation := d.relations[name]
+	_, isPermission := d.permissions[name]
+	return isRelation || isPermission
+}
+
+// compileSchema validates the schema the way SpiceDB does when it is written, then
+// indexes it and compiles its caveats.
+func compileSchema(s *ast.Schema) (*schema, error) {
+	if err := validator.Validate(s); err != nil {
+		return nil, err
+	}
+
+	compiled := &schema{
+		definitions: make(map[authz.Type]*definition),
+		caveats:     make(map[authz.CaveatName]*caveat),
+	}
+
+	for _, c := range s.Caveats {
+		cv, err := compileCaveat(c)
+		if err != nil {
+			return nil, err
+		}
+		compiled.caveats[authz.CaveatName(c.Name)] = cv
+	}
+
+	for _, def := range s.Definitions {
+		d := &definition{
+			name:        authz.Type(def.Name),
+			relations:   make(map[authz.Relation]*ast.Relation),
+			permissions: make(map[authz.Relation]ast.Expr),
+		}
+		for _, rel := range def.Relations {
+			d.relations[authz.Relation(rel.Name)] = rel
+		}
+		for _, perm := range def.Permissions {
+			d.permissions[authz.Relation(perm.Name)] = perm.Expression
+		}
+		compiled.definitions[d.name] = d
+	}
+
+	return compiled, nil
+}
+
+// validateRelationship reports whether a relationship may be written under the schema,
+// returning an error that names the offending part when it may not.
+func (s *schema) validateRelationship(r relationship) error {
+	def, ok := s.definitions[r.resource.Type]
+	if !ok {
+		return fmt.Errorf("object definition %q not found", r.resource.Type)
+	}
+	rel, ok := def.relations[r.relation]
+	if !ok {
+		if _, isPermission := def.permissions[r.relation]; isPermission {
+			return fmt.Errorf("cannot write a relationship to permission %s#%s", r.resource.Type, r.relation)
+		}
+		return fmt.Errorf("relation %s#%s not found", r.resource.Type, r.relation)
+	}
+	if r.resource.ID == "" || r.subject.id == "" {
+		return fmt.Errorf("relationship %s has an empty object id", r)
+	}
+	if r.resource.ID == "*" {
+		return fmt.Errorf("relationship %s uses a wildcard resource id", r)
+	}
+
+	wildcard := r.subject.id == "*"
+	if wildcard && r.subject.relation != "" {
+		return fmt.Errorf("relationship %s uses a wildcard subject with a relation", r)
+	}
+
+	var caveatName string
+	if r.caveat != nil {
+		caveatName = string(r.caveat.Name)
+	}
+	for _, st := range rel.SubjectTypes {
+		if authz.Type(st.TypeName) == r.subject.typ &&
+			authz.Relation(st.Relation) == r.subject.relation &&
+			st.IsWildcard == wildcard &&
+			st.Caveat == caveatName &&
+			st.Expiration == !r.expiresAt.IsZero() {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("subject %s is not allowed on relation %s#%s", r.subjectString(), r.resource.Type, r.relation)
+}
@@ -0,0 +1,56 @@
+package authz
+
+import "fmt"
+
+// PreconditionOperation says whether a precondition requires matching relationships to
+// exist or to be absent.
+type PreconditionOperation int
+
+const (
+	// PreconditionMustMatch requires at least one relationship to match the filter.
+	PreconditionMustMatch PreconditionOperation = iota
+	// PreconditionMustNotMatch requires that no relationship matches the filter.
+	PreconditionMustNotMatch
+)
+
+// String returns a lower-case description of the operation.
+func (o PreconditionOperation) String() string {
+	switch o {
+	case PreconditionMustMatch:
+		return "must match"
+	case PreconditionMustNotMatch:
+		return "must not match"
+	default:
+		return fmt.Sprintf("PreconditionOperation(%d)", int(o))
+	}
+}
+
+// Precondition makes a write conditional on the relationships that exist when it is
+// applied. Preconditions are evaluated atomically with the write, so they can guard
+// against races such as two subjects claiming ownership at once.
+type Precondition struct {
+	Operation PreconditionOperation
+	Filter    RelationshipFilter
+}
+
+// PreconditionFailedError is returned by a write whose preconditions did not hold.
+// Nothing was written. Use errors.As to detect it.
+type PreconditionFailedError struct {
+	// Precondition is the precondition that failed, when the engine reports which one.
+	Precondition *Precondition
+	// Err is the underlying engine error, if any.
+	Err error
+}
+
+func (e *PreconditionFailedError) Error() string {
+	switch {
+	case e.Precondition != nil:
+		return fmt.Sprintf("write precondition failed: relationships %s %+v", e.Precondition.Operation, e.Precondition.Filter)
+	case e.Err != nil:
+		return "write precondition failed: " + e.Err.Error()
+	default:
+		return "write precondition failed"
+	}
+}
+
+func (e *PreconditionFailedError) Unwrap() error { return e.Err }
@@ -0,0 +1,106 @@
+package spicedb
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	v1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	"github.com/oitnes/authzed-codegen/pkg/authz"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// caveatToProto converts an authz caveat into the SpiceDB wire form. A nil caveat yields nil.
+func caveatToProto(caveat *authz.Caveat) (*v1.ContextualizedCaveat, error) {
+	if caveat == nil {
+		return nil, nil
+	}
+
+	caveatContext, err := contextToStruct(caveat.Context)
+	if err != nil {
+		return nil, fmt.Errorf("caveat %s: %w", caveat.Name, err)
+	}
+
+	return &v1.ContextualizedCaveat{
+		CaveatName: string(caveat.Name),
+		Context:    caveatContext,
+	}, nil
+}
+
+// caveatFromProto converts a SpiceDB caveat into its authz form. A nil caveat yields nil.
+func caveatFromProto(caveat *v1.ContextualizedCaveat) *authz.Caveat {
+	if caveat == nil {
+		return nil
+	}
+
+	return &authz.Caveat{
+		Name:    authz.CaveatName(caveat.CaveatName),
+		Context: caveat.Context.AsMap(),
+	}
+}
+
+// contextToStruct converts a caveat context map into a protobuf Struct. Values that structpb
+// does not understand natively (typed slices and maps, time.Time, time.Duration) are normalized
+// to the representation SpiceDB expects. An empty context yields nil.
+func contextToStruct(caveatContext map[string]any) (*structpb.Struct, error) {
+	if len(caveatContext) == 0 {
+		return nil, nil
+	}
+
+	normalized := make(map[string]any, len(caveatContext))
+	for key, value := range caveatContext {
+		v, err := normalizeContextValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("context field %q: %w", key, err)
+		}
+		normalized[key] = v
+	}
+
+	return structpb.NewStruct(normalized)
+}
+
+func normalizeContextValue(value any) (any, error) {
+	switch v := value.(type) {
+	case nil, bool, string, []byte, int, int32, int64, uint, uint32, uint64, float32, float64:
+		return v, nil
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano), nil
+	case time.Duration:
+		return v.String(), nil
+	}
+
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Pointer:
+		if rv.IsNil() {
+			return nil, nil
+		}
+		return normalizeContextValue(rv.Elem().Interface())
+	case reflect.Slice, reflect.Array:
+		list := make([]any, rv.Len())
+		for i := range list {
+			item, err := normalizeContextValue(rv.Index(i).Interface())
+			if err != nil {
+				return nil, err
+			}
+			list[i] = item
+		}
+		return list, nil
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("map keys must be strings, got %s", rv.Type().Key())
+		}
+		m := make(map[string]any, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			item, err := normalizeContextValue(iter.Value().Interface())
+			if err != nil {
+				return nil, err
+			}
+			m[iter.Key().String()] = item
+		}
+		return m, nil
+	}
+
+	return nil, fmt.Errorf("unsupported value type %T", value)
+}
@@ -2,21 +2,25 @@ package spicedb
 
 import (
 	"context"
-	"io"
+	"fmt"
+	"time"
 
 	v1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
 	"github.com/authzed/authzed-go/v1"
 	"github.com/authzed/grpcutil"
 	"github.com/oitnes/authzed-codegen/pkg/authz"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 // Engine implements authz.Engine using a SpiceDB client.
 type Engine struct {
-	client *authzed.Client
+	client             *authzed.Client
+	defaultConsistency authz.Consistency
 }
 
 // NewEngine creates a SpiceDB-backed Engine by connecting to the given endpoint
@@ -40,6 +44,15 @@ func NewEngineWithClient(client *authzed.Client) *Engine {
 	return &Engine{client: client}
 }
 
+// WithConsistency returns a copy of the Engine that uses c for reads and checks
+// whose context carries no consistency of its own (see authz.WithConsistency).
+// Engines default to full consistency.
+func (e *Engine) WithConsistency(c authz.Consistency) *Engine {
+	clone := *e
+	clone.defaultConsistency = c
+	return &clone
+}
+
 // ReadSchema returns the current schema text, or an empty string if no schema
 // has been written yet.
 func (e *Engine) ReadSchema(ctx context.Context) (string, error) {
@@ -73,11 +86,27 @@ func (e *Engine) EnsureSchema(ctx context.Context, schema string) error {
 	return e.WriteSchema(ctx, schema)
 }
 
-func (e *Engine) CreateRelations(ctx context.Context, resource authz.Resource, relation authz.Relation, subjectType authz.Type, subjectIDs []authz.ID) error {
+func (e *Engine) CreateRelations(ctx context.Context, resource authz.Resource, relation authz.Relation, subjectType authz.Type, subjectRelation authz.Relation, subjectIDs []authz.ID, caveat *authz.Caveat, expiresAt time.Time, preconditions ...authz.Precondition) (authz.ZedToken, error) {
+	return e.putRelations(ctx, v1.RelationshipUpdate_OPERATION_CREATE, resource, relation, subjectType, subjectRelation, subjectIDs, caveat, expiresAt, preconditions)
+}
+
+// TouchRelations writes relationships with OPERATION_TOUCH, creating them or overwriting
+// the caveat and expiry of existing ones.
+func (e *Engine) TouchRelations(ctx context.Context, resource authz.Resource, relation authz.Relation, subjectType authz.Type, subjectRelation authz.Relation, subjectIDs []authz.ID, caveat *authz.Caveat, expiresAt time.Time, preconditions ...authz.Precondition) (authz.ZedToken, error) {
+	return e.putRelations(ctx, v1.RelationshipUpdate_OPERATION_TOUCH, resource, relation, subjectType, subjectRelation, subjectIDs, caveat, expiresAt, preconditions)
+}
+
+// putRelations writes one relationship per subject ID with the given create or touch operation.
+func (e *Engine) putRelations(ctx context.Context, op v1.RelationshipUpdate_Operation, resource authz.Resource, relation authz.Relation, subjectType authz.Type, subjectRelation authz.Relation, subjectIDs []authz.ID, caveat *authz.Caveat, expiresAt time.Time, preconditions []authz.Precondition) (authz.ZedToken, error) {
+	optionalCaveat, err := caveatToProto(caveat)
+	if err != nil {
+		return "", err
+	}
+
 	updates := make([]*v1.RelationshipUpdate, len(subjectIDs))
 	for i, id := range subjectIDs {
 		updates[i] = &v1.RelationshipUpdate{
-			Operation: v1.RelationshipUpdate_OPERATION_CREATE,
+			Operation: op,
 			Relationship: &v1.Relationship{
 				Resource: &v1.ObjectReference{
 					ObjectType: string(resource.Type),
@@ -89,51 +118,22 @@ func (e *Engine) CreateRelations(ctx context.Context, resource authz.Resource, r
 						ObjectType: string(subjectType),
 						ObjectId:   string(id),
 					},
+					OptionalRelation: string(subjectRelation),
 				},
+				OptionalCaveat:    optionalCaveat,
+				OptionalExpiresAt: expiresAtToProto(expiresAt),
 			},
 		}
 	}
 
-	_, err := e.client.WriteRelationships(ctx, &v1.WriteRelationshipsRequest{
-		Updates: updates,
-	})
-	return err
+	return e.writeRelationships(ctx, updates, preconditions)
 }
 
-func (e *Engine) ReadRelations(ctx context.Context, resource authz.Resource, relation authz.Relation, subjectType authz.Type) ([]authz.ID, error) {
-	stream, err := e.client.ReadRelationships(ctx, &v1.ReadRelationshipsRequest{
-		RelationshipFilter: &v1.RelationshipFilter{
-			ResourceType:       string(resource.Type),
-			OptionalResourceId: string(resource.ID),
-			OptionalRelation:   string(relation),
-			OptionalSubjectFilter: &v1.SubjectFilter{
-				SubjectType: string(subjectType),
-			},
-		},
-		Consistency: &v1.Consistency{
-			Requirement: &v1.Consistency_FullyConsistent{FullyConsistent: true},
-		},
-	})
-	if err != nil {
-		return nil, err
-	}
-
-	var ids []authz.ID
-	for {
-		resp, err := stream.Recv()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return nil, err
-		}
-		ids = append(ids, authz.ID(resp.Relationship.Subject.Object.ObjectId))
-	}
-
-	return ids, nil
+func (e *Engine) ReadRelations(ctx context.Context, resource authz.Resource, relation authz.Relation, subjectType authz.Type, subjectRelation authz.Relation) ([]authz.RelationshipObject, error) {
+	return collect(e.ReadRelationsSeq(ctx, resource, relation, subjectType, subjectRelation))
 }
 
-func (e *Engine) DeleteRelations(ctx context.Context, resource authz.Resource, relation authz.Relation, subjectType authz.Type, subjectIDs []authz.ID) error {
+func (e *Engine) DeleteRelations(ctx context.Context, resource authz.Resource, relation authz.Relation, subjectType authz.Type, subjectRelation authz.Relation, subjectIDs []authz.ID, preconditions ...authz.Precondition) (authz.ZedToken, error) {
 	updates := make([]*v1.RelationshipUpdate, len(subjectIDs))
 	for i, id := range subjectIDs {
 		updates[i] = &v1.RelationshipUpdate{
@@ -149,108 +149,193 @@ func (e *Engine) DeleteRelations(ctx context.Context, resource authz.Resource, r
 						ObjectType: string(subjectType),
 						ObjectId:   string(id),
 					},
+					OptionalRelation: string(subjectRelation),
 				},
 			},
 		}
 	}
 
-	_, err := e.client.WriteRelationships(ctx, &v1.WriteRelationshipsRequest{
-		Updates: updates,
-	})
-	return err
+	return e.writeRelationships(ctx, updates, preconditions)
 }
 
-func (e *Engine) CheckPermission(ctx context.Context, resource authz.Resource, permission authz.Permission, subjectType authz.Type, subjectID authz.ID) (bool, error) {
-	resp, err := e.client.CheckPermission(ctx, &v1.CheckPermissionRequest{
-		Resource: &v1.ObjectReference{
-			ObjectType: string(resource.Type),
-			ObjectId:   string(resource.ID),
-		},
-		Permission: string(permission),
-		Subject: &v1.SubjectReference{
-			Object: &v1.ObjectReference{
-				ObjectType: string(subjectType),
-				ObjectId:   string(subjectID),
-			},
-		},
-		Consistency: &v1.Consistency{
-			Requirement: &v1.Consistency_FullyConsistent{FullyConsistent: true},
-		},
-	})
+// deleteBatchSize is the number of relationships deleted per request when DeleteRelationships
+// is called without a limit. It matches SpiceDB's default maximum deletion limit.
+const deleteBatchSize = 1000
+
+// DeleteRelationships deletes matching relationships with SpiceDB's DeleteRelationships RPC.
+// Without a limit it deletes in partial batches until none match, so the deletion as a whole
+// is not atomic; each batch is.
+func (e *Engine) DeleteRelationships(ctx context.Context, filter authz.RelationshipFilter, opts authz.DeleteOptions, preconditions ...authz.Precondition) (authz.DeleteResult, error) {
+	protoPreconditions, err := preconditionsToProto(preconditions)
 	if err != nil {
-		return false, err
+		return authz.DeleteResult{}, err
+	}
+
+	req := &v1.DeleteRelationshipsRequest{
+		RelationshipFilter:            relationshipFilterToProto(filter),
+		OptionalPreconditions:         protoPreconditions,
+		OptionalLimit:                 opts.Limit,
+		OptionalAllowPartialDeletions: opts.AllowPartial,
+	}
+	if opts.Limit == 0 {
+		req.OptionalLimit = deleteBatchSize
+		req.OptionalAllowPartialDeletions = true
 	}
 
-	return resp.Permissionship == v1.CheckPermissionResponse_PERMISSIONSHIP_HAS_PERMISSION, nil
+	var result authz.DeleteResult
+	for {
+		resp, err := e.client.DeleteRelationships(ctx, req)
+		if err != nil {
+			if isPreconditionFailure(err) {
+				return result, &authz.PreconditionFailedError{Err: err}
+			}
+			return result, err
+		}
+		result.Token = authz.ZedToken(resp.GetDeletedAt().GetToken())
+		result.Deleted += resp.RelationshipsDeletedCount
+		result.Complete = resp.DeletionProgress != v1.DeleteRelationshipsResponse_DELETION_PROGRESS_PARTIAL
+		if result.Complete || opts.Limit != 0 {
+			return result, nil
+		}
+		// The preconditions held for the first batch; later batches would see its effects.
+		req.OptionalPreconditions = nil
+	}
 }
 
-func (e *Engine) LookupResources(ctx context.Context, resourceType authz.Type, permission authz.Permission, subjectType authz.Type, subjectID authz.ID) ([]authz.ID, error) {
-	stream, err := e.client.LookupResources(ctx, &v1.LookupResourcesRequest{
-		ResourceObjectType: string(resourceType),
-		Permission:         string(permission),
-		Subject: &v1.SubjectReference{
-			Object: &v1.ObjectReference{
-				ObjectType: string(subjectType),
-				ObjectId:   string(subjectID),
-			},
-		},
-		Consistency: &v1.Consistency{
-			Requirement: &v1.Consistency_FullyConsistent{FullyConsistent: true},
-		},
-	})
+// WriteRelationships applies all updates in a single atomic WriteRelationships call.
+func (e *Engine) WriteRelationships(ctx context.Context, updates []authz.RelationshipUpdate, preconditions ...authz.Precondition) (authz.ZedToken, error) {
+	protoUpdates := make([]*v1.RelationshipUpdate, len(updates))
+	for i, u := range updates {
+		rel, err := relationshipToProto(u.Relationship)
+		if err != nil {
+			return "", err
+		}
+		op, err := writeOperationToProto(u.Operation)
+		if err != nil {
+			return "", err
+		}
+		protoUpdates[i] = &v1.RelationshipUpdate{Operation: op, Relationship: rel}
+	}
+
+	return e.writeRelationships(ctx, protoUpdates, preconditions)
+}
+
+func writeOperationToProto(op authz.WriteOperation) (v1.RelationshipUpdate_Operation, error) {
+	switch op {
+	case authz.WriteCreate:
+		return v1.RelationshipUpdate_OPERATION_CREATE, nil
+	case authz.WriteTouch:
+		return v1.RelationshipUpdate_OPERATION_TOUCH, nil
+	case authz.WriteDelete:
+		return v1.RelationshipUpdate_OPERATION_DELETE, nil
+	default:
+		return v1.RelationshipUpdate_OPERATION_UNSPECIFIED, fmt.Errorf("unknown write operation %s", op)
+	}
+}
+
+// writeRelationships applies updates atomically if all preconditions hold and returns the
+// revision they were written at.
+func (e *Engine) writeRelationships(ctx context.Context, updates []*v1.RelationshipUpdate, preconditions []authz.Precondition) (authz.ZedToken, error) {
+	protoPreconditions, err := preconditionsToProto(preconditions)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
 
-	var ids []authz.ID
-	for {
-		resp, err := stream.Recv()
-		if err == io.EOF {
-			break
+	resp, err := e.client.WriteRelationships(ctx, &v1.WriteRelationshipsRequest{
+		Updates:               updates,
+		OptionalPreconditions: protoPreconditions,
+	})
+	if err != nil {
+		if isPreconditionFailure(err) {
+			return "", &authz.PreconditionFailedError{Err: err}
 		}
+		return "", err
+	}
+	return authz.ZedToken(resp.GetWrittenAt().GetToken()), nil
+}
+
+func preconditionsToProto(preconditions []authz.Precondition) ([]*v1.Precondition, error) {
+	protoPreconditions := make([]*v1.Precondition, len(preconditions))
+	for i, p := range preconditions {
+		op, err := preconditionOperationToProto(p.Operation)
 		if err != nil {
 			return nil, err
 		}
-		ids = append(ids, authz.ID(resp.ResourceObjectId))
+		protoPreconditions[i] = &v1.Precondition{Operation: op, Filter: relationshipFilterToProto(p.Filter)}
 	}
+	return protoPreconditions, nil
+}
 
-	return ids, nil
+func preconditionOperationToProto(op authz.PreconditionOperation) (v1.Precondition_Operation, error) {
+	switch op {
+	case authz.PreconditionMustMatch:
+		return v1.Precondition_OPERATION_MUST_MATCH, nil
+	case authz.PreconditionMustNotMatch:
+		return v1.Precondition_OPERATION_MUST_NOT_MATCH, nil
+	default:
+		return v1.Precondition_OPERATION_UNSPECIFIED, fmt.Errorf("unknown precondition operation %s", op)
+	}
 }
 
-func (e *Engine) LookupSubjects(ctx context.Context, resource authz.Resource, permission authz.Permission, subjectType authz.Type) ([]authz.ID, error) {
-	stream, err := e.client.LookupSubjects(ctx, &v1.LookupSubjectsRequest{
+// isPreconditionFailure reports whether err is SpiceDB's error for a write whose
+// preconditions did not hold. SpiceDB uses the same status code for schema violations,
+// so the error reason decides.
+func isPreconditionFailure(err error) bool {
+	st, ok := status.FromError(err)
+	if !ok || st.Code() != codes.FailedPrecondition {
+		return false
+	}
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok && info.Reason == v1.ErrorReason_ERROR_REASON_WRITE_OR_DELETE_PRECONDITION_FAILURE.String() {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *Engine) CheckPermission(ctx context.Context, resource authz.Resource, permission authz.Permission, subjectType authz.Type, subjectID authz.ID, caveatContext map[string]any) (authz.CheckResult, error) {
+	checkContext, err := contextToStruct(caveatContext)
+	if err != nil {
+		return authz.CheckResult{}, err
+	}
+
+	resp, err := e.client.CheckPermission(ctx, &v1.CheckPermissionRequest{
 		Resource: &v1.ObjectReference{
 			ObjectType: string(resource.Type),
 			ObjectId:   string(resource.ID),
 		},
-		Permission:        string(permission),
-		SubjectObjectType: string(subjectType),
-		Consistency: &v1.Consistency{
-			Requirement: &v1.Consistency_FullyConsistent{FullyConsistent: true},
+		Permission: string(permission),
+		Subject: &v1.SubjectReference{
+			Object: &v1.ObjectReference{
+				ObjectType: string(subjectType),
+				ObjectId:   string(subjectID),
+			},
 		},
+		Context:     checkContext,
+		Consistency: e.requestConsistency(ctx),
 	})
 	if err != nil {
-		return nil, err
+		return authz.CheckResult{}, err
 	}
 
-	var ids []authz.ID
-	for {
-		resp, err := stream.Recv()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return nil, err
-		}
-		ids = append(ids, authz.ID(resp.Subject.SubjectObjectId))
-	}
+	return checkResultFromProto(resp.Permissionship, resp.PartialCaveatInfo), nil
+}
+
+func (e *Engine) LookupResources(ctx context.Context, resourceType authz.Type, permission authz.Permission, subjectType authz.Type, subjectID authz.ID) ([]authz.ID, error) {
+	return collect(e.LookupResourcesSeq(ctx, resourceType, permission, subjectType, subjectID))
+}
 
-	return ids, nil
+func (e *Engine) LookupSubjects(ctx context.Context, resource authz.Resource, permission authz.Permission, subjectType authz.Type) ([]authz.ID, error) {
+	return collect(e.LookupSubjectsSeq(ctx, resource, permission, subjectType))
 }
 
-func (e *Engine) CheckBulkPermission(ctx context.Context, checks []authz.PermissionCheck) ([]bool, error) {
+func (e *Engine) CheckBulkPermission(ctx context.Context, checks []authz.PermissionCheck) ([]authz.BulkCheckResult, error) {
 	items := make([]*v1.CheckBulkPermissionsRequestItem, len(checks))
 	for i, check := range checks {
+		checkContext, err := contextToStruct(check.CaveatContext)
+		if err != nil {
+			return nil, err
+		}
 		items[i] = &v1.CheckBulkPermissionsRequestItem{
 			Resource: &v1.ObjectReference{
 				ObjectType: string(check.Resource.Type),
@@ -263,71 +348,50 @@ func (e *Engine) CheckBulkPermission(ctx context.Context, checks []authz.Permiss
 					ObjectId:   string(check.SubjectID),
 				},
 			},
+			Context: checkContext,
 		}
 	}
 
 	resp, err := e.client.CheckBulkPermissions(ctx, &v1.CheckBulkPermissionsRequest{
-		Items: items,
-		Consistency: &v1.Consistency{
-			Requirement: &v1.Consistency_FullyConsistent{FullyConsistent: true},
-		},
+		Items:       items,
+		Consistency: e.requestConsistency(ctx),
 	})
 	if err != nil {
 		return nil, err
 	}
 
-	results := make([]bool, len(resp.Pairs))
+	if len(resp.Pairs) != len(checks) {
+		return nil, fmt.Errorf("bulk check returned %d results for %d checks", len(resp.Pairs), len(checks))
+	}
+	results := make([]authz.BulkCheckResult, len(resp.Pairs))
 	for i, pair := range resp.Pairs {
-		if pair.GetItem() != nil {
-			results[i] = pair.GetItem().Permissionship == v1.CheckPermissionResponse_PERMISSIONSHIP_HAS_PERMISSION
+		if item := pair.GetItem(); item != nil {
+			results[i].CheckResult = checkResultFromProto(item.Permissionship, item.PartialCaveatInfo)
+		} else {
+			results[i].Err = status.ErrorProto(pair.GetError())
 		}
 	}
 
 	return results, nil
 }
 
-func (e *Engine) ExportBulkRelationships(ctx context.Context, filter authz.RelationshipFilter) ([]authz.RelationshipObject, error) {
-	stream, err := e.client.ExportBulkRelationships(ctx, &v1.ExportBulkRelationshipsRequest{
-		OptionalRelationshipFilter: &v1.RelationshipFilter{
-			ResourceType:       filter.ResourceType,
-			OptionalResourceId: filter.ResourceID,
-			OptionalRelation:   filter.Relation,
-			OptionalSubjectFilter: &v1.SubjectFilter{
-				SubjectType: filter.SubjectType,
-			},
-		},
-		Consistency: &v1.Consistency{
-			Requirement: &v1.Consistency_FullyConsistent{FullyConsistent: true},
-		},
-	})
-	if err != nil {
-		return nil, err
-	}
-
-	var relationships []authz.RelationshipObject
-	for {
-		resp, err := stream.Recv()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return nil, err
-		}
-
-		for _, rel := range resp.Relationships {
-			relationships = append(relationships, authz.RelationshipObject{
-				Resource: authz.Resource{
-					Type: authz.Type(rel.Resource.ObjectType),
-					ID:   authz.ID(rel.Resource.ObjectId),
-				},
-				Relation:    authz.Relation(rel.Relation),
-				SubjectType: authz.Type(rel.Subject.Object.ObjectType),
-				SubjectID:   authz.ID(rel.Subject.Object.ObjectId),
-			})
+// checkResultFromProto converts a SpiceDB permissionship into a three-state CheckResult.
+func checkResultFromProto(permissionship v1.CheckPermissionResponse_Permissionship, partial *v1.PartialCaveatInfo) authz.CheckResult {
+	switch permissionship {
+	case v1.CheckPermissionResponse_PERMISSIONSHIP_HAS_PERMISSION:
+		return authz.CheckResult{Permissionship: authz.PermissionshipAllowed}
+	case v1.CheckPermissionResponse_PERMISSIONSHIP_CONDITIONAL_PERMISSION:
+		return authz.CheckResult{
+			Permissionship: authz.PermissionshipConditional,
+			MissingFields:  partial.GetMissingRequiredContext(),
 		}
+	default:
+		return authz.CheckResult{Permissionship: authz.PermissionshipDenied}
 	}
+}
 
-	return relationships, nil
+func (e *Engine) ExportBulkRelationships(ctx context.Context, filter authz.RelationshipFilter) ([]authz.RelationshipObject, error) {
+	return collect(e.ExportBulkRelationshipsSeq(ctx, filter))
 }
 
 func (e *Engine) ImportBulkRelationships(ctx context.Context, relationships []authz.RelationshipObject) error {
@@ -337,22 +401,12 @@ func (e *Engine) ImportBulkRelationships(ctx context.Context, relationships []au
 	}
 
 	for _, rel := range relationships {
+		protoRel, err := relationshipToProto(rel)
+		if err != nil {
+			return err
+		}
 		req := &v1.ImportBulkRelationshipsRequest{
-			Relationships: []*v1.Relationship{
-				{
-					Resource: &v1.ObjectReference{
-						ObjectType: string(rel.Resource.Type),
-						ObjectId:   string(rel.Resource.ID),
-					},
-					Relation: string(rel.Relation),
-					Subject: &v1.SubjectReference{
-						Object: &v1.ObjectReference{
-							ObjectType: string(rel.SubjectType),
-							ObjectId:   string(rel.SubjectID),
-						},
-					},
-				},
-			},
+			Relationships: []*v1.Relationship{protoRel},
 		}
 		if err := stream.Send(req); err != nil {
 			return err
@@ -362,3 +416,108 @@ func (e *Engine) ImportBulkRelationships(ctx context.Context, relationships []au
 	_, err = stream.CloseAndRecv()
 	return err
 }
+
+// requestConsistency resolves the consistency for a request: the context's consistency wins,
+// then the Engine's configured default, then full consistency.
+func (e *Engine) requestConsistency(ctx context.Context) *v1.Consistency {
+	c, ok := authz.ConsistencyFromContext(ctx)
+	if !ok || c.Mode == authz.ConsistencyDefault {
+		c = e.defaultConsistency
+	}
+	return consistencyToProto(c)
+}
+
+func consistencyToProto(c authz.Consistency) *v1.Consistency {
+	switch c.Mode {
+	case authz.ConsistencyMinimizeLatency:
+		return &v1.Consistency{
+			Requirement: &v1.Consistency_MinimizeLatency{MinimizeLatency: true},
+		}
+	case authz.ConsistencyAtLeastAsFresh:
+		return &v1.Consistency{
+			Requirement: &v1.Consistency_AtLeastAsFresh{AtLeastAsFresh: &v1.ZedToken{Token: string(c.Token)}},
+		}
+	case authz.ConsistencyAtExactSnapshot:
+		return &v1.Consistency{
+			Requirement: &v1.Consistency_AtExactSnapshot{AtExactSnapshot: &v1.ZedToken{Token: string(c.Token)}},
+		}
+	default:
+		return &v1.Consistency{
+			Requirement: &v1.Consistency_FullyConsistent{FullyConsistent: true},
+		}
+	}
+}
+
+// relationshipFilterToProto converts a filter, leaving out the subject filter when no
+// subject type is given.
+func relationshipFilterToProto(filter authz.RelationshipFilter) *v1.RelationshipFilter {
+	f := &v1.RelationshipFilter{
+		ResourceType:       filter.ResourceType,
+		OptionalResourceId: filter.ResourceID,
+		OptionalRelation:   filter.Relation,
+	}
+	if filter.SubjectType != "" {
+		f.OptionalSubjectFilter = &v1.SubjectFilter{
+			SubjectType:       filter.SubjectType,
+			OptionalSubjectId: filter.SubjectID,
+		}
+		if filter.SubjectRelation != "" {
+			f.OptionalSubjectFilter.OptionalRelation = &v1.SubjectFilter_RelationFilter{Relation: filter.SubjectRelation}
+		}
+	}
+	return f
+}
+
+func relationshipToProto(rel authz.RelationshipObject) (*v1.Relationship, error) {
+	optionalCaveat, err := caveatToProto(rel.Caveat)
+	if err != nil {
+		return nil, err
+	}
+
+	return &v1.Relationship{
+		Resource: &v1.ObjectReference{
+			ObjectType: string(rel.Resource.Type),
+			ObjectId:   string(rel.Resource.ID),
+		},
+		Relation: string(rel.Relation),
+		Subject: &v1.SubjectReference{
+			Object: &v1.ObjectReference{
+				ObjectType: string(rel.SubjectType),
+				ObjectId:   string(rel.SubjectID),
+			},
+			OptionalRelation: string(rel.SubjectRelation),
+		},
+		OptionalCaveat:    optionalCaveat,
+		OptionalExpiresAt: expiresAtToProto(rel.ExpiresAt),
+	}, nil
+}
+
+func relationshipFromProto(rel *v1.Relationship) authz.RelationshipObject {
+	return authz.RelationshipObject{
+		Resource: authz.Resource{
+			Type: authz.Type(rel.Resource.ObjectType),
+			ID:   authz.ID(rel.Resource.ObjectId),
+		},
+		Relation:        authz.Relation(rel.Relation),
+		SubjectType:     authz.Type(rel.Subject.Object.ObjectType),
+		SubjectID:       authz.ID(rel.Subject.Object.ObjectId),
+		SubjectRelation: authz.Relation(rel.Subject.OptionalRelation),
+		Caveat:          caveatFromProto(rel.OptionalCaveat),
+		ExpiresAt:       expiresAtFromProto(rel.OptionalExpiresAt),
+	}
+}
+
+// expiresAtToProto converts an expiry to its protobuf form; the zero time means no expiry.
+func expiresAtToProto(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
+
+func expiresAtFromProto(ts *timestamppb.Timestamp) time.Time {
+	if ts == nil {
+		return time.Time{}
+	}
+	return ts.AsTime()
+}
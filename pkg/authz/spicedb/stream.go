@@ -0,0 +1,216 @@
+package spicedb
+
+import (
+	"context"
+	"io"
+	"iter"
+
+	v1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	"github.com/oitnes/authzed-codegen/pkg/authz"
+	"google.golang.org/grpc"
+)
+
+// streamSeq adapts a SpiceDB response stream to an iterator. open starts the stream when
+// iteration begins, and convert turns each response into zero or more results. Stopping
+// the iteration early cancels the stream.
+func streamSeq[Resp, T any](ctx context.Context, open func(ctx context.Context) (grpc.ServerStreamingClient[Resp], error), convert func(*Resp) []T) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		var zero T
+		stream, err := open(ctx)
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+		for {
+			resp, err := stream.Recv()
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				yield(zero, err)
+				return
+			}
+			for _, result := range convert(resp) {
+				if !yield(result, nil) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// collect reads a whole stream into a slice.
+func collect[T any](seq iter.Seq2[T, error]) ([]T, error) {
+	var results []T
+	for result, err := range seq {
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func cursorToProto(c authz.Cursor) *v1.Cursor {
+	if c == "" {
+		return nil
+	}
+	return &v1.Cursor{Token: string(c)}
+}
+
+// nextCursor returns the cursor of the page after one that returned n results ending at
+// last, or an empty cursor if the page was the final one.
+func nextCursor(n int, limit uint32, last *v1.Cursor) authz.Cursor {
+	if limit == 0 || n < int(limit) {
+		return ""
+	}
+	return authz.Cursor(last.GetToken())
+}
+
+func (e *Engine) lookupResourcesRequest(ctx context.Context, resourceType authz.Type, permission authz.Permission, subjectType authz.Type, subjectID authz.ID) *v1.LookupResourcesRequest {
+	return &v1.LookupResourcesRequest{
+		ResourceObjectType: string(resourceType),
+		Permission:         string(permission),
+		Subject: &v1.SubjectReference{
+			Object: &v1.ObjectReference{
+				ObjectType: string(subjectType),
+				ObjectId:   string(subjectID),
+			},
+		},
+		Consistency: e.requestConsistency(ctx),
+	}
+}
+
+// LookupResourcesSeq streams the resources on which the subject has the permission.
+func (e *Engine) LookupResourcesSeq(ctx context.Context, resourceType authz.Type, permission authz.Permission, subjectType authz.Type, subjectID authz.ID) iter.Seq2[authz.ID, error] {
+	req := e.lookupResourcesRequest(ctx, resourceType, permission, subjectType, subjectID)
+	return streamSeq(ctx,
+		func(ctx context.Context) (grpc.ServerStreamingClient[v1.LookupResourcesResponse], error) {
+			return e.client.LookupResources(ctx, req)
+		},
+		func(resp *v1.LookupResourcesResponse) []authz.ID {
+			return []authz.ID{authz.ID(resp.ResourceObjectId)}
+		},
+	)
+}
+
+// LookupResourcesPage returns one page of the resources on which the subject has the
+// permission, using SpiceDB's limit and cursor.
+func (e *Engine) LookupResourcesPage(ctx context.Context, resourceType authz.Type, permission authz.Permission, subjectType authz.Type, subjectID authz.ID, limit uint32, cursor authz.Cursor) ([]authz.ID, authz.Cursor, error) {
+	req := e.lookupResourcesRequest(ctx, resourceType, permission, subjectType, subjectID)
+	req.OptionalLimit = limit
+	req.OptionalCursor = cursorToProto(cursor)
+
+	var last *v1.Cursor
+	ids, err := collect(streamSeq(ctx,
+		func(ctx context.Context) (grpc.ServerStreamingClient[v1.LookupResourcesResponse], error) {
+			return e.client.LookupResources(ctx, req)
+		},
+		func(resp *v1.LookupResourcesResponse) []authz.ID {
+			last = resp.AfterResultCursor
+			return []authz.ID{authz.ID(resp.ResourceObjectId)}
+		},
+	))
+	if err != nil {
+		return nil, "", err
+	}
+	return ids, nextCursor(len(ids), limit, last), nil
+}
+
+// LookupSubjectsSeq streams the subjects that have the permission on the resource.
+// SpiceDB does not paginate LookupSubjects, so there is no page form.
+func (e *Engine) LookupSubjectsSeq(ctx context.Context, resource authz.Resource, permission authz.Permission, subjectType authz.Type) iter.Seq2[authz.ID, error] {
+	req := &v1.LookupSubjectsRequest{
+		Resource: &v1.ObjectReference{
+			ObjectType: string(resource.Type),
+			ObjectId:   string(resource.ID),
+		},
+		Permission:        string(permission),
+		SubjectObjectType: string(subjectType),
+		Consistency:       e.requestConsistency(ctx),
+	}
+	return streamSeq(ctx,
+		func(ctx context.Context) (grpc.ServerStreamingClient[v1.LookupSubjectsResponse], error) {
+			return e.client.LookupSubjects(ctx, req)
+		},
+		func(resp *v1.LookupSubjectsResponse) []authz.ID {
+			return []authz.ID{authz.ID(resp.Subject.SubjectObjectId)}
+		},
+	)
+}
+
+func (e *Engine) readRelationshipsRequest(ctx context.Context, resource authz.Resource, relation authz.Relation, subjectType authz.Type, subjectRelation authz.Relation) *v1.ReadRelationshipsRequest {
+	return &v1.ReadRelationshipsRequest{
+		RelationshipFilter: &v1.RelationshipFilter{
+			ResourceType:       string(resource.Type),
+			OptionalResourceId: string(resource.ID),
+			OptionalRelation:   string(relation),
+			OptionalSubjectFilter: &v1.SubjectFilter{
+				SubjectType: string(subjectType),
+				OptionalRelation: &v1.SubjectFilter_RelationFilter{
+					Relation: string(subjectRelation),
+				},
+			},
+		},
+		Consistency: e.requestConsistency(ctx),
+	}
+}
+
+// ReadRelationsSeq streams the relationships of the resource under relation.
+func (e *Engine) ReadRelationsSeq(ctx context.Context, resource authz.Resource, relation authz.Relation, subjectType authz.Type, subjectRelation authz.Relation) iter.Seq2[authz.RelationshipObject, error] {
+	req := e.readRelationshipsRequest(ctx, resource, relation, subjectType, subjectRelation)
+	return streamSeq(ctx,
+		func(ctx context.Context) (grpc.ServerStreamingClient[v1.ReadRelationshipsResponse], error) {
+			return e.client.ReadRelationships(ctx, req)
+		},
+		func(resp *v1.ReadRelationshipsResponse) []authz.RelationshipObject {
+			return []authz.RelationshipObject{relationshipFromProto(resp.Relationship)}
+		},
+	)
+}
+
+// ReadRelationsPage returns one page of the relationships of the resource under relation,
+// using SpiceDB's limit and cursor.
+func (e *Engine) ReadRelationsPage(ctx context.Context, resource authz.Resource, relation authz.Relation, subjectType authz.Type, subjectRelation authz.Relation, limit uint32, cursor authz.Cursor) ([]authz.RelationshipObject, authz.Cursor, error) {
+	req := e.readRelationshipsRequest(ctx, resource, relation, subjectType, subjectRelation)
+	req.OptionalLimit = limit
+	req.OptionalCursor = cursorToProto(cursor)
+
+	var last *v1.Cursor
+	relationships, err := collect(streamSeq(ctx,
+		func(ctx context.Context) (grpc.ServerStreamingClient[v1.ReadRelationshipsResponse], error) {
+			return e.client.ReadRelationships(ctx, req)
+		},
+		func(resp *v1.ReadRelationshipsResponse) []authz.RelationshipObject {
+			last = resp.AfterResultCursor
+			return []authz.RelationshipObject{relationshipFromProto(resp.Relationship)}
+		},
+	))
+	if err != nil {
+		return nil, "", err
+	}
+	return relationships, nextCursor(len(relationships), limit, last), nil
+}
+
+// ExportBulkRelationshipsSeq streams every relationship matching filter.
+func (e *Engine) ExportBulkRelationshipsSeq(ctx context.Context, filter authz.RelationshipFilter) iter.Seq2[authz.RelationshipObject, error] {
+	req := &v1.ExportBulkRelationshipsRequest{
+		OptionalRelationshipFilter: relationshipFilterToProto(filter),
+		Consistency:                e.requestConsistency(ctx),
+	}
+	return streamSeq(ctx,
+		func(ctx context.Context) (grpc.ServerStreamingClient[v1.ExportBulkRelationshipsResponse], error) {
+			return e.client.ExportBulkRelationships(ctx, req)
+		},
+		func(resp *v1.ExportBulkRelationshipsResponse) []authz.RelationshipObject {
+			relationships := make([]authz.RelationshipObject, len(resp.Relationships))
+			for i, rel := range resp.Relationships {
+				relationships[i] = relationshipFromProto(rel)
+			}
+			return relationships
+		},
+	)
+}
@@ -0,0 +1,158 @@
+package spicedb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"time"
+
+	v1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	"github.com/oitnes/authzed-codegen/pkg/authz"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Backoff bounds for reconnecting a failed watch stream.
+const (
+	watchMinBackoff = 100 * time.Millisecond
+	watchMaxBackoff = 10 * time.Second
+)
+
+// Watch streams relationship changes from SpiceDB's Watch API. When the stream ends or
+// fails with a transient error it reconnects with exponential backoff, resuming from the
+// last token it yielded. An empty token watches from the current revision, which is read
+// before connecting so that a reconnect does not skip changes made in the meantime.
+func (e *Engine) Watch(ctx context.Context, token authz.ZedToken, objectTypes ...authz.Type) iter.Seq2[authz.WatchEvent, error] {
+	return func(yield func(authz.WatchEvent, error) bool) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		req := &v1.WatchRequest{}
+		for _, t := range objectTypes {
+			req.OptionalObjectTypes = append(req.OptionalObjectTypes, string(t))
+		}
+		if token != "" {
+			req.OptionalStartCursor = &v1.ZedToken{Token: string(token)}
+		}
+
+		backoff := watchMinBackoff
+		for {
+			received, stopped, err := e.watchStream(ctx, req, yield)
+			if stopped || ctx.Err() != nil {
+				return
+			}
+			if !isTransientWatchError(err) {
+				yield(authz.WatchEvent{}, err)
+				return
+			}
+			if received {
+				backoff = watchMinBackoff
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			backoff = min(2*backoff, watchMaxBackoff)
+		}
+	}
+}
+
+// watchStream runs one Watch call, yielding its events and advancing req's start cursor
+// past each response. Without a start cursor it starts at the current revision. It reports
+// whether any response was received, whether the consumer stopped the iteration, and the
+// error that ended the stream.
+func (e *Engine) watchStream(ctx context.Context, req *v1.WatchRequest, yield func(authz.WatchEvent, error) bool) (received, stopped bool, err error) {
+	if req.OptionalStartCursor == nil {
+		req.OptionalStartCursor, err = e.currentRevision(ctx)
+		if err != nil {
+			return false, false, err
+		}
+	}
+
+	stream, err := e.client.Watch(ctx, req)
+	if err != nil {
+		return false, false, err
+	}
+	for {
+		resp, err := stream.Recv()
+		if err != nil {
+			return received, false, err
+		}
+		received = true
+
+		if len(resp.Updates) > 0 {
+			event, err := watchEventFromProto(resp)
+			if err != nil {
+				return received, false, err
+			}
+			if !yield(event, nil) {
+				return received, true, nil
+			}
+		}
+		if resp.ChangesThrough != nil {
+			req.OptionalStartCursor = resp.ChangesThrough
+		}
+	}
+}
+
+// currentRevision returns a token for the revision SpiceDB is currently at, as reported by
+// ReadSchema. It returns nil if no schema has been written yet, when there
+// are no relationships whose changes could be missed.
+func (e *Engine) currentRevision(ctx context.Context) (*v1.ZedToken, error) {
+	resp, err := e.client.ReadSchema(ctx, &v1.ReadSchemaRequest{})
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return resp.GetReadAt(), nil
+}
+
+func watchEventFromProto(resp *v1.WatchResponse) (authz.WatchEvent, error) {
+	event := authz.WatchEvent{
+		Changes: make([]authz.RelationshipChange, len(resp.Updates)),
+		Token:   authz.ZedToken(resp.ChangesThrough.GetToken()),
+	}
+	for i, update := range resp.Updates {
+		op, err := writeOperationFromProto(update.Operation)
+		if err != nil {
+			return authz.WatchEvent{}, err
+		}
+		event.Changes[i] = authz.RelationshipChange{
+			Operation:    op,
+			Relationship: relationshipFromProto(update.Relationship),
+		}
+	}
+	return event, nil
+}
+
+func writeOperationFromProto(op v1.RelationshipUpdate_Operation) (authz.WriteOperation, error) {
+	switch op {
+	case v1.RelationshipUpdate_OPERATION_CREATE:
+		return authz.WriteCreate, nil
+	case v1.RelationshipUpdate_OPERATION_TOUCH:
+		return authz.WriteTouch, nil
+	case v1.RelationshipUpdate_OPERATION_DELETE:
+		return authz.WriteDelete, nil
+	default:
+		return 0, fmt.Errorf("unknown relationship update operation %s", op)
+	}
+}
+
+// isTransientWatchError reports whether a watch stream that ended with err should be
+// reopened. Errors about the request itself, such as an expired start token, are final.
+func isTransientWatchError(err error) bool {
+	if errors.Is(err, io.EOF) {
+		return true
+	}
+	switch status.Code(err) {
+	case codes.Unavailable, codes.Aborted, codes.ResourceExhausted, codes.Internal, codes.Unknown, codes.DeadlineExceeded:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,30 @@
+package authz
+
+import (
+	"context"
+	"iter"
+)
+
+// RelationshipChange is one relationship write observed by a Watcher.
+type RelationshipChange struct {
+	Operation    WriteOperation
+	Relationship RelationshipObject
+}
+
+// WatchEvent is a set of relationship changes committed together.
+type WatchEvent struct {
+	Changes []RelationshipChange
+	// Token is the revision the changes are current through. Passing it to Watch resumes
+	// after this event.
+	Token ZedToken
+}
+
+// Watcher streams relationship changes. It is implemented by the engines that can observe
+// writes, separately from Engine so that engines without a change feed remain usable.
+type Watcher interface {
+	// Watch yields the changes committed after token, or after the current revision when
+	// token is empty, to resources of objectTypes or of every type when none are given.
+	// It reconnects and resumes from the last yielded token after transient failures.
+	// Iteration ends when ctx is done, or after yielding an error it cannot recover from.
+	Watch(ctx context.Context, token ZedToken, objectTypes ...Type) iter.Seq2[WatchEvent, error]
+}
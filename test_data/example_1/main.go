@@ -51,6 +51,11 @@ func mustFalse(ctx context.Context, label string, got bool, err error) {
 	log.Printf("PASS [%s]", label)
 }
 
+// allowed adapts a raw engine check result to the mustTrue/mustFalse helpers.
+func allowed(res authz.CheckResult, err error) (bool, error) {
+	return res.Allowed(), err
+}
+
 func main() {
 	ctx := context.Background()
 	engine := newEngine()
@@ -90,42 +95,42 @@ func main() {
 	menuSetting := client.NewMenusvcSetting("menu-setting-1")
 
 	// --- Setup: bookingsvc/brand ---
-	if err := brand.CreateAdminRelations(ctx, permitions.BookingsvcBrandAdminObjects{
+	if _, err := brand.CreateAdminRelations(ctx, permitions.BookingsvcBrandAdminObjects{
 		BookingsvcUser: []permitions.BookingsvcUser{brandAdminUser},
 	}); err != nil {
 		log.Fatal(err)
 	}
-	if err := brand.CreateManagerRelations(ctx, permitions.BookingsvcBrandManagerObjects{
+	if _, err := brand.CreateManagerRelations(ctx, permitions.BookingsvcBrandManagerObjects{
 		BookingsvcEmployee: []permitions.BookingsvcEmployee{managerEmployee},
 	}); err != nil {
 		log.Fatal(err)
 	}
-	if err := brand.CreateEmployeeRelations(ctx, permitions.BookingsvcBrandEmployeeObjects{
+	if _, err := brand.CreateEmployeeRelations(ctx, permitions.BookingsvcBrandEmployeeObjects{
 		BookingsvcEmployee: []permitions.BookingsvcEmployee{brandOnlyEmployee},
 	}); err != nil {
 		log.Fatal(err)
 	}
 
 	// managerEmployee belongs to brand so it inherits brand->manage
-	if err := managerEmployee.CreateBelongsBrandRelations(ctx, permitions.BookingsvcEmployeeBelongsBrandObjects{
+	if _, err := managerEmployee.CreateBelongsBrandRelations(ctx, permitions.BookingsvcEmployeeBelongsBrandObjects{
 		BookingsvcBrand: []permitions.BookingsvcBrand{brand},
 	}); err != nil {
 		log.Fatal(err)
 	}
 	// ownerEmployee has brandAdminUser as its linked account
-	if err := ownerEmployee.CreateAccountRelations(ctx, permitions.BookingsvcEmployeeAccountObjects{
+	if _, err := ownerEmployee.CreateAccountRelations(ctx, permitions.BookingsvcEmployeeAccountObjects{
 		BookingsvcUser: []permitions.BookingsvcUser{brandAdminUser},
 	}); err != nil {
 		log.Fatal(err)
 	}
 
 	// --- Setup: bookingsvc/booking ---
-	if err := booking.CreateOwnerRelations(ctx, permitions.BookingsvcBookingOwnerObjects{
+	if _, err := booking.CreateOwnerRelations(ctx, permitions.BookingsvcBookingOwnerObjects{
 		BookingsvcEmployee: []permitions.BookingsvcEmployee{ownerEmployee},
 	}); err != nil {
 		log.Fatal(err)
 	}
-	if err := booking.CreateCreatorRelations(ctx, permitions.BookingsvcBookingCreatorObjects{
+	if _, err := booking.CreateCreatorRelations(ctx, permitions.BookingsvcBookingCreatorObjects{
 		BookingsvcCustomer: []permitions.BookingsvcCustomer{creatorCustomer},
 	}); err != nil {
 		log.Fatal(err)
@@ -182,13 +187,14 @@ func main() {
 	// belongs_brand->manage: subjects are the users/employees who have manage on the brand.
 	// The generated wrapper exposes BookingsvcBrand as subject type (stops at the arrow target),
 	// but the actual actors are BookingsvcUser/Employee. Use raw engine to verify the transitive path.
-	ok, err = engine.CheckPermission(
+	ok, err = allowed(engine.CheckPermission(
 		ctx,
 		authz.Resource{Type: permitions.TypeBookingsvcEmployee, ID: authz.ID(managerEmployee.ID())},
 		permitions.BookingsvcEmployeePermissionManage,
 		permitions.TypeBookingsvcUser,
 		authz.ID(brandAdminUser.ID()),
-	)
+		nil,
+	))
 	mustTrue(ctx, "brand admin user can manage managerEmployee (via belongs_brand->manage->admin)", ok, err)
 
 	ok, err = ownerEmployee.CheckManage(ctx, permitions.CheckBookingsvcEmployeeManageInputs{
@@ -208,7 +214,7 @@ func main() {
 	mustFalse(ctx, "outsider user CANNOT view employee before wildcard", ok, err)
 
 	// Set viewer:* so any bookingsvc/user can view the employee
-	if err = ownerEmployee.CreateViewerRelations(ctx, permitions.BookingsvcEmployeeViewerObjects{
+	if _, err = ownerEmployee.CreateViewerRelations(ctx, permitions.BookingsvcEmployeeViewerObjects{
 		BookingsvcUserWildcard: true,
 	}); err != nil {
 		log.Fatal(err)
@@ -251,24 +257,24 @@ func main() {
 	mustFalse(ctx, "outsider employee CANNOT change_owner", ok, err)
 
 	// --- Setup: menusvc/company ---
-	if err = company.CreateAdminRelations(ctx, permitions.MenusvcCompanyAdminObjects{
+	if _, err = company.CreateAdminRelations(ctx, permitions.MenusvcCompanyAdminObjects{
 		MenusvcUser: []permitions.MenusvcUser{companyAdminUser},
 	}); err != nil {
 		log.Fatal(err)
 	}
-	if err = company.CreateManagerRelations(ctx, permitions.MenusvcCompanyManagerObjects{
+	if _, err = company.CreateManagerRelations(ctx, permitions.MenusvcCompanyManagerObjects{
 		MenusvcUser: []permitions.MenusvcUser{companyManagerUser},
 	}); err != nil {
 		log.Fatal(err)
 	}
-	if err = company.CreateEmployeeRelations(ctx, permitions.MenusvcCompanyEmployeeObjects{
+	if _, err = company.CreateEmployeeRelations(ctx, permitions.MenusvcCompanyEmployeeObjects{
 		MenusvcUser: []permitions.MenusvcUser{companyEmployeeUser},
 	}); err != nil {
 		log.Fatal(err)
 	}
 
 	// companyAdminUser belongs to company (enables manage via belongs_company->manage)
-	if err = companyAdminUser.CreateBelongsCompanyRelations(ctx, permitions.MenusvcUserBelongsCompanyObjects{
+	if _, err = companyAdminUser.CreateBelongsCompanyRelations(ctx, permitions.MenusvcUserBelongsCompanyObjects{
 		MenusvcCompany: []permitions.MenusvcCompany{company},
 	}); err != nil {
 		log.Fatal(err)
@@ -330,31 +336,33 @@ func main() {
 	// --- menusvc/user: manage = belongs_company->manage ---
 	// The generated wrapper exposes MenusvcCompany as subject type for this arrow permission.
 	// Use the raw engine to check with the actual user-level subjects.
-	ok, err = engine.CheckPermission(
+	ok, err = allowed(engine.CheckPermission(
 		ctx,
 		authz.Resource{Type: permitions.TypeMenusvcUser, ID: authz.ID(companyAdminUser.ID())},
 		permitions.MenusvcUserPermissionManage,
 		permitions.TypeMenusvcUser,
 		authz.ID(companyAdminUser.ID()),
-	)
+		nil,
+	))
 	mustTrue(ctx, "companyAdminUser can manage themselves (belongs to company they admin)", ok, err)
 
-	ok, err = engine.CheckPermission(
+	ok, err = allowed(engine.CheckPermission(
 		ctx,
 		authz.Resource{Type: permitions.TypeMenusvcUser, ID: authz.ID(companyAdminUser.ID())},
 		permitions.MenusvcUserPermissionManage,
 		permitions.TypeMenusvcUser,
 		authz.ID(outsiderMenuUser.ID()),
-	)
+		nil,
+	))
 	mustFalse(ctx, "outsider menu user CANNOT manage companyAdminUser", ok, err)
 
 	// --- Setup: menusvc/booking ---
-	if err = menuBooking.CreateOwnerRelations(ctx, permitions.MenusvcBookingOwnerObjects{
+	if _, err = menuBooking.CreateOwnerRelations(ctx, permitions.MenusvcBookingOwnerObjects{
 		MenusvcCompany: []permitions.MenusvcCompany{company},
 	}); err != nil {
 		log.Fatal(err)
 	}
-	if err = menuBooking.CreateCreatorRelations(ctx, permitions.MenusvcBookingCreatorObjects{
+	if _, err = menuBooking.CreateCreatorRelations(ctx, permitions.MenusvcBookingCreatorObjects{
 		MenusvcUser:     []permitions.MenusvcUser{companyEmployeeUser},
 		MenusvcCustomer: []permitions.MenusvcCustomer{menuCustomer},
 	}); err != nil {
@@ -378,22 +386,23 @@ func main() {
 	mustFalse(ctx, "outsider menu user CANNOT write menu booking", ok, err)
 
 	// Company admin can write via owner->manage — use raw engine (transitive arrow)
-	ok, err = engine.CheckPermission(
+	ok, err = allowed(engine.CheckPermission(
 		ctx,
 		authz.Resource{Type: permitions.TypeMenusvcBooking, ID: authz.ID(menuBooking.ID())},
 		permitions.MenusvcBookingPermissionWrite,
 		permitions.TypeMenusvcUser,
 		authz.ID(companyAdminUser.ID()),
-	)
+		nil,
+	))
 	mustTrue(ctx, "company admin can write menu booking (via owner->manage)", ok, err)
 
 	// --- Setup: menusvc/order ---
-	if err = menuOrder.CreateBelongsCompanyRelations(ctx, permitions.MenusvcOrderBelongsCompanyObjects{
+	if _, err = menuOrder.CreateBelongsCompanyRelations(ctx, permitions.MenusvcOrderBelongsCompanyObjects{
 		MenusvcCompany: []permitions.MenusvcCompany{company},
 	}); err != nil {
 		log.Fatal(err)
 	}
-	if err = menuOrder.CreateCreatorRelations(ctx, permitions.MenusvcOrderCreatorObjects{
+	if _, err = menuOrder.CreateCreatorRelations(ctx, permitions.MenusvcOrderCreatorObjects{
 		MenusvcUser: []permitions.MenusvcUser{companyEmployeeUser},
 	}); err != nil {
 		log.Fatal(err)
@@ -411,106 +420,115 @@ func main() {
 	mustFalse(ctx, "outsider menu user CANNOT write menu order", ok, err)
 
 	// Company admin can write via belongs_company->manage — use raw engine (transitive arrow)
-	ok, err = engine.CheckPermission(
+	ok, err = allowed(engine.CheckPermission(
 		ctx,
 		authz.Resource{Type: permitions.TypeMenusvcOrder, ID: authz.ID(menuOrder.ID())},
 		permitions.MenusvcOrderPermissionWrite,
 		permitions.TypeMenusvcUser,
 		authz.ID(companyAdminUser.ID()),
-	)
+		nil,
+	))
 	mustTrue(ctx, "company admin can write menu order (via belongs_company->manage)", ok, err)
 
 	// --- Setup: menusvc/table, pricelist, setting owned by company ---
-	if err = menuTable.CreateOwnerRelations(ctx, permitions.MenusvcTableOwnerObjects{
+	if _, err = menuTable.CreateOwnerRelations(ctx, permitions.MenusvcTableOwnerObjects{
 		MenusvcCompany: []permitions.MenusvcCompany{company},
 	}); err != nil {
 		log.Fatal(err)
 	}
-	if err = menuPricelist.CreateOwnerRelations(ctx, permitions.MenusvcPricelistOwnerObjects{
+	if _, err = menuPricelist.CreateOwnerRelations(ctx, permitions.MenusvcPricelistOwnerObjects{
 		MenusvcCompany: []permitions.MenusvcCompany{company},
 	}); err != nil {
 		log.Fatal(err)
 	}
-	if err = menuSetting.CreateOwnerRelations(ctx, permitions.MenusvcSettingOwnerObjects{
+	if _, err = menuSetting.CreateOwnerRelations(ctx, permitions.MenusvcSettingOwnerObjects{
 		MenusvcCompany: []permitions.MenusvcCompany{company},
 	}); err != nil {
 		log.Fatal(err)
 	}
 
 	// --- menusvc/table: write = owner->manage (use raw engine — transitive arrow) ---
-	ok, err = engine.CheckPermission(
+	ok, err = allowed(engine.CheckPermission(
 		ctx,
 		authz.Resource{Type: permitions.TypeMenusvcTable, ID: authz.ID(menuTable.ID())},
 		permitions.MenusvcTablePermissionWrite,
 		permitions.TypeMenusvcUser,
 		authz.ID(companyAdminUser.ID()),
-	)
+		nil,
+	))
 	mustTrue(ctx, "company admin can write table (via owner->manage)", ok, err)
 
-	ok, err = engine.CheckPermission(
+	ok, err = allowed(engine.CheckPermission(
 		ctx,
 		authz.Resource{Type: permitions.TypeMenusvcTable, ID: authz.ID(menuTable.ID())},
 		permitions.MenusvcTablePermissionWrite,
 		permitions.TypeMenusvcUser,
 		authz.ID(companyEmployeeUser.ID()),
-	)
+		nil,
+	))
 	mustFalse(ctx, "company employee CANNOT write table (not manager/admin)", ok, err)
 
-	ok, err = engine.CheckPermission(
+	ok, err = allowed(engine.CheckPermission(
 		ctx,
 		authz.Resource{Type: permitions.TypeMenusvcTable, ID: authz.ID(menuTable.ID())},
 		permitions.MenusvcTablePermissionWrite,
 		permitions.TypeMenusvcUser,
 		authz.ID(outsiderMenuUser.ID()),
-	)
+		nil,
+	))
 	mustFalse(ctx, "outsider menu user CANNOT write table", ok, err)
 
 	// --- menusvc/table: no write for outsider company ---
-	ok, err = engine.CheckPermission(
+	ok, err = allowed(engine.CheckPermission(
 		ctx,
 		authz.Resource{Type: permitions.TypeMenusvcTable, ID: authz.ID(menuTable.ID())},
 		permitions.MenusvcTablePermissionWrite,
 		permitions.TypeMenusvcCompany,
 		authz.ID(outsiderCompany.ID()),
-	)
+		nil,
+	))
 	mustFalse(ctx, "outsider company CANNOT write table", ok, err)
 
 	// --- menusvc/pricelist: write = owner->manage ---
-	ok, err = engine.CheckPermission(
+	ok, err = allowed(engine.CheckPermission(
 		ctx,
 		authz.Resource{Type: permitions.TypeMenusvcPricelist, ID: authz.ID(menuPricelist.ID())},
 		permitions.MenusvcPricelistPermissionWrite,
 		permitions.TypeMenusvcUser,
 		authz.ID(companyManagerUser.ID()),
-	)
+		nil,
+	))
 	mustTrue(ctx, "company manager can write pricelist (via owner->manage)", ok, err)
 
-	ok, err = engine.CheckPermission(
+	ok, err = allowed(engine.CheckPermission(
 		ctx,
 		authz.Resource{Type: permitions.TypeMenusvcPricelist, ID: authz.ID(menuPricelist.ID())},
 		permitions.MenusvcPricelistPermissionWrite,
 		permitions.TypeMenusvcUser,
 		authz.ID(outsiderMenuUser.ID()),
-	)
+		nil,
+	))
 	mustFalse(ctx, "outsider menu user CANNOT write pricelist", ok, err)
 
 	// --- menusvc/setting: write = owner->manage ---
-	ok, err = engine.CheckPermission(
+	ok, err = allowed(engine.CheckPermission(
 		ctx,
 		authz.Resource{Type: permitions.TypeMenusvcSetting, ID: authz.ID(menuSetting.ID())},
 		permitions.MenusvcSettingPermissionWrite,
 		permitions.TypeMenusvcUser,
 		authz.ID(companyAdminUser.ID()),
-	)
+		nil,
+	))
 	mustTrue(ctx, "company admin can write setting (via owner->manage)", ok, err)
 
-	ok, err = engine.CheckPermission(
+	ok, err = allowed(engine.CheckPermission(
 		ctx,
 		authz.Resource{Type: permitions.TypeMenusvcSetting, ID: authz.ID(menuSetting.ID())},
 		permitions.MenusvcSettingPermissionWrite,
 		permitions.TypeMenusvcUser,
 		authz.ID(outsiderMenuUser.ID()),
-	)
+		nil,
+	))
 	mustFalse(ctx, "outsider menu user CANNOT write setting", ok, err)
 
 	log.Println("All checks passed — example 1 completed successfully")
@@ -65,12 +65,12 @@ func main() {
 	outsider := client.NewUser("outsider-1")
 	doc := client.NewDocument("doc-1")
 
-	if err := doc.CreateWriterRelations(ctx, permissions.DocumentWriterObjects{
+	if _, err := doc.CreateWriterRelations(ctx, permissions.DocumentWriterObjects{
 		User: []permissions.User{writer},
 	}); err != nil {
 		log.Fatal(err)
 	}
-	if err := doc.CreateReaderRelations(ctx, permissions.DocumentReaderObjects{
+	if _, err := doc.CreateReaderRelations(ctx, permissions.DocumentReaderObjects{
 		User: []permissions.User{reader},
 	}); err != nil {
 		log.Fatal(err)
@@ -51,6 +51,11 @@ func mustFalse(ctx context.Context, label string, got bool, err error) {
 	log.Printf("PASS [%s]", label)
 }
 
+// allowed adapts a raw engine check result to the mustTrue/mustFalse helpers.
+func allowed(res authz.CheckResult, err error) (bool, error) {
+	return res.Allowed(), err
+}
+
 func main() {
 	ctx := context.Background()
 	engine := newEngine()
@@ -67,17 +72,17 @@ func main() {
 	ent := client.NewEntitlement("entitlement-1")
 	feature := client.NewFeature("feature-1")
 
-	if err := org.CreateMemberRelations(ctx, permissions.OrganizationMemberObjects{
+	if _, err := org.CreateMemberRelations(ctx, permissions.OrganizationMemberObjects{
 		User: []permissions.User{member},
 	}); err != nil {
 		log.Fatal(err)
 	}
-	if err := ent.CreateOrgRelations(ctx, permissions.EntitlementOrgObjects{
+	if _, err := ent.CreateOrgRelations(ctx, permissions.EntitlementOrgObjects{
 		Organization: []permissions.Organization{org},
 	}); err != nil {
 		log.Fatal(err)
 	}
-	if err := feature.CreateAssociatedEntitlementRelations(ctx, permissions.FeatureAssociatedEntitlementObjects{
+	if _, err := feature.CreateAssociatedEntitlementRelations(ctx, permissions.FeatureAssociatedEntitlementObjects{
 		Entitlement: []permissions.Entitlement{ent},
 	}); err != nil {
 		log.Fatal(err)
@@ -86,22 +91,24 @@ func main() {
 	// feature.access = associated_entitlement->subscribed_member, subscribed_member = org->member
 	// Subject types for CheckAccess are Entitlement (direct relation type on feature), so use raw engine
 	// to check user-level access through the full arrow chain.
-	ok, err := engine.CheckPermission(
+	ok, err := allowed(engine.CheckPermission(
 		ctx,
 		authz.Resource{Type: permissions.TypeFeature, ID: authz.ID(feature.ID())},
 		permissions.FeaturePermissionAccess,
 		permissions.TypeUser,
 		authz.ID(member.ID()),
-	)
+		nil,
+	))
 	mustTrue(ctx, "org member can access feature", ok, err)
 
-	ok, err = engine.CheckPermission(
+	ok, err = allowed(engine.CheckPermission(
 		ctx,
 		authz.Resource{Type: permissions.TypeFeature, ID: authz.ID(feature.ID())},
 		permissions.FeaturePermissionAccess,
 		permissions.TypeUser,
 		authz.ID(outsider.ID()),
-	)
+		nil,
+	))
 	mustFalse(ctx, "outsider CANNOT access feature", ok, err)
 
 	log.Println("All checks passed — example 4 completed successfully")
@@ -51,6 +51,11 @@ func mustFalse(ctx context.Context, label string, got bool, err error) {
 	log.Printf("PASS [%s]", label)
 }
 
+// allowed adapts a raw engine check result to the mustTrue/mustFalse helpers.
+func allowed(res authz.CheckResult, err error) (bool, error) {
+	return res.Allowed(), err
+}
+
 func main() {
 	ctx := context.Background()
 	engine := newEngine()
@@ -70,28 +75,28 @@ func main() {
 	docOwnedByOrg := client.NewDocument("doc-org-owned")
 
 	// Setup: platform administrator
-	if err := platform.CreateAdministratorRelations(ctx, permissions.PlatformAdministratorObjects{
+	if _, err := platform.CreateAdministratorRelations(ctx, permissions.PlatformAdministratorObjects{
 		User: []permissions.User{sysadmin},
 	}); err != nil {
 		log.Fatal(err)
 	}
 
 	// Setup: org linked to platform
-	if err := org.CreatePlatformRelations(ctx, permissions.OrganizationPlatformObjects{
+	if _, err := org.CreatePlatformRelations(ctx, permissions.OrganizationPlatformObjects{
 		Platform: []permissions.Platform{platform},
 	}); err != nil {
 		log.Fatal(err)
 	}
 
 	// Setup: document owned by a direct user
-	if err := docOwnedByUser.CreateOwnerRelations(ctx, permissions.DocumentOwnerObjects{
+	if _, err := docOwnedByUser.CreateOwnerRelations(ctx, permissions.DocumentOwnerObjects{
 		User: []permissions.User{directOwner},
 	}); err != nil {
 		log.Fatal(err)
 	}
 
 	// Setup: document owned by the org
-	if err := docOwnedByOrg.CreateOwnerRelations(ctx, permissions.DocumentOwnerObjects{
+	if _, err := docOwnedByOrg.CreateOwnerRelations(ctx, permissions.DocumentOwnerObjects{
 		Organization: []permissions.Organization{org},
 	}); err != nil {
 		log.Fatal(err)
@@ -115,41 +120,45 @@ func main() {
 	// document: admin = owner->admin (org-owned doc — org.admin = platform->super_admin = sysadmin)
 	// The generated CheckAdmin on Document checks Organization as a direct subject type.
 	// Use the raw engine to verify the full transitive chain: sysadmin → platform → org → doc.
-	ok, err = engine.CheckPermission(
+	ok, err = allowed(engine.CheckPermission(
 		ctx,
 		authz.Resource{Type: permissions.TypeDocument, ID: authz.ID(docOwnedByOrg.ID())},
 		permissions.DocumentPermissionAdmin,
 		permissions.TypeUser,
 		authz.ID(sysadmin.ID()),
-	)
+		nil,
+	))
 	mustTrue(ctx, "sysadmin can admin org-owned doc (via platform->org->doc)", ok, err)
 
-	ok, err = engine.CheckPermission(
+	ok, err = allowed(engine.CheckPermission(
 		ctx,
 		authz.Resource{Type: permissions.TypeDocument, ID: authz.ID(docOwnedByOrg.ID())},
 		permissions.DocumentPermissionAdmin,
 		permissions.TypeUser,
 		authz.ID(outsider.ID()),
-	)
+		nil,
+	))
 	mustFalse(ctx, "outsider CANNOT admin org-owned doc", ok, err)
 
 	// org: admin = platform->super_admin (use raw engine for user-level check)
-	ok, err = engine.CheckPermission(
+	ok, err = allowed(engine.CheckPermission(
 		ctx,
 		authz.Resource{Type: permissions.TypeOrganization, ID: authz.ID(org.ID())},
 		permissions.OrganizationPermissionAdmin,
 		permissions.TypeUser,
 		authz.ID(sysadmin.ID()),
-	)
+		nil,
+	))
 	mustTrue(ctx, "sysadmin can admin org (via platform->super_admin)", ok, err)
 
-	ok, err = engine.CheckPermission(
+	ok, err = allowed(engine.CheckPermission(
 		ctx,
 		authz.Resource{Type: permissions.TypeOrganization, ID: authz.ID(org.ID())},
 		permissions.OrganizationPermissionAdmin,
 		permissions.TypeUser,
 		authz.ID(outsider.ID()),
-	)
+		nil,
+	))
 	mustFalse(ctx, "outsider CANNOT admin org", ok, err)
 
 	log.Println("All checks passed — example 5 completed successfully")
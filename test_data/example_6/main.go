@@ -51,6 +51,11 @@ func mustFalse(ctx context.Context, label string, got bool, err error) {
 	log.Printf("PASS [%s]", label)
 }
 
+// allowed adapts a raw engine check result to the mustTrue/mustFalse helpers.
+func allowed(res authz.CheckResult, err error) (bool, error) {
+	return res.Allowed(), err
+}
+
 func main() {
 	ctx := context.Background()
 	engine := newEngine()
@@ -72,40 +77,40 @@ func main() {
 	database := client.NewSpannerDatabase("database-1")
 
 	// Bind the user to the role
-	if err := adminRole.CreateBoundUserRelations(ctx, permissions.RoleBoundUserObjects{
+	if _, err := adminRole.CreateBoundUserRelations(ctx, permissions.RoleBoundUserObjects{
 		User: []permissions.User{dbAdmin},
 	}); err != nil {
 		log.Fatal(err)
 	}
 
 	// Self-grant: adminRole grants itself spanner_databases_create and spanner_databases_read
-	if err := adminRole.CreateSpannerDatabasesCreateRelations(ctx, permissions.RoleSpannerDatabasesCreateObjects{
+	if _, err := adminRole.CreateSpannerDatabasesCreateRelations(ctx, permissions.RoleSpannerDatabasesCreateObjects{
 		Role: []permissions.Role{adminRole},
 	}); err != nil {
 		log.Fatal(err)
 	}
-	if err := adminRole.CreateSpannerDatabasesReadRelations(ctx, permissions.RoleSpannerDatabasesReadObjects{
+	if _, err := adminRole.CreateSpannerDatabasesReadRelations(ctx, permissions.RoleSpannerDatabasesReadObjects{
 		Role: []permissions.Role{adminRole},
 	}); err != nil {
 		log.Fatal(err)
 	}
 
 	// Grant the role to the project
-	if err := project.CreateGrantedRelations(ctx, permissions.ProjectGrantedObjects{
+	if _, err := project.CreateGrantedRelations(ctx, permissions.ProjectGrantedObjects{
 		Role: []permissions.Role{adminRole},
 	}); err != nil {
 		log.Fatal(err)
 	}
 
 	// Link instance to project
-	if err := instance.CreateProjectRelations(ctx, permissions.SpannerInstanceProjectObjects{
+	if _, err := instance.CreateProjectRelations(ctx, permissions.SpannerInstanceProjectObjects{
 		Project: []permissions.Project{project},
 	}); err != nil {
 		log.Fatal(err)
 	}
 
 	// Link database to instance
-	if err := database.CreateInstanceRelations(ctx, permissions.SpannerDatabaseInstanceObjects{
+	if _, err := database.CreateInstanceRelations(ctx, permissions.SpannerDatabaseInstanceObjects{
 		SpannerInstance: []permissions.SpannerInstance{instance},
 	}); err != nil {
 		log.Fatal(err)
@@ -122,40 +127,44 @@ func main() {
 
 	// Verify deep cascade to database: db.create = granted->... + instance->...
 	// Use raw engine since subject chain is user → role → project → instance → database
-	ok, err = engine.CheckPermission(
+	ok, err = allowed(engine.CheckPermission(
 		ctx,
 		authz.Resource{Type: permissions.TypeSpannerDatabase, ID: authz.ID(database.ID())},
 		permissions.SpannerDatabasePermissionCreate,
 		permissions.TypeUser,
 		authz.ID(dbAdmin.ID()),
-	)
+		nil,
+	))
 	mustTrue(ctx, "dbAdmin can create database (via role → project → instance → database)", ok, err)
 
-	ok, err = engine.CheckPermission(
+	ok, err = allowed(engine.CheckPermission(
 		ctx,
 		authz.Resource{Type: permissions.TypeSpannerDatabase, ID: authz.ID(database.ID())},
 		permissions.SpannerDatabasePermissionRead,
 		permissions.TypeUser,
 		authz.ID(dbAdmin.ID()),
-	)
+		nil,
+	))
 	mustTrue(ctx, "dbAdmin can read database", ok, err)
 
-	ok, err = engine.CheckPermission(
+	ok, err = allowed(engine.CheckPermission(
 		ctx,
 		authz.Resource{Type: permissions.TypeSpannerDatabase, ID: authz.ID(database.ID())},
 		permissions.SpannerDatabasePermissionCreate,
 		permissions.TypeUser,
 		authz.ID(outsider.ID()),
-	)
+		nil,
+	))
 	mustFalse(ctx, "outsider CANNOT create database", ok, err)
 
-	ok, err = engine.CheckPermission(
+	ok, err = allowed(engine.CheckPermission(
 		ctx,
 		authz.Resource{Type: permissions.TypeSpannerDatabase, ID: authz.ID(database.ID())},
 		permissions.SpannerDatabasePermissionRead,
 		permissions.TypeUser,
 		authz.ID(outsider.ID()),
-	)
+		nil,
+	))
 	mustFalse(ctx, "outsider CANNOT read database", ok, err)
 
 	log.Println("All checks passed — example 6 completed successfully")